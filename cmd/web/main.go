@@ -5,12 +5,17 @@ import (
 	"context"
 	"database/sql"
 	"flag"
+	"fmt"
 	"game-forum-abaliyev-ashirbay/internal/handlers"
+	"game-forum-abaliyev-ashirbay/internal/mailer"
 	"game-forum-abaliyev-ashirbay/internal/models"
+	"game-forum-abaliyev-ashirbay/internal/oauth"
+	"game-forum-abaliyev-ashirbay/internal/storage"
 	"log/slog"
 	"net/http"
 	"os"
 	"os/signal"
+	"strconv"
 	"strings"
 	"syscall"
 	"time"
@@ -21,6 +26,14 @@ import (
 func main() {
 	addr := flag.String("addr", ":8433", "HTTP network address")
 	dbPath := flag.String("db", "./data/app.db", "Path to SQLite database file")
+	sessionLifetime := flag.Duration("session-lifetime", 24*time.Hour, "How long an idle session stays valid")
+	rememberLifetime := flag.Duration("remember-lifetime", 30*24*time.Hour, "How long an idle \"remember me\" session stays valid")
+	sessionCleanup := flag.Duration("session-cleanup", time.Hour, "How often expired sessions are purged")
+	imageSweep := flag.Duration("image-sweep", time.Hour, "How often images no post uses are deleted")
+	imageSweepAge := flag.Duration("image-sweep-age", time.Hour, "How old an image no post uses must be before it is deleted")
+	commentEditWindow := flag.Duration("comment-edit-window", 15*time.Minute, "How long authors can edit their comments after posting them")
+	trashRetention := flag.Duration("trash-retention", 30*24*time.Hour, "How long deleted posts and comments stay in the trash before they are purged")
+	trashPurge := flag.Duration("trash-purge", time.Hour, "How often posts and comments past the trash retention are purged")
 	flag.Parse()
 
 	logger := slog.New(slog.NewTextHandler(os.Stdout, nil))
@@ -31,10 +44,34 @@ func main() {
 		os.Exit(1)
 	}
 
-	googleClientID := os.Getenv("GOOGLE_CLIENT_ID")
-	googleClientSecret := os.Getenv("GOOGLE_CLIENT_SECRET")
-	githubClientID := os.Getenv("GITHUB_CLIENT_ID")
-	githubClientSecret := os.Getenv("GITHUB_CLIENT_SECRET")
+	oauthProviders, err := loadOAuthProviders(logger)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	// Where users reach the forum, for links in emails
+	baseURL := os.Getenv("BASE_URL")
+	if baseURL == "" {
+		baseURL = "https://localhost" + *addr
+	}
+
+	oauthRedirectBaseURL := os.Getenv("OAUTH_REDIRECT_BASE_URL")
+	if oauthRedirectBaseURL == "" {
+		oauthRedirectBaseURL = baseURL
+	}
+
+	mail, closeMail, err := loadMailer(logger)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
+
+	images, err := loadImageStore(logger)
+	if err != nil {
+		logger.Error(err.Error())
+		os.Exit(1)
+	}
 
 	db, err := sql.Open("sqlite3", *dbPath)
 	if err != nil {
@@ -64,6 +101,19 @@ func main() {
 	reports := &models.ReportsModel{DB: db}
 	reportReasons := &models.ReportReasonsModel{DB: db}
 	notifications := &models.NotificationsModel{DB: db}
+	search := &models.SearchModel{DB: db}
+	apiTokens := &models.ApiTokensModel{DB: db}
+	oauthStates := &models.OAuthStatesModel{DB: db}
+	userIdentities := &models.UserIdentitiesModel{DB: db}
+	userTokens := &models.UserTokensModel{DB: db}
+	suspensions := &models.SuspensionsModel{DB: db}
+	twoFactor := &models.TwoFactorModel{DB: db}
+	loginChallenges := &models.LoginChallengesModel{DB: db}
+	loginAttempts := &models.LoginAttemptsModel{DB: db}
+	profiles := &models.ProfilesModel{DB: db}
+	postAttachments := &models.PostAttachmentsModel{DB: db}
+	postRevisions := &models.PostRevisionsModel{DB: db}
+	trash := &models.TrashModel{DB: db}
 
 	app := handlers.NewApp(
 		addr,
@@ -81,15 +131,45 @@ func main() {
 		reportReasons,
 
 		// authentication
-		googleClientID,
-		googleClientSecret,
-		githubClientID,
-		githubClientSecret,
+		oauthProviders,
+		oauthRedirectBaseURL,
 
 		// notifications
 		notifications,
+
+		search,
+		apiTokens,
+
+		// sessions
+		*sessionLifetime,
+		*rememberLifetime,
+
+		oauthStates,
+		userIdentities,
+
+		// email
+		userTokens,
+		mail,
+		baseURL,
+
+		suspensions,
+		twoFactor,
+		loginChallenges,
+		loginAttempts,
+		profiles,
+		postAttachments,
+		postRevisions,
+		trash,
+		images,
+		*commentEditWindow,
+		*trashRetention,
 	)
 
+	janitorCtx, stopJanitor := context.WithCancel(context.Background())
+	go sessionJanitor(janitorCtx, session, *sessionCleanup, logger)
+	go imageJanitor(janitorCtx, app, *imageSweep, *imageSweepAge, logger)
+	go trashJanitor(janitorCtx, app, *trashPurge, *trashRetention, logger)
+
 	srv := &http.Server{
 		Addr:     *addr,
 		ErrorLog: slog.NewLogLogger(logger.Handler(), slog.LevelError),
@@ -104,6 +184,7 @@ func main() {
 	go func() {
 		<-quit
 		logger.Info("Shutting down server...")
+		stopJanitor()
 
 		ctx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
 		defer cancel()
@@ -113,6 +194,7 @@ func main() {
 		}
 
 		db.Close()
+		closeMail()
 
 		os.Exit(0)
 	}()
@@ -121,6 +203,177 @@ func main() {
 	logger.Error(err.Error())
 }
 
+// loadOAuthProviders sets up the login providers configured in the
+// environment. Providers whose OpenID Connect discovery fails are skipped so
+// an unreachable issuer does not keep the forum from starting.
+func loadOAuthProviders(logger *slog.Logger) ([]oauth.Provider, error) {
+	configs, err := oauth.ConfigsFromEnv(os.Getenv)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 15*time.Second)
+	defer cancel()
+
+	var providers []oauth.Provider
+	for _, cfg := range configs {
+		provider, err := oauth.NewProvider(ctx, cfg, nil)
+		if err != nil {
+			logger.Error("could not set up login provider: " + err.Error())
+			continue
+		}
+		providers = append(providers, provider)
+	}
+
+	return providers, nil
+}
+
+// loadMailer sends mail through SMTP_HOST when it is set. Otherwise messages
+// are appended to MAIL_LOG_FILE, or printed when that is not set either.
+func loadMailer(logger *slog.Logger) (mailer.Mailer, func(), error) {
+	from := os.Getenv("MAIL_FROM")
+	if from == "" {
+		from = "Forum <no-reply@localhost>"
+	}
+
+	if host := os.Getenv("SMTP_HOST"); host != "" {
+		port := 587
+		if p := os.Getenv("SMTP_PORT"); p != "" {
+			var err error
+			port, err = strconv.Atoi(p)
+			if err != nil {
+				return nil, nil, fmt.Errorf("invalid SMTP_PORT %q", p)
+			}
+		}
+
+		logger.Info("sending mail through SMTP", "host", host, "port", port)
+		return mailer.NewSMTPMailer(host, port, os.Getenv("SMTP_USERNAME"), os.Getenv("SMTP_PASSWORD"), from), func() {}, nil
+	}
+
+	path := os.Getenv("MAIL_LOG_FILE")
+	if path == "" {
+		logger.Info("SMTP_HOST is not set, printing mail to stdout")
+		return mailer.NewLogMailer(os.Stdout, from), func() {}, nil
+	}
+
+	f, err := os.OpenFile(path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0o600)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	logger.Info("SMTP_HOST is not set, writing mail to file", "path", path)
+	return mailer.NewLogMailer(f, from), func() { f.Close() }, nil
+}
+
+// loadImageStore keeps post images in the S3 bucket S3_BUCKET when
+// MEDIA_STORAGE is "s3", and in IMAGE_DIR (./data/imgs by default) otherwise.
+func loadImageStore(logger *slog.Logger) (storage.Store, error) {
+	switch kind := os.Getenv("MEDIA_STORAGE"); kind {
+	case "", "local":
+		dir := os.Getenv("IMAGE_DIR")
+		if dir == "" {
+			dir = "./data/imgs"
+		}
+
+		logger.Info("storing images on disk", "dir", dir)
+		return storage.NewLocalStore(dir), nil
+
+	case "s3":
+		pathStyle := false
+		if p := os.Getenv("S3_PATH_STYLE"); p != "" {
+			var err error
+			pathStyle, err = strconv.ParseBool(p)
+			if err != nil {
+				return nil, fmt.Errorf("invalid S3_PATH_STYLE %q", p)
+			}
+		}
+
+		store, err := storage.NewS3Store(
+			os.Getenv("S3_ENDPOINT"),
+			os.Getenv("S3_BUCKET"),
+			os.Getenv("S3_REGION"),
+			os.Getenv("S3_ACCESS_KEY_ID"),
+			os.Getenv("S3_SECRET_ACCESS_KEY"),
+			pathStyle,
+		)
+		if err != nil {
+			return nil, err
+		}
+
+		logger.Info("storing images in S3", "endpoint", store.Endpoint.String(), "bucket", store.Bucket)
+		return store, nil
+
+	default:
+		return nil, fmt.Errorf("invalid MEDIA_STORAGE %q, use local or s3", kind)
+	}
+}
+
+// imageJanitor deletes images no post uses every interval until ctx is done.
+// Only images older than age go, so uploads whose post is still being saved
+// are left alone.
+func imageJanitor(ctx context.Context, app *handlers.Application, interval time.Duration, age time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := app.SweepImages(time.Now().Add(-age))
+		if err != nil {
+			logger.Error("could not sweep unused images: " + err.Error())
+		} else if n > 0 {
+			logger.Info("deleted unused images", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// trashJanitor purges the posts and comments that have been in the trash for
+// longer than retention every interval until ctx is done.
+func trashJanitor(ctx context.Context, app *handlers.Application, interval, retention time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := app.PurgeTrash(time.Now().Add(-retention))
+		if err != nil {
+			logger.Error("could not purge the trash: " + err.Error())
+		} else if n > 0 {
+			logger.Info("purged deleted posts and comments", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// sessionJanitor purges expired sessions every interval until ctx is done.
+func sessionJanitor(ctx context.Context, sessions *models.SessionModel, interval time.Duration, logger *slog.Logger) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		n, err := sessions.DeleteExpired()
+		if err != nil {
+			logger.Error("could not purge expired sessions: " + err.Error())
+		} else if n > 0 {
+			logger.Info("purged expired sessions", "count", n)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
 func loadEnvFile(filename string) error {
 	f, err := os.Open(filename)
 	if err != nil {
@@ -0,0 +1,64 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Replies point at the comment they answer, top-level comments keep NULL
+ALTER TABLE Comments ADD COLUMN parent_id INTEGER REFERENCES Comments(id);
+
+CREATE INDEX idx_comments_parent_id ON Comments(parent_id);
+
+-- Recreate Notifications so the type check accepts 'reply'
+CREATE TABLE Notifications_new (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    type TEXT CHECK(type IN ('post_like', 'post_dislike', 'comment', 'comment_like', 'comment_dislike', 'reply')) NOT NULL,
+    actor_id INTEGER NOT NULL,
+    recipient_id INTEGER NOT NULL,
+    post_id INTEGER NOT NULL,
+    comment_id INTEGER,
+    created_at DATETIME NOT NULL,
+    is_read BOOLEAN NOT NULL DEFAULT 0,
+
+    FOREIGN KEY (actor_id) REFERENCES Users(id),
+    FOREIGN KEY (recipient_id) REFERENCES Users(id),
+    FOREIGN KEY (post_id) REFERENCES Posts(id),
+    FOREIGN KEY (comment_id) REFERENCES Comments(id)
+);
+
+INSERT INTO Notifications_new (id, type, actor_id, recipient_id, post_id, comment_id, created_at, is_read)
+SELECT id, type, actor_id, recipient_id, post_id, comment_id, created_at, is_read FROM Notifications;
+
+DROP TABLE Notifications;
+ALTER TABLE Notifications_new RENAME TO Notifications;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DELETE FROM Notifications WHERE type = 'reply';
+
+CREATE TABLE Notifications_old (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    type TEXT CHECK(type IN ('post_like', 'post_dislike', 'comment', 'comment_like', 'comment_dislike')) NOT NULL,
+    actor_id INTEGER NOT NULL,
+    recipient_id INTEGER NOT NULL,
+    post_id INTEGER NOT NULL,
+    comment_id INTEGER,
+    created_at DATETIME NOT NULL,
+    is_read BOOLEAN NOT NULL DEFAULT 0,
+
+    FOREIGN KEY (actor_id) REFERENCES Users(id),
+    FOREIGN KEY (recipient_id) REFERENCES Users(id),
+    FOREIGN KEY (post_id) REFERENCES Posts(id),
+    FOREIGN KEY (comment_id) REFERENCES Comments(id)
+);
+
+INSERT INTO Notifications_old (id, type, actor_id, recipient_id, post_id, comment_id, created_at, is_read)
+SELECT id, type, actor_id, recipient_id, post_id, comment_id, created_at, is_read FROM Notifications;
+
+DROP TABLE Notifications;
+ALTER TABLE Notifications_old RENAME TO Notifications;
+
+DROP INDEX IF EXISTS idx_comments_parent_id;
+ALTER TABLE Comments DROP COLUMN parent_id;
+
+-- +goose StatementEnd
@@ -0,0 +1,65 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Full-text indexes over post titles/bodies and comment texts. Both are
+-- external content tables, the rows live in Posts and Comments and the
+-- triggers below keep the indexes in sync with them.
+CREATE VIRTUAL TABLE Posts_Search USING fts5(
+    title,
+    content,
+    content='Posts',
+    content_rowid='id',
+    tokenize='unicode61 remove_diacritics 2'
+);
+
+CREATE VIRTUAL TABLE Comments_Search USING fts5(
+    text,
+    content='Comments',
+    content_rowid='id',
+    tokenize='unicode61 remove_diacritics 2'
+);
+
+INSERT INTO Posts_Search (Posts_Search) VALUES ('rebuild');
+INSERT INTO Comments_Search (Comments_Search) VALUES ('rebuild');
+
+CREATE TRIGGER Posts_Search_ai AFTER INSERT ON Posts BEGIN
+    INSERT INTO Posts_Search (rowid, title, content) VALUES (new.id, new.title, new.content);
+END;
+
+CREATE TRIGGER Posts_Search_ad AFTER DELETE ON Posts BEGIN
+    INSERT INTO Posts_Search (Posts_Search, rowid, title, content) VALUES ('delete', old.id, old.title, old.content);
+END;
+
+CREATE TRIGGER Posts_Search_au AFTER UPDATE OF title, content ON Posts BEGIN
+    INSERT INTO Posts_Search (Posts_Search, rowid, title, content) VALUES ('delete', old.id, old.title, old.content);
+    INSERT INTO Posts_Search (rowid, title, content) VALUES (new.id, new.title, new.content);
+END;
+
+CREATE TRIGGER Comments_Search_ai AFTER INSERT ON Comments BEGIN
+    INSERT INTO Comments_Search (rowid, text) VALUES (new.id, new.text);
+END;
+
+CREATE TRIGGER Comments_Search_ad AFTER DELETE ON Comments BEGIN
+    INSERT INTO Comments_Search (Comments_Search, rowid, text) VALUES ('delete', old.id, old.text);
+END;
+
+CREATE TRIGGER Comments_Search_au AFTER UPDATE OF text ON Comments BEGIN
+    INSERT INTO Comments_Search (Comments_Search, rowid, text) VALUES ('delete', old.id, old.text);
+    INSERT INTO Comments_Search (rowid, text) VALUES (new.id, new.text);
+END;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TRIGGER IF EXISTS Comments_Search_au;
+DROP TRIGGER IF EXISTS Comments_Search_ad;
+DROP TRIGGER IF EXISTS Comments_Search_ai;
+DROP TRIGGER IF EXISTS Posts_Search_au;
+DROP TRIGGER IF EXISTS Posts_Search_ad;
+DROP TRIGGER IF EXISTS Posts_Search_ai;
+DROP TABLE IF EXISTS Comments_Search;
+DROP TABLE IF EXISTS Posts_Search;
+
+-- +goose StatementEnd
@@ -0,0 +1,24 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- A user may be logged in on several devices at once, each session remembers
+-- where it was created from and when it was last used.
+ALTER TABLE Sessions ADD COLUMN user_agent TEXT NOT NULL DEFAULT '';
+ALTER TABLE Sessions ADD COLUMN ip TEXT NOT NULL DEFAULT '';
+ALTER TABLE Sessions ADD COLUMN lastSeenAt DATETIME;
+
+UPDATE Sessions SET lastSeenAt = createdAt;
+
+CREATE INDEX idx_sessions_user_id ON Sessions(user_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP INDEX IF EXISTS idx_sessions_user_id;
+ALTER TABLE Sessions DROP COLUMN lastSeenAt;
+ALTER TABLE Sessions DROP COLUMN ip;
+ALTER TABLE Sessions DROP COLUMN user_agent;
+
+-- +goose StatementEnd
@@ -0,0 +1,18 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Sessions slide: every use pushes expiresAt to lifetime seconds from now.
+-- "Remember me" logins get a longer lifetime than regular ones.
+ALTER TABLE Sessions ADD COLUMN lifetime INTEGER NOT NULL DEFAULT 86400;
+
+CREATE INDEX idx_sessions_expires_at ON Sessions(expiresAt);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP INDEX IF EXISTS idx_sessions_expires_at;
+ALTER TABLE Sessions DROP COLUMN lifetime;
+
+-- +goose StatementEnd
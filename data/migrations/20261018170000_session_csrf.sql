@@ -0,0 +1,16 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Every session gets its own CSRF token that state-changing forms echo back
+ALTER TABLE Sessions ADD COLUMN csrf_token TEXT NOT NULL DEFAULT '';
+
+UPDATE Sessions SET csrf_token = lower(hex(randomblob(32)));
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE Sessions DROP COLUMN csrf_token;
+
+-- +goose StatementEnd
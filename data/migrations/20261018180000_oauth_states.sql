@@ -0,0 +1,21 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Pending OAuth logins. The state is also kept in a cookie of the browser that
+-- started the login, the callback has to present both and consumes the row.
+CREATE TABLE OAuth_States (
+    state TEXT NOT NULL PRIMARY KEY,
+    provider VARCHAR(50) NOT NULL,
+    code_verifier TEXT NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS OAuth_States;
+
+-- +goose StatementEnd
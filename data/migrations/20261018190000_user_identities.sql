@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- External accounts (provider + the provider's stable user id) that can be
+-- used to log in to a local account. A user links at most one account per
+-- provider.
+CREATE TABLE User_Identities (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    provider VARCHAR(50) NOT NULL,
+    subject TEXT NOT NULL,
+    email VARCHAR(100) NOT NULL DEFAULT '',
+    created_at DATETIME NOT NULL,
+    last_login_at DATETIME,
+
+    UNIQUE (provider, subject),
+    UNIQUE (user_id, provider),
+    FOREIGN KEY (user_id) REFERENCES Users(id)
+);
+
+-- Set when the login was started by a logged in user to link an account
+ALTER TABLE OAuth_States ADD COLUMN user_id INTEGER;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE OAuth_States DROP COLUMN user_id;
+DROP TABLE IF EXISTS User_Identities;
+
+-- +goose StatementEnd
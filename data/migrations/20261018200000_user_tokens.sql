@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Single-use links mailed to users. Only a hash of the token is stored, email
+-- is the address the link was sent to.
+CREATE TABLE User_Tokens (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    purpose TEXT CHECK(purpose IN ('verify_email', 'reset_password')) NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    email VARCHAR(100) NOT NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+
+    FOREIGN KEY (user_id) REFERENCES Users(id)
+);
+
+CREATE INDEX idx_user_tokens_user_purpose ON User_Tokens(user_id, purpose);
+
+-- Logins now require a verified email. Nothing checked "enabled" before, so
+-- existing accounts keep working.
+UPDATE Users SET enabled = 1;
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP INDEX IF EXISTS idx_user_tokens_user_purpose;
+DROP TABLE IF EXISTS User_Tokens;
+
+-- +goose StatementEnd
@@ -0,0 +1,32 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Suspensions handed out by admins. suspended_until is NULL for permanent
+-- ones, lifted_at is set when an admin ends one early. Old rows are kept as
+-- the user's history.
+CREATE TABLE User_Suspensions (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    reason TEXT NOT NULL,
+    suspended_until DATETIME,
+    created_by INTEGER NOT NULL,
+    created_at DATETIME NOT NULL,
+    lifted_at DATETIME,
+    lifted_by INTEGER,
+
+    FOREIGN KEY (user_id) REFERENCES Users(id),
+    FOREIGN KEY (created_by) REFERENCES Users(id),
+    FOREIGN KEY (lifted_by) REFERENCES Users(id)
+);
+
+CREATE INDEX idx_user_suspensions_user_id ON User_Suspensions(user_id);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP INDEX IF EXISTS idx_user_suspensions_user_id;
+DROP TABLE IF EXISTS User_Suspensions;
+
+-- +goose StatementEnd
@@ -0,0 +1,54 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- TOTP secrets, confirmed_at is set once the user proved their app works.
+-- last_used_step keeps a code from being used twice.
+CREATE TABLE User_TOTP (
+    user_id INTEGER NOT NULL PRIMARY KEY,
+    secret TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+    confirmed_at DATETIME,
+    last_used_step INTEGER NOT NULL DEFAULT 0,
+
+    FOREIGN KEY (user_id) REFERENCES Users(id)
+);
+
+-- One-time recovery codes, hashed. A used code is deleted.
+CREATE TABLE User_Recovery_Codes (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    code_hash TEXT NOT NULL,
+    created_at DATETIME NOT NULL,
+
+    UNIQUE (user_id, code_hash),
+    FOREIGN KEY (user_id) REFERENCES Users(id)
+);
+
+-- Roles whose members must set up two-factor authentication
+CREATE TABLE Two_Factor_Required_Roles (
+    role VARCHAR(20) NOT NULL PRIMARY KEY
+);
+
+-- Logins that passed the password and wait for the second factor
+CREATE TABLE Login_Challenges (
+    token_hash TEXT NOT NULL PRIMARY KEY,
+    user_id INTEGER NOT NULL,
+    remember BOOLEAN NOT NULL DEFAULT 0,
+    attempts INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+
+    FOREIGN KEY (user_id) REFERENCES Users(id)
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE IF EXISTS Login_Challenges;
+DROP TABLE IF EXISTS Two_Factor_Required_Roles;
+DROP TABLE IF EXISTS User_Recovery_Codes;
+DROP TABLE IF EXISTS User_TOTP;
+
+-- +goose StatementEnd
@@ -0,0 +1,34 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Every password and two-factor attempt. user_id is NULL when the login
+-- names no account, login keeps what was typed so that guessing unknown
+-- names is throttled the same way.
+CREATE TABLE Login_Attempts (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER,
+    login TEXT NOT NULL,
+    ip TEXT NOT NULL,
+    success BOOLEAN NOT NULL,
+    created_at DATETIME NOT NULL,
+
+    FOREIGN KEY (user_id) REFERENCES Users(id)
+);
+
+CREATE INDEX idx_login_attempts_user_id ON Login_Attempts(user_id);
+CREATE INDEX idx_login_attempts_login ON Login_Attempts(login);
+CREATE INDEX idx_login_attempts_ip ON Login_Attempts(ip);
+CREATE INDEX idx_login_attempts_created_at ON Login_Attempts(created_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP INDEX IF EXISTS idx_login_attempts_created_at;
+DROP INDEX IF EXISTS idx_login_attempts_ip;
+DROP INDEX IF EXISTS idx_login_attempts_login;
+DROP INDEX IF EXISTS idx_login_attempts_user_id;
+DROP TABLE IF EXISTS Login_Attempts;
+
+-- +goose StatementEnd
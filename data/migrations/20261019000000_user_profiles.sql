@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Join date and the bio shown on public profiles
+ALTER TABLE Users ADD COLUMN created_at DATETIME;
+ALTER TABLE Users ADD COLUMN bio TEXT NOT NULL DEFAULT '';
+
+-- Older accounts joined no later than their first post or comment
+UPDATE Users SET created_at = COALESCE(
+    (SELECT MIN(first) FROM (
+        SELECT datetime(MIN(createdAt)) AS first FROM Posts WHERE owner_id = Users.id
+        UNION ALL
+        SELECT datetime(MIN(created_at)) FROM Comments WHERE user_id = Users.id
+    )),
+    datetime('now')
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE Users DROP COLUMN bio;
+ALTER TABLE Users DROP COLUMN created_at;
+
+-- +goose StatementEnd
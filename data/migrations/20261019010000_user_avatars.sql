@@ -0,0 +1,15 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Name the uploaded avatar files are stored under, empty for users who show
+-- an identicon
+ALTER TABLE Users ADD COLUMN avatar TEXT NOT NULL DEFAULT '';
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+ALTER TABLE Users DROP COLUMN avatar;
+
+-- +goose StatementEnd
@@ -0,0 +1,60 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Deleted accounts keep their row so that their posts and comments stay in
+-- place, anonymized. deleted_at marks such a row.
+ALTER TABLE Users ADD COLUMN deleted_at DATETIME;
+
+-- Recreate User_Tokens so the purpose check accepts 'change_email'
+CREATE TABLE User_Tokens_new (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    purpose TEXT CHECK(purpose IN ('verify_email', 'reset_password', 'change_email')) NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    email VARCHAR(100) NOT NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+
+    FOREIGN KEY (user_id) REFERENCES Users(id)
+);
+
+INSERT INTO User_Tokens_new (id, user_id, purpose, token_hash, email, created_at, expires_at)
+SELECT id, user_id, purpose, token_hash, email, created_at, expires_at FROM User_Tokens;
+
+DROP INDEX IF EXISTS idx_user_tokens_user_purpose;
+DROP TABLE User_Tokens;
+ALTER TABLE User_Tokens_new RENAME TO User_Tokens;
+
+CREATE INDEX idx_user_tokens_user_purpose ON User_Tokens(user_id, purpose);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DELETE FROM User_Tokens WHERE purpose = 'change_email';
+
+CREATE TABLE User_Tokens_old (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    purpose TEXT CHECK(purpose IN ('verify_email', 'reset_password')) NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    email VARCHAR(100) NOT NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+
+    FOREIGN KEY (user_id) REFERENCES Users(id)
+);
+
+INSERT INTO User_Tokens_old (id, user_id, purpose, token_hash, email, created_at, expires_at)
+SELECT id, user_id, purpose, token_hash, email, created_at, expires_at FROM User_Tokens;
+
+DROP INDEX IF EXISTS idx_user_tokens_user_purpose;
+DROP TABLE User_Tokens;
+ALTER TABLE User_Tokens_old RENAME TO User_Tokens;
+
+CREATE INDEX idx_user_tokens_user_purpose ON User_Tokens(user_id, purpose);
+
+ALTER TABLE Users DROP COLUMN deleted_at;
+
+-- +goose StatementEnd
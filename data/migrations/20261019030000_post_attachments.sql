@@ -0,0 +1,30 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Images attached to a post, shown in the order of position. Posts.imgUrl
+-- keeps the name of the first one as the cover shown in post lists.
+CREATE TABLE Post_Attachments (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER NOT NULL,
+    name TEXT NOT NULL,
+    caption TEXT NOT NULL DEFAULT '',
+    position INTEGER NOT NULL,
+    created_at DATETIME NOT NULL,
+
+    FOREIGN KEY (post_id) REFERENCES Posts(id)
+);
+
+CREATE INDEX idx_post_attachments_post ON Post_Attachments(post_id, position);
+CREATE INDEX idx_post_attachments_name ON Post_Attachments(name);
+
+INSERT INTO Post_Attachments (post_id, name, caption, position, created_at)
+SELECT id, imgUrl, '', 1, createdAt FROM Posts WHERE imgUrl IS NOT NULL AND imgUrl != '';
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE Post_Attachments;
+
+-- +goose StatementEnd
@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Every version of an edited post, numbered from 1 per post. The first edit
+-- also records the post as it was written, so an edited post has at least
+-- two revisions and the last one is what Posts shows.
+CREATE TABLE Post_Revisions (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    post_id INTEGER NOT NULL,
+    revision INTEGER NOT NULL,
+    title VARCHAR(255) NOT NULL,
+    content TEXT NOT NULL,
+    category_id INTEGER NOT NULL,
+    editor_id INTEGER NOT NULL,
+    created_at DATETIME NOT NULL,
+
+    FOREIGN KEY (post_id) REFERENCES Posts(id),
+    FOREIGN KEY (editor_id) REFERENCES Users(id),
+    UNIQUE (post_id, revision)
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE Post_Revisions;
+
+-- +goose StatementEnd
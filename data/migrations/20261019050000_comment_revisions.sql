@@ -0,0 +1,29 @@
+-- +goose Up
+-- +goose StatementBegin
+
+ALTER TABLE Comments ADD COLUMN edited_at DATETIME;
+
+-- Every version of an edited comment, numbered from 1 per comment. The
+-- first edit also records the comment as it was written.
+CREATE TABLE Comment_Revisions (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    comment_id INTEGER NOT NULL,
+    revision INTEGER NOT NULL,
+    text TEXT NOT NULL,
+    editor_id INTEGER NOT NULL,
+    created_at DATETIME NOT NULL,
+
+    FOREIGN KEY (comment_id) REFERENCES Comments(id),
+    FOREIGN KEY (editor_id) REFERENCES Users(id),
+    UNIQUE (comment_id, revision)
+);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP TABLE Comment_Revisions;
+ALTER TABLE Comments DROP COLUMN edited_at;
+
+-- +goose StatementEnd
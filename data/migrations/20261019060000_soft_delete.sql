@@ -0,0 +1,26 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Deleted posts and comments stay in the trash, hidden from everyone but
+-- admins, until they are restored or purged.
+ALTER TABLE Posts ADD COLUMN deleted_at DATETIME;
+ALTER TABLE Posts ADD COLUMN deleted_by INTEGER REFERENCES Users(id);
+ALTER TABLE Comments ADD COLUMN deleted_at DATETIME;
+ALTER TABLE Comments ADD COLUMN deleted_by INTEGER REFERENCES Users(id);
+
+CREATE INDEX idx_posts_deleted_at ON Posts(deleted_at);
+CREATE INDEX idx_comments_deleted_at ON Comments(deleted_at);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DROP INDEX idx_comments_deleted_at;
+DROP INDEX idx_posts_deleted_at;
+ALTER TABLE Comments DROP COLUMN deleted_by;
+ALTER TABLE Comments DROP COLUMN deleted_at;
+ALTER TABLE Posts DROP COLUMN deleted_by;
+ALTER TABLE Posts DROP COLUMN deleted_at;
+
+-- +goose StatementEnd
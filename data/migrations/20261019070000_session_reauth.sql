@@ -0,0 +1,65 @@
+-- +goose Up
+-- +goose StatementBegin
+
+-- Accounts without a password prove who they are before sensitive changes
+-- by opening a mailed link or logging in with a linked provider again. The
+-- session they did it from remembers when.
+ALTER TABLE Sessions ADD COLUMN reauthenticated_at DATETIME;
+
+-- Pending OAuth logins that only confirm the logged in user
+ALTER TABLE OAuth_States ADD COLUMN reauth INTEGER NOT NULL DEFAULT 0;
+
+-- Recreate User_Tokens so the purpose check accepts 'reauthenticate'
+CREATE TABLE User_Tokens_new (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    purpose TEXT CHECK(purpose IN ('verify_email', 'reset_password', 'change_email', 'reauthenticate')) NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    email VARCHAR(100) NOT NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+
+    FOREIGN KEY (user_id) REFERENCES Users(id)
+);
+
+INSERT INTO User_Tokens_new (id, user_id, purpose, token_hash, email, created_at, expires_at)
+SELECT id, user_id, purpose, token_hash, email, created_at, expires_at FROM User_Tokens;
+
+DROP INDEX IF EXISTS idx_user_tokens_user_purpose;
+DROP TABLE User_Tokens;
+ALTER TABLE User_Tokens_new RENAME TO User_Tokens;
+
+CREATE INDEX idx_user_tokens_user_purpose ON User_Tokens(user_id, purpose);
+
+-- +goose StatementEnd
+
+-- +goose Down
+-- +goose StatementBegin
+
+DELETE FROM User_Tokens WHERE purpose = 'reauthenticate';
+
+CREATE TABLE User_Tokens_old (
+    id INTEGER NOT NULL PRIMARY KEY AUTOINCREMENT,
+    user_id INTEGER NOT NULL,
+    purpose TEXT CHECK(purpose IN ('verify_email', 'reset_password', 'change_email')) NOT NULL,
+    token_hash TEXT NOT NULL UNIQUE,
+    email VARCHAR(100) NOT NULL,
+    created_at DATETIME NOT NULL,
+    expires_at DATETIME NOT NULL,
+
+    FOREIGN KEY (user_id) REFERENCES Users(id)
+);
+
+INSERT INTO User_Tokens_old (id, user_id, purpose, token_hash, email, created_at, expires_at)
+SELECT id, user_id, purpose, token_hash, email, created_at, expires_at FROM User_Tokens;
+
+DROP INDEX IF EXISTS idx_user_tokens_user_purpose;
+DROP TABLE User_Tokens;
+ALTER TABLE User_Tokens_old RENAME TO User_Tokens;
+
+CREATE INDEX idx_user_tokens_user_purpose ON User_Tokens(user_id, purpose);
+
+ALTER TABLE OAuth_States DROP COLUMN reauth;
+ALTER TABLE Sessions DROP COLUMN reauthenticated_at;
+
+-- +goose StatementEnd
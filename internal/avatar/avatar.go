@@ -0,0 +1,93 @@
+// Package avatar turns uploaded pictures into square avatars of fixed sizes
+// and draws identicons for users without one.
+package avatar
+
+import (
+	"bytes"
+	"errors"
+	"game-forum-abaliyev-ashirbay/internal/imaging"
+	"image"
+	"image/draw"
+	_ "image/gif" // decoders for the accepted formats
+	_ "image/jpeg"
+	"image/png"
+	"io"
+)
+
+// Sizes are the edge lengths avatars are stored and served in.
+var Sizes = []int{32, 64, 256}
+
+const (
+	maxSide   = 4096
+	maxPixels = 4096 * 4096
+)
+
+var (
+	ErrFormat   = errors.New("avatar: not a JPEG, PNG or GIF image")
+	ErrTooLarge = errors.New("avatar: image dimensions too large")
+)
+
+// ValidSize reports whether size is one of Sizes.
+func ValidSize(size int) bool {
+	for _, s := range Sizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
+
+// Render decodes a JPEG, PNG or GIF picture, crops it to a centred square
+// and returns it as PNG in every one of Sizes. Re-encoding drops anything
+// but the pixels, such as EXIF data or trailing payloads.
+func Render(r io.Reader) (map[int][]byte, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return nil, err
+	}
+
+	// Check the header first so that huge images are never decoded
+	config, format, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || (format != "jpeg" && format != "png" && format != "gif") {
+		return nil, ErrFormat
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width > maxSide || config.Height > maxSide ||
+		config.Width*config.Height > maxPixels {
+		return nil, ErrTooLarge
+	}
+
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return nil, ErrFormat
+	}
+
+	square := cropSquare(img)
+
+	images := make(map[int][]byte, len(Sizes))
+	for _, size := range Sizes {
+		var buf bytes.Buffer
+		err = png.Encode(&buf, imaging.Resize(square, size, size))
+		if err != nil {
+			return nil, err
+		}
+		images[size] = buf.Bytes()
+	}
+
+	return images, nil
+}
+
+// cropSquare copies the largest centred square of img into an RGBA image.
+func cropSquare(img image.Image) *image.RGBA {
+	b := img.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+
+	x := b.Min.X + (b.Dx()-side)/2
+	y := b.Min.Y + (b.Dy()-side)/2
+
+	square := image.NewRGBA(image.Rect(0, 0, side, side))
+	draw.Draw(square, square.Bounds(), img, image.Pt(x, y), draw.Src)
+	return square
+}
@@ -0,0 +1,56 @@
+package avatar
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"image"
+	"image/color"
+	"image/png"
+)
+
+const identiconGrid = 5
+
+var identiconBackground = color.RGBA{0xF0, 0xF0, 0xF0, 0xFF}
+
+// Identicon draws a symmetric 5x5 pattern derived from seed as a PNG of
+// size pixels. The same seed always gives the same picture.
+func Identicon(seed string, size int) ([]byte, error) {
+	sum := sha256.Sum256([]byte(seed))
+
+	// Darker colours read better on the light background
+	fg := color.RGBA{sum[0] / 2, sum[1] / 2, sum[2] / 2, 0xFF}
+
+	// Columns 0-2 come from the hash, 3 and 4 mirror 1 and 0
+	var cells [identiconGrid][identiconGrid]bool
+	bit := 0
+	for x := 0; x < (identiconGrid+1)/2; x++ {
+		for y := 0; y < identiconGrid; y++ {
+			on := sum[3+bit/8]>>(bit%8)&1 == 1
+			cells[y][x] = on
+			cells[y][identiconGrid-1-x] = on
+			bit++
+		}
+	}
+
+	img := image.NewRGBA(image.Rect(0, 0, size, size))
+	pad := size / 12
+	inner := size - 2*pad
+	for y := 0; y < size; y++ {
+		for x := 0; x < size; x++ {
+			c := identiconBackground
+			if x >= pad && y >= pad && x < pad+inner && y < pad+inner &&
+				cells[(y-pad)*identiconGrid/inner][(x-pad)*identiconGrid/inner] {
+				c = fg
+			}
+			img.SetRGBA(x, y, c)
+		}
+	}
+
+	var buf bytes.Buffer
+	err := png.Encode(&buf, img)
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,112 @@
+// Package diff compares two texts line by line.
+package diff
+
+import "strings"
+
+// maxCells bounds the table Lines fills in. Beyond it the texts are shown as
+// entirely removed and added instead.
+const maxCells = 4_000_000
+
+type Op int
+
+const (
+	Equal Op = iota
+	Insert
+	Delete
+)
+
+// Line is a line of a diff: unchanged, only in the new text or only in the
+// old one.
+type Line struct {
+	Op   Op
+	Text string
+}
+
+// Lines returns the changes that turn a into b, using a longest common
+// subsequence of their lines.
+func Lines(a, b string) []Line {
+	x, y := split(a), split(b)
+
+	// Lines both texts start or end with are equal either way
+	prefix := 0
+	for prefix < len(x) && prefix < len(y) && x[prefix] == y[prefix] {
+		prefix++
+	}
+	suffix := 0
+	for suffix < len(x)-prefix && suffix < len(y)-prefix && x[len(x)-1-suffix] == y[len(y)-1-suffix] {
+		suffix++
+	}
+
+	var lines []Line
+	for _, s := range x[:prefix] {
+		lines = append(lines, Line{Equal, s})
+	}
+	lines = append(lines, middle(x[prefix:len(x)-suffix], y[prefix:len(y)-suffix])...)
+	for _, s := range x[len(x)-suffix:] {
+		lines = append(lines, Line{Equal, s})
+	}
+
+	return lines
+}
+
+func middle(x, y []string) []Line {
+	var lines []Line
+
+	if len(x)*len(y) > maxCells {
+		for _, s := range x {
+			lines = append(lines, Line{Delete, s})
+		}
+		for _, s := range y {
+			lines = append(lines, Line{Insert, s})
+		}
+		return lines
+	}
+
+	// lcs[i][j] is the length of the longest common subsequence of x[i:]
+	// and y[j:]
+	lcs := make([][]int, len(x)+1)
+	for i := range lcs {
+		lcs[i] = make([]int, len(y)+1)
+	}
+	for i := len(x) - 1; i >= 0; i-- {
+		for j := len(y) - 1; j >= 0; j-- {
+			if x[i] == y[j] {
+				lcs[i][j] = lcs[i+1][j+1] + 1
+			} else {
+				lcs[i][j] = max(lcs[i+1][j], lcs[i][j+1])
+			}
+		}
+	}
+
+	i, j := 0, 0
+	for i < len(x) && j < len(y) {
+		switch {
+		case x[i] == y[j]:
+			lines = append(lines, Line{Equal, x[i]})
+			i++
+			j++
+		case lcs[i+1][j] >= lcs[i][j+1]:
+			lines = append(lines, Line{Delete, x[i]})
+			i++
+		default:
+			lines = append(lines, Line{Insert, y[j]})
+			j++
+		}
+	}
+	for ; i < len(x); i++ {
+		lines = append(lines, Line{Delete, x[i]})
+	}
+	for ; j < len(y); j++ {
+		lines = append(lines, Line{Insert, y[j]})
+	}
+
+	return lines
+}
+
+func split(s string) []string {
+	if s == "" {
+		return nil
+	}
+	s = strings.ReplaceAll(s, "\r\n", "\n")
+	return strings.Split(strings.TrimSuffix(s, "\n"), "\n")
+}
@@ -0,0 +1,367 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"game-forum-abaliyev-ashirbay/internal/mailer"
+	"game-forum-abaliyev-ashirbay/internal/models"
+	"game-forum-abaliyev-ashirbay/internal/validator"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	verifyEmailLifetime   = 48 * time.Hour
+	resetPasswordLifetime = time.Hour
+)
+
+type emailForm struct {
+	Email string
+}
+
+type resetPasswordForm struct {
+	Token           string
+	Password        string
+	ConfirmPassword string
+}
+
+// absoluteURL turns a path into a link that works from an email.
+func (app *Application) absoluteURL(path string) string {
+	return strings.TrimSuffix(app.BaseURL, "/") + path
+}
+
+func (app *Application) sendMail(msg mailer.Message) error {
+	if app.Mailer == nil {
+		return errors.New("no mailer configured")
+	}
+	return app.Mailer.Send(msg)
+}
+
+// sendVerificationEmail mails a link that proves the user owns email.
+func (app *Application) sendVerificationEmail(user *models.User, email string) error {
+	token, err := randomURLToken(32)
+	if err != nil {
+		return err
+	}
+
+	err = app.UserTokens.Insert(token, user.ID, models.TokenVerifyEmail, email, verifyEmailLifetime)
+	if err != nil {
+		return err
+	}
+
+	return app.sendMail(mailer.Message{
+		To:      email,
+		Subject: "Verify your email address",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Please confirm your email address by opening this link:\n\n%s\n\n"+
+			"The link is valid for %d hours. If you did not create an account, you can ignore this email.\n",
+			user.Username, app.absoluteURL("/verify-email?token="+token), int(verifyEmailLifetime.Hours())),
+	})
+}
+
+func (app *Application) sendPasswordResetEmail(user *models.User) error {
+	token, err := randomURLToken(32)
+	if err != nil {
+		return err
+	}
+
+	err = app.UserTokens.Insert(token, user.ID, models.TokenResetPassword, user.Email, resetPasswordLifetime)
+	if err != nil {
+		return err
+	}
+
+	return app.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Reset your password",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"Someone asked to reset the password of your account. To choose a new password open this link:\n\n%s\n\n"+
+			"The link is valid for %d minutes and works once. If you did not ask for this, ignore this email and your password stays the same.\n",
+			user.Username, app.absoluteURL("/password/reset?token="+token), int(resetPasswordLifetime.Minutes())),
+	})
+}
+
+func validateEmailForm(form emailForm) *validator.Validator {
+	v := &validator.Validator{}
+	v.CheckField(validator.NotBlank(form.Email), "email", "Email cannot be blank")
+	v.CheckField(validator.MaxChars(form.Email, 50), "email", "Email must not exceed 50 characters")
+	v.CheckField(validator.Matches(form.Email, validator.EmailRX), "email", "Invalid email address")
+	return v
+}
+
+func (app *Application) verifyEmail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	data := templateData{Form: emailForm{}}
+
+	token, err := app.UserTokens.Consume(r.URL.Query().Get("token"), models.TokenVerifyEmail)
+	if err != nil {
+		if !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+		data.FormErrors = map[string]string{"general": "This link is invalid or has expired. Enter your email to get a new one."}
+		app.render(w, r, http.StatusBadRequest, "verify_email.html", data)
+		return
+	}
+
+	user, err := app.Users.GetById(token.UserID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The link was sent to an address the account no longer uses
+	if user.Email != token.Email {
+		data.FormErrors = map[string]string{"general": "This link is invalid or has expired. Enter your email to get a new one."}
+		app.render(w, r, http.StatusBadRequest, "verify_email.html", data)
+		return
+	}
+
+	err = app.Users.SetEnabled(user.ID, true)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data = templateData{
+		Form:    loginForm{Email: user.Email},
+		Message: "Your email address is verified, you can log in now.",
+	}
+	app.render(w, r, http.StatusOK, "login.html", data)
+}
+
+func (app *Application) verifyEmailResend(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	data := templateData{Form: emailForm{Email: r.URL.Query().Get("email")}}
+
+	app.render(w, r, http.StatusOK, "verify_email.html", data)
+}
+
+func (app *Application) verifyEmailResendPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	form := emailForm{Email: strings.ToLower(r.PostForm.Get("email"))}
+
+	v := validateEmailForm(form)
+	if !v.Valid() {
+		data := templateData{
+			Form:       form,
+			FormErrors: v.FieldErrors,
+		}
+		app.render(w, r, http.StatusUnprocessableEntity, "verify_email.html", data)
+		return
+	}
+
+	user, err := app.Users.GetByEmail(form.Email)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if user != nil && !user.Enabled {
+		err = app.sendVerificationEmail(user, user.Email)
+		if err != nil {
+			app.Logger.Error("sending verification email", "user", user.ID, "err", err)
+		}
+	}
+
+	// Same answer whether or not the address is registered
+	data := templateData{
+		Form:    form,
+		Message: fmt.Sprintf("If %s belongs to an account that still needs verifying, a new link is on its way.", form.Email),
+	}
+	app.render(w, r, http.StatusOK, "verify_email.html", data)
+}
+
+func (app *Application) forgotPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	data := templateData{Form: emailForm{}}
+
+	app.render(w, r, http.StatusOK, "forgot_password.html", data)
+}
+
+func (app *Application) forgotPasswordPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	form := emailForm{Email: strings.ToLower(r.PostForm.Get("email"))}
+
+	v := validateEmailForm(form)
+	if !v.Valid() {
+		data := templateData{
+			Form:       form,
+			FormErrors: v.FieldErrors,
+		}
+		app.render(w, r, http.StatusUnprocessableEntity, "forgot_password.html", data)
+		return
+	}
+
+	user, err := app.Users.GetByEmail(form.Email)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if user != nil {
+		err = app.sendPasswordResetEmail(user)
+		if err != nil {
+			app.Logger.Error("sending password reset email", "user", user.ID, "err", err)
+		}
+	}
+
+	// Same answer whether or not the address is registered
+	data := templateData{
+		Form:    form,
+		Message: fmt.Sprintf("If %s belongs to an account, we sent it a link to choose a new password.", form.Email),
+	}
+	app.render(w, r, http.StatusOK, "forgot_password.html", data)
+}
+
+func (app *Application) resetPassword(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	form := resetPasswordForm{Token: r.URL.Query().Get("token")}
+	data := templateData{Form: form}
+
+	// Only look at the token here, it is used up by the form
+	_, err := app.UserTokens.Get(form.Token, models.TokenResetPassword)
+	if err != nil {
+		if !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+		data.FormErrors = map[string]string{"general": "This link is invalid or has expired."}
+		app.render(w, r, http.StatusBadRequest, "reset_password.html", data)
+		return
+	}
+
+	app.render(w, r, http.StatusOK, "reset_password.html", data)
+}
+
+func (app *Application) resetPasswordPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	form := resetPasswordForm{
+		Token:           r.PostForm.Get("token"),
+		Password:        r.PostForm.Get("password"),
+		ConfirmPassword: r.PostForm.Get("confirmPassword"),
+	}
+
+	v := validator.Validator{}
+	v.CheckField(validator.NotBlank(form.Password), "password", "Password cannot be blank")
+	v.CheckField(validator.MinChars(form.Password, 8), "password", "Password must be at least 8 characters long")
+	v.CheckField(validator.MaxChars(form.Password, 30), "password", "Password must not exceed 30 characters")
+	v.CheckField(form.Password == form.ConfirmPassword, "confirmPassword", "Passwords do not match")
+
+	if !v.Valid() {
+		data := templateData{
+			Form:       resetPasswordForm{Token: form.Token},
+			FormErrors: v.FieldErrors,
+		}
+		app.render(w, r, http.StatusUnprocessableEntity, "reset_password.html", data)
+		return
+	}
+
+	invalid := func() {
+		data := templateData{
+			Form:       resetPasswordForm{},
+			FormErrors: map[string]string{"general": "This link is invalid or has expired."},
+		}
+		app.render(w, r, http.StatusBadRequest, "reset_password.html", data)
+	}
+
+	token, err := app.UserTokens.Consume(form.Token, models.TokenResetPassword)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			invalid()
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.Users.GetById(token.UserID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if user.Email != token.Email {
+		invalid()
+		return
+	}
+
+	hashedPassword, err := app.generateHashPassword(form.Password)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.Users.UpdatePassword(user.ID, hashedPassword)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Whoever knew the old password is logged out everywhere
+	err = app.Session.DeleteByUserId(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Opening the link proved the address belongs to the user
+	if !user.Enabled {
+		err = app.Users.SetEnabled(user.ID, true)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	data := templateData{
+		Form:    loginForm{Email: user.Email},
+		Message: "Your password has been changed, log in with the new one.",
+	}
+	app.render(w, r, http.StatusOK, "login.html", data)
+}
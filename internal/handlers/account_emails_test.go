@@ -0,0 +1,129 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+
+	"game-forum-abaliyev-ashirbay/internal/mailer"
+)
+
+// recordingMailer keeps the messages instead of sending them.
+type recordingMailer struct {
+	mu   sync.Mutex
+	sent []mailer.Message
+}
+
+func (m *recordingMailer) Send(msg mailer.Message) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	m.sent = append(m.sent, msg)
+	return nil
+}
+
+var mailLinkRX = regexp.MustCompile(`https://forum\.example\.com(\S+)`)
+
+var _ = ginkgo.Describe("Email verification and password reset", func() {
+	var (
+		app  *testApp
+		mail *recordingMailer
+	)
+
+	ginkgo.BeforeEach(func() {
+		app = newTestApp("198.51.100.1")
+		mail = &recordingMailer{}
+		app.Mailer = mail
+		app.BaseURL = "https://forum.example.com/"
+	})
+
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		return app.postForm(nil, path, form)
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		return app.get(nil, path)
+	}
+
+	// lastLink returns the path of the link in the last mail sent to email.
+	lastLink := func(email string) string {
+		gomega.Expect(mail.sent).ToNot(gomega.BeEmpty())
+		msg := mail.sent[len(mail.sent)-1]
+		gomega.Expect(msg.To).To(gomega.Equal(email))
+		m := mailLinkRX.FindStringSubmatch(msg.Body)
+		gomega.Expect(m).ToNot(gomega.BeNil())
+		return m[1]
+	}
+
+	login := func(email, password string) *httptest.ResponseRecorder {
+		return post("/login/post", url.Values{"email": {email}, "password": {password}})
+	}
+
+	ginkgo.It("only lets a new account log in after its email is verified", func() {
+		rr := post("/register/post", url.Values{
+			"email":           {"new@example.com"},
+			"username":        {"newbie"},
+			"password":        {"password1"},
+			"confirmPassword": {"password1"},
+		})
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusCreated))
+		link := lastLink("new@example.com")
+		gomega.Expect(link).To(gomega.HavePrefix("/verify-email?token="))
+
+		rr = login("new@example.com", "password1")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusForbidden))
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("Please verify your email address"))
+
+		rr = get(link)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("Your email address is verified"))
+
+		// The link works once
+		gomega.Expect(get(link).Code).To(gomega.Equal(http.StatusBadRequest))
+
+		rr = login("new@example.com", "password1")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+	})
+
+	ginkgo.It("gives the same answer for unknown addresses without sending mail", func() {
+		rr := post("/password/forgot/post", url.Values{"email": {"nobody@example.com"}})
+
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("If nobody@example.com belongs to an account"))
+		gomega.Expect(mail.sent).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("resets a forgotten password once and logs out the old sessions", func() {
+		_, err := app.DB.Exec(`INSERT INTO Users (email, username, password, enabled) VALUES ('old@example.com', 'old', 'not-a-hash', 1)`)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		_, err = app.Sessions.Insert("stolen", 1, time.Hour, "test", "127.0.0.1")
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		rr := post("/password/forgot/post", url.Values{"email": {"old@example.com"}})
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		link := lastLink("old@example.com")
+
+		rr = get(link)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		token := strings.TrimPrefix(link, "/password/reset?token=")
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring(token))
+
+		form := url.Values{"token": {token}, "password": {"new-password"}, "confirmPassword": {"new-password"}}
+		rr = post("/password/reset/post", form)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("Your password has been changed"))
+
+		var sessions int
+		gomega.Expect(app.DB.QueryRow(`SELECT COUNT(*) FROM Sessions`).Scan(&sessions)).To(gomega.Succeed())
+		gomega.Expect(sessions).To(gomega.Equal(0))
+
+		gomega.Expect(post("/password/reset/post", form).Code).To(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(login("old@example.com", "new-password").Code).To(gomega.Equal(http.StatusSeeOther))
+	})
+})
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"game-forum-abaliyev-ashirbay/internal/models"
 	"net/http"
 )
 
@@ -10,42 +11,72 @@ func (app *Application) adminPanel(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	// Fetch all users
-	users, err := app.Users.GetAll()
+	data, err := app.adminPanelData()
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
+	app.render(w, r, http.StatusOK, "admin_panel.html", data)
+}
+
+// adminPanelData loads everything the admin panel lists, handlers that
+// re-render the panel after a form submission add their own fields to it.
+func (app *Application) adminPanelData() (templateData, error) {
+	// Fetch all users
+	users, err := app.Users.GetAll()
+	if err != nil {
+		return templateData{}, err
+	}
+
 	// Fetch all promotion requests
 	promotionRequests, err := app.PromotionRequests.GetAll()
 	if err != nil {
-		app.serverError(w, r, err)
-		return
+		return templateData{}, err
 	}
 
 	// Fetch all reports
 	reports, err := app.Reports.GetAllReports()
 	if err != nil {
-		app.serverError(w, r, err)
-		return
+		return templateData{}, err
 	}
 
 	// fetch categories
 
 	categories, err := app.Categories.GetAll()
+	if err != nil {
+		return templateData{}, err
+	}
 
+	suspensions, err := app.Suspensions.GetAllActive()
 	if err != nil {
-		app.serverError(w, r, err)
-		return
+		return templateData{}, err
+	}
+
+	twoFactorRoles, err := app.TwoFactor.RequiredRoles()
+	if err != nil {
+		return templateData{}, err
+	}
+
+	failedLogins, failedLoginIPs, err := app.loginFailuresData()
+	if err != nil {
+		return templateData{}, err
 	}
 
 	data := templateData{
+		FailedLogins:      failedLogins,
+		FailedLoginIPs:    failedLoginIPs,
+		TwoFactorRoles:    twoFactorRoles,
+		Roles:             defaultRoles,
 		Users:             users,
 		PromotionRequests: promotionRequests,
 		Reports:           reports,
 		Categories:        categories,
+		Suspensions:       map[int]*models.Suspension{},
+	}
+	for _, s := range suspensions {
+		data.Suspensions[s.UserID] = s
 	}
 
-	app.render(w, r, http.StatusOK, "admin_panel.html", data)
+	return data, nil
 }
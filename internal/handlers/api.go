@@ -0,0 +1,319 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"game-forum-abaliyev-ashirbay/internal/models"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// The JSON API lives under /api/v1/ and mirrors the HTML handlers. Requests
+// are authenticated with the same "token" session cookie as the website or
+// with an "Authorization: Bearer <token>" header carrying a session or personal
+// API token, and every error is returned
+// as {"error": {"status": ..., "message": ...}}.
+
+type envelope map[string]interface{}
+
+type apiUser struct {
+	ID       int    `json:"id"`
+	Username string `json:"username"`
+	Email    string `json:"email,omitempty"`
+	Role     string `json:"role"`
+}
+
+type apiCategory struct {
+	ID   int    `json:"id"`
+	Name string `json:"name"`
+}
+
+type apiPost struct {
+	ID           int       `json:"id"`
+	Title        string    `json:"title"`
+	Content      string    `json:"content"`
+	ImageURL     string    `json:"image_url,omitempty"`
+	CategoryID   int       `json:"category_id"`
+	CategoryName string    `json:"category_name,omitempty"`
+	OwnerID      int       `json:"owner_id"`
+	OwnerName    string    `json:"owner_name,omitempty"`
+	LikeCount    int       `json:"like_count"`
+	DislikeCount int       `json:"dislike_count"`
+	CommentCount int       `json:"comment_count"`
+	IsLiked      bool      `json:"is_liked"`
+	IsDisliked   bool      `json:"is_disliked"`
+	CreatedAt    time.Time `json:"created_at"`
+}
+
+type apiComment struct {
+	ID           int          `json:"id"`
+	PostID       int          `json:"post_id"`
+	ParentID     int          `json:"parent_id,omitempty"`
+	UserID       int          `json:"user_id"`
+	Username     string       `json:"username,omitempty"`
+	Text         string       `json:"text"`
+	LikeCount    int          `json:"like_count"`
+	DislikeCount int          `json:"dislike_count"`
+	IsLiked      bool         `json:"is_liked"`
+	IsDisliked   bool         `json:"is_disliked"`
+	CreatedAt    time.Time    `json:"created_at"`
+	Deleted      bool         `json:"deleted,omitempty"`
+	Replies      []apiComment `json:"replies,omitempty"`
+}
+
+type apiNotification struct {
+	ID        int       `json:"id"`
+	Type      string    `json:"type"`
+	ActorID   int       `json:"actor_id"`
+	PostID    int       `json:"post_id"`
+	CommentID int       `json:"comment_id,omitempty"`
+	IsRead    bool      `json:"is_read"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+func (app *Application) writeJSON(w http.ResponseWriter, status int, data interface{}) {
+	js, err := json.Marshal(data)
+	if err != nil {
+		app.Logger.Error(err.Error())
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	w.Write(append(js, '\n'))
+}
+
+func (app *Application) readJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	r.Body = http.MaxBytesReader(w, r.Body, 1<<20)
+
+	dec := json.NewDecoder(r.Body)
+	dec.DisallowUnknownFields()
+
+	err := dec.Decode(dst)
+	if err != nil {
+		if errors.Is(err, io.EOF) {
+			return errors.New("body must not be empty")
+		}
+		return fmt.Errorf("invalid JSON body: %w", err)
+	}
+
+	if dec.More() {
+		return errors.New("body must only contain a single JSON value")
+	}
+
+	return nil
+}
+
+func (app *Application) apiError(w http.ResponseWriter, r *http.Request, status int, message string) {
+	app.writeJSON(w, status, envelope{"error": envelope{
+		"status":  status,
+		"message": message,
+	}})
+}
+
+func (app *Application) apiClientError(w http.ResponseWriter, r *http.Request, status int) {
+	app.apiError(w, r, status, http.StatusText(status))
+}
+
+func (app *Application) apiServerError(w http.ResponseWriter, r *http.Request, err error) {
+	app.Logger.Error(err.Error(), "method", r.Method, "uri", r.URL.RequestURI())
+	app.apiClientError(w, r, http.StatusInternalServerError)
+}
+
+func (app *Application) apiValidationError(w http.ResponseWriter, r *http.Request, fieldErrors map[string]string) {
+	app.writeJSON(w, http.StatusUnprocessableEntity, envelope{"error": envelope{
+		"status":  http.StatusUnprocessableEntity,
+		"message": "validation failed",
+		"fields":  fieldErrors,
+	}})
+}
+
+// apiAuthenticate resolves the optional user of an API request and stores it
+// in the request context. Invalid credentials are rejected instead of being
+// treated as anonymous, so clients notice expired or revoked tokens.
+func (app *Application) apiAuthenticate(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, err := r.Cookie("token")
+		if r.Header.Get("Authorization") == "" && err != nil {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		user, apiToken, err := app.authenticate(r)
+		if errors.Is(err, errSuspended) {
+			app.apiError(w, r, http.StatusForbidden, "account suspended")
+			return
+		}
+		if err != nil {
+			if !errors.Is(err, models.ErrNoRecord) {
+				app.Logger.Error(err.Error())
+			}
+			if r.Header.Get("Authorization") != "" {
+				app.apiError(w, r, http.StatusUnauthorized, "invalid or expired token")
+				return
+			}
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), userContextKey, user)
+		ctx = context.WithValue(ctx, apiTokenContextKey, apiToken)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// apiAuthenticatedUser returns the user the request is authenticated as, or
+// nil for anonymous requests.
+func apiAuthenticatedUser(r *http.Request) *models.User {
+	user, _ := r.Context().Value(userContextKey).(*models.User)
+	return user
+}
+
+// apiRequireUser writes an error response and returns false when the request
+// is not authenticated or its API token lacks the scope for the method.
+func (app *Application) apiRequireUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	user := apiAuthenticatedUser(r)
+	if user == nil {
+		app.apiError(w, r, http.StatusUnauthorized, "authentication required")
+		return nil, false
+	}
+
+	scope := requiredScope(r, defaultRoles)
+	if !hasScope(r, scope) {
+		app.apiError(w, r, http.StatusForbidden, "token is missing the "+scope+" scope")
+		return nil, false
+	}
+
+	return user, true
+}
+
+func apiPathID(r *http.Request) (int, bool) {
+	id, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || id < 1 {
+		return 0, false
+	}
+	return id, true
+}
+
+func (app *Application) apiRoutes() http.Handler {
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("/api/v1/", app.apiNotFound)
+
+	mux.HandleFunc("/api/v1/me", app.apiMe)
+	mux.HandleFunc("/api/v1/categories", app.apiCategories)
+
+	mux.HandleFunc("/api/v1/posts", app.apiPosts)
+	mux.HandleFunc("/api/v1/posts/{id}", app.apiPost)
+	mux.HandleFunc("/api/v1/posts/{id}/comments", app.apiPostComments)
+	mux.HandleFunc("/api/v1/posts/{id}/reactions", app.apiPostReaction)
+
+	mux.HandleFunc("/api/v1/comments/{id}", app.apiComment)
+	mux.HandleFunc("/api/v1/comments/{id}/reactions", app.apiCommentReaction)
+
+	mux.HandleFunc("/api/v1/notifications", app.apiNotifications)
+	mux.HandleFunc("/api/v1/notifications/read", app.apiNotificationsRead)
+
+	return app.apiAuthenticate(mux)
+}
+
+func (app *Application) apiNotFound(w http.ResponseWriter, r *http.Request) {
+	app.apiClientError(w, r, http.StatusNotFound)
+}
+
+func (app *Application) apiMe(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.apiClientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := app.apiRequireUser(w, r)
+	if !ok {
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"user": apiUser{
+		ID:       user.ID,
+		Username: user.Username,
+		Email:    user.Email,
+		Role:     user.Role,
+	}})
+}
+
+func (app *Application) apiCategories(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.apiClientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	categories, err := app.Categories.GetAll()
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	result := make([]apiCategory, 0, len(categories))
+	for _, c := range categories {
+		result = append(result, apiCategory{ID: c.ID, Name: c.Name})
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"categories": result})
+}
+
+func (app *Application) apiNotifications(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.apiClientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := app.apiRequireUser(w, r)
+	if !ok {
+		return
+	}
+
+	notifs, err := app.Notifications.GetAllByRecipient(user.ID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	result := make([]apiNotification, 0, len(notifs))
+	for _, n := range notifs {
+		result = append(result, apiNotification{
+			ID:        n.ID,
+			Type:      n.Type,
+			ActorID:   n.Actor_ID,
+			PostID:    n.Post_ID,
+			CommentID: int(n.Comment_ID.Int64),
+			IsRead:    n.Is_read,
+			CreatedAt: n.Created_at,
+		})
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"notifications": result})
+}
+
+func (app *Application) apiNotificationsRead(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.apiClientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := app.apiRequireUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.Notifications.MarkAllAsReadByUser(user.ID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
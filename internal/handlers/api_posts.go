@@ -0,0 +1,605 @@
+package handlers
+
+import (
+	"errors"
+	"game-forum-abaliyev-ashirbay/internal/models"
+	"game-forum-abaliyev-ashirbay/internal/validator"
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+type apiPostInput struct {
+	Title      *string `json:"title"`
+	Content    *string `json:"content"`
+	CategoryID *int    `json:"category_id"`
+}
+
+type apiCommentInput struct {
+	Text     string `json:"text"`
+	ParentID int    `json:"parent_id"`
+}
+
+type apiReactionInput struct {
+	Reaction string `json:"reaction"`
+}
+
+func toAPIPost(p *models.Post) apiPost {
+	return apiPost{
+		ID:           p.ID,
+		Title:        p.Title,
+		Content:      p.Content,
+		ImageURL:     imageURL(p.ImgUrl),
+		CategoryID:   p.CategoryID,
+		OwnerID:      p.OwnerID,
+		LikeCount:    p.LikeCount,
+		DislikeCount: p.DislikeCount,
+		CreatedAt:    p.CreatedAt,
+	}
+}
+
+func toAPIComments(comments []*models.CommentReaction) []apiComment {
+	result := make([]apiComment, 0, len(comments))
+	for _, c := range comments {
+		comment := apiComment{
+			ID:           c.ID,
+			PostID:       c.PostID,
+			ParentID:     c.ParentID,
+			UserID:       c.UserID,
+			Username:     c.Username,
+			Text:         c.Text,
+			LikeCount:    c.LikeCount,
+			DislikeCount: c.DislikeCount,
+			IsLiked:      c.IsLiked,
+			IsDisliked:   c.IsDisliked,
+			CreatedAt:    c.CreatedAt,
+			Replies:      toAPIComments(c.Replies),
+		}
+		// Deleted comments only hold their place in the thread
+		if c.Deleted {
+			comment.UserID = 0
+			comment.Username = ""
+			comment.Deleted = true
+		}
+		result = append(result, comment)
+	}
+	return result
+}
+
+func imageURL(name string) string {
+	if name == "" {
+		return ""
+	}
+	return "/imgs/" + name
+}
+
+// canModerate reports whether the user may remove content owned by ownerID:
+// their own, or anybody's for moderators acting with the moderate scope.
+func canModerate(r *http.Request, user *models.User, ownerID int) bool {
+	if ownerID == user.ID {
+		return true
+	}
+	return (user.Role == "moderator" || user.Role == "admin") && hasScope(r, models.ScopeModerate)
+}
+
+// apiLoadPost fetches the post named in the URL, writing the error response
+// itself when that is not possible.
+func (app *Application) apiLoadPost(w http.ResponseWriter, r *http.Request) (*models.Post, bool) {
+	id, ok := apiPathID(r)
+	if !ok {
+		app.apiClientError(w, r, http.StatusNotFound)
+		return nil, false
+	}
+
+	post, err := app.Posts.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiClientError(w, r, http.StatusNotFound)
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return nil, false
+	}
+
+	return post, true
+}
+
+func (app *Application) apiLoadComment(w http.ResponseWriter, r *http.Request) (*models.Comment, bool) {
+	id, ok := apiPathID(r)
+	if !ok {
+		app.apiClientError(w, r, http.StatusNotFound)
+		return nil, false
+	}
+
+	comment, err := app.Comments.Get(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.apiClientError(w, r, http.StatusNotFound)
+		} else {
+			app.apiServerError(w, r, err)
+		}
+		return nil, false
+	}
+
+	return comment, true
+}
+
+func (app *Application) apiPosts(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		app.apiPostList(w, r)
+	case http.MethodPost:
+		app.apiPostCreate(w, r)
+	default:
+		app.apiClientError(w, r, http.StatusMethodNotAllowed)
+	}
+}
+
+func (app *Application) apiPost(w http.ResponseWriter, r *http.Request) {
+	switch r.Method {
+	case http.MethodGet:
+		app.apiPostGet(w, r)
+	case http.MethodPut, http.MethodPatch:
+		app.apiPostEdit(w, r)
+	case http.MethodDelete:
+		app.apiPostDelete(w, r)
+	default:
+		app.apiClientError(w, r, http.StatusMethodNotAllowed)
+	}
+}
+
+func (app *Application) apiPostList(w http.ResponseWriter, r *http.Request) {
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(r.URL.Query().Get("pageSize"))
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	categoryID, err := strconv.Atoi(r.URL.Query().Get("category"))
+	if err != nil {
+		categoryID = 0
+	}
+
+	user := apiAuthenticatedUser(r)
+	userID := 0
+	if user != nil {
+		userID = user.ID
+	}
+
+	posts, err := app.Posts.GetFilteredPosts(userID, categoryID, page, pageSize)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	totalPosts, err := app.Posts.CountPosts(categoryID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	result := make([]apiPost, 0, len(posts))
+	for _, p := range posts {
+		post := toAPIPost(&p.Post)
+		post.CategoryName = p.CategoryName
+		post.OwnerName = p.OwnerName
+		post.CommentCount = p.CommentCount
+		post.IsLiked = p.IsLiked
+		post.IsDisliked = p.IsDisliked
+		result = append(result, post)
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{
+		"posts":       result,
+		"page":        page,
+		"page_size":   pageSize,
+		"total":       totalPosts,
+		"total_pages": int(math.Ceil(float64(totalPosts) / float64(pageSize))),
+	})
+}
+
+func (app *Application) apiPostGet(w http.ResponseWriter, r *http.Request) {
+	post, ok := app.apiLoadPost(w, r)
+	if !ok {
+		return
+	}
+
+	user := apiAuthenticatedUser(r)
+
+	result := toAPIPost(post)
+
+	category, err := app.Categories.Get(post.CategoryID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.apiServerError(w, r, err)
+		return
+	}
+	if category != nil {
+		result.CategoryName = category.Name
+	}
+
+	author, err := app.Users.GetById(post.OwnerID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.apiServerError(w, r, err)
+		return
+	}
+	if author != nil {
+		result.OwnerName = author.Username
+	}
+
+	userID := 0
+	if user != nil {
+		userID = user.ID
+
+		reaction, err := app.PostReactions.GetReaction(user.ID, post.ID)
+		if err != nil && err != models.ErrNoReaction {
+			app.apiServerError(w, r, err)
+			return
+		}
+		if reaction != nil {
+			result.IsLiked = reaction.Type == "like"
+			result.IsDisliked = reaction.Type == "dislike"
+		}
+	}
+
+	comments, err := app.Comments.GetAllCommentsReactionsByPostID(post.ID, userID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+	result.CommentCount = len(comments)
+
+	app.writeJSON(w, http.StatusOK, envelope{"post": result})
+}
+
+// checkAPIPostInput validates the merged post fields, checking the category
+// exists as well since API clients do not pick it from a list.
+func (app *Application) checkAPIPostInput(form PostForm) (map[string]string, error) {
+	v := validator.Validator{}
+	checkPostForm(&v, form)
+
+	if form.CategoryID > 0 {
+		_, err := app.Categories.Get(form.CategoryID)
+		if err != nil {
+			if !errors.Is(err, models.ErrNoRecord) {
+				return nil, err
+			}
+			v.AddFieldError("category_id", "Category does not exist")
+		}
+	}
+
+	return v.FieldErrors, nil
+}
+
+func (app *Application) apiPostCreate(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.apiRequireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input apiPostInput
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.apiError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	form := PostForm{}
+	if input.Title != nil {
+		form.Title = *input.Title
+	}
+	if input.Content != nil {
+		form.Content = *input.Content
+	}
+	if input.CategoryID != nil {
+		form.CategoryID = *input.CategoryID
+	}
+
+	fieldErrors, err := app.checkAPIPostInput(form)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+	if len(fieldErrors) > 0 {
+		app.apiValidationError(w, r, fieldErrors)
+		return
+	}
+
+	postID, err := app.Posts.Insert(form.Title, form.Content, "", time.Now(), form.CategoryID, user.ID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	post, err := app.Posts.Get(postID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", "/api/v1/posts/"+strconv.Itoa(postID))
+	app.writeJSON(w, http.StatusCreated, envelope{"post": toAPIPost(post)})
+}
+
+func (app *Application) apiPostEdit(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.apiRequireUser(w, r)
+	if !ok {
+		return
+	}
+
+	post, ok := app.apiLoadPost(w, r)
+	if !ok {
+		return
+	}
+
+	if post.OwnerID != user.ID {
+		app.apiClientError(w, r, http.StatusForbidden)
+		return
+	}
+
+	var input apiPostInput
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.apiError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	form := PostForm{
+		Title:      post.Title,
+		CategoryID: post.CategoryID,
+		Content:    post.Content,
+	}
+	if input.Title != nil {
+		form.Title = *input.Title
+	}
+	if input.Content != nil {
+		form.Content = *input.Content
+	}
+	if input.CategoryID != nil {
+		form.CategoryID = *input.CategoryID
+	}
+
+	fieldErrors, err := app.checkAPIPostInput(form)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+	if len(fieldErrors) > 0 {
+		app.apiValidationError(w, r, fieldErrors)
+		return
+	}
+
+	err = app.Posts.UpdatePost(post.ID, user.ID, form.Title, form.Content, post.ImgUrl, form.CategoryID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	post, err = app.Posts.Get(post.ID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{"post": toAPIPost(post)})
+}
+
+func (app *Application) apiPostDelete(w http.ResponseWriter, r *http.Request) {
+	user, ok := app.apiRequireUser(w, r)
+	if !ok {
+		return
+	}
+
+	post, ok := app.apiLoadPost(w, r)
+	if !ok {
+		return
+	}
+
+	if !canModerate(r, user, post.OwnerID) {
+		app.apiClientError(w, r, http.StatusForbidden)
+		return
+	}
+
+	err := app.Posts.SoftDelete(post.ID, user.ID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *Application) apiPostComments(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodPost {
+		app.apiClientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	post, ok := app.apiLoadPost(w, r)
+	if !ok {
+		return
+	}
+
+	if r.Method == http.MethodGet {
+		user := apiAuthenticatedUser(r)
+		userID := 0
+		if user != nil {
+			userID = user.ID
+		}
+
+		comments, err := app.Comments.GetCommentTreeByPostID(post.ID, userID)
+		if err != nil {
+			app.apiServerError(w, r, err)
+			return
+		}
+
+		app.writeJSON(w, http.StatusOK, envelope{"comments": toAPIComments(comments)})
+		return
+	}
+
+	user, ok := app.apiRequireUser(w, r)
+	if !ok {
+		return
+	}
+
+	var input apiCommentInput
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.apiError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	v := validator.Validator{}
+	v.CheckField(validator.NotBlank(input.Text), "text", "Comment must not be blank")
+
+	var parent *models.Comment
+	if input.ParentID != 0 {
+		parent, err = app.Comments.Get(input.ParentID)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.apiServerError(w, r, err)
+			return
+		}
+		v.CheckField(parent != nil && parent.PostID == post.ID, "parent_id", "Parent comment does not belong to this post")
+	}
+
+	if !v.Valid() {
+		app.apiValidationError(w, r, v.FieldErrors)
+		return
+	}
+
+	commentID, err := app.addComment(post.ID, parent, user.ID, input.Text)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	comment, err := app.Comments.Get(commentID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusCreated, envelope{"comment": apiComment{
+		ID:        comment.ID,
+		PostID:    comment.PostID,
+		ParentID:  comment.ParentID,
+		UserID:    comment.UserID,
+		Username:  user.Username,
+		Text:      comment.Text,
+		CreatedAt: comment.CreatedAt,
+	}})
+}
+
+func (app *Application) apiPostReaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.apiClientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := app.apiRequireUser(w, r)
+	if !ok {
+		return
+	}
+
+	post, ok := app.apiLoadPost(w, r)
+	if !ok {
+		return
+	}
+
+	var input apiReactionInput
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.apiError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if input.Reaction != "like" && input.Reaction != "dislike" {
+		app.apiValidationError(w, r, map[string]string{"reaction": "Reaction must be like or dislike"})
+		return
+	}
+
+	err = app.reactToPost(user.ID, post, input.Reaction)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{
+		"like_count":    post.LikeCount,
+		"dislike_count": post.DislikeCount,
+	})
+}
+
+func (app *Application) apiComment(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodDelete {
+		app.apiClientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := app.apiRequireUser(w, r)
+	if !ok {
+		return
+	}
+
+	comment, ok := app.apiLoadComment(w, r)
+	if !ok {
+		return
+	}
+
+	if !canModerate(r, user, comment.UserID) {
+		app.apiClientError(w, r, http.StatusForbidden)
+		return
+	}
+
+	err := app.Comments.SoftDelete(comment.ID, user.ID)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (app *Application) apiCommentReaction(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.apiClientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := app.apiRequireUser(w, r)
+	if !ok {
+		return
+	}
+
+	comment, ok := app.apiLoadComment(w, r)
+	if !ok {
+		return
+	}
+
+	var input apiReactionInput
+	err := app.readJSON(w, r, &input)
+	if err != nil {
+		app.apiError(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	if input.Reaction != "like" && input.Reaction != "dislike" {
+		app.apiValidationError(w, r, map[string]string{"reaction": "Reaction must be like or dislike"})
+		return
+	}
+
+	err = app.reactToComment(user.ID, comment, input.Reaction)
+	if err != nil {
+		app.apiServerError(w, r, err)
+		return
+	}
+
+	app.writeJSON(w, http.StatusOK, envelope{
+		"like_count":    comment.LikeCount,
+		"dislike_count": comment.DislikeCount,
+	})
+}
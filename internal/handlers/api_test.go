@@ -0,0 +1,265 @@
+package handlers_test
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+
+	"game-forum-abaliyev-ashirbay/internal/models"
+)
+
+var _ = ginkgo.Describe("JSON API", func() {
+	var app *testApp
+
+	ginkgo.BeforeEach(func() {
+		app = newTestApp("198.51.100.14")
+
+		_, err := app.DB.Exec(`
+		INSERT INTO Categories (name) VALUES ('Speedruns'), ('Glitches');
+		INSERT INTO Users (id, email, username, password, role) VALUES
+			(1, 'player@example.com', 'player', '', 'user'),
+			(2, 'rival@example.com', 'rival', '', 'user'),
+			(3, 'mod@example.com', 'mod', '', 'moderator');
+		`)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		for i, name := range []string{"player", "rival", "mod"} {
+			app.login(i+1, name+"-session")
+		}
+	})
+
+	// call sends a JSON request authenticated with the bearer token, which
+	// can be a session or a personal API token. An empty token is anonymous.
+	call := func(method, path, token, body string) (*httptest.ResponseRecorder, map[string]interface{}) {
+		req := httptest.NewRequest(method, path, strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		if token != "" {
+			req.Header.Set("Authorization", "Bearer "+token)
+		}
+		rr := app.do(nil, req)
+
+		var result map[string]interface{}
+		if rr.Code != http.StatusNoContent {
+			gomega.Expect(rr.Header().Get("Content-Type")).To(gomega.Equal("application/json"))
+			gomega.Expect(json.Unmarshal(rr.Body.Bytes(), &result)).To(gomega.Succeed())
+		}
+		return rr, result
+	}
+
+	apiToken := func(userID int, scopes ...string) string {
+		token := fmt.Sprintf("gfp_test-%d-%s", userID, strings.Join(scopes, "-"))
+		_, err := app.ApiTokens.Insert(userID, "test", token, scopes)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		return token
+	}
+
+	expectError := func(result map[string]interface{}, status int, message string) {
+		gomega.Expect(result).To(gomega.HaveKey("error"))
+		e := result["error"].(map[string]interface{})
+		gomega.Expect(e).To(gomega.HaveKeyWithValue("status", float64(status)))
+		gomega.Expect(e).To(gomega.HaveKeyWithValue("message", message))
+	}
+
+	insertPost := func(ownerID int, title string) int {
+		id, err := app.Posts.Insert(title, "Content long enough to be valid.", "", time.Now(), 1, ownerID)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		return id
+	}
+
+	ginkgo.It("answers every failure with the same error shape", func() {
+		rr, result := call(http.MethodGet, "/api/v1/me", "", "")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusUnauthorized))
+		expectError(result, http.StatusUnauthorized, "authentication required")
+
+		rr, result = call(http.MethodGet, "/api/v1/me", "not-a-session", "")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusUnauthorized))
+		expectError(result, http.StatusUnauthorized, "invalid or expired token")
+
+		rr, result = call(http.MethodGet, "/api/v1/nothing-here", "", "")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusNotFound))
+		expectError(result, http.StatusNotFound, "Not Found")
+
+		rr, result = call(http.MethodDelete, "/api/v1/categories", "player-session", "")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusMethodNotAllowed))
+		expectError(result, http.StatusMethodNotAllowed, "Method Not Allowed")
+
+		rr, result = call(http.MethodGet, "/api/v1/posts/99", "", "")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusNotFound))
+		expectError(result, http.StatusNotFound, "Not Found")
+
+		rr, result = call(http.MethodGet, "/api/v1/me", "player-session", "")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(result["user"]).To(gomega.HaveKeyWithValue("username", "player"))
+
+		// The session cookie works as well, but then writes need the CSRF token
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/notifications/read", nil)
+		req.AddCookie(&http.Cookie{Name: "token", Value: "player-session"})
+		rr = app.do(nil, req)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusForbidden))
+		gomega.Expect(json.Unmarshal(rr.Body.Bytes(), &result)).To(gomega.Succeed())
+		expectError(result, http.StatusForbidden, "missing or invalid CSRF token")
+	})
+
+	ginkgo.It("pages the post list and bounds the page size", func() {
+		for i := 1; i <= 12; i++ {
+			insertPost(1, fmt.Sprintf("Route number %d", i))
+		}
+
+		rr, result := call(http.MethodGet, "/api/v1/posts?page=3&pageSize=5", "", "")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(result["posts"]).To(gomega.HaveLen(2))
+		gomega.Expect(result).To(gomega.HaveKeyWithValue("page", float64(3)))
+		gomega.Expect(result).To(gomega.HaveKeyWithValue("page_size", float64(5)))
+		gomega.Expect(result).To(gomega.HaveKeyWithValue("total", float64(12)))
+		gomega.Expect(result).To(gomega.HaveKeyWithValue("total_pages", float64(3)))
+
+		// Sizes out of range fall back to the default
+		for _, size := range []string{"0", "-1", "101", "many"} {
+			_, result = call(http.MethodGet, "/api/v1/posts?pageSize="+size, "", "")
+			gomega.Expect(result).To(gomega.HaveKeyWithValue("page_size", float64(10)))
+			gomega.Expect(result["posts"]).To(gomega.HaveLen(10))
+		}
+
+		_, result = call(http.MethodGet, "/api/v1/posts?page=0&pageSize=100", "", "")
+		gomega.Expect(result).To(gomega.HaveKeyWithValue("page", float64(1)))
+		gomega.Expect(result["posts"]).To(gomega.HaveLen(12))
+	})
+
+	ginkgo.It("creates, reads, edits and deletes posts", func() {
+		rr, result := call(http.MethodPost, "/api/v1/posts", "player-session", `{"title": "Any% route", "content": "The new skip saves twelve seconds.", "category_id": 1}`)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusCreated))
+		gomega.Expect(rr.Header().Get("Location")).To(gomega.Equal("/api/v1/posts/1"))
+		gomega.Expect(result["post"]).To(gomega.HaveKeyWithValue("owner_id", float64(1)))
+
+		rr, result = call(http.MethodGet, "/api/v1/posts/1", "", "")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(result["post"]).To(gomega.HaveKeyWithValue("title", "Any% route"))
+		gomega.Expect(result["post"]).To(gomega.HaveKeyWithValue("category_name", "Speedruns"))
+		gomega.Expect(result["post"]).To(gomega.HaveKeyWithValue("owner_name", "player"))
+
+		// Fields left out keep their value
+		rr, result = call(http.MethodPatch, "/api/v1/posts/1", "player-session", `{"category_id": 2}`)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(result["post"]).To(gomega.HaveKeyWithValue("title", "Any% route"))
+		gomega.Expect(result["post"]).To(gomega.HaveKeyWithValue("category_id", float64(2)))
+
+		rr, result = call(http.MethodDelete, "/api/v1/posts/1", "player-session", "")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusNoContent))
+
+		rr, result = call(http.MethodGet, "/api/v1/posts/1", "", "")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusNotFound))
+	})
+
+	ginkgo.It("rejects bodies that are not a valid post", func() {
+		rr, result := call(http.MethodPost, "/api/v1/posts", "player-session", "")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+		expectError(result, http.StatusBadRequest, "body must not be empty")
+
+		rr, result = call(http.MethodPost, "/api/v1/posts", "player-session", `{"title": "Any% route", "likes": 100}`)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(result["error"]).To(gomega.HaveKeyWithValue("message", gomega.ContainSubstring("unknown field")))
+
+		rr, result = call(http.MethodPost, "/api/v1/posts", "player-session", `{} {}`)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+		expectError(result, http.StatusBadRequest, "body must only contain a single JSON value")
+
+		rr, result = call(http.MethodPost, "/api/v1/posts", "player-session", `{"title": "Hi", "content": "Too short?", "category_id": 9}`)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+		e := result["error"].(map[string]interface{})
+		gomega.Expect(e).To(gomega.HaveKeyWithValue("message", "validation failed"))
+		gomega.Expect(e["fields"]).To(gomega.HaveKey("title"))
+		gomega.Expect(e["fields"]).To(gomega.HaveKeyWithValue("category_id", "Category does not exist"))
+
+		var count int
+		gomega.Expect(app.DB.QueryRow(`SELECT COUNT(*) FROM Posts`).Scan(&count)).To(gomega.Succeed())
+		gomega.Expect(count).To(gomega.Equal(0))
+	})
+
+	ginkgo.It("only lets owners edit and owners or moderators delete", func() {
+		insertPost(1, "Any% route")
+
+		rr, _ := call(http.MethodPatch, "/api/v1/posts/1", "rival-session", `{"title": "Mine now"}`)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusForbidden))
+		rr, _ = call(http.MethodPatch, "/api/v1/posts/1", "mod-session", `{"title": "Moderated"}`)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusForbidden))
+		rr, _ = call(http.MethodDelete, "/api/v1/posts/1", "rival-session", "")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusForbidden))
+
+		// A moderator's token needs the moderate scope for other people's posts
+		rr, _ = call(http.MethodDelete, "/api/v1/posts/1", apiToken(3, models.ScopeRead, models.ScopeWrite), "")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusForbidden))
+		rr, _ = call(http.MethodDelete, "/api/v1/posts/1", apiToken(3, models.ScopeWrite, models.ScopeModerate), "")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusNoContent))
+
+		var deletedBy int
+		gomega.Expect(app.DB.QueryRow(`SELECT deleted_by FROM Posts WHERE id = 1`).Scan(&deletedBy)).To(gomega.Succeed())
+		gomega.Expect(deletedBy).To(gomega.Equal(3))
+	})
+
+	ginkgo.It("holds personal tokens to their scopes", func() {
+		readOnly := apiToken(1, models.ScopeRead)
+
+		rr, _ := call(http.MethodGet, "/api/v1/me", readOnly, "")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+
+		rr, result := call(http.MethodPost, "/api/v1/posts", readOnly, `{"title": "Any% route", "content": "The new skip saves twelve seconds.", "category_id": 1}`)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusForbidden))
+		expectError(result, http.StatusForbidden, "token is missing the write scope")
+	})
+
+	ginkgo.It("adds comments and replies and lets only their authors or moderators remove them", func() {
+		insertPost(1, "Any% route")
+		insertPost(1, "Other route")
+
+		rr, result := call(http.MethodPost, "/api/v1/posts/1/comments", "rival-session", `{"text": "Nice route"}`)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusCreated))
+		gomega.Expect(result["comment"]).To(gomega.HaveKeyWithValue("username", "rival"))
+
+		rr, _ = call(http.MethodPost, "/api/v1/posts/1/comments", "player-session", `{"text": "Thanks", "parent_id": 1}`)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusCreated))
+
+		rr, result = call(http.MethodPost, "/api/v1/posts/2/comments", "player-session", `{"text": "Wrong thread", "parent_id": 1}`)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+		gomega.Expect(result["error"].(map[string]interface{})["fields"]).To(gomega.HaveKey("parent_id"))
+
+		rr, result = call(http.MethodPost, "/api/v1/posts/1/comments", "player-session", `{"text": "  "}`)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+
+		_, result = call(http.MethodGet, "/api/v1/posts/1/comments", "", "")
+		comments := result["comments"].([]interface{})
+		gomega.Expect(comments).To(gomega.HaveLen(1))
+		gomega.Expect(comments[0]).To(gomega.HaveKeyWithValue("replies", gomega.HaveLen(1)))
+
+		rr, _ = call(http.MethodDelete, "/api/v1/comments/1", "player-session", "")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusForbidden))
+		rr, _ = call(http.MethodDelete, "/api/v1/comments/1", "mod-session", "")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusNoContent))
+		rr, _ = call(http.MethodDelete, "/api/v1/comments/2", "player-session", "")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusNoContent))
+	})
+
+	ginkgo.It("counts reactions once per user", func() {
+		insertPost(1, "Any% route")
+
+		rr, result := call(http.MethodPost, "/api/v1/posts/1/reactions", "rival-session", `{"reaction": "like"}`)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(result).To(gomega.HaveKeyWithValue("like_count", float64(1)))
+
+		_, result = call(http.MethodPost, "/api/v1/posts/1/reactions", "rival-session", `{"reaction": "dislike"}`)
+		gomega.Expect(result).To(gomega.HaveKeyWithValue("like_count", float64(0)))
+		gomega.Expect(result).To(gomega.HaveKeyWithValue("dislike_count", float64(1)))
+
+		rr, result = call(http.MethodPost, "/api/v1/posts/1/reactions", "rival-session", `{"reaction": "love"}`)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+		gomega.Expect(result["error"].(map[string]interface{})["fields"]).To(gomega.HaveKey("reaction"))
+
+		rr, _ = call(http.MethodPost, "/api/v1/posts/1/reactions", "", `{"reaction": "like"}`)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusUnauthorized))
+	})
+})
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"game-forum-abaliyev-ashirbay/internal/models"
+	"game-forum-abaliyev-ashirbay/internal/validator"
+	"net/http"
+	"strconv"
+)
+
+type apiTokenForm struct {
+	Name   string
+	Scopes []string
+}
+
+// generateAPIToken returns a new random personal API token. Only its hash is
+// stored, so the value has to be shown to the user right away.
+func generateAPIToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return apiTokenPrefix + base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+func (app *Application) apiTokenCreatePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := app.getAuthenticatedUserID(r)
+	if err != nil {
+		app.notAuthenticated(w, r)
+		return
+	}
+
+	user, err := app.Users.GetById(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	form := apiTokenForm{
+		Name:   r.PostForm.Get("name"),
+		Scopes: r.PostForm["scopes"],
+	}
+
+	v := validator.Validator{}
+	v.CheckField(validator.NotBlank(form.Name), "name", "Name must not be blank")
+	v.CheckField(validator.MaxChars(form.Name, 50), "name", "Name must be at most 50 characters long")
+	v.CheckField(len(form.Scopes) > 0, "scopes", "Choose at least one scope")
+	for _, scope := range form.Scopes {
+		if !contains(models.AllScopes, scope) {
+			v.AddFieldError("scopes", "Unknown scope "+scope)
+		}
+		if scope == models.ScopeModerate && user.Role != "moderator" && user.Role != "admin" {
+			v.AddFieldError("scopes", "Only moderators can create tokens with the moderate scope")
+		}
+	}
+
+	data, err := app.personalPageData(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !v.Valid() {
+		data.Form = form
+		data.FormErrors = v.FieldErrors
+		app.render(w, r, http.StatusUnprocessableEntity, "personal_page.html", data)
+		return
+	}
+
+	token, err := generateAPIToken()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	_, err = app.ApiTokens.Insert(userID, form.Name, token, form.Scopes)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.APITokens, err = app.ApiTokens.GetAllByUserId(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data.NewAPIToken = token
+
+	app.render(w, r, http.StatusCreated, "personal_page.html", data)
+}
+
+func (app *Application) apiTokenRevoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := app.getAuthenticatedUserID(r)
+	if err != nil {
+		app.notAuthenticated(w, r)
+		return
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	err = app.ApiTokens.Delete(id, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/user/personal-page", http.StatusSeeOther)
+}
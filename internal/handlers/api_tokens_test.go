@@ -0,0 +1,151 @@
+package handlers_test
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var newTokenRX = regexp.MustCompile(`<code>(gfp_[A-Za-z0-9_-]+)</code>`)
+
+var _ = ginkgo.Describe("Personal API tokens", func() {
+	var (
+		app    *testApp
+		player *testSession
+		mod    *testSession
+	)
+
+	ginkgo.BeforeEach(func() {
+		app = newTestApp("198.51.100.15")
+
+		_, err := app.DB.Exec(`
+		INSERT INTO Categories (name) VALUES ('Speedruns');
+		INSERT INTO Users (id, email, username, password, role) VALUES
+			(1, 'player@example.com', 'player', '', 'user'),
+			(2, 'mod@example.com', 'mod', '', 'moderator');
+		`)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		player = app.login(1, "player-session")
+		mod = app.login(2, "mod-session")
+	})
+
+	create := func(s *testSession, name string, scopes ...string) *httptest.ResponseRecorder {
+		return app.postForm(s, "/user/tokens/create", url.Values{"name": {name}, "scopes": scopes})
+	}
+
+	// createToken creates a token and returns the value shown once.
+	createToken := func(s *testSession, scopes ...string) string {
+		rr := create(s, "script", scopes...)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusCreated))
+		m := newTokenRX.FindStringSubmatch(rr.Body.String())
+		gomega.Expect(m).ToNot(gomega.BeNil())
+		return m[1]
+	}
+
+	bearer := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		return app.do(nil, req)
+	}
+
+	ginkgo.It("shows a new token once and only stores its hash", func() {
+		token := createToken(player, "read", "write")
+
+		var hash, scopes string
+		err := app.DB.QueryRow(`SELECT token_hash, scopes FROM Api_Tokens WHERE user_id = 1`).Scan(&hash, &scopes)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		sum := sha256.Sum256([]byte(token))
+		gomega.Expect(hash).To(gomega.Equal(hex.EncodeToString(sum[:])))
+		gomega.Expect(scopes).To(gomega.Equal("read write"))
+
+		// The listing only names it
+		body := app.get(player, "/user/personal-page").Body.String()
+		gomega.Expect(body).To(gomega.ContainSubstring("script"))
+		gomega.Expect(body).ToNot(gomega.ContainSubstring(token))
+
+		gomega.Expect(bearer(http.MethodGet, "/api/v1/me", token).Code).To(gomega.Equal(http.StatusOK))
+		var used bool
+		gomega.Expect(app.DB.QueryRow(`SELECT last_used_at IS NOT NULL FROM Api_Tokens WHERE user_id = 1`).Scan(&used)).To(gomega.Succeed())
+		gomega.Expect(used).To(gomega.BeTrue())
+
+		// The hash itself is not a token
+		gomega.Expect(bearer(http.MethodGet, "/api/v1/me", "gfp_"+hash).Code).To(gomega.Equal(http.StatusUnauthorized))
+	})
+
+	ginkgo.It("stops accepting a token once it is revoked", func() {
+		token := createToken(player, "read")
+
+		var id string
+		gomega.Expect(app.DB.QueryRow(`SELECT id FROM Api_Tokens WHERE user_id = 1`).Scan(&id)).To(gomega.Succeed())
+
+		// Only by its owner
+		gomega.Expect(app.postForm(mod, "/user/tokens/revoke?id="+id, nil).Code).To(gomega.Equal(http.StatusNotFound))
+		gomega.Expect(bearer(http.MethodGet, "/api/v1/me", token).Code).To(gomega.Equal(http.StatusOK))
+
+		gomega.Expect(app.postForm(player, "/user/tokens/revoke?id="+id, nil).Code).To(gomega.Equal(http.StatusSeeOther))
+		gomega.Expect(bearer(http.MethodGet, "/api/v1/me", token).Code).To(gomega.Equal(http.StatusUnauthorized))
+	})
+
+	ginkgo.It("only grants known scopes the user may have", func() {
+		gomega.Expect(create(player, "script").Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+		gomega.Expect(create(player, "script", "admin").Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+
+		rr := create(player, "script", "read", "moderate")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("Only moderators can create tokens with the moderate scope"))
+
+		gomega.Expect(create(mod, "script", "moderate").Code).To(gomega.Equal(http.StatusCreated))
+
+		var count int
+		gomega.Expect(app.DB.QueryRow(`SELECT COUNT(*) FROM Api_Tokens`).Scan(&count)).To(gomega.Succeed())
+		gomega.Expect(count).To(gomega.Equal(1))
+	})
+
+	ginkgo.It("needs read for reading, write for changes and moderate for moderation", func() {
+		read := createToken(player, "read")
+		write := createToken(player, "write")
+
+		gomega.Expect(bearer(http.MethodGet, "/user/notifications", read).Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(bearer(http.MethodGet, "/user/notifications", write).Code).To(gomega.Equal(http.StatusForbidden))
+		gomega.Expect(bearer(http.MethodPost, "/api/v1/notifications/read", read).Code).To(gomega.Equal(http.StatusForbidden))
+		gomega.Expect(bearer(http.MethodPost, "/api/v1/notifications/read", write).Code).To(gomega.Equal(http.StatusNoContent))
+
+		modWrite := createToken(mod, "read", "write")
+		modModerate := createToken(mod, "moderate")
+		gomega.Expect(bearer(http.MethodPost, "/post/report", modWrite).Code).To(gomega.Equal(http.StatusForbidden))
+		// Past the scope check, the empty report is rejected by the handler
+		gomega.Expect(bearer(http.MethodPost, "/post/report", modModerate).Code).To(gomega.Equal(http.StatusBadRequest))
+	})
+
+	ginkgo.It("keeps tokens out of account management", func() {
+		token := createToken(mod, "read", "write")
+
+		// Not even the same scopes again, let alone moderate
+		req := httptest.NewRequest(http.MethodPost, "/user/tokens/create", strings.NewReader(url.Values{"name": {"wider"}, "scopes": {"moderate"}}.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("Authorization", "Bearer "+token)
+		gomega.Expect(app.do(nil, req).Code).To(gomega.Equal(http.StatusForbidden))
+
+		var count int
+		gomega.Expect(app.DB.QueryRow(`SELECT COUNT(*) FROM Api_Tokens`).Scan(&count)).To(gomega.Succeed())
+		gomega.Expect(count).To(gomega.Equal(1))
+
+		for _, path := range []string{"/user/tokens/revoke?id=1", "/user/sessions/revoke-others", "/user/2fa/disable", "/user/identities/unlink", "/user/settings/password", "/user/settings/delete"} {
+			gomega.Expect(bearer(http.MethodPost, path, token).Code).To(gomega.Equal(http.StatusForbidden), path)
+		}
+		for _, path := range []string{"/user/sessions", "/user/2fa", "/user/settings", "/user/export"} {
+			gomega.Expect(bearer(http.MethodGet, path, token).Code).To(gomega.Equal(http.StatusForbidden), path)
+		}
+
+		// The session still can
+		gomega.Expect(app.get(mod, "/user/settings").Code).To(gomega.Equal(http.StatusOK))
+	})
+})
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"game-forum-abaliyev-ashirbay/internal/avatar"
+	"game-forum-abaliyev-ashirbay/internal/models"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+const (
+	maxAvatarBytes = 5 << 20
+
+	// avatarPrefix is the folder of the image store avatars are kept in,
+	// SweepImages leaves it alone
+	avatarPrefix = "avatars/"
+
+	// maxAvatarBody bounds an avatar form with the largest picture
+	maxAvatarBody = maxAvatarBytes + 1<<20
+)
+
+// avatarURL is where the avatar of a user is served, the uploaded one or
+// an identicon.
+func avatarURL(userID int, size int) string {
+	return fmt.Sprintf("/avatars/%d/%d", userID, size)
+}
+
+func avatarFile(name string, size int) string {
+	return fmt.Sprintf("%s-%d.png", name, size)
+}
+
+// avatarObject is the name of an avatar file in the image store.
+func avatarObject(name string, size int) string {
+	return avatarPrefix + avatarFile(name, size)
+}
+
+func (app *Application) avatarImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := strconv.Atoi(r.PathValue("id"))
+	if err != nil || userID < 1 {
+		app.notFound(w, r)
+		return
+	}
+	size, err := strconv.Atoi(r.PathValue("size"))
+	if err != nil || !avatar.ValidSize(size) {
+		app.notFound(w, r)
+		return
+	}
+
+	name, err := app.Profiles.Avatar(userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Browsers ask again every time but get a 304 until the avatar changes
+	w.Header().Set("Content-Type", "image/png")
+	w.Header().Set("Cache-Control", "no-cache")
+
+	if name == "" {
+		img, err := avatar.Identicon(strconv.Itoa(userID), size)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		w.Header().Set("ETag", fmt.Sprintf(`"identicon-%d-%d"`, userID, size))
+		http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(img))
+		return
+	}
+
+	img, err := app.images().Get(avatarObject(name, size))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("ETag", `"`+avatarFile(name, size)+`"`)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(img))
+}
+
+func (app *Application) avatarUploadPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := app.authenticatedUser(w, r)
+	if !ok {
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxAvatarBody)
+	err := r.ParseMultipartForm(maxAvatarBytes)
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	if !app.checkFormCSRF(w, r) {
+		return
+	}
+
+	file, header, err := r.FormFile("avatar")
+	if err != nil {
+		if errors.Is(err, http.ErrMissingFile) {
+			app.avatarError(w, r, user.ID, "Choose a picture to upload")
+			return
+		}
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+	defer file.Close()
+
+	if header.Size > maxAvatarBytes {
+		app.avatarError(w, r, user.ID, "The picture must not be larger than 5MB")
+		return
+	}
+
+	images, err := avatar.Render(file)
+	if err != nil {
+		switch {
+		case errors.Is(err, avatar.ErrFormat):
+			app.avatarError(w, r, user.ID, "Only JPEG, PNG or GIF pictures are allowed")
+		case errors.Is(err, avatar.ErrTooLarge):
+			app.avatarError(w, r, user.ID, "The picture must not be larger than 4096x4096 pixels")
+		default:
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// A new name for every upload, so cached copies of the old one are
+	// never served for it
+	sum := sha256.Sum256(images[avatar.Sizes[len(avatar.Sizes)-1]])
+	name := fmt.Sprintf("%d-%s", user.ID, hex.EncodeToString(sum[:8]))
+
+	for size, img := range images {
+		err = app.images().Put(avatarObject(name, size), img)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	err = app.replaceAvatar(user.ID, name)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/user/personal-page", http.StatusSeeOther)
+}
+
+func (app *Application) avatarDeletePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := app.authenticatedUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := app.replaceAvatar(user.ID, "")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/user/personal-page", http.StatusSeeOther)
+}
+
+// replaceAvatar switches the user to the avatar stored as name, or to the
+// identicon when name is empty, and removes the files of the old one.
+func (app *Application) replaceAvatar(userID int, name string) error {
+	old, err := app.Profiles.Avatar(userID)
+	if err != nil {
+		return err
+	}
+
+	err = app.Profiles.SetAvatar(userID, name)
+	if err != nil {
+		return err
+	}
+
+	if old == "" || old == name {
+		return nil
+	}
+	for _, size := range avatar.Sizes {
+		err = app.images().Delete(avatarObject(old, size))
+		if err != nil {
+			app.Logger.Error("failed to remove old avatar", "name", avatarObject(old, size), "error", err.Error())
+		}
+	}
+
+	return nil
+}
+
+// avatarError re-renders the personal page with an upload error.
+func (app *Application) avatarError(w http.ResponseWriter, r *http.Request, userID int, message string) {
+	data, err := app.personalPageData(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	data.FormErrors = map[string]string{"avatar": message}
+	app.render(w, r, http.StatusUnprocessableEntity, "personal_page.html", data)
+}
@@ -1,6 +1,7 @@
 package handlers_test
 
 import (
+	"net/http"
 	"testing"
 
 	"github.com/onsi/ginkgo/v2"
@@ -11,3 +12,12 @@ func TestHandlers(t *testing.T) {
 	gomega.RegisterFailHandler(ginkgo.Fail)
 	ginkgo.RunSpecs(t, "Handlers Suite")
 }
+
+// fromIP makes all requests to h come from ip. Routes rate limit by address
+// across the whole suite, every Describe uses its own.
+func fromIP(h http.Handler, ip string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.RemoteAddr = ip + ":1234"
+		h.ServeHTTP(w, r)
+	})
+}
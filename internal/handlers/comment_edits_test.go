@@ -0,0 +1,111 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Comment editing", func() {
+	var (
+		app   *testApp
+		users map[string]*testSession
+	)
+
+	ginkgo.BeforeEach(func() {
+		app = newTestApp("198.51.100.11")
+		app.CommentEditWindow = 30 * time.Minute
+
+		_, err := app.DB.Exec(`
+		INSERT INTO Categories (name) VALUES ('Speedruns');
+		INSERT INTO Users (id, email, username, password, role, created_at) VALUES
+		(1, 'player@example.com', 'player', '', 'user', '2026-01-02 10:00:00'),
+		(2, 'rival@example.com', 'rival', '', 'user', '2026-01-02 10:00:00'),
+		(3, 'mod@example.com', 'mod', '', 'moderator', '2026-01-02 10:00:00'),
+		(4, 'boss@example.com', 'boss', '', 'admin', '2026-01-02 10:00:00');
+		INSERT INTO Posts (title, content, imgUrl, createdAt, category_id, owner_id, like_count, dislike_count)
+		VALUES ('Any% route', 'Skip the boss.', '', '2026-01-02 10:00:00', 1, 2, 0, 0);
+		INSERT INTO Comments (post_id, user_id, created_at, text, like_count, dislike_count) VALUES
+		(1, 1, ?, 'Nice rotue', 0, 0),
+		(1, 1, ?, 'Old news', 0, 0);
+		`, time.Now().Add(-time.Minute), time.Now().Add(-2*time.Hour))
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		users = map[string]*testSession{}
+		for i, name := range []string{"player", "rival", "mod", "boss"} {
+			users[name] = app.login(i+1, name+"-session")
+		}
+	})
+
+	get := func(user string, path string) *httptest.ResponseRecorder {
+		return app.get(users[user], path)
+	}
+
+	edit := func(user string, id string, text string) *httptest.ResponseRecorder {
+		return app.postForm(users[user], "/comments/edit/post?id="+id, url.Values{"text": {text}})
+	}
+
+	commentText := func(id int) string {
+		var text string
+		gomega.Expect(app.DB.QueryRow(`SELECT text FROM Comments WHERE id = ?`, id).Scan(&text)).To(gomega.Succeed())
+		return text
+	}
+
+	ginkgo.It("lets authors fix their comments and keeps the earlier text", func() {
+		body := get("player", "/post/view?id=1").Body.String()
+		gomega.Expect(body).To(gomega.ContainSubstring(`href="/comments/edit?id=1"`))
+		gomega.Expect(body).ToNot(gomega.ContainSubstring(`href="/comments/edit?id=2"`))
+		gomega.Expect(body).ToNot(gomega.ContainSubstring("(edited)"))
+
+		rr := edit("player", "1", "   ")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("Comment must not be blank"))
+
+		rr = edit("player", "1", "Nice route")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+		gomega.Expect(rr.Header().Get("Location")).To(gomega.Equal("/post/view?id=1"))
+		gomega.Expect(commentText(1)).To(gomega.Equal("Nice route"))
+
+		var revisions []string
+		rows, err := app.DB.Query(`SELECT revision || ':' || editor_id || ':' || text FROM Comment_Revisions WHERE comment_id = 1 ORDER BY revision`)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		for rows.Next() {
+			var r string
+			gomega.Expect(rows.Scan(&r)).To(gomega.Succeed())
+			revisions = append(revisions, r)
+		}
+		rows.Close()
+		gomega.Expect(revisions).To(gomega.Equal([]string{"1:1:Nice rotue", "2:1:Nice route"}))
+
+		body = get("rival", "/post/view?id=1").Body.String()
+		gomega.Expect(body).To(gomega.ContainSubstring("Nice route"))
+		gomega.Expect(body).To(gomega.ContainSubstring(`class="comment-edited"`))
+		gomega.Expect(body).ToNot(gomega.ContainSubstring(`href="/comments/edit?id=1"`))
+
+		rr = get("player", "/comments/edit?id=1")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("Revision 1"))
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("Nice rotue"))
+	})
+
+	ginkgo.It("applies the delete checks and the edit window", func() {
+		gomega.Expect(get("rival", "/comments/edit?id=1").Code).To(gomega.Equal(http.StatusForbidden))
+		gomega.Expect(edit("rival", "1", "Bad route").Code).To(gomega.Equal(http.StatusForbidden))
+		gomega.Expect(get("player", "/comments/edit?id=9").Code).To(gomega.Equal(http.StatusNotFound))
+
+		gomega.Expect(edit("mod", "1", "Nice route [removed link]").Code).To(gomega.Equal(http.StatusSeeOther))
+		var editor int
+		gomega.Expect(app.DB.QueryRow(`SELECT editor_id FROM Comment_Revisions WHERE comment_id = 1 AND revision = 2`).Scan(&editor)).To(gomega.Succeed())
+		gomega.Expect(editor).To(gomega.Equal(3))
+
+		// Only admins can edit once the window has passed
+		gomega.Expect(edit("player", "2", "Old news, still true").Code).To(gomega.Equal(http.StatusForbidden))
+		gomega.Expect(edit("mod", "2", "Old news, still true").Code).To(gomega.Equal(http.StatusForbidden))
+		gomega.Expect(edit("boss", "2", "Old news, still true").Code).To(gomega.Equal(http.StatusSeeOther))
+		gomega.Expect(commentText(2)).To(gomega.Equal("Old news, still true"))
+	})
+})
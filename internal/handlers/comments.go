@@ -4,6 +4,7 @@ import (
 	"errors"
 	"fmt"
 	"game-forum-abaliyev-ashirbay/internal/models"
+	"game-forum-abaliyev-ashirbay/internal/validator"
 	"net/http"
 	"strconv"
 	"time"
@@ -35,25 +36,35 @@ func (app *Application) createCommentPost(w http.ResponseWriter, r *http.Request
 		return
 	}
 
-	commentID, err := app.Comments.Insert(postId, userId, text, time.Now())
+	var parent *models.Comment
+	if parentIdStr := r.PostForm.Get("parentId"); parentIdStr != "" {
+		parentId, err := strconv.Atoi(parentIdStr)
+		if err != nil || parentId < 1 {
+			app.clientError(w, r, http.StatusBadRequest)
+			return
+		}
+
+		parent, err = app.Comments.Get(parentId)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				app.notFound(w, r)
+			} else {
+				app.serverError(w, r, err)
+			}
+			return
+		}
+
+		if parent.PostID != postId {
+			app.clientError(w, r, http.StatusBadRequest)
+			return
+		}
+	}
+
+	_, err = app.addComment(postId, parent, userId, text)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
-	post, err := app.Posts.Get(postId)
-	if err == nil && post.OwnerID != userId {
-		_, nErr := app.Notifications.Insert(
-			"comment",
-			userId,       // actor
-			post.OwnerID, // recipient
-			postId,       // post
-			&commentID,   // comment
-		)
-		if nErr != nil {
-			app.serverError(w, r, nErr)
-			return
-		}
-	}
 
 	http.Redirect(w, r, fmt.Sprintf("/post/view?id=%d", postId), http.StatusSeeOther)
 }
@@ -93,12 +104,110 @@ func (app *Application) handleCommentReaction(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	existingReaction, err := app.CommentsReactions.GetReaction(userID, commentID)
-	if err != nil && err != models.ErrNoReaction {
+	comment, err := app.Comments.Get(commentID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = app.reactToComment(userID, comment, reaction)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	redirectURL := fmt.Sprintf("/post/view?id=%d", postId)
+	http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+}
+
+func (app *Application) commentDelete(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	idStr := r.URL.Query().Get("id")
+	commentID, err := strconv.Atoi(idStr)
+	if err != nil || commentID < 1 {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	userID, err := app.getAuthenticatedUserID(r)
+	if err != nil {
+		app.notAuthenticated(w, r)
+		return
+	}
+
+	comment, err := app.Comments.Get(commentID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.Users.GetById(userID)
+	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
+	if comment.UserID != userID && !canModerate(r, user, comment.UserID) {
+		app.clientError(w, r, http.StatusForbidden)
+		return
+	}
+
+	err = app.Comments.SoftDelete(comment.ID, user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/post/view?id=%d", comment.PostID), http.StatusSeeOther)
+}
+
+// defaultCommentEditWindow is used when the application was set up without
+// a CommentEditWindow.
+const defaultCommentEditWindow = 15 * time.Minute
+
+func (app *Application) commentEditWindow() time.Duration {
+	if app.CommentEditWindow <= 0 {
+		return defaultCommentEditWindow
+	}
+	return app.CommentEditWindow
+}
+
+// canEditComment applies the checks commentDelete makes, and then only lets
+// admins edit once the edit window after posting has passed.
+func canEditComment(r *http.Request, user *models.User, comment *models.Comment, window time.Duration) bool {
+	if comment.UserID != user.ID && !canModerate(r, user, comment.UserID) {
+		return false
+	}
+	return user.Role == "admin" || time.Since(comment.CreatedAt) < window
+}
+
+// loadEditableComment fetches the comment named in the query and checks
+// that the user may edit it, writing the error response itself when not.
+func (app *Application) loadEditableComment(w http.ResponseWriter, r *http.Request) (*models.Comment, *models.User, bool) {
+	commentID, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || commentID < 1 {
+		app.clientError(w, r, http.StatusBadRequest)
+		return nil, nil, false
+	}
+
+	userID, err := app.getAuthenticatedUserID(r)
+	if err != nil {
+		app.notAuthenticated(w, r)
+		return nil, nil, false
+	}
+
 	comment, err := app.Comments.Get(commentID)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
@@ -106,18 +215,157 @@ func (app *Application) handleCommentReaction(w http.ResponseWriter, r *http.Req
 		} else {
 			app.serverError(w, r, err)
 		}
+		return nil, nil, false
+	}
+
+	user, err := app.Users.GetById(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return nil, nil, false
+	}
+
+	if !canEditComment(r, user, comment, app.commentEditWindow()) {
+		app.clientError(w, r, http.StatusForbidden)
+		return nil, nil, false
+	}
+
+	return comment, user, true
+}
+
+func (app *Application) commentEdit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
 		return
 	}
 
+	comment, _, ok := app.loadEditableComment(w, r)
+	if !ok {
+		return
+	}
+
+	revisions, err := app.Comments.GetRevisions(comment.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := templateData{
+		Comment:          comment,
+		CommentRevisions: revisions,
+	}
+
+	app.render(w, r, http.StatusOK, "edit_comment.html", data)
+}
+
+func (app *Application) commentEditPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	comment, user, ok := app.loadEditableComment(w, r)
+	if !ok {
+		return
+	}
+
+	text := r.PostForm.Get("text")
+
+	v := validator.Validator{}
+	v.CheckField(validator.NotBlank(text), "text", "Comment must not be blank")
+
+	if !v.Valid() {
+		revisions, err := app.Comments.GetRevisions(comment.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		comment.Text = text
+		data := templateData{
+			Comment:          comment,
+			CommentRevisions: revisions,
+			FormErrors:       v.FieldErrors,
+		}
+
+		app.render(w, r, http.StatusUnprocessableEntity, "edit_comment.html", data)
+		return
+	}
+
+	err = app.Comments.Update(comment.ID, user.ID, text)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/post/view?id=%d", comment.PostID), http.StatusSeeOther)
+}
+
+// addComment stores a comment (or a reply when parent is set) and notifies the
+// post owner and the author of the parent comment.
+func (app *Application) addComment(postID int, parent *models.Comment, userID int, text string) (int, error) {
+	var parentID *int
+	if parent != nil {
+		parentID = &parent.ID
+	}
+
+	commentID, err := app.Comments.Insert(postID, parentID, userID, text, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	if parent != nil && parent.UserID != userID {
+		_, err = app.Notifications.Insert(
+			"reply",
+			userID,        // actor
+			parent.UserID, // recipient
+			postID,        // post
+			&commentID,    // comment
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	post, err := app.Posts.Get(postID)
+	if err == nil && post.OwnerID != userID && (parent == nil || parent.UserID != post.OwnerID) {
+		_, err = app.Notifications.Insert(
+			"comment",
+			userID,       // actor
+			post.OwnerID, // recipient
+			postID,       // post
+			&commentID,   // comment
+		)
+		if err != nil {
+			return 0, err
+		}
+	}
+
+	return commentID, nil
+}
+
+// reactToComment toggles the user's like or dislike on a comment, keeps the
+// cached counters in sync and notifies the comment author.
+func (app *Application) reactToComment(userID int, comment *models.Comment, reaction string) error {
+	existingReaction, err := app.CommentsReactions.GetReaction(userID, comment.ID)
+	if err != nil && err != models.ErrNoReaction {
+		return err
+	}
+
 	newLikeCount := comment.LikeCount
 	newDislikeCount := comment.DislikeCount
+	notify := true
 
 	if existingReaction != nil {
 		if existingReaction.Type == reaction {
-			err = app.CommentsReactions.DeleteReaction(userID, commentID)
+			err = app.CommentsReactions.DeleteReaction(userID, comment.ID)
 			if err != nil {
-				app.serverError(w, r, err)
-				return
+				return err
 			}
 
 			if reaction == "like" {
@@ -125,12 +373,11 @@ func (app *Application) handleCommentReaction(w http.ResponseWriter, r *http.Req
 			} else {
 				newDislikeCount -= 1
 			}
-
+			notify = false
 		} else {
-			err = app.CommentsReactions.UpdateReaction(userID, commentID, reaction)
+			err = app.CommentsReactions.UpdateReaction(userID, comment.ID, reaction)
 			if err != nil {
-				app.serverError(w, r, err)
-				return
+				return err
 			}
 
 			if reaction == "like" {
@@ -140,33 +387,11 @@ func (app *Application) handleCommentReaction(w http.ResponseWriter, r *http.Req
 				newLikeCount -= 1
 				newDislikeCount += 1
 			}
-
-
-			var notifType string
-			if reaction == "like" {
-				notifType = "comment_like"
-			} else {
-				notifType = "comment_dislike"
-			}
-	
-			_, nErr := app.Notifications.Insert(
-				notifType,
-				userID,         // actor
-				comment.UserID, // recipient
-				comment.PostID, // post
-				&comment.ID,    // comment
-			)
-			if nErr != nil {
-				app.serverError(w, r, nErr)
-				return
-			}
-
 		}
 	} else {
-		err = app.CommentsReactions.AddReaction(userID, commentID, reaction)
+		err = app.CommentsReactions.AddReaction(userID, comment.ID, reaction)
 		if err != nil {
-			app.serverError(w, r, err)
-			return
+			return err
 		}
 
 		if reaction == "like" {
@@ -174,7 +399,9 @@ func (app *Application) handleCommentReaction(w http.ResponseWriter, r *http.Req
 		} else {
 			newDislikeCount += 1
 		}
+	}
 
+	if notify {
 		var notifType string
 		if reaction == "like" {
 			notifType = "comment_like"
@@ -182,83 +409,40 @@ func (app *Application) handleCommentReaction(w http.ResponseWriter, r *http.Req
 			notifType = "comment_dislike"
 		}
 
-		_, nErr := app.Notifications.Insert(
+		_, err = app.Notifications.Insert(
 			notifType,
 			userID,         // actor
 			comment.UserID, // recipient
 			comment.PostID, // post
 			&comment.ID,    // comment
 		)
-		if nErr != nil {
-			app.serverError(w, r, nErr)
-			return
+		if err != nil {
+			return err
 		}
 	}
 
-	err = app.Comments.UpdateCommentLikeDislikeCounts(commentID, newLikeCount, newDislikeCount)
+	err = app.Comments.UpdateCommentLikeDislikeCounts(comment.ID, newLikeCount, newDislikeCount)
 	if err != nil {
-		app.serverError(w, r, err)
-		return
+		return err
 	}
-	// if comment.UserID != userID && existingReaction != nil && existingReaction.Type == reaction {
+	comment.LikeCount = newLikeCount
+	comment.DislikeCount = newDislikeCount
 
-	// }
-
-	redirectURL := fmt.Sprintf("/post/view?id=%d", postId)
-	http.Redirect(w, r, redirectURL, http.StatusSeeOther)
+	return nil
 }
 
-func (app *Application) commentDelete(w http.ResponseWriter, r *http.Request) {
-	if r.Method != http.MethodPost {
-		app.clientError(w, r, http.StatusMethodNotAllowed)
-		return
-	}
-
-	idStr := r.URL.Query().Get("id")
-	commentID, err := strconv.Atoi(idStr)
-	if err != nil || commentID < 1 {
-		app.clientError(w, r, http.StatusBadRequest)
-		return
-	}
-
-	userID, err := app.getAuthenticatedUserID(r)
+// purgeComment removes a comment for good together with its reactions and
+// notifications. Replies to it are kept.
+func (app *Application) purgeComment(comment *models.Comment) error {
+	err := app.CommentsReactions.DeleteReactioByCommentId(comment.ID)
 	if err != nil {
-		app.notAuthenticated(w, r)
-		return
-	}
-
-	comment, err := app.Comments.Get(commentID)
-	if err != nil {
-		if errors.Is(err, models.ErrNoRecord) {
-			app.notFound(w, r)
-		} else {
-			app.serverError(w, r, err)
-		}
-		return
-	}
-
-	user, err := app.Users.GetById(userID)
-	if err != nil {
-		app.serverError(w, r, err)
-		return
-	}
-
-	if comment.UserID != userID && user.Role != "moderator" && user.Role != "admin" {
-		app.clientError(w, r, http.StatusForbidden)
-		return
+		return err
 	}
 
-	err = app.CommentsReactions.DeleteReactioByCommentId(commentID)
+	err = app.Notifications.DeleteByCommentID(comment.ID)
 	if err != nil {
-		app.serverError(w, r, err)
-		return
+		return err
 	}
 
-	err = app.Comments.DeleteCommentById(commentID)
-	if err != nil {
-		app.serverError(w, r, err)
-		return
-	}
-
-	http.Redirect(w, r, fmt.Sprintf("/post/view?id=%d", comment.PostID), http.StatusSeeOther)
+	return app.Comments.DeleteCommentById(comment.ID)
 }
@@ -0,0 +1,151 @@
+package handlers_test
+
+import (
+	"io"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("CSRF protection", func() {
+	var (
+		app    *testApp
+		player *testSession
+	)
+
+	ginkgo.BeforeEach(func() {
+		app = newTestApp("198.51.100.13")
+
+		_, err := app.DB.Exec(`
+		INSERT INTO Categories (name) VALUES ('Speedruns');
+		INSERT INTO Users (id, email, username, password, role)
+		VALUES (1, 'player@example.com', 'player', '', 'user');
+		`)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		player = app.login(1, "player-session")
+	})
+
+	tokens := func() int {
+		var n int
+		gomega.Expect(app.DB.QueryRow(`SELECT COUNT(*) FROM Api_Tokens`).Scan(&n)).To(gomega.Succeed())
+		return n
+	}
+
+	posts := func() int {
+		var n int
+		gomega.Expect(app.DB.QueryRow(`SELECT COUNT(*) FROM Posts`).Scan(&n)).To(gomega.Succeed())
+		return n
+	}
+
+	// createToken posts the form for a personal API token, with the CSRF
+	// token in the form or in the X-CSRF-Token header.
+	createToken := func(token string, header bool) *httptest.ResponseRecorder {
+		form := url.Values{"name": {"script"}, "scopes": {"read"}}
+		if token != "" && !header {
+			form.Set("csrf_token", token)
+		}
+		req := httptest.NewRequest(http.MethodPost, "/user/tokens/create", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		if header {
+			req.Header.Set("X-CSRF-Token", token)
+		}
+		return app.do(player, req)
+	}
+
+	ginkgo.It("accepts the session's token in the form or in the header", func() {
+		gomega.Expect(createToken(player.CSRF, false).Code).To(gomega.Equal(http.StatusCreated))
+		gomega.Expect(createToken(player.CSRF, true).Code).To(gomega.Equal(http.StatusCreated))
+		gomega.Expect(tokens()).To(gomega.Equal(2))
+	})
+
+	ginkgo.It("rejects a missing or wrong token", func() {
+		gomega.Expect(createToken("", false).Code).To(gomega.Equal(http.StatusForbidden))
+		gomega.Expect(createToken("not-the-token", false).Code).To(gomega.Equal(http.StatusForbidden))
+		gomega.Expect(createToken("not-the-token", true).Code).To(gomega.Equal(http.StatusForbidden))
+
+		// Another session's token does not do either
+		other := app.login(1, "other-session")
+		gomega.Expect(createToken(other.CSRF, false).Code).To(gomega.Equal(http.StatusForbidden))
+		gomega.Expect(tokens()).To(gomega.Equal(0))
+	})
+
+	ginkgo.It("does not read more than a small url-encoded form for the token", func() {
+		form := url.Values{"csrf_token": {player.CSRF}, "name": {strings.Repeat("a", 2<<20)}, "scopes": {"read"}}
+		req := httptest.NewRequest(http.MethodPost, "/user/tokens/create", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+		gomega.Expect(app.do(player, req).Code).To(gomega.Equal(http.StatusForbidden))
+		gomega.Expect(tokens()).To(gomega.Equal(0))
+	})
+
+	ginkgo.It("leaves the token of a multipart form to its handler", func() {
+		fields := map[string]string{"title": "Any% route", "category_id": "1", "content": "The new skip saves twelve seconds."}
+
+		gomega.Expect(app.postMultipart(player, "/post/create/post", fields, "images").Code).To(gomega.Equal(http.StatusSeeOther))
+		gomega.Expect(posts()).To(gomega.Equal(1))
+
+		gomega.Expect(app.postMultipart(&testSession{Cookie: player.Cookie, CSRF: "not-the-token"}, "/post/create/post", fields, "images").Code).To(gomega.Equal(http.StatusForbidden))
+		gomega.Expect(posts()).To(gomega.Equal(1))
+
+		// Handlers that do not check it themselves get no multipart forms without the header
+		rr := app.postMultipart(player, "/user/tokens/create", map[string]string{"name": "script", "scopes": "read"}, "")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusForbidden))
+		gomega.Expect(tokens()).To(gomega.Equal(0))
+	})
+
+	ginkgo.It("rejects a multipart post larger than a post can be before reading it all", func() {
+		// The body is streamed, it is larger than maxPostBody
+		pr, pw := io.Pipe()
+		mw := multipart.NewWriter(pw)
+		go func() {
+			mw.WriteField("csrf_token", player.CSRF)
+			mw.WriteField("title", "Any% route")
+			mw.WriteField("category_id", "1")
+			fw, err := mw.CreateFormFile("images", "huge.png")
+			if err != nil {
+				pw.CloseWithError(err)
+				return
+			}
+			chunk := make([]byte, 1<<20)
+			for i := 0; i < 160; i++ {
+				if _, err := fw.Write(chunk); err != nil {
+					return
+				}
+			}
+			pw.CloseWithError(mw.Close())
+		}()
+		defer pr.Close()
+
+		req := httptest.NewRequest(http.MethodPost, "/post/create/post", pr)
+		req.Header.Set("Content-Type", mw.FormDataContentType())
+
+		gomega.Expect(app.do(player, req).Code).To(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(posts()).To(gomega.Equal(0))
+	})
+
+	ginkgo.It("does not ask for a token without a session cookie", func() {
+		// Bearer tokens are never sent by browsers on their own
+		req := httptest.NewRequest(http.MethodPost, "/api/v1/notifications/read", nil)
+		req.Header.Set("Authorization", "Bearer "+player.Cookie.Value)
+		gomega.Expect(app.do(nil, req).Code).To(gomega.Equal(http.StatusNoContent))
+
+		// Anonymous forms get as far as the handler
+		rr := app.postForm(nil, "/user/tokens/create", url.Values{"name": {"script"}, "scopes": {"read"}})
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+		gomega.Expect(rr.Header().Get("Location")).To(gomega.Equal("/login"))
+
+		// So do requests with a session that ran out
+		_, err := app.DB.Exec(`UPDATE Sessions SET expiresAt = datetime('now', '-1 minute')`)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		rr = createToken("", false)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+		gomega.Expect(rr.Header().Get("Location")).To(gomega.Equal("/login"))
+		gomega.Expect(tokens()).To(gomega.Equal(0))
+	})
+})
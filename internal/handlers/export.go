@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"game-forum-abaliyev-ashirbay/internal/avatar"
+	"game-forum-abaliyev-ashirbay/internal/models"
+	"game-forum-abaliyev-ashirbay/internal/storage"
+	"io"
+	"net/http"
+	"path"
+	"sort"
+	"time"
+)
+
+// The files of a personal data export. Uploaded pictures go next to them,
+// post images under images/ and the avatar as avatar.png. Posts and comments
+// in the trash are exported too, with the time they were deleted.
+type exportProfile struct {
+	ID           int       `json:"id"`
+	Username     string    `json:"username"`
+	Email        string    `json:"email"`
+	Role         string    `json:"role"`
+	Bio          string    `json:"bio"`
+	Avatar       string    `json:"avatar,omitempty"`
+	JoinedAt     time.Time `json:"joined_at"`
+	PostCount    int       `json:"post_count"`
+	CommentCount int       `json:"comment_count"`
+	Reputation   int       `json:"reputation"`
+}
+
+type exportPost struct {
+	ID           int                `json:"id"`
+	Title        string             `json:"title"`
+	Content      string             `json:"content"`
+	Image        string             `json:"image,omitempty"`
+	Attachments  []exportAttachment `json:"attachments"`
+	CategoryID   int                `json:"category_id"`
+	LikeCount    int                `json:"like_count"`
+	DislikeCount int                `json:"dislike_count"`
+	CreatedAt    time.Time          `json:"created_at"`
+	DeletedAt    *time.Time         `json:"deleted_at,omitempty"`
+}
+
+type exportAttachment struct {
+	Image    string `json:"image"`
+	Caption  string `json:"caption"`
+	Position int    `json:"position"`
+}
+
+type exportComment struct {
+	ID           int        `json:"id"`
+	PostID       int        `json:"post_id"`
+	PostTitle    string     `json:"post_title"`
+	Text         string     `json:"text"`
+	LikeCount    int        `json:"like_count"`
+	DislikeCount int        `json:"dislike_count"`
+	CreatedAt    time.Time  `json:"created_at"`
+	DeletedAt    *time.Time `json:"deleted_at,omitempty"`
+}
+
+type exportReactions struct {
+	Posts    []exportPostReaction    `json:"posts"`
+	Comments []exportCommentReaction `json:"comments"`
+}
+
+type exportPostReaction struct {
+	PostID   int    `json:"post_id"`
+	Reaction string `json:"reaction"`
+}
+
+type exportCommentReaction struct {
+	CommentID int    `json:"comment_id"`
+	Reaction  string `json:"reaction"`
+}
+
+type exportNotification struct {
+	ID        int       `json:"id"`
+	Type      string    `json:"type"`
+	ActorID   int       `json:"actor_id"`
+	PostID    int       `json:"post_id"`
+	CommentID *int      `json:"comment_id,omitempty"`
+	IsRead    bool      `json:"is_read"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+type exportPromotionRequest struct {
+	ID          int    `json:"id"`
+	Description string `json:"description"`
+	Status      string `json:"status"`
+}
+
+func (app *Application) dataExport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := app.authenticatedUser(w, r)
+	if !ok {
+		return
+	}
+
+	// Build the whole archive first, an error halfway through would
+	// otherwise leave the user with a broken download
+	var buf bytes.Buffer
+	err := app.writeDataExport(&buf, user)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="forum-data-%s.zip"`, time.Now().Format("2006-01-02")))
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write(buf.Bytes())
+}
+
+// writeDataExport writes a ZIP of everything the user created or received
+// on the forum to w.
+func (app *Application) writeDataExport(w io.Writer, user *models.User) error {
+	zw := zip.NewWriter(w)
+
+	profile, err := app.Profiles.Get(user.ID)
+	if err != nil {
+		return err
+	}
+
+	exported := exportProfile{
+		ID:           user.ID,
+		Username:     user.Username,
+		Email:        user.Email,
+		Role:         user.Role,
+		Bio:          profile.Bio,
+		JoinedAt:     profile.JoinedAt,
+		PostCount:    profile.PostCount,
+		CommentCount: profile.CommentCount,
+		Reputation:   profile.Reputation,
+	}
+	if profile.Avatar != "" {
+		ok, err := app.addExportImage(zw, "avatar.png", avatarObject(profile.Avatar, avatar.Sizes[len(avatar.Sizes)-1]))
+		if err != nil {
+			return err
+		}
+		if ok {
+			exported.Avatar = "avatar.png"
+		}
+	}
+	err = writeExportJSON(zw, "profile.json", exported)
+	if err != nil {
+		return err
+	}
+
+	posts, err := app.Posts.GetPostsByUserID(user.ID)
+	if err != nil {
+		return err
+	}
+	// The same image can be attached more than once, it is only added once
+	images := map[string]string{}
+	exportImage := func(image string) (string, error) {
+		if name, ok := images[image]; ok {
+			return name, nil
+		}
+		name := "images/" + path.Base(image)
+		ok, err := app.addExportImage(zw, name, image)
+		if err != nil {
+			return "", err
+		}
+		if !ok {
+			name = ""
+		}
+		images[image] = name
+		return name, nil
+	}
+
+	toExportPost := func(p *models.Post, deletedAt *time.Time) (exportPost, error) {
+		post := exportPost{
+			ID:           p.ID,
+			Title:        p.Title,
+			Content:      p.Content,
+			CategoryID:   p.CategoryID,
+			LikeCount:    p.LikeCount,
+			DislikeCount: p.DislikeCount,
+			CreatedAt:    p.CreatedAt,
+			DeletedAt:    deletedAt,
+			Attachments:  []exportAttachment{},
+		}
+		var err error
+		if p.ImgUrl != "" {
+			post.Image, err = exportImage(p.ImgUrl)
+			if err != nil {
+				return post, err
+			}
+		}
+
+		attachments, err := app.PostAttachments.GetByPostID(p.ID)
+		if err != nil {
+			return post, err
+		}
+		for _, a := range attachments {
+			name, err := exportImage(a.Name)
+			if err != nil {
+				return post, err
+			}
+			if name != "" {
+				post.Attachments = append(post.Attachments, exportAttachment{Image: name, Caption: a.Caption, Position: a.Position})
+			}
+		}
+		return post, nil
+	}
+
+	trashedPosts, err := app.Trash.GetPostsByOwner(user.ID)
+	if err != nil {
+		return err
+	}
+	exportedPosts := make([]exportPost, 0, len(posts)+len(trashedPosts))
+	for _, p := range posts {
+		post, err := toExportPost(p, nil)
+		if err != nil {
+			return err
+		}
+		exportedPosts = append(exportedPosts, post)
+	}
+	for _, p := range trashedPosts {
+		post, err := toExportPost(&p.Post, &p.DeletedAt)
+		if err != nil {
+			return err
+		}
+		exportedPosts = append(exportedPosts, post)
+	}
+	sort.SliceStable(exportedPosts, func(i, j int) bool {
+		return exportedPosts[i].CreatedAt.Before(exportedPosts[j].CreatedAt)
+	})
+	err = writeExportJSON(zw, "posts.json", exportedPosts)
+	if err != nil {
+		return err
+	}
+
+	comments, err := app.Comments.GetAllByUserId(user.ID)
+	if err != nil {
+		return err
+	}
+	trashedComments, err := app.Trash.GetCommentsByUser(user.ID)
+	if err != nil {
+		return err
+	}
+	exportedComments := make([]exportComment, 0, len(comments)+len(trashedComments))
+	for _, c := range comments {
+		exportedComments = append(exportedComments, exportComment{
+			ID:           c.ID,
+			PostID:       c.PostID,
+			PostTitle:    c.PostTitle,
+			Text:         c.Text,
+			LikeCount:    c.LikeCount,
+			DislikeCount: c.DislikeCount,
+			CreatedAt:    c.CreatedAt,
+		})
+	}
+	for _, c := range trashedComments {
+		deletedAt := c.DeletedAt
+		exportedComments = append(exportedComments, exportComment{
+			ID:           c.ID,
+			PostID:       c.PostID,
+			PostTitle:    c.PostTitle,
+			Text:         c.Text,
+			LikeCount:    c.LikeCount,
+			DislikeCount: c.DislikeCount,
+			CreatedAt:    c.CreatedAt,
+			DeletedAt:    &deletedAt,
+		})
+	}
+	sort.SliceStable(exportedComments, func(i, j int) bool {
+		return exportedComments[i].CreatedAt.Before(exportedComments[j].CreatedAt)
+	})
+	err = writeExportJSON(zw, "comments.json", exportedComments)
+	if err != nil {
+		return err
+	}
+
+	postReactions, err := app.PostReactions.GetAllByUserID(user.ID)
+	if err != nil {
+		return err
+	}
+	commentReactions, err := app.CommentsReactions.GetAllByUserID(user.ID)
+	if err != nil {
+		return err
+	}
+	reactions := exportReactions{
+		Posts:    make([]exportPostReaction, 0, len(postReactions)),
+		Comments: make([]exportCommentReaction, 0, len(commentReactions)),
+	}
+	for _, pr := range postReactions {
+		reactions.Posts = append(reactions.Posts, exportPostReaction{PostID: pr.PostID, Reaction: pr.Type})
+	}
+	for _, cr := range commentReactions {
+		reactions.Comments = append(reactions.Comments, exportCommentReaction{CommentID: cr.CommentID, Reaction: cr.Type})
+	}
+	err = writeExportJSON(zw, "reactions.json", reactions)
+	if err != nil {
+		return err
+	}
+
+	notifications, err := app.Notifications.GetAllByRecipient(user.ID)
+	if err != nil {
+		return err
+	}
+	exportedNotifications := make([]exportNotification, 0, len(notifications))
+	for _, n := range notifications {
+		notification := exportNotification{
+			ID:        n.ID,
+			Type:      n.Type,
+			ActorID:   n.Actor_ID,
+			PostID:    n.Post_ID,
+			IsRead:    n.Is_read,
+			CreatedAt: n.Created_at,
+		}
+		if n.Comment_ID.Valid {
+			commentID := int(n.Comment_ID.Int64)
+			notification.CommentID = &commentID
+		}
+		exportedNotifications = append(exportedNotifications, notification)
+	}
+	err = writeExportJSON(zw, "notifications.json", exportedNotifications)
+	if err != nil {
+		return err
+	}
+
+	requests, err := app.PromotionRequests.GetAllByUserID(user.ID)
+	if err != nil {
+		return err
+	}
+	exportedRequests := make([]exportPromotionRequest, 0, len(requests))
+	for _, pr := range requests {
+		exportedRequests = append(exportedRequests, exportPromotionRequest{
+			ID:          pr.ID,
+			Description: pr.Description,
+			Status:      pr.Status,
+		})
+	}
+	err = writeExportJSON(zw, "promotion_requests.json", exportedRequests)
+	if err != nil {
+		return err
+	}
+
+	return zw.Close()
+}
+
+func writeExportJSON(zw *zip.Writer, name string, v interface{}) error {
+	f, err := zw.Create(name)
+	if err != nil {
+		return err
+	}
+
+	enc := json.NewEncoder(f)
+	enc.SetIndent("", "  ")
+	return enc.Encode(v)
+}
+
+// addExportImage copies the image stored as image, a post image or an
+// avatar, into the archive as name. A missing image is left out and reported
+// as not added.
+func (app *Application) addExportImage(zw *zip.Writer, name string, image string) (bool, error) {
+	data, err := app.images().Get(image)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotExist) {
+			app.Logger.Warn("image missing from data export", "name", image)
+			return false, nil
+		}
+		return false, err
+	}
+
+	f, err := zw.Create(name)
+	if err != nil {
+		return false, err
+	}
+
+	_, err = f.Write(data)
+	if err != nil {
+		return false, err
+	}
+
+	return true, nil
+}
@@ -0,0 +1,212 @@
+package handlers_test
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"log/slog"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+
+	"game-forum-abaliyev-ashirbay/internal/handlers"
+	"game-forum-abaliyev-ashirbay/internal/models"
+	"game-forum-abaliyev-ashirbay/internal/storage"
+)
+
+// migrationsDir holds the schema goose applies in production. Specs run
+// against it so the two cannot drift apart.
+const migrationsDir = "../../data/migrations"
+
+// newTestDB opens a database in a temporary directory with the Up part of
+// every migration applied. It is closed when the spec ends. Unless sqlite was
+// built with FTS5 (-tags sqlite_fts5), the search index is left out.
+func newTestDB() *sql.DB {
+	db, err := sql.Open("sqlite3", filepath.Join(ginkgo.GinkgoT().TempDir(), "forum.db"))
+	gomega.Expect(err).ToNot(gomega.HaveOccurred())
+	ginkgo.DeferCleanup(db.Close)
+
+	files, err := filepath.Glob(filepath.Join(migrationsDir, "*.sql"))
+	gomega.Expect(err).ToNot(gomega.HaveOccurred())
+	gomega.Expect(files).ToNot(gomega.BeEmpty())
+	sort.Strings(files)
+
+	for _, file := range files {
+		up, err := migrationUp(file)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		_, err = db.Exec(up)
+		if err != nil && strings.Contains(err.Error(), "no such module: fts5") {
+			continue
+		}
+		gomega.Expect(err).ToNot(gomega.HaveOccurred(), file)
+	}
+
+	return db
+}
+
+// migrationUp returns the statements between the goose Up and Down markers.
+func migrationUp(path string) (string, error) {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		return "", err
+	}
+	s := string(b)
+
+	start := strings.Index(s, "-- +goose Up")
+	if start < 0 {
+		return "", fmt.Errorf("%s: no goose Up section", path)
+	}
+	end := strings.Index(s, "-- +goose Down")
+	if end < start {
+		end = len(s)
+	}
+
+	return s[start:end], nil
+}
+
+// testApp is an Application with every model on a fresh migrated database,
+// keeping images and avatars in a temporary directory. Handler serves its
+// routes as if every request came from the address given to newTestApp:
+// routes rate limit by address across the whole suite, so every Describe
+// uses its own.
+type testApp struct {
+	*handlers.Application
+	DB       *sql.DB
+	Sessions *models.SessionModel
+	Handler  http.Handler
+}
+
+func newTestApp(ip string) *testApp {
+	db := newTestDB()
+
+	templateCache, err := handlers.NewTemplateCache()
+	gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+	addr := ":8433"
+	postReactions := &models.PostReactionsModel{DB: db}
+	sessions := &models.SessionModel{DB: db}
+	app := &handlers.Application{
+		Addr:          &addr,
+		Logger:        slog.New(slog.NewTextHandler(ginkgo.GinkgoWriter, nil)),
+		TemplateCache: templateCache,
+
+		Categories:        &models.CategoriesModel{DB: db},
+		Posts:             &models.PostModel{DB: db, PostReactionsModel: postReactions},
+		Users:             &models.UserModel{DB: db},
+		Session:           sessions,
+		PostReactions:     postReactions,
+		Comments:          &models.CommentsModel{DB: db},
+		CommentsReactions: &models.CommentsReactionsModel{DB: db},
+		PromotionRequests: &models.PromotionRequestsModel{DB: db},
+		Reports:           &models.ReportsModel{DB: db},
+		ReportReasons:     &models.ReportReasonsModel{DB: db},
+		OAuthStates:       &models.OAuthStatesModel{DB: db},
+		UserIdentities:    &models.UserIdentitiesModel{DB: db},
+		UserTokens:        &models.UserTokensModel{DB: db},
+		Notifications:     &models.NotificationsModel{DB: db},
+		Search:            &models.SearchModel{DB: db},
+		ApiTokens:         &models.ApiTokensModel{DB: db},
+		Suspensions:       &models.SuspensionsModel{DB: db},
+		TwoFactor:         &models.TwoFactorModel{DB: db},
+		LoginChallenges:   &models.LoginChallengesModel{DB: db},
+		LoginAttempts:     &models.LoginAttemptsModel{DB: db},
+		Profiles:          &models.ProfilesModel{DB: db},
+		PostAttachments:   &models.PostAttachmentsModel{DB: db},
+		PostRevisions:     &models.PostRevisionsModel{DB: db},
+		Trash:             &models.TrashModel{DB: db},
+
+		Images: storage.NewLocalStore(ginkgo.GinkgoT().TempDir()),
+	}
+
+	return &testApp{
+		Application: app,
+		DB:          db,
+		Sessions:    sessions,
+		Handler:     fromIP(app.Routes(), ip),
+	}
+}
+
+// testSession is a logged in browser: its session cookie and the CSRF token
+// its forms carry.
+type testSession struct {
+	Cookie *http.Cookie
+	CSRF   string
+}
+
+// login starts a session named token for the user.
+func (a *testApp) login(userID int, token string) *testSession {
+	_, err := a.Sessions.Insert(token, userID, time.Hour, "test", "127.0.0.1")
+	gomega.Expect(err).ToNot(gomega.HaveOccurred())
+	csrf, err := a.Sessions.GetCSRFToken(token)
+	gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+	return &testSession{Cookie: &http.Cookie{Name: "token", Value: token}, CSRF: csrf}
+}
+
+// do serves req as s, or anonymously when s is nil.
+func (a *testApp) do(s *testSession, req *http.Request) *httptest.ResponseRecorder {
+	if s != nil {
+		req.AddCookie(s.Cookie)
+	}
+	rr := httptest.NewRecorder()
+	a.Handler.ServeHTTP(rr, req)
+	return rr
+}
+
+func (a *testApp) get(s *testSession, path string) *httptest.ResponseRecorder {
+	return a.do(s, httptest.NewRequest(http.MethodGet, path, nil))
+}
+
+// postForm submits form to path like a browser would, with the session's
+// CSRF token.
+func (a *testApp) postForm(s *testSession, path string, form url.Values) *httptest.ResponseRecorder {
+	if form == nil {
+		form = url.Values{}
+	}
+	if s != nil {
+		form.Set("csrf_token", s.CSRF)
+	}
+	req := httptest.NewRequest(http.MethodPost, path, strings.NewReader(form.Encode()))
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return a.do(s, req)
+}
+
+// upload is a file sent with a multipart form.
+type upload struct {
+	filename string
+	data     []byte
+}
+
+// postMultipart submits fields like a form with enctype="multipart/form-data",
+// with the session's CSRF token and the uploads as files named fileField.
+func (a *testApp) postMultipart(s *testSession, path string, fields map[string]string, fileField string, uploads ...upload) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	if s != nil {
+		gomega.Expect(mw.WriteField("csrf_token", s.CSRF)).To(gomega.Succeed())
+	}
+	for name, value := range fields {
+		gomega.Expect(mw.WriteField(name, value)).To(gomega.Succeed())
+	}
+	for _, u := range uploads {
+		fw, err := mw.CreateFormFile(fileField, u.filename)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		_, err = fw.Write(u.data)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+	}
+	gomega.Expect(mw.Close()).To(gomega.Succeed())
+
+	req := httptest.NewRequest(http.MethodPost, path, &body)
+	req.Header.Set("Content-Type", mw.FormDataContentType())
+	return a.do(s, req)
+}
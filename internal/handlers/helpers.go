@@ -4,11 +4,9 @@ import (
 	"bytes"
 	"errors"
 	"fmt"
+	"game-forum-abaliyev-ashirbay/internal/models"
 	"net/http"
-	"path/filepath"
-	"strings"
 
-	"github.com/gofrs/uuid"
 	"golang.org/x/crypto/bcrypt"
 )
 
@@ -62,10 +60,13 @@ func (app *Application) render(w http.ResponseWriter, r *http.Request, status in
 			app.serverError(w, r, err)
 		}
 
+		data.CSRFToken = app.csrfToken(r)
 	} else {
 		data.IsAuthenticated = false
 	}
 
+	data.OAuthProviders = app.OAuthProviders
+
 	ts, ok := app.TemplateCache[page]
 	if !ok {
 		err := fmt.Errorf("the template %s does not exist", page)
@@ -101,6 +102,18 @@ func (app *Application) compareHashPassword(password, hashedPassword string) err
 }
 
 func (app *Application) getAuthenticatedUserID(r *http.Request) (int, error) {
+	if user, ok := r.Context().Value(userContextKey).(*models.User); ok {
+		return user.ID, nil
+	}
+
+	if r.Header.Get("Authorization") != "" {
+		user, _, err := app.authenticate(r)
+		if err != nil {
+			return 0, errors.New("invalid api token")
+		}
+		return user.ID, nil
+	}
+
 	tokenCookie, err := r.Cookie("token")
 	if err != nil || tokenCookie.Value == "" {
 		return 0, errors.New("user not authenticated")
@@ -116,24 +129,40 @@ func (app *Application) getAuthenticatedUserID(r *http.Request) (int, error) {
 	return userID, nil
 }
 
-func isAllowedImageExt(filename string) bool {
-	ext := strings.ToLower(filepath.Ext(filename))
-	switch ext {
-	case ".jpg", ".jpeg", ".png", ".gif", ".svg":
-		return true
+// visiblePages returns the page numbers shown in the pagination bar: up to
+// seven pages starting three before the current one.
+func visiblePages(page, totalPages int) []int {
+	startPage := page - 3
+	if startPage < 1 {
+		startPage = 1
 	}
-	return false
+	endPage := startPage + 6
+	if endPage > totalPages {
+		endPage = totalPages
+	}
+	pages := make([]int, 0, max(endPage-startPage+1, 0))
+	for i := startPage; i <= endPage; i++ {
+		pages = append(pages, i)
+	}
+	return pages
 }
 
-func generateUniqueFileName(originalFilename string) (string, error) {
-	ext := strings.ToLower(filepath.Ext(originalFilename))
+// authenticatedUser loads the logged in user, writing the error response
+// when that fails.
+func (app *Application) authenticatedUser(w http.ResponseWriter, r *http.Request) (*models.User, bool) {
+	userID, err := app.getAuthenticatedUserID(r)
+	if err != nil {
+		app.notAuthenticated(w, r)
+		return nil, false
+	}
 
-	u, err := uuid.NewV4()
+	user, err := app.Users.GetById(userID)
 	if err != nil {
-		return "", err
+		app.serverError(w, r, err)
+		return nil, false
 	}
 
-	return u.String() + ext, nil
+	return user, true
 }
 
 func contains(roles []string, role string) bool {
@@ -57,18 +57,7 @@ func (app *Application) home(w http.ResponseWriter, r *http.Request) {
 
 	totalPages := int(math.Ceil(float64(totalPosts) / float64(pageSize)))
 
-	startPage := page - 3
-	if startPage < 1 {
-		startPage = 1
-	}
-	endPage := startPage + 6
-	if endPage > totalPages {
-		endPage = totalPages
-	}
-	visiblePages := make([]int, 0, endPage-startPage+1)
-	for i := startPage; i <= endPage; i++ {
-		visiblePages = append(visiblePages, i)
-	}
+	visiblePages := visiblePages(page, totalPages)
 
 	categories, err := app.Categories.GetAll()
 	if err != nil {
@@ -0,0 +1,182 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"game-forum-abaliyev-ashirbay/internal/models"
+	"game-forum-abaliyev-ashirbay/internal/oauth"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// linkedAccount is a row of the linked accounts table on the personal page.
+// Identity is nil when the user has not linked the provider yet, Configured
+// is false for identities of providers that were removed from the config.
+type linkedAccount struct {
+	Name        string
+	DisplayName string
+	Identity    *models.UserIdentity
+	Configured  bool
+}
+
+func (app *Application) linkedAccounts(userID int) ([]linkedAccount, error) {
+	identities, err := app.UserIdentities.GetAllByUserId(userID)
+	if err != nil {
+		return nil, err
+	}
+
+	byProvider := map[string]*models.UserIdentity{}
+	for _, i := range identities {
+		byProvider[i.Provider] = i
+	}
+
+	var accounts []linkedAccount
+	for _, p := range app.OAuthProviders {
+		accounts = append(accounts, linkedAccount{
+			Name:        p.Name(),
+			DisplayName: p.DisplayName(),
+			Identity:    byProvider[p.Name()],
+			Configured:  true,
+		})
+		delete(byProvider, p.Name())
+	}
+	for _, i := range identities {
+		if byProvider[i.Provider] != nil {
+			accounts = append(accounts, linkedAccount{Name: i.Provider, DisplayName: i.Provider, Identity: i})
+		}
+	}
+
+	return accounts, nil
+}
+
+func (app *Application) identityLink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := app.getAuthenticatedUserID(r)
+	if err != nil {
+		app.notAuthenticated(w, r)
+		return
+	}
+
+	var provider oauth.Provider
+	for _, p := range app.OAuthProviders {
+		if p.Name() == r.URL.Query().Get("provider") {
+			provider = p
+		}
+	}
+	if provider == nil {
+		app.notFound(w, r)
+		return
+	}
+
+	state, codeChallenge, err := app.beginOAuth(w, provider.Name(), provider.UsesPKCE(), userID, false)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, provider.AuthCodeURL(state, codeChallenge, app.oauthRedirectURI(provider)), http.StatusSeeOther)
+}
+
+// linkIdentity finishes linking an external account started from the
+// personal page of userID.
+func (app *Application) linkIdentity(w http.ResponseWriter, r *http.Request, provider oauth.Provider, userID int, info *oauth.UserInfo) {
+	// The callback has to come back to the browser of the user who asked
+	// for the link, not just to someone holding the state
+	currentID, err := app.getAuthenticatedUserID(r)
+	if err != nil || currentID != userID {
+		app.clientError(w, r, http.StatusForbidden)
+		return
+	}
+
+	identity, err := app.UserIdentities.GetByProviderSubject(provider.Name(), info.Subject)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+	if identity != nil {
+		if identity.UserID == userID {
+			http.Redirect(w, r, "/user/personal-page", http.StatusSeeOther)
+			return
+		}
+		app.linkIdentityError(w, r, userID, fmt.Sprintf("This %s account is already linked to another user", provider.DisplayName()))
+		return
+	}
+
+	_, err = app.UserIdentities.Insert(userID, provider.Name(), info.Subject, strings.ToLower(info.Email))
+	if errors.Is(err, models.ErrDuplicateIdentity) {
+		app.linkIdentityError(w, r, userID, fmt.Sprintf("You already linked a %s account, unlink it first", provider.DisplayName()))
+		return
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/user/personal-page", http.StatusSeeOther)
+}
+
+func (app *Application) linkIdentityError(w http.ResponseWriter, r *http.Request, userID int, message string) {
+	data, err := app.personalPageData(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data.FormErrors = map[string]string{"identities": message}
+	app.render(w, r, http.StatusUnprocessableEntity, "personal_page.html", data)
+}
+
+func (app *Application) identityUnlink(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	userID, err := app.getAuthenticatedUserID(r)
+	if err != nil {
+		app.notAuthenticated(w, r)
+		return
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	user, err := app.Users.GetById(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	identities, err := app.UserIdentities.GetAllByUserId(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Users who signed up through a provider have no password, their last
+	// identity is the only way back into the account
+	if user.Password == "" && len(identities) == 1 && identities[0].ID == id {
+		app.linkIdentityError(w, r, userID, "Set a password before unlinking your last login method")
+		return
+	}
+
+	err = app.UserIdentities.Delete(id, userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/user/personal-page", http.StatusSeeOther)
+}
@@ -0,0 +1,318 @@
+package handlers
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"game-forum-abaliyev-ashirbay/internal/imaging"
+	"game-forum-abaliyev-ashirbay/internal/storage"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+const (
+	maxImageBytes   = 15 << 20
+	defaultImageDir = "./data/imgs"
+
+	maxAttachments       = 10
+	maxAttachmentCaption = 200
+
+	// maxPostBody bounds a post form with all its images
+	maxPostBody = maxAttachments*maxImageBytes + 1<<20
+)
+
+// readImage reads and processes an uploaded image. The errors of imaging
+// are the uploader's fault, see imageError.
+func readImage(file io.Reader) (*imaging.Image, error) {
+	data, err := io.ReadAll(io.LimitReader(file, maxImageBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if len(data) > maxImageBytes {
+		return nil, imaging.ErrTooLarge
+	}
+
+	return imaging.Process(data)
+}
+
+// readUploads processes the images uploaded in the form field "images" of
+// a parsed multipart form, which has room for slots more attachments. The
+// message says why the uploads were not accepted. Too many of them are
+// refused before any is decoded.
+func readUploads(r *http.Request, slots int) ([]*imaging.Image, string, error) {
+	var headers []*multipart.FileHeader
+	for _, header := range r.MultipartForm.File["images"] {
+		// Browsers send an empty part when no file was chosen
+		if header.Filename == "" && header.Size == 0 {
+			continue
+		}
+		headers = append(headers, header)
+	}
+
+	if len(headers) > slots {
+		return nil, fmt.Sprintf("A post can have at most %d images", maxAttachments), nil
+	}
+
+	var imgs []*imaging.Image
+	for _, header := range headers {
+		file, err := header.Open()
+		if err != nil {
+			return nil, "", err
+		}
+		img, err := readImage(file)
+		file.Close()
+		if err != nil {
+			message, ok := imageError(err)
+			if !ok {
+				return nil, "", err
+			}
+			return nil, header.Filename + ": " + message, nil
+		}
+
+		imgs = append(imgs, img)
+	}
+
+	return imgs, "", nil
+}
+
+// attachImages stores imgs and attaches them to the post after its existing
+// attachments.
+func (app *Application) attachImages(postID int, imgs []*imaging.Image) error {
+	for _, img := range imgs {
+		name, err := app.saveImage(img)
+		if err != nil {
+			return err
+		}
+
+		_, err = app.PostAttachments.Insert(postID, name, "")
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// imageError returns the message for an upload that was not accepted, false
+// for other errors.
+func imageError(err error) (string, bool) {
+	switch {
+	case errors.Is(err, imaging.ErrFormat):
+		return "Only JPEG, PNG or GIF images are allowed", true
+	case errors.Is(err, imaging.ErrTooLarge):
+		return "The image must not be larger than 15MB or 6000x4000 pixels", true
+	}
+	return "", false
+}
+
+// images returns where post images are kept, ./data/imgs on the local disk
+// unless Images is set.
+func (app *Application) images() storage.Store {
+	if app.Images == nil {
+		return storage.NewLocalStore(defaultImageDir)
+	}
+	return app.Images
+}
+
+// thumbnailName is the name the thumbnail of image name is stored under.
+func thumbnailName(name string) string {
+	return "thumbs/" + strings.TrimSuffix(name, path.Ext(name)) + ".jpg"
+}
+
+// rasterImage reports whether the image stored as name can have a
+// thumbnail. Old uploads may be SVGs.
+func rasterImage(name string) bool {
+	switch strings.ToLower(path.Ext(name)) {
+	case ".jpg", ".jpeg", ".png", ".gif":
+		return true
+	}
+	return false
+}
+
+// thumbnailURL is where the thumbnail of a post image is served, empty for
+// images without one.
+func thumbnailURL(name string) string {
+	if name == "" || !rasterImage(name) {
+		return ""
+	}
+	return "/imgs/thumbs/" + name
+}
+
+// saveImage stores a processed upload with its thumbnail and returns its
+// name. Names come from the content, so an image posted twice is stored
+// once.
+func (app *Application) saveImage(img *imaging.Image) (string, error) {
+	name := storage.ContentName(img.Data, img.Ext)
+
+	err := app.images().Put(name, img.Data)
+	if err != nil {
+		return "", err
+	}
+
+	err = app.images().Put(thumbnailName(name), img.Thumbnail)
+	if err != nil {
+		return "", err
+	}
+
+	return name, nil
+}
+
+// releaseImage deletes a post image and its thumbnail once no post shows it
+// any more. Call it after the post stopped using the image. Failures are only
+// logged, sweepImages gets another go at it.
+func (app *Application) releaseImage(name string) {
+	inUse, err := app.Posts.ImageInUse(name)
+	if err != nil {
+		app.Logger.Error("could not check image use", "name", name, "error", err)
+		return
+	}
+	if inUse {
+		return
+	}
+
+	for _, n := range []string{name, thumbnailName(name)} {
+		err = app.images().Delete(n)
+		if err != nil {
+			app.Logger.Error("Error deleting image file", "name", n, "error", err)
+		}
+	}
+}
+
+// SweepImages deletes stored images and thumbnails that no post shows.
+// Objects changed after olderThan are kept, their post may still be on its
+// way into the database, and so are avatars. It returns the number of
+// objects deleted.
+func (app *Application) SweepImages(olderThan time.Time) (int, error) {
+	names, err := app.Posts.ImageNames()
+	if err != nil {
+		return 0, err
+	}
+	used := make(map[string]bool, 2*len(names))
+	for _, name := range names {
+		used[name] = true
+		used[thumbnailName(name)] = true
+	}
+
+	// Listed after the query: an upload reusing an old object touches it
+	// first, so it is seen as new here
+	objects, err := app.images().List()
+	if err != nil {
+		return 0, err
+	}
+
+	deleted := 0
+	for _, obj := range objects {
+		if used[obj.Name] || obj.ModTime.After(olderThan) || strings.HasPrefix(obj.Name, avatarPrefix) {
+			continue
+		}
+		err = app.images().Delete(obj.Name)
+		if err != nil {
+			return deleted, err
+		}
+		deleted++
+	}
+
+	return deleted, nil
+}
+
+// imageHeaders keeps uploaded files from running scripts when opened
+// directly, such as SVGs uploaded before they were rejected.
+func imageHeaders(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Security-Policy", "default-src 'none'; style-src 'unsafe-inline'; sandbox")
+		w.Header().Set("X-Content-Type-Options", "nosniff")
+		next.ServeHTTP(w, r)
+	})
+}
+
+// postImage serves a post image from storage.
+func (app *Application) postImage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.PathValue("name")
+	if !storage.ValidName(name) {
+		app.notFound(w, r)
+		return
+	}
+
+	data, err := app.images().Get(name)
+	if err != nil {
+		if errors.Is(err, storage.ErrNotExist) {
+			app.notFound(w, r)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	contentType := mime.TypeByExtension(strings.ToLower(path.Ext(name)))
+	if contentType == "" {
+		contentType = "application/octet-stream"
+	}
+	w.Header().Set("Content-Type", contentType)
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+// postThumbnail serves the thumbnail of a post image. Images uploaded before
+// thumbnails existed get theirs made on the first request.
+func (app *Application) postThumbnail(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet && r.Method != http.MethodHead {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	name := r.PathValue("name")
+	if !storage.ValidName(name) || strings.HasPrefix(name, ".") || !rasterImage(name) {
+		app.notFound(w, r)
+		return
+	}
+
+	data, err := app.images().Get(thumbnailName(name))
+	if errors.Is(err, storage.ErrNotExist) {
+		data, err = app.makeThumbnail(name)
+		if err != nil {
+			if errors.Is(err, storage.ErrNotExist) {
+				app.notFound(w, r)
+				return
+			}
+			if _, ok := imageError(err); ok {
+				app.notFound(w, r)
+				return
+			}
+		}
+	}
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Content-Type", "image/jpeg")
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(data))
+}
+
+func (app *Application) makeThumbnail(name string) ([]byte, error) {
+	original, err := app.images().Get(name)
+	if err != nil {
+		return nil, err
+	}
+
+	img, err := readImage(bytes.NewReader(original))
+	if err != nil {
+		return nil, err
+	}
+
+	err = app.images().Put(thumbnailName(name), img.Thumbnail)
+	if err != nil {
+		return nil, err
+	}
+
+	return img.Thumbnail, nil
+}
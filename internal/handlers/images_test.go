@@ -0,0 +1,372 @@
+package handlers_test
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"encoding/xml"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+
+	"game-forum-abaliyev-ashirbay/internal/storage"
+)
+
+var _ = ginkgo.Describe("Post images", func() {
+	var (
+		app      *testApp
+		imageDir string
+		player   *testSession
+	)
+
+	ginkgo.BeforeEach(func() {
+		app = newTestApp("198.51.100.8")
+		imageDir = ginkgo.GinkgoT().TempDir()
+		app.Images = storage.NewLocalStore(imageDir)
+
+		_, err := app.DB.Exec(`
+		INSERT INTO Categories (name) VALUES ('Speedruns');
+		INSERT INTO Users (id, email, username, password, role, created_at)
+		VALUES (1, 'player@example.com', 'player', '', 'user', '2026-01-02 10:00:00');
+		`)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		player = app.login(1, "player-session")
+	})
+
+	postForm := func(path string, fields map[string]string, uploads ...upload) *httptest.ResponseRecorder {
+		return app.postMultipart(player, path, fields, "images", uploads...)
+	}
+
+	postFields := map[string]string{
+		"title":       "Any% route",
+		"category_id": "1",
+		"content":     "The new skip saves twelve seconds.",
+	}
+
+	createPost := func(uploads ...upload) *httptest.ResponseRecorder {
+		return postForm("/post/create/post", postFields, uploads...)
+	}
+
+	storedImage := func() string {
+		var name string
+		gomega.Expect(app.DB.QueryRow(`SELECT imgUrl FROM Posts ORDER BY id DESC LIMIT 1`).Scan(&name)).To(gomega.Succeed())
+		return name
+	}
+
+	deletePost := func(id string) {
+		req := httptest.NewRequest(http.MethodPost, "/post/delete?id="+id, nil)
+		req.Header.Set("X-CSRF-Token", player.CSRF)
+		gomega.Expect(app.do(player, req).Code).To(gomega.Equal(http.StatusSeeOther))
+	}
+
+	pngImage := func(width, height int) []byte {
+		var buf bytes.Buffer
+		gomega.Expect(png.Encode(&buf, image.NewRGBA(image.Rect(0, 0, width, height)))).To(gomega.Succeed())
+		return buf.Bytes()
+	}
+
+	ginkgo.It("re-encodes uploads without their metadata and turns them upright", func() {
+		var jpg bytes.Buffer
+		gomega.Expect(jpeg.Encode(&jpg, image.NewRGBA(image.Rect(0, 0, 40, 20)), nil)).To(gomega.Succeed())
+
+		// An EXIF block saying the camera was turned, with a GPS note behind it
+		tiff := []byte("MM\x00\x2a\x00\x00\x00\x08\x00\x01\x01\x12\x00\x03\x00\x00\x00\x01\x00\x06\x00\x00\x00\x00\x00\x00GPS 51.5N 0.1W")
+		app1 := append([]byte("Exif\x00\x00"), tiff...)
+		segment := []byte{0xFF, 0xE1, 0, 0}
+		binary.BigEndian.PutUint16(segment[2:], uint16(len(app1)+2))
+		photo := append([]byte{0xFF, 0xD8}, segment...)
+		photo = append(photo, app1...)
+		photo = append(photo, jpg.Bytes()[2:]...)
+
+		rr := createPost(upload{"IMG_0001.jpeg", photo})
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+
+		name := storedImage()
+		gomega.Expect(filepath.Ext(name)).To(gomega.Equal(".jpg"))
+		stored, err := os.ReadFile(filepath.Join(imageDir, name))
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		gomega.Expect(string(stored)).ToNot(gomega.ContainSubstring("GPS"))
+		gomega.Expect(string(stored)).ToNot(gomega.ContainSubstring("Exif"))
+
+		config, err := jpeg.DecodeConfig(bytes.NewReader(stored))
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		gomega.Expect([]int{config.Width, config.Height}).To(gomega.Equal([]int{20, 40}))
+	})
+
+	ginkgo.It("rejects files that are not what their name says", func() {
+		svg := []byte(`<svg xmlns="http://www.w3.org/2000/svg"><script>alert(1)</script></svg>`)
+		gomega.Expect(createPost(upload{"cat.svg", svg}).Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+
+		rr := createPost(upload{"cat.png", svg})
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("Only JPEG, PNG or GIF images are allowed"))
+
+		var posts int
+		gomega.Expect(app.DB.QueryRow(`SELECT COUNT(*) FROM Posts`).Scan(&posts)).To(gomega.Succeed())
+		gomega.Expect(posts).To(gomega.Equal(0))
+		files, err := os.ReadDir(imageDir)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		gomega.Expect(files).To(gomega.BeEmpty())
+	})
+
+	ginkgo.It("stores the real format and serves a thumbnail for the feed", func() {
+		img := image.NewRGBA(image.Rect(0, 0, 1200, 600))
+		for y := 0; y < 600; y++ {
+			for x := 0; x < 1200; x++ {
+				img.Set(x, y, color.RGBA{R: 200, A: 255})
+			}
+		}
+		var buf bytes.Buffer
+		gomega.Expect(png.Encode(&buf, img)).To(gomega.Succeed())
+
+		// A PNG renamed to .gif with something appended is kept as a PNG
+		rr := createPost(upload{"boss.gif", append(buf.Bytes(), []byte("<?php system($_GET['c']); ?>")...)})
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+
+		name := storedImage()
+		gomega.Expect(filepath.Ext(name)).To(gomega.Equal(".png"))
+		stored, err := os.ReadFile(filepath.Join(imageDir, name))
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		gomega.Expect(string(stored)).ToNot(gomega.ContainSubstring("php"))
+
+		req := httptest.NewRequest(http.MethodGet, "/imgs/thumbs/"+name, nil)
+		rr = httptest.NewRecorder()
+		app.Handler.ServeHTTP(rr, req)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(rr.Header().Get("Content-Type")).To(gomega.Equal("image/jpeg"))
+		config, err := jpeg.DecodeConfig(rr.Body)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		gomega.Expect([]int{config.Width, config.Height}).To(gomega.Equal([]int{320, 160}))
+
+		req = httptest.NewRequest(http.MethodGet, "/imgs/"+name, nil)
+		rr = httptest.NewRecorder()
+		app.Handler.ServeHTTP(rr, req)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(rr.Header().Get("Content-Security-Policy")).To(gomega.ContainSubstring("sandbox"))
+	})
+
+	ginkgo.It("shows several images as a gallery and edits them one by one", func() {
+		rr := createPost(upload{"a.png", pngImage(10, 10)}, upload{"b.png", pngImage(20, 20)}, upload{"c.png", pngImage(30, 30)})
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+
+		type attachment struct {
+			id      int
+			name    string
+			caption string
+		}
+		attachments := func() []attachment {
+			rows, err := app.DB.Query(`SELECT id, name, caption FROM Post_Attachments WHERE post_id = 1 ORDER BY position, id`)
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+			defer rows.Close()
+			var list []attachment
+			for rows.Next() {
+				var a attachment
+				gomega.Expect(rows.Scan(&a.id, &a.name, &a.caption)).To(gomega.Succeed())
+				list = append(list, a)
+			}
+			return list
+		}
+		before := attachments()
+		gomega.Expect(before).To(gomega.HaveLen(3))
+		gomega.Expect(storedImage()).To(gomega.Equal(before[0].name))
+
+		rr = app.get(player, "/post/view?id=1")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(strings.Count(rr.Body.String(), `class="post-gallery-item"`)).To(gomega.Equal(3))
+
+		fields := map[string]string{
+			fmt.Sprintf("remove_%d", before[0].id):   "1",
+			fmt.Sprintf("caption_%d", before[1].id):  "Boss room",
+			fmt.Sprintf("position_%d", before[1].id): "5",
+			fmt.Sprintf("position_%d", before[2].id): "2",
+		}
+		for name, value := range postFields {
+			fields[name] = value
+		}
+		rr = postForm("/post/edit/post?id=1", fields, upload{"d.png", pngImage(40, 40)})
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+
+		after := attachments()
+		gomega.Expect(after).To(gomega.HaveLen(3))
+		gomega.Expect(after[0].id).To(gomega.Equal(before[2].id))
+		gomega.Expect(after[1]).To(gomega.Equal(attachment{id: before[1].id, name: before[1].name, caption: "Boss room"}))
+		gomega.Expect(after[2].id).To(gomega.BeNumerically(">", before[2].id))
+		gomega.Expect(storedImage()).To(gomega.Equal(before[2].name))
+		gomega.Expect(filepath.Join(imageDir, before[0].name)).ToNot(gomega.BeAnExistingFile())
+
+		// Uploads are counted before any is decoded, the broken last one
+		// is never looked at
+		uploads := make([]upload, 8)
+		for i := range uploads {
+			uploads[i] = upload{fmt.Sprintf("%d.png", i), pngImage(i+1, 1)}
+		}
+		uploads[7].data = []byte("not an image")
+		rr = postForm("/post/edit/post?id=1", fields, uploads...)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("A post can have at most 10 images"))
+		gomega.Expect(rr.Body.String()).ToNot(gomega.ContainSubstring("Only JPEG, PNG or GIF images are allowed"))
+		gomega.Expect(attachments()).To(gomega.Equal(after))
+
+		uploads = append(uploads, uploads[:3]...)
+		rr = createPost(uploads...)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("A post can have at most 10 images"))
+		gomega.Expect(rr.Body.String()).ToNot(gomega.ContainSubstring("Only JPEG, PNG or GIF images are allowed"))
+	})
+
+	ginkgo.It("keeps an image posted twice once and deletes it when the last post is purged", func() {
+		gomega.Expect(createPost(upload{"a.png", pngImage(30, 30)}).Code).To(gomega.Equal(http.StatusSeeOther))
+		first := storedImage()
+		gomega.Expect(createPost(upload{"b.png", pngImage(30, 30)}).Code).To(gomega.Equal(http.StatusSeeOther))
+		gomega.Expect(storedImage()).To(gomega.Equal(first))
+
+		thumbnail := filepath.Join(imageDir, "thumbs", strings.TrimSuffix(first, ".png")+".jpg")
+		gomega.Expect(thumbnail).To(gomega.BeAnExistingFile())
+
+		deletePost("1")
+		gomega.Expect(filepath.Join(imageDir, first)).To(gomega.BeAnExistingFile())
+
+		deletePost("2")
+		gomega.Expect(filepath.Join(imageDir, first)).To(gomega.BeAnExistingFile())
+
+		purged, err := app.PurgeTrash(time.Now())
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		gomega.Expect(purged).To(gomega.Equal(2))
+		gomega.Expect(filepath.Join(imageDir, first)).ToNot(gomega.BeAnExistingFile())
+		gomega.Expect(thumbnail).ToNot(gomega.BeAnExistingFile())
+	})
+
+	ginkgo.It("sweeps old images that no post uses", func() {
+		gomega.Expect(createPost(upload{"a.png", pngImage(30, 30)}).Code).To(gomega.Equal(http.StatusSeeOther))
+		used := storedImage()
+
+		gomega.Expect(os.WriteFile(filepath.Join(imageDir, "orphan.png"), pngImage(5, 5), 0o644)).To(gomega.Succeed())
+		gomega.Expect(os.WriteFile(filepath.Join(imageDir, "thumbs", "orphan.jpg"), []byte("thumb"), 0o644)).To(gomega.Succeed())
+		gomega.Expect(os.WriteFile(filepath.Join(imageDir, "uploading.png"), pngImage(5, 5), 0o644)).To(gomega.Succeed())
+		old := time.Now().Add(-2 * time.Hour)
+		for _, name := range []string{used, "orphan.png", "thumbs/orphan.jpg"} {
+			gomega.Expect(os.Chtimes(filepath.Join(imageDir, name), old, old)).To(gomega.Succeed())
+		}
+
+		deleted, err := app.SweepImages(time.Now().Add(-time.Hour))
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		gomega.Expect(deleted).To(gomega.Equal(2))
+
+		gomega.Expect(filepath.Join(imageDir, used)).To(gomega.BeAnExistingFile())
+		gomega.Expect(filepath.Join(imageDir, "uploading.png")).To(gomega.BeAnExistingFile())
+		gomega.Expect(filepath.Join(imageDir, "orphan.png")).ToNot(gomega.BeAnExistingFile())
+		gomega.Expect(filepath.Join(imageDir, "thumbs", "orphan.jpg")).ToNot(gomega.BeAnExistingFile())
+	})
+
+	ginkgo.It("keeps images in an S3 compatible bucket", func() {
+		bucket := &fakeS3{bucket: "media", objects: map[string][]byte{}}
+		server := httptest.NewServer(bucket)
+		defer server.Close()
+
+		store, err := storage.NewS3Store(server.URL, "media", "", "minio", "minio-secret", true)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		app.Images = store
+
+		gomega.Expect(createPost(upload{"a.png", pngImage(30, 30)}).Code).To(gomega.Equal(http.StatusSeeOther))
+		name := storedImage()
+		gomega.Expect(bucket.objects).To(gomega.HaveKey(name))
+		gomega.Expect(bucket.objects).To(gomega.HaveKey("thumbs/" + strings.TrimSuffix(name, ".png") + ".jpg"))
+
+		req := httptest.NewRequest(http.MethodGet, "/imgs/"+name, nil)
+		rr := httptest.NewRecorder()
+		app.Handler.ServeHTTP(rr, req)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(rr.Header().Get("Content-Type")).To(gomega.Equal("image/png"))
+		gomega.Expect(rr.Body.Bytes()).To(gomega.Equal(bucket.objects[name]))
+
+		objects, err := store.List()
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		gomega.Expect(objects).To(gomega.HaveLen(2))
+
+		deletePost("1")
+		gomega.Expect(bucket.objects).To(gomega.HaveLen(2))
+
+		_, err = app.PurgeTrash(time.Now())
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		gomega.Expect(bucket.objects).To(gomega.BeEmpty())
+
+		req = httptest.NewRequest(http.MethodGet, "/imgs/"+name, nil)
+		rr = httptest.NewRecorder()
+		app.Handler.ServeHTTP(rr, req)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusNotFound))
+	})
+})
+
+// fakeS3 stands in for a bucket of an S3 compatible service with path-style
+// URLs. It only accepts signed requests whose payload hash matches the body.
+type fakeS3 struct {
+	bucket string
+
+	mu      sync.Mutex
+	objects map[string][]byte
+}
+
+func (f *fakeS3) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	body, _ := io.ReadAll(r.Body)
+	sum := sha256.Sum256(body)
+	if !strings.HasPrefix(r.Header.Get("Authorization"), "AWS4-HMAC-SHA256 Credential=minio/") ||
+		r.Header.Get("X-Amz-Content-Sha256") != hex.EncodeToString(sum[:]) {
+		http.Error(w, "<Error><Code>AccessDenied</Code></Error>", http.StatusForbidden)
+		return
+	}
+
+	key, ok := strings.CutPrefix(r.URL.Path, "/"+f.bucket+"/")
+	if !ok {
+		http.Error(w, "<Error><Code>NoSuchBucket</Code></Error>", http.StatusNotFound)
+		return
+	}
+
+	switch {
+	case r.Method == http.MethodGet && key == "" && r.URL.Query().Get("list-type") == "2":
+		type content struct {
+			Key          string
+			LastModified time.Time
+		}
+		result := struct {
+			XMLName     xml.Name `xml:"ListBucketResult"`
+			Contents    []content
+			IsTruncated bool
+		}{}
+		for k := range f.objects {
+			result.Contents = append(result.Contents, content{Key: k, LastModified: time.Now().UTC()})
+		}
+		xml.NewEncoder(w).Encode(result)
+	case r.Method == http.MethodPut:
+		f.objects[key] = body
+	case r.Method == http.MethodGet:
+		data, ok := f.objects[key]
+		if !ok {
+			http.Error(w, "<Error><Code>NoSuchKey</Code></Error>", http.StatusNotFound)
+			return
+		}
+		w.Write(data)
+	case r.Method == http.MethodDelete:
+		delete(f.objects, key)
+		w.WriteHeader(http.StatusNoContent)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
@@ -8,6 +8,7 @@ import (
 	"game-forum-abaliyev-ashirbay/internal/validator"
 	"net/http"
 	"strings"
+	"time"
 
 	"github.com/gofrs/uuid"
 )
@@ -18,9 +19,14 @@ type UserInfo struct {
 	Email    string `json:"email"`
 }
 
+// defaultSessionLifetime is used when the application was set up without
+// session lifetimes.
+const defaultSessionLifetime = 24 * time.Hour
+
 type loginForm struct {
 	Email       string
 	Password    string
+	Remember    bool
 	FieldErrors map[string]string
 }
 
@@ -52,6 +58,7 @@ func (app *Application) LoginPost(w http.ResponseWriter, r *http.Request) {
 	form := loginForm{
 		Email:    r.PostForm.Get("email"),
 		Password: r.PostForm.Get("password"),
+		Remember: r.PostForm.Get("remember") != "",
 	}
 
 	form.Email = strings.ToLower(form.Email)
@@ -74,21 +81,33 @@ func (app *Application) LoginPost(w http.ResponseWriter, r *http.Request) {
 
 	user, err := app.Users.GetByUsernameOrEmail(form.Email)
 	if err != nil {
-		if err == models.ErrNoRecord {
-			v.AddFieldError("general", "Incorrect email or password")
-			data := templateData{
-				Form:       form,
-				FormErrors: v.FieldErrors,
-			}
-			app.render(w, r, http.StatusUnprocessableEntity, "login.html", data)
+		if !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
 			return
 		}
+		user = nil
+	}
+
+	userID := 0
+	if user != nil {
+		userID = user.ID
+	}
+	blocked, err := app.loginBlocked(w, r, userID, form.Email, "login.html", form)
+	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
+	if blocked {
+		return
+	}
+
+	if user == nil || app.compareHashPassword(form.Password, user.Password) != nil {
+		err = app.recordLoginFailure(r, user, form.Email)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
 
-	err = app.compareHashPassword(form.Password, user.Password)
-	if err != nil {
 		v.AddFieldError("general", "Incorrect email or password")
 		data := templateData{
 			Form:       form,
@@ -98,66 +117,81 @@ func (app *Application) LoginPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	existingToken, err := app.Session.GetByUserId(user.ID)
-	if err != nil {
-		// If there's a real error
-		if errors.Is(err, models.ErrNoRecord) {
-			// No session found, do nothing
-		} else {
-			// Some unexpected error
-			app.serverError(w, r, err)
-			return
-		}
-	} else {
-		// err == nil
-		if existingToken != nil {
-			// There's an existing session for this user
-			// remove it so we create a fresh one
-			app.Session.DeleteByUserId(user.ID)
-			// handle any error from DeleteByUserId if needed
+	// Checked after the password so that it does not tell strangers which
+	// addresses are registered
+	if !user.Enabled {
+		v.AddFieldError("unverified", "Please verify your email address before logging in.")
+		data := templateData{
+			Form:       form,
+			FormErrors: v.FieldErrors,
 		}
+		app.render(w, r, http.StatusForbidden, "login.html", data)
+		return
 	}
 
-	token, err := GenerateToken()
+	suspension, err := app.activeSuspension(user.ID)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
+	if suspension != nil {
+		v.AddFieldError("general", suspensionMessage(suspension))
+		data := templateData{
+			Form:       form,
+			FormErrors: v.FieldErrors,
+		}
+		app.render(w, r, http.StatusForbidden, "login.html", data)
+		return
+	}
 
-	_, err = app.Session.Insert(token, user.ID)
+	app.completeLogin(w, r, user, form.Remember)
+}
+
+// startSession logs the user in on the requesting device. Sessions on other
+// devices are left alone, they are managed from the sessions page.
+func (app *Application) startSession(w http.ResponseWriter, r *http.Request, user *models.User, remember bool) error {
+	token, err := GenerateToken()
 	if err != nil {
-		app.serverError(w, r, err)
-		return
+		return err
+	}
+
+	userAgent := r.UserAgent()
+	if len(userAgent) > 255 {
+		userAgent = userAgent[:255]
+	}
+
+	lifetime := app.SessionLifetime
+	if remember {
+		lifetime = app.RememberLifetime
 	}
-	userInfo := UserInfo{
-		ID:       user.ID,
-		Username: user.Username,
-		Email:    user.Email,
+	if lifetime <= 0 {
+		lifetime = defaultSessionLifetime
 	}
 
-	err = setLoginCookies(r, w, userInfo, token)
+	_, err = app.Session.Insert(token, user.ID, lifetime, userAgent, clientIP(r))
 	if err != nil {
-		app.serverError(w, r, err)
-		return
+		return err
 	}
 
-	http.Redirect(w, r, "/", http.StatusSeeOther)
+	setSessionCookie(w, token, lifetime)
+
+	return app.recordLoginSuccess(r, user)
 }
 
-func setLoginCookies(r *http.Request, w http.ResponseWriter, userInfo UserInfo, token string) error {
+// setSessionCookie sets the "token" cookie to expire together with the
+// session it belongs to.
+func setSessionCookie(w http.ResponseWriter, token string, lifetime time.Duration) {
 	tokenCookie := http.Cookie{
 		Name:     "token",
 		Value:    token,
 		Path:     "/",
-		MaxAge:   24 * 60 * 60 * 60 * 60, // 1 day
+		MaxAge:   int(lifetime.Seconds()),
 		HttpOnly: true,
 		Secure:   true,
 		SameSite: http.SameSiteLaxMode,
 	}
 
 	http.SetCookie(w, &tokenCookie)
-
-	return nil
 }
 
 func GenerateToken() (string, error) {
@@ -192,18 +226,21 @@ func (app *Application) logout(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userId, err := app.getAuthenticatedUserID(r)
+	_, err := app.getAuthenticatedUserID(r)
 	if err != nil {
 
 		http.Redirect(w, r, "/", http.StatusSeeOther)
 		return
 	}
 
-	err = app.Session.DeleteByUserId(userId)
-
-	if err != nil {
-		app.serverError(w, r, err)
-		return
+	// Only end the session of this device, others stay logged in
+	tokenCookie, err := r.Cookie("token")
+	if err == nil {
+		err = app.Session.DeleteByToken(tokenCookie.Value)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
 	}
 
 	deleteCookie := http.Cookie{
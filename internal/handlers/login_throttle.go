@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"fmt"
+	"game-forum-abaliyev-ashirbay/internal/mailer"
+	"game-forum-abaliyev-ashirbay/internal/models"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// Failed logins older than loginFailureWindow are forgotten. After a few
+// free tries every further failure doubles the wait before the next attempt,
+// until the account or IP address is locked out for a while.
+const (
+	loginFailureWindow = time.Hour
+
+	accountFreeFailures = 3
+	accountLockFailures = 10
+	accountLockout      = 15 * time.Minute
+
+	// Higher, as several people can share an address
+	ipFreeFailures = 10
+	ipLockFailures = 50
+	ipLockout      = 15 * time.Minute
+)
+
+// loginRetryAt returns when the next attempt is allowed after failures
+// failed ones, the last made at last. Zero means right away.
+func loginRetryAt(failures int, last time.Time, free int, lock int, lockout time.Duration) time.Time {
+	if failures < free {
+		return time.Time{}
+	}
+	if failures >= lock || failures-free >= 20 {
+		return last.Add(lockout)
+	}
+
+	// Attempts are stored to the second, start at two to always wait
+	delay := 2 * time.Second << (failures - free)
+	if delay > lockout {
+		delay = lockout
+	}
+	return last.Add(delay)
+}
+
+// loginBlockedUntil returns until when logins to the account, or from the
+// IP address of the request, are refused. It is zero or in the past when
+// they are allowed. userID is 0 when the login names no account.
+func (app *Application) loginBlockedUntil(r *http.Request, userID int, login string) (time.Time, error) {
+	failures, last, err := app.LoginAttempts.AccountFailures(userID, login, loginFailureWindow)
+	if err != nil {
+		return time.Time{}, err
+	}
+	until := loginRetryAt(failures, last, accountFreeFailures, accountLockFailures, accountLockout)
+
+	failures, last, err = app.LoginAttempts.IPFailures(clientIP(r), loginFailureWindow)
+	if err != nil {
+		return time.Time{}, err
+	}
+	if ipUntil := loginRetryAt(failures, last, ipFreeFailures, ipLockFailures, ipLockout); ipUntil.After(until) {
+		until = ipUntil
+	}
+
+	return until, nil
+}
+
+// loginBlocked answers a login attempt made too soon and reports whether it
+// did.
+func (app *Application) loginBlocked(w http.ResponseWriter, r *http.Request, userID int, login string, page string, form interface{}) (bool, error) {
+	until, err := app.loginBlockedUntil(r, userID, login)
+	if err != nil {
+		return false, err
+	}
+
+	wait := time.Until(until)
+	if wait <= 0 {
+		return false, nil
+	}
+
+	seconds := int(wait.Round(time.Second).Seconds())
+	if seconds < 1 {
+		seconds = 1
+	}
+	message := fmt.Sprintf("Too many failed login attempts, try again in %d seconds", seconds)
+	if seconds >= 60 {
+		message = fmt.Sprintf("Too many failed login attempts, try again in %d minutes", (seconds+59)/60)
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(seconds))
+	data := templateData{
+		Form:       form,
+		FormErrors: map[string]string{"general": message},
+	}
+	app.render(w, r, http.StatusTooManyRequests, page, data)
+	return true, nil
+}
+
+// recordLoginFailure stores a failed password or code, user is nil when the
+// login names no account. Lockouts are logged and the owner of a locked
+// account gets an email.
+func (app *Application) recordLoginFailure(r *http.Request, user *models.User, login string) error {
+	ip := clientIP(r)
+	userID := 0
+	if user != nil {
+		userID = user.ID
+	}
+
+	err := app.LoginAttempts.Insert(userID, login, ip, false)
+	if err != nil {
+		return err
+	}
+
+	failures, _, err := app.LoginAttempts.AccountFailures(userID, login, loginFailureWindow)
+	if err != nil {
+		return err
+	}
+	if failures == accountLockFailures {
+		app.Logger.Warn("account locked after failed logins", "user_id", userID, "login", login, "ip", ip)
+		if user != nil && app.Mailer != nil {
+			err = app.sendLockoutEmail(user, ip)
+			if err != nil {
+				app.Logger.Error("failed to send lockout email", "user_id", userID, "error", err.Error())
+			}
+		}
+	}
+
+	failures, _, err = app.LoginAttempts.IPFailures(ip, loginFailureWindow)
+	if err != nil {
+		return err
+	}
+	if failures == ipLockFailures {
+		app.Logger.Warn("ip address locked after failed logins", "ip", ip)
+	}
+
+	return nil
+}
+
+// recordLoginSuccess resets the failure count of the account.
+func (app *Application) recordLoginSuccess(r *http.Request, user *models.User) error {
+	return app.LoginAttempts.Insert(user.ID, "", clientIP(r), true)
+}
+
+func (app *Application) sendLockoutEmail(user *models.User, ip string) error {
+	return app.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Failed login attempts on your account",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"There were %d failed attempts to log in to your account, the last one from %s. "+
+			"Logging in is blocked for %d minutes.\n\n"+
+			"If this was not you, someone may be guessing your password. You can choose a new one here:\n\n%s\n",
+			user.Username, accountLockFailures, ip, int(accountLockout.Minutes()), app.absoluteURL("/password/forgot")),
+	})
+}
+
+// loginFailuresView is a row of the failed logins tables of the admin panel.
+type loginFailuresView struct {
+	*models.LoginFailures
+	BlockedUntil time.Time
+}
+
+// loginFailuresData lists recent failed logins by account and by IP
+// address for the admin panel.
+func (app *Application) loginFailuresData() ([]loginFailuresView, []loginFailuresView, error) {
+	byAccount, err := app.LoginAttempts.FailuresByAccount(loginFailureWindow)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	byIP, err := app.LoginAttempts.FailuresByIP(loginFailureWindow)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	now := time.Now()
+	view := func(failures []*models.LoginFailures, free int, lock int, lockout time.Duration) []loginFailuresView {
+		rows := make([]loginFailuresView, 0, len(failures))
+		for _, f := range failures {
+			row := loginFailuresView{LoginFailures: f}
+			if until := loginRetryAt(f.Count, f.Last, free, lock, lockout); until.After(now) {
+				row.BlockedUntil = until
+			}
+			rows = append(rows, row)
+		}
+		return rows
+	}
+
+	return view(byAccount, accountFreeFailures, accountLockFailures, accountLockout),
+		view(byIP, ipFreeFailures, ipLockFailures, ipLockout), nil
+}
@@ -0,0 +1,91 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var _ = ginkgo.Describe("Login throttling", func() {
+	var (
+		app  *testApp
+		mail *recordingMailer
+	)
+
+	ginkgo.BeforeEach(func() {
+		app = newTestApp("198.51.100.2")
+		mail = &recordingMailer{}
+		app.Mailer = mail
+		app.BaseURL = "https://forum.example.com"
+
+		hash, err := bcrypt.GenerateFromPassword([]byte("password1"), bcrypt.MinCost)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		_, err = app.DB.Exec(`INSERT INTO Users (id, email, username, password) VALUES
+			(1, 'alice@example.com', 'alice', ?)`, string(hash))
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+	})
+
+	login := func(email, password string) *httptest.ResponseRecorder {
+		return app.postForm(nil, "/login/post", url.Values{"email": {email}, "password": {password}})
+	}
+
+	// backdate moves all recorded attempts into the past.
+	backdate := func(minutes string) {
+		_, err := app.DB.Exec(`UPDATE Login_Attempts SET created_at = datetime('now', '-' || ? || ' minutes')`, minutes)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+	}
+
+	ginkgo.It("makes guessers wait, even with the right password, and resets after a login", func() {
+		for i := 0; i < 3; i++ {
+			gomega.Expect(login("alice@example.com", "wrong-password").Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+		}
+
+		rr := login("alice@example.com", "password1")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusTooManyRequests))
+		gomega.Expect(rr.Header().Get("Retry-After")).ToNot(gomega.BeEmpty())
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("Too many failed login attempts"))
+
+		var sessions int
+		gomega.Expect(app.DB.QueryRow(`SELECT COUNT(*) FROM Sessions`).Scan(&sessions)).To(gomega.Succeed())
+		gomega.Expect(sessions).To(gomega.Equal(0))
+
+		backdate("1")
+		gomega.Expect(login("alice@example.com", "password1").Code).To(gomega.Equal(http.StatusSeeOther))
+		gomega.Expect(login("alice@example.com", "wrong-password").Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+	})
+
+	ginkgo.It("locks the account and tells the owner once", func() {
+		for i := 0; i < 9; i++ {
+			_, err := app.DB.Exec(`INSERT INTO Login_Attempts (user_id, login, ip, success, created_at)
+				VALUES (1, 'alice@example.com', '203.0.113.7', 0, datetime('now'))`)
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		}
+		backdate("5")
+
+		gomega.Expect(login("alice@example.com", "wrong-password").Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+		gomega.Expect(mail.sent).To(gomega.HaveLen(1))
+		gomega.Expect(mail.sent[0].To).To(gomega.Equal("alice@example.com"))
+		gomega.Expect(mail.sent[0].Body).To(gomega.ContainSubstring("https://forum.example.com/password/forgot"))
+
+		for i := 0; i < 2; i++ {
+			rr := login("alice@example.com", "password1")
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusTooManyRequests))
+			gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("try again in 15 minutes"))
+		}
+		gomega.Expect(mail.sent).To(gomega.HaveLen(1))
+	})
+
+	ginkgo.It("throttles logins of unknown accounts the same way", func() {
+		for i := 0; i < 3; i++ {
+			gomega.Expect(login("nobody@example.com", "password1").Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+		}
+		gomega.Expect(login("nobody@example.com", "password1").Code).To(gomega.Equal(http.StatusTooManyRequests))
+
+		// Other accounts are not affected
+		gomega.Expect(login("alice@example.com", "password1").Code).To(gomega.Equal(http.StatusSeeOther))
+	})
+})
@@ -0,0 +1,87 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Markdown", func() {
+	var (
+		app    *testApp
+		player *testSession
+	)
+
+	ginkgo.BeforeEach(func() {
+		app = newTestApp("198.51.100.9")
+
+		_, err := app.DB.Exec(`
+		INSERT INTO Categories (name) VALUES ('Speedruns');
+		INSERT INTO Users (id, email, username, password, role, created_at)
+		VALUES (1, 'player@example.com', 'player', '', 'user', '2026-01-02 10:00:00');
+		`)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		player = app.login(1, "player-session")
+	})
+
+	preview := func(content string, s *testSession) *httptest.ResponseRecorder {
+		return app.postForm(s, "/post/preview", url.Values{"content": {content}})
+	}
+
+	ginkgo.It("previews the formatting and escapes everything else", func() {
+		rr := preview("**Any%** in *record* time\n\n"+
+			"<script>alert(1)</script>\n\n"+
+			"[route](https://example.com/route) [bad](javascript:alert(1)) [own](/post/view?id=2)\n\n"+
+			"> the boss\n\n"+
+			"- first\n- second\n\n"+
+			"```go\nfmt.Println(\"<b>\")\n```\n\n"+
+			"The end is ||a twist||", player)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(rr.Header().Get("Content-Type")).To(gomega.HavePrefix("text/html"))
+
+		body := rr.Body.String()
+		gomega.Expect(body).To(gomega.ContainSubstring("<strong>Any%</strong> in <em>record</em> time"))
+		gomega.Expect(body).ToNot(gomega.ContainSubstring("<script>"))
+		gomega.Expect(body).To(gomega.ContainSubstring("&lt;script&gt;alert(1)&lt;/script&gt;"))
+		gomega.Expect(body).To(gomega.ContainSubstring(`<a href="https://example.com/route" rel="nofollow ugc noopener">route</a>`))
+		gomega.Expect(body).To(gomega.ContainSubstring("[bad](javascript:alert(1))"))
+		gomega.Expect(body).ToNot(gomega.ContainSubstring(`href="javascript:`))
+		gomega.Expect(body).To(gomega.ContainSubstring(`<a href="/post/view?id=2">own</a>`))
+		gomega.Expect(body).To(gomega.ContainSubstring("<blockquote>"))
+		gomega.Expect(body).To(gomega.ContainSubstring("<ul>\n<li>first</li>\n<li>second</li>\n</ul>"))
+		gomega.Expect(body).To(gomega.ContainSubstring(`<pre><code class="language-go">fmt.Println(&#34;&lt;b&gt;&#34;)</code></pre>`))
+		gomega.Expect(body).To(gomega.ContainSubstring(`<span class="spoiler" tabindex="0">a twist</span>`))
+	})
+
+	ginkgo.It("only previews for signed in members", func() {
+		rr := preview("**hi**", nil)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+		gomega.Expect(rr.Header().Get("Location")).To(gomega.Equal("/login"))
+	})
+
+	ginkgo.It("renders posts and comments but keeps the source for editing", func() {
+		source := "Skip the **second** door <img src=x onerror=alert(1)>"
+		_, err := app.DB.Exec(`
+		INSERT INTO Posts (title, content, imgUrl, createdAt, category_id, owner_id, like_count, dislike_count)
+		VALUES ('Route', ?, '', '2026-01-02 10:00:00', 1, 1, 0, 0);
+		INSERT INTO Comments (post_id, user_id, created_at, text, like_count, dislike_count)
+		VALUES (1, 1, '2026-01-02 11:00:00', 'Works with ||the glitch|| too', 0, 0);
+		`, source)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		rr := app.get(player, "/post/view?id=1")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		body := rr.Body.String()
+		gomega.Expect(body).To(gomega.ContainSubstring("Skip the <strong>second</strong> door &lt;img src=x onerror=alert(1)&gt;"))
+		gomega.Expect(body).ToNot(gomega.ContainSubstring("<img src=x"))
+		gomega.Expect(body).To(gomega.ContainSubstring(`Works with <span class="spoiler" tabindex="0">the glitch</span> too`))
+
+		rr = app.get(player, "/post/edit?id=1")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("Skip the **second** door &lt;img src=x onerror=alert(1)&gt;</textarea>"))
+	})
+})
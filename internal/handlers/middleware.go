@@ -2,7 +2,13 @@ package handlers
 
 import (
 	"context"
+	"crypto/subtle"
+	"errors"
+	"game-forum-abaliyev-ashirbay/internal/models"
+	"mime"
+	"net"
 	"net/http"
+	"strings"
 	"sync"
 	"time"
 )
@@ -11,6 +17,19 @@ type contextKey string
 
 const userContextKey contextKey = "userContextKey"
 
+// apiTokenContextKey holds the personal API token a request was authenticated
+// with, it is nil for requests authenticated by the session cookie.
+const apiTokenContextKey contextKey = "apiTokenContextKey"
+
+// csrfContextKey holds the CSRF token a multipart form still has to carry.
+// csrfProtect leaves that check to the handler, which reads the body only
+// after bounding it.
+const csrfContextKey contextKey = "csrfContextKey"
+
+// apiTokenPrefix starts every personal API token, bearer tokens without it
+// are looked up as session tokens.
+const apiTokenPrefix = "gfp_"
+
 var defaultRoles = []string{"user", "moderator", "admin"}
 
 var (
@@ -31,18 +50,19 @@ func (app *Application) loginMiddware(next http.Handler, roles ...string) http.H
 	}
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		tokenCookie, err := r.Cookie("token")
-		if err != nil {
-			app.Logger.Error(err.Error())
-
-			http.Redirect(w, r, "/login", http.StatusSeeOther)
+		user, apiToken, err := app.authenticate(r)
+		if errors.Is(err, errSuspended) {
+			app.clientError(w, r, http.StatusForbidden)
 			return
 		}
-
-		user, err := app.Users.GetByToken(tokenCookie.Value)
 		if err != nil {
 			app.Logger.Error(err.Error())
 
+			if r.Header.Get("Authorization") != "" {
+				app.notAuthenticated(w, r)
+				return
+			}
+
 			http.Redirect(w, r, "/login", http.StatusSeeOther)
 			return
 		}
@@ -52,11 +72,124 @@ func (app *Application) loginMiddware(next http.Handler, roles ...string) http.H
 			return
 		}
 
+		if apiToken != nil && !apiToken.HasScope(requiredScope(r, roles)) {
+			app.clientError(w, r, http.StatusForbidden)
+			return
+		}
+
+		// Members of roles that require two-factor authentication can only
+		// set it up until they have
+		if apiToken == nil && !strings.HasPrefix(r.URL.Path, "/user/2fa") {
+			missing, err := app.twoFactorMissing(user)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+			if missing {
+				http.Redirect(w, r, "/user/2fa", http.StatusSeeOther)
+				return
+			}
+		}
+
 		ctx := context.WithValue(r.Context(), userContextKey, user)
+		ctx = context.WithValue(ctx, apiTokenContextKey, apiToken)
 		next.ServeHTTP(w, r.WithContext(ctx))
 	})
 }
 
+// authenticate resolves the user behind a request from the
+// "Authorization: Bearer" header or, without one, from the "token" session
+// cookie. The returned API token is nil for session authentication.
+func (app *Application) authenticate(r *http.Request) (*models.User, *models.ApiToken, error) {
+	var token string
+
+	if header := r.Header.Get("Authorization"); header != "" {
+		scheme, value, found := strings.Cut(header, " ")
+		if !found || !strings.EqualFold(scheme, "Bearer") {
+			return nil, nil, errors.New("unsupported authorization scheme")
+		}
+		token = strings.TrimSpace(value)
+	} else {
+		tokenCookie, err := r.Cookie("token")
+		if err != nil {
+			return nil, nil, err
+		}
+		token = tokenCookie.Value
+	}
+
+	if token == "" {
+		return nil, nil, models.ErrNoRecord
+	}
+
+	if !strings.HasPrefix(token, apiTokenPrefix) {
+		user, err := app.Users.GetByToken(token)
+		if err != nil {
+			return nil, nil, err
+		}
+		return user, nil, app.checkSuspension(user)
+	}
+
+	apiToken, err := app.ApiTokens.GetByToken(token)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	user, err := app.Users.GetById(apiToken.UserID)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	// Suspending a user ends their sessions but not their API tokens
+	err = app.checkSuspension(user)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	err = app.ApiTokens.UpdateLastUsed(apiToken.ID)
+	if err != nil {
+		app.Logger.Warn(err.Error())
+	}
+
+	return user, apiToken, nil
+}
+
+// requiredScope is the API token scope needed for a request: moderation
+// routes need "moderate", other reads "read" and everything else "write".
+func requiredScope(r *http.Request, roles []string) string {
+	if !contains(roles, "user") {
+		return models.ScopeModerate
+	}
+	if r.Method == http.MethodGet || r.Method == http.MethodHead {
+		return models.ScopeRead
+	}
+	return models.ScopeWrite
+}
+
+// hasScope reports whether the request may act with the given scope.
+// Requests authenticated by the session cookie may do everything.
+func hasScope(r *http.Request, scope string) bool {
+	apiToken, ok := r.Context().Value(apiTokenContextKey).(*models.ApiToken)
+	if !ok || apiToken == nil {
+		return true
+	}
+	return apiToken.HasScope(scope)
+}
+
+// sessionOnly refuses requests authenticated with a personal API token. It
+// guards account management, which a token must not be able to use to mint
+// wider tokens or take the account over. It goes inside loginMiddware.
+func (app *Application) sessionOnly(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		apiToken, _ := r.Context().Value(apiTokenContextKey).(*models.ApiToken)
+		if apiToken != nil {
+			app.clientError(w, r, http.StatusForbidden)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
 func (app *Application) secureHeaders(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
         w.Header().Set("Content-Security-Policy",
@@ -113,5 +246,143 @@ func (app *Application) rateLimitMiddleware(next http.Handler) http.Handler {
 }
 
 func clientIP(r *http.Request) string {
-    return r.RemoteAddr 
-}
\ No newline at end of file
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+// trackSession records when and from where the session cookie of a request
+// was last used, for the sessions page, and renews the session so that it
+// only expires after a full lifetime of inactivity.
+func (app *Application) trackSession(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tokenCookie, err := r.Cookie("token")
+		if err == nil && tokenCookie.Value != "" {
+			lifetime, err := app.Session.Touch(tokenCookie.Value, clientIP(r))
+			if err == nil {
+				setSessionCookie(w, tokenCookie.Value, lifetime)
+			} else if !errors.Is(err, models.ErrNoRecord) {
+				app.Logger.Warn(err.Error())
+			}
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// csrfProtect rejects state-changing requests made with the session cookie
+// unless they carry the session's CSRF token, either in the "csrf_token" form
+// field or in an "X-CSRF-Token" header. Bearer-authenticated requests are let
+// through since browsers never attach those credentials on their own.
+// Multipart bodies are not read here, their handlers bound them first and
+// then call checkFormCSRF.
+func (app *Application) csrfProtect(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		tokenCookie, err := r.Cookie("token")
+		if err != nil || tokenCookie.Value == "" || r.Header.Get("Authorization") != "" {
+			next.ServeHTTP(w, r)
+			return
+		}
+
+		expected, err := app.Session.GetCSRFToken(tokenCookie.Value)
+		if err != nil {
+			if errors.Is(err, models.ErrNoRecord) {
+				// Expired session, the handler treats the request as anonymous
+				next.ServeHTTP(w, r)
+				return
+			}
+			app.serverError(w, r, err)
+			return
+		}
+
+		given := r.Header.Get("X-CSRF-Token")
+		if given == "" {
+			mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+			if mediaType == "multipart/form-data" {
+				if !multipartForms[r.URL.Path] {
+					app.csrfFailed(w, r)
+					return
+				}
+				ctx := context.WithValue(r.Context(), csrfContextKey, expected)
+				next.ServeHTTP(w, r.WithContext(ctx))
+				return
+			}
+
+			r.Body = http.MaxBytesReader(w, r.Body, maxCSRFFormBody)
+			given = r.PostFormValue("csrf_token")
+		}
+
+		if !validCSRFToken(given, expected) {
+			app.csrfFailed(w, r)
+			return
+		}
+
+		next.ServeHTTP(w, r)
+	})
+}
+
+// maxCSRFFormBody bounds the url-encoded forms csrfProtect parses to find the
+// token, handlers with a smaller limit set their own.
+const maxCSRFFormBody = 1 << 20
+
+// multipartForms are the paths whose handlers take multipart/form-data and
+// check its token with checkFormCSRF. Other multipart requests need the
+// X-CSRF-Token header.
+var multipartForms = map[string]bool{
+	"/post/create/post": true,
+	"/post/edit/post":   true,
+	"/user/avatar":      true,
+}
+
+// checkFormCSRF does the check csrfProtect left to the handler of a multipart
+// form, call it once the bounded form is parsed. It sends the error response
+// and returns false when the token is missing or wrong.
+func (app *Application) checkFormCSRF(w http.ResponseWriter, r *http.Request) bool {
+	expected, ok := r.Context().Value(csrfContextKey).(string)
+	if !ok {
+		return true
+	}
+
+	if !validCSRFToken(r.PostFormValue("csrf_token"), expected) {
+		app.csrfFailed(w, r)
+		return false
+	}
+	return true
+}
+
+func validCSRFToken(given, expected string) bool {
+	return given != "" && subtle.ConstantTimeCompare([]byte(given), []byte(expected)) == 1
+}
+
+func (app *Application) csrfFailed(w http.ResponseWriter, r *http.Request) {
+	app.Logger.Warn("csrf token mismatch", "method", r.Method, "uri", r.URL.RequestURI())
+	if strings.HasPrefix(r.URL.Path, "/api/") {
+		app.apiError(w, r, http.StatusForbidden, "missing or invalid CSRF token")
+		return
+	}
+	app.clientError(w, r, http.StatusForbidden)
+}
+
+// csrfToken returns the CSRF token forms rendered for this request have to
+// submit, it is empty for visitors without a session.
+func (app *Application) csrfToken(r *http.Request) string {
+	tokenCookie, err := r.Cookie("token")
+	if err != nil || tokenCookie.Value == "" {
+		return ""
+	}
+
+	csrfToken, err := app.Session.GetCSRFToken(tokenCookie.Value)
+	if err != nil {
+		return ""
+	}
+
+	return csrfToken
+}
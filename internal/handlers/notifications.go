@@ -45,6 +45,7 @@ func (app *Application) notificationsPage(w http.ResponseWriter, r *http.Request
 		notificationViews = append(notificationViews, NotificationView{
 			ID:            n.ID,
 			Type:          n.Type,
+			ActorID:       n.Actor_ID,
 			ActorUsername: actorName,
 			PostID:        n.Post_ID,
 			CommentText:   commentText,
@@ -0,0 +1,415 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"game-forum-abaliyev-ashirbay/internal/models"
+	"game-forum-abaliyev-ashirbay/internal/oauth"
+	"net/http"
+	"strings"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	oauthStateCookie   = "oauth_state"
+	oauthStateLifetime = 10 * time.Minute
+)
+
+// randomURLToken returns n random bytes encoded for use in URLs.
+func randomURLToken(n int) (string, error) {
+	b := make([]byte, n)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return base64.RawURLEncoding.EncodeToString(b), nil
+}
+
+// pkceChallenge derives the S256 code challenge sent with the authorization
+// request from the verifier that is later sent with the token request.
+func pkceChallenge(codeVerifier string) string {
+	sum := sha256.Sum256([]byte(codeVerifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+// beginOAuth starts a login with provider: it stores a random state, and a
+// PKCE code verifier when usePKCE is set, and binds the state to the browser
+// with a short-lived cookie. userID is set when a logged in user links the
+// external account instead, or confirms who they are with it when reauth is
+// set. It returns the state and the code challenge.
+func (app *Application) beginOAuth(w http.ResponseWriter, provider string, usePKCE bool, userID int, reauth bool) (string, string, error) {
+	state, err := randomURLToken(32)
+	if err != nil {
+		return "", "", err
+	}
+
+	codeVerifier, codeChallenge := "", ""
+	if usePKCE {
+		codeVerifier, err = randomURLToken(32)
+		if err != nil {
+			return "", "", err
+		}
+		codeChallenge = pkceChallenge(codeVerifier)
+	}
+
+	err = app.OAuthStates.Insert(state, provider, codeVerifier, userID, reauth, oauthStateLifetime)
+	if err != nil {
+		return "", "", err
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    state,
+		Path:     "/auth/",
+		MaxAge:   int(oauthStateLifetime.Seconds()),
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	return state, codeChallenge, nil
+}
+
+var errOAuthState = errors.New("oauth: state mismatch")
+
+// finishOAuth checks the state a provider redirected back with against the
+// cookie set by beginOAuth and the stored pending login, and returns it.
+// errOAuthState means the callback was not started by this browser.
+func (app *Application) finishOAuth(w http.ResponseWriter, r *http.Request, provider string) (*models.OAuthState, error) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     oauthStateCookie,
+		Value:    "",
+		Path:     "/auth/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	state := r.URL.Query().Get("state")
+	stateCookie, err := r.Cookie(oauthStateCookie)
+	if err != nil || state == "" || subtle.ConstantTimeCompare([]byte(state), []byte(stateCookie.Value)) != 1 {
+		return nil, errOAuthState
+	}
+
+	pending, err := app.OAuthStates.Consume(state, provider)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil, errOAuthState
+		}
+		return nil, err
+	}
+
+	return pending, nil
+}
+
+// oauthCallbackError writes the response for a failed finishOAuth.
+func (app *Application) oauthCallbackError(w http.ResponseWriter, r *http.Request, err error) {
+	if errors.Is(err, errOAuthState) {
+		app.Logger.Warn("oauth callback with invalid state", "uri", r.URL.Path)
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+	app.serverError(w, r, err)
+}
+
+// oauthProvider returns the configured provider named in the URL.
+func (app *Application) oauthProvider(r *http.Request) (oauth.Provider, bool) {
+	name := r.PathValue("provider")
+	for _, p := range app.OAuthProviders {
+		if p.Name() == name {
+			return p, true
+		}
+	}
+	return nil, false
+}
+
+func (app *Application) oauthRedirectURI(p oauth.Provider) string {
+	return strings.TrimSuffix(app.OAuthRedirectBaseURL, "/") + "/auth/" + p.Name() + "/callback"
+}
+
+func (app *Application) oauthLogin(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	provider, ok := app.oauthProvider(r)
+	if !ok {
+		app.notFound(w, r)
+		return
+	}
+
+	// A random state ties the callback to this browser, the PKCE challenge
+	// ties the code to this login
+	state, codeChallenge, err := app.beginOAuth(w, provider.Name(), provider.UsesPKCE(), 0, false)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, provider.AuthCodeURL(state, codeChallenge, app.oauthRedirectURI(provider)), http.StatusTemporaryRedirect)
+}
+
+func (app *Application) oauthCallback(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	provider, ok := app.oauthProvider(r)
+	if !ok {
+		app.notFound(w, r)
+		return
+	}
+
+	pending, err := app.finishOAuth(w, r, provider.Name())
+	if err != nil {
+		app.oauthCallbackError(w, r, err)
+		return
+	}
+
+	code := r.URL.Query().Get("code")
+	if code == "" {
+		// The user cancelled the login on the provider's side
+		if pending.Reauth {
+			http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+		} else if pending.UserID != 0 {
+			http.Redirect(w, r, "/user/personal-page", http.StatusSeeOther)
+		} else {
+			http.Redirect(w, r, "/login", http.StatusSeeOther)
+		}
+		return
+	}
+
+	token, err := provider.Exchange(r.Context(), code, pending.CodeVerifier, app.oauthRedirectURI(provider))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	info, err := provider.UserInfo(r.Context(), token)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if pending.Reauth {
+		app.reauthIdentity(w, r, provider, pending.UserID, info)
+		return
+	}
+
+	if pending.UserID != 0 {
+		app.linkIdentity(w, r, provider, pending.UserID, info)
+		return
+	}
+
+	identity, err := app.UserIdentities.GetByProviderSubject(provider.Name(), info.Subject)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Addresses are stored in lower case, as at registration
+	email := strings.ToLower(info.Email)
+
+	var user *models.User
+	switch {
+	case identity != nil:
+		// A known external account, whatever its email says today
+		user, err = app.Users.GetById(identity.UserID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		err = app.UserIdentities.RecordLogin(identity.ID, email)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+	case info.Email == "" || !info.EmailVerified:
+		// Anyone can put someone else's address on an account at some
+		// providers, an unverified one is neither matched to an account
+		// nor given to a new one
+		if info.Email != "" {
+			exists, err := app.Users.EmailExists(email)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+			if exists {
+				app.oauthLoginError(w, r, fmt.Sprintf("An account with this email already exists. Log in with your password and link %s from your personal page.", provider.DisplayName()))
+				return
+			}
+		}
+
+		user, err = app.createOAuthUser(info, "")
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+	default:
+		user, err = app.Users.GetByEmail(email)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+
+		if user == nil {
+			user, err = app.createOAuthUser(info, email)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+		} else if !user.Enabled {
+			// The provider vouches for the address the account was
+			// waiting to have verified. Whoever registered it never
+			// proved they own the address, so their password and
+			// anything logged in with it go
+			err = app.claimUnverifiedUser(user)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+		}
+	}
+
+	if identity == nil {
+		_, err = app.UserIdentities.Insert(user.ID, provider.Name(), info.Subject, email)
+		if errors.Is(err, models.ErrDuplicateIdentity) {
+			app.oauthLoginError(w, r, fmt.Sprintf("This account is already linked to another %s account", provider.DisplayName()))
+			return
+		}
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	suspension, err := app.activeSuspension(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if suspension != nil {
+		app.oauthLoginError(w, r, suspensionMessage(suspension))
+		return
+	}
+
+	app.completeLogin(w, r, user, false)
+}
+
+// claimUnverifiedUser hands an account that never verified its email over to
+// the owner of the address: the password it was registered with is cleared,
+// its sessions and API tokens revoked and the account enabled.
+func (app *Application) claimUnverifiedUser(user *models.User) error {
+	err := app.Users.UpdatePassword(user.ID, "")
+	if err != nil {
+		return err
+	}
+	user.Password = ""
+
+	err = app.Session.DeleteByUserId(user.ID)
+	if err != nil {
+		return err
+	}
+
+	err = app.ApiTokens.DeleteByUserId(user.ID)
+	if err != nil {
+		return err
+	}
+
+	err = app.Users.SetEnabled(user.ID, true)
+	if err != nil {
+		return err
+	}
+	user.Enabled = true
+
+	return nil
+}
+
+// oauthLoginError shows the login page with a message about a failed
+// external login.
+func (app *Application) oauthLoginError(w http.ResponseWriter, r *http.Request, message string) {
+	data := templateData{
+		Form: loginForm{},
+		FormErrors: map[string]string{
+			"general": message,
+		},
+	}
+	app.render(w, r, http.StatusUnprocessableEntity, "login.html", data)
+}
+
+// unboundEmailDomain holds the placeholder addresses of accounts created
+// from an external login without a verified email. Nothing is mailed there,
+// the user sets a real address in the settings.
+const unboundEmailDomain = "unverified.invalid"
+
+// hasEmail reports whether the user's address is a real one.
+func hasEmail(user *models.User) bool {
+	return !strings.HasSuffix(user.Email, "@"+unboundEmailDomain)
+}
+
+// createOAuthUser registers the user of an external account with the
+// verified address email, or a placeholder when email is empty. The account
+// has no password, it can only be used through its linked identities.
+func (app *Application) createOAuthUser(info *oauth.UserInfo, email string) (*models.User, error) {
+	base := info.Username
+	if base == "" {
+		base = info.Name
+	}
+	if base == "" {
+		base, _, _ = strings.Cut(email, "@")
+	}
+	base = truncateRunes(strings.TrimSpace(base), 25)
+	if base == "" {
+		base = "player"
+	}
+
+	if email == "" {
+		token, err := randomURLToken(16)
+		if err != nil {
+			return nil, err
+		}
+		email = "user-" + strings.ToLower(token) + "@" + unboundEmailDomain
+	}
+
+	// Pick the first free name of base, base2, base3...
+	for i := 1; i <= 100; i++ {
+		username := base
+		if i > 1 {
+			username = fmt.Sprintf("%s%d", base, i)
+		}
+
+		if reservedUsername(username) {
+			continue
+		}
+
+		id, err := app.Users.Insert(email, username, "", true)
+		if errors.Is(err, models.ErrDuplicateUsername) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		return app.Users.GetById(id)
+	}
+
+	return nil, fmt.Errorf("no free username for %q", base)
+}
+
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+	return string([]rune(s)[:n])
+}
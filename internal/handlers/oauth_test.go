@@ -0,0 +1,533 @@
+package handlers_test
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+
+	"game-forum-abaliyev-ashirbay/internal/models"
+	"game-forum-abaliyev-ashirbay/internal/oauth"
+)
+
+// stubOAuthProvider plays Google, GitHub and an OpenID Connect issuer: it
+// hands out an access token for the code "good-code" and answers the profile
+// requests made with it.
+type stubOAuthProvider struct {
+	server        *httptest.Server
+	codeChallenge string
+	tokenRequests int
+
+	// googleUnverified makes Google report the address as unverified,
+	// googleEmail replaces gopher@example.com
+	googleUnverified bool
+	googleEmail      string
+}
+
+func newStubOAuthProvider() *stubOAuthProvider {
+	p := &stubOAuthProvider{}
+	mux := http.NewServeMux()
+
+	token := func(checkPKCE bool) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			p.tokenRequests++
+			r.ParseForm()
+
+			if r.PostForm.Get("code") != "good-code" || r.PostForm.Get("client_id") != "client-id" {
+				http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+				return
+			}
+			if checkPKCE {
+				sum := sha256.Sum256([]byte(r.PostForm.Get("code_verifier")))
+				if base64.RawURLEncoding.EncodeToString(sum[:]) != p.codeChallenge {
+					http.Error(w, `{"error":"invalid_grant"}`, http.StatusBadRequest)
+					return
+				}
+			}
+
+			json.NewEncoder(w).Encode(map[string]string{"access_token": "access-123", "token_type": "bearer"})
+		}
+	}
+
+	profile := func(body interface{}) http.HandlerFunc {
+		return func(w http.ResponseWriter, r *http.Request) {
+			if r.Header.Get("Authorization") != "Bearer access-123" {
+				http.Error(w, "unauthorized", http.StatusUnauthorized)
+				return
+			}
+			json.NewEncoder(w).Encode(body)
+		}
+	}
+
+	mux.HandleFunc("/google/token", token(true))
+	mux.HandleFunc("/google/userinfo", func(w http.ResponseWriter, r *http.Request) {
+		email := p.googleEmail
+		if email == "" {
+			email = "gopher@example.com"
+		}
+		profile(map[string]interface{}{"email": email, "email_verified": !p.googleUnverified, "name": "gopher", "sub": "42"})(w, r)
+	})
+	mux.HandleFunc("/github/token", token(false))
+	mux.HandleFunc("/github/user", profile(map[string]interface{}{"id": 1234, "login": "octocat"}))
+	mux.HandleFunc("/github/emails", profile([]map[string]interface{}{
+		{"email": "old@example.com", "primary": false, "verified": true},
+		{"email": "octocat@example.com", "primary": true, "verified": true},
+	}))
+
+	mux.HandleFunc("/oidc/.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 p.server.URL + "/oidc",
+			"authorization_endpoint": p.server.URL + "/oidc/authorize",
+			"token_endpoint":         p.server.URL + "/oidc/token",
+			"userinfo_endpoint":      p.server.URL + "/oidc/userinfo",
+		})
+	})
+	mux.HandleFunc("/oidc/token", token(true))
+	mux.HandleFunc("/oidc/userinfo", profile(map[string]interface{}{"sub": "ada-1", "email": "ada@example.com", "email_verified": true, "preferred_username": "ada"}))
+
+	p.server = httptest.NewServer(mux)
+	return p
+}
+
+var _ = ginkgo.Describe("OAuth login", func() {
+	var (
+		app      *testApp
+		provider *stubOAuthProvider
+	)
+
+	ginkgo.BeforeEach(func() {
+		provider = newStubOAuthProvider()
+
+		// Google through the old variables, GitHub with its endpoints
+		// overridden and "acme" as a company issuer found by discovery
+		env := map[string]string{
+			"OAUTH_PROVIDERS":            "github, acme",
+			"GOOGLE_CLIENT_ID":           "client-id",
+			"GOOGLE_CLIENT_SECRET":       "client-secret",
+			"OAUTH_GOOGLE_AUTH_URL":      provider.server.URL + "/google/authorize",
+			"OAUTH_GOOGLE_TOKEN_URL":     provider.server.URL + "/google/token",
+			"OAUTH_GOOGLE_USERINFO_URL":  provider.server.URL + "/google/userinfo",
+			"OAUTH_GITHUB_CLIENT_ID":     "client-id",
+			"OAUTH_GITHUB_CLIENT_SECRET": "client-secret",
+			"OAUTH_GITHUB_AUTH_URL":      provider.server.URL + "/github/authorize",
+			"OAUTH_GITHUB_TOKEN_URL":     provider.server.URL + "/github/token",
+			"OAUTH_GITHUB_USERINFO_URL":  provider.server.URL + "/github/user",
+			"OAUTH_GITHUB_EMAILS_URL":    provider.server.URL + "/github/emails",
+			"OAUTH_ACME_CLIENT_ID":       "client-id",
+			"OAUTH_ACME_CLIENT_SECRET":   "client-secret",
+			"OAUTH_ACME_DISPLAY_NAME":    "Acme SSO",
+			"OAUTH_ACME_ISSUER":          provider.server.URL + "/oidc",
+		}
+		configs, err := oauth.ConfigsFromEnv(func(key string) string { return env[key] })
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		var providers []oauth.Provider
+		for _, cfg := range configs {
+			p, err := oauth.NewProvider(context.Background(), cfg, provider.server.Client())
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+			providers = append(providers, p)
+		}
+
+		app = newTestApp("198.51.100.3")
+		app.OAuthProviders = providers
+		app.OAuthRedirectBaseURL = "https://forum.example.com"
+	})
+
+	ginkgo.AfterEach(func() {
+		provider.server.Close()
+	})
+
+	// startLogin follows the login link and returns the authorization request
+	// sent to the provider together with the state cookie set on the browser.
+	startLogin := func(path string) (url.Values, *http.Cookie) {
+		rr := app.get(nil, path)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusTemporaryRedirect))
+
+		location, err := url.Parse(rr.Header().Get("Location"))
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		var stateCookie *http.Cookie
+		for _, c := range rr.Result().Cookies() {
+			if c.Name == "oauth_state" {
+				stateCookie = c
+			}
+		}
+		gomega.Expect(stateCookie).ToNot(gomega.BeNil())
+
+		return location.Query(), stateCookie
+	}
+
+	callback := func(path, state string, stateCookie *http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, path+"?code=good-code&state="+url.QueryEscape(state), nil)
+		if stateCookie != nil {
+			req.AddCookie(stateCookie)
+		}
+		return app.do(nil, req)
+	}
+
+	hasSessionCookie := func(rr *httptest.ResponseRecorder) bool {
+		for _, c := range rr.Result().Cookies() {
+			if c.Name == "token" && c.Value != "" {
+				return true
+			}
+		}
+		return false
+	}
+
+	ginkgo.Describe("Google", func() {
+		ginkgo.It("sends a fresh random state and a PKCE challenge", func() {
+			first, stateCookie := startLogin("/auth/google")
+			second, _ := startLogin("/auth/google")
+
+			gomega.Expect(first.Get("state")).ToNot(gomega.BeEmpty())
+			gomega.Expect(first.Get("state")).ToNot(gomega.Equal(second.Get("state")))
+			gomega.Expect(stateCookie.Value).To(gomega.Equal(first.Get("state")))
+			gomega.Expect(first.Get("code_challenge")).ToNot(gomega.BeEmpty())
+			gomega.Expect(first.Get("code_challenge_method")).To(gomega.Equal("S256"))
+		})
+
+		ginkgo.It("logs in when the callback carries the state of this browser", func() {
+			params, stateCookie := startLogin("/auth/google")
+			provider.codeChallenge = params.Get("code_challenge")
+
+			rr := callback("/auth/google/callback", params.Get("state"), stateCookie)
+
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+			gomega.Expect(rr.Header().Get("Location")).To(gomega.Equal("/"))
+			gomega.Expect(hasSessionCookie(rr)).To(gomega.BeTrue())
+
+			var username string
+			err := app.DB.QueryRow("SELECT username FROM Users WHERE email = ?", "gopher@example.com").Scan(&username)
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+			gomega.Expect(username).To(gomega.Equal("gopher"))
+		})
+
+		ginkgo.It("rejects a state that does not match the browser's cookie", func() {
+			params, _ := startLogin("/auth/google")
+			_, otherCookie := startLogin("/auth/google")
+			provider.codeChallenge = params.Get("code_challenge")
+
+			rr := callback("/auth/google/callback", params.Get("state"), otherCookie)
+
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+			gomega.Expect(hasSessionCookie(rr)).To(gomega.BeFalse())
+			gomega.Expect(provider.tokenRequests).To(gomega.Equal(0))
+		})
+
+		ginkgo.It("rejects a callback from a browser that never started the login", func() {
+			params, _ := startLogin("/auth/google")
+
+			rr := callback("/auth/google/callback", params.Get("state"), nil)
+
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+			gomega.Expect(provider.tokenRequests).To(gomega.Equal(0))
+		})
+
+		ginkgo.It("does not accept the same state twice", func() {
+			params, stateCookie := startLogin("/auth/google")
+			provider.codeChallenge = params.Get("code_challenge")
+
+			rr := callback("/auth/google/callback", params.Get("state"), stateCookie)
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+
+			rr = callback("/auth/google/callback", params.Get("state"), stateCookie)
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+		})
+	})
+
+	ginkgo.Describe("Linked identities", func() {
+		// createUser adds a user with a password and logs it in.
+		createUser := func(email, username string) *testSession {
+			var id int
+			err := app.DB.QueryRow(`INSERT INTO Users (email, username, password) VALUES (?, ?, 'hash') RETURNING id`, email, username).Scan(&id)
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+			return app.login(id, "session-"+username)
+		}
+
+		countIdentities := func(email string) int {
+			var n int
+			err := app.DB.QueryRow(`SELECT COUNT(*) FROM User_Identities i JOIN Users u ON u.id = i.user_id WHERE u.email = ?`, email).Scan(&n)
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+			return n
+		}
+
+		ginkgo.It("records the identity of a new user and logs in with it", func() {
+			params, stateCookie := startLogin("/auth/google")
+			provider.codeChallenge = params.Get("code_challenge")
+			gomega.Expect(callback("/auth/google/callback", params.Get("state"), stateCookie).Code).To(gomega.Equal(http.StatusSeeOther))
+
+			var subject, password string
+			err := app.DB.QueryRow(`SELECT i.subject, u.password FROM User_Identities i JOIN Users u ON u.id = i.user_id
+			WHERE i.provider = 'google'`).Scan(&subject, &password)
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+			gomega.Expect(subject).To(gomega.Equal("42"))
+			gomega.Expect(password).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("links an existing account when the provider verified the email", func() {
+			createUser("gopher@example.com", "gopher")
+
+			params, stateCookie := startLogin("/auth/google")
+			provider.codeChallenge = params.Get("code_challenge")
+			rr := callback("/auth/google/callback", params.Get("state"), stateCookie)
+
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+			gomega.Expect(hasSessionCookie(rr)).To(gomega.BeTrue())
+			gomega.Expect(countIdentities("gopher@example.com")).To(gomega.Equal(1))
+		})
+
+		ginkgo.It("matches the address in lower case", func() {
+			createUser("gopher@example.com", "gopher")
+			provider.googleEmail = "Gopher@Example.COM"
+
+			params, stateCookie := startLogin("/auth/google")
+			provider.codeChallenge = params.Get("code_challenge")
+			gomega.Expect(callback("/auth/google/callback", params.Get("state"), stateCookie).Code).To(gomega.Equal(http.StatusSeeOther))
+
+			gomega.Expect(countIdentities("gopher@example.com")).To(gomega.Equal(1))
+		})
+
+		ginkgo.It("does not give an unverified address to the account it creates", func() {
+			provider.googleUnverified = true
+
+			params, stateCookie := startLogin("/auth/google")
+			provider.codeChallenge = params.Get("code_challenge")
+			rr := callback("/auth/google/callback", params.Get("state"), stateCookie)
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+			gomega.Expect(hasSessionCookie(rr)).To(gomega.BeTrue())
+
+			var email string
+			err := app.DB.QueryRow(`SELECT u.email FROM User_Identities i JOIN Users u ON u.id = i.user_id
+			WHERE i.provider = 'google' AND i.subject = '42'`).Scan(&email)
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+			gomega.Expect(email).To(gomega.HaveSuffix("@unverified.invalid"))
+
+			// The owner of the address can still register it, and a
+			// verified login with it is not matched to that account
+			exists, err := app.Users.EmailExists("gopher@example.com")
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+			gomega.Expect(exists).To(gomega.BeFalse())
+		})
+
+		ginkgo.It("takes an unverified account away from whoever registered it", func() {
+			createUser("gopher@example.com", "squatter")
+			_, err := app.DB.Exec(`UPDATE Users SET enabled = 0 WHERE username = 'squatter'`)
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+			_, err = app.ApiTokens.Insert(1, "bot", "gfp_squatter-token", []string{models.ScopeRead})
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+			params, stateCookie := startLogin("/auth/google")
+			provider.codeChallenge = params.Get("code_challenge")
+			rr := callback("/auth/google/callback", params.Get("state"), stateCookie)
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+			gomega.Expect(hasSessionCookie(rr)).To(gomega.BeTrue())
+
+			var password string
+			var enabled bool
+			gomega.Expect(app.DB.QueryRow(`SELECT password, enabled FROM Users WHERE id = 1`).Scan(&password, &enabled)).To(gomega.Succeed())
+			gomega.Expect(password).To(gomega.BeEmpty())
+			gomega.Expect(enabled).To(gomega.BeTrue())
+
+			var sessions, tokens int
+			gomega.Expect(app.DB.QueryRow(`SELECT COUNT(*) FROM Sessions WHERE token = 'session-squatter'`).Scan(&sessions)).To(gomega.Succeed())
+			gomega.Expect(sessions).To(gomega.Equal(0))
+			gomega.Expect(app.DB.QueryRow(`SELECT COUNT(*) FROM Api_Tokens`).Scan(&tokens)).To(gomega.Succeed())
+			gomega.Expect(tokens).To(gomega.Equal(0))
+			gomega.Expect(countIdentities("gopher@example.com")).To(gomega.Equal(1))
+		})
+
+		ginkgo.It("does not take a username that looks like the email for the account", func() {
+			createUser("someone@example.com", "gopher@example.com")
+
+			params, stateCookie := startLogin("/auth/google")
+			provider.codeChallenge = params.Get("code_challenge")
+			gomega.Expect(callback("/auth/google/callback", params.Get("state"), stateCookie).Code).To(gomega.Equal(http.StatusSeeOther))
+
+			gomega.Expect(countIdentities("someone@example.com")).To(gomega.Equal(0))
+			gomega.Expect(countIdentities("gopher@example.com")).To(gomega.Equal(1))
+		})
+
+		ginkgo.It("refuses an unverified email that belongs to an existing account", func() {
+			createUser("gopher@example.com", "gopher")
+			provider.googleUnverified = true
+
+			params, stateCookie := startLogin("/auth/google")
+			provider.codeChallenge = params.Get("code_challenge")
+			rr := callback("/auth/google/callback", params.Get("state"), stateCookie)
+
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+			gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("An account with this email already exists"))
+			gomega.Expect(hasSessionCookie(rr)).To(gomega.BeFalse())
+			gomega.Expect(countIdentities("gopher@example.com")).To(gomega.Equal(0))
+		})
+
+		ginkgo.It("links a provider from the personal page of a logged in user", func() {
+			someone := createUser("someone@example.com", "someone")
+
+			rr := app.postForm(someone, "/user/identities/link?provider=github", nil)
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+
+			location, err := url.Parse(rr.Header().Get("Location"))
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+			var stateCookie *http.Cookie
+			for _, c := range rr.Result().Cookies() {
+				if c.Name == "oauth_state" {
+					stateCookie = c
+				}
+			}
+			gomega.Expect(stateCookie).ToNot(gomega.BeNil())
+
+			req := httptest.NewRequest(http.MethodGet, "/auth/github/callback?code=good-code&state="+url.QueryEscape(location.Query().Get("state")), nil)
+			req.AddCookie(stateCookie)
+			rr = app.do(someone, req)
+
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+			gomega.Expect(rr.Header().Get("Location")).To(gomega.Equal("/user/personal-page"))
+
+			// The GitHub account's address differs, the identity still
+			// belongs to the user who linked it
+			var email string
+			err = app.DB.QueryRow(`SELECT i.email FROM User_Identities i JOIN Users u ON u.id = i.user_id
+			WHERE u.username = 'someone' AND i.provider = 'github' AND i.subject = '1234'`).Scan(&email)
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+			gomega.Expect(email).To(gomega.Equal("octocat@example.com"))
+
+			params, stateCookie := startLogin("/auth/github")
+			rr = callback("/auth/github/callback", params.Get("state"), stateCookie)
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+
+			var exists bool
+			err = app.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM Users WHERE email = 'octocat@example.com')`).Scan(&exists)
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+			gomega.Expect(exists).To(gomega.BeFalse())
+		})
+
+		ginkgo.It("does not finish a link in another user's browser", func() {
+			someone := createUser("someone@example.com", "someone")
+			other := createUser("other@example.com", "other")
+
+			rr := app.postForm(someone, "/user/identities/link?provider=github", nil)
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+
+			location, err := url.Parse(rr.Header().Get("Location"))
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+			req := httptest.NewRequest(http.MethodGet, "/auth/github/callback?code=good-code&state="+url.QueryEscape(location.Query().Get("state")), nil)
+			req.AddCookie(&http.Cookie{Name: "oauth_state", Value: location.Query().Get("state")})
+			rr = app.do(other, req)
+
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusForbidden))
+			gomega.Expect(countIdentities("other@example.com")).To(gomega.Equal(0))
+			gomega.Expect(countIdentities("someone@example.com")).To(gomega.Equal(0))
+		})
+	})
+
+	ginkgo.Describe("GitHub", func() {
+		ginkgo.It("logs in when the callback carries the state of this browser", func() {
+			params, stateCookie := startLogin("/auth/github")
+			gomega.Expect(params.Get("state")).ToNot(gomega.Equal("someRandomState"))
+
+			rr := callback("/auth/github/callback", params.Get("state"), stateCookie)
+
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+			gomega.Expect(hasSessionCookie(rr)).To(gomega.BeTrue())
+		})
+
+		ginkgo.It("uses the primary verified address and the login as username", func() {
+			params, stateCookie := startLogin("/auth/github")
+			gomega.Expect(callback("/auth/github/callback", params.Get("state"), stateCookie).Code).To(gomega.Equal(http.StatusSeeOther))
+
+			var username string
+			err := app.DB.QueryRow("SELECT username FROM Users WHERE email = ?", "octocat@example.com").Scan(&username)
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+			gomega.Expect(username).To(gomega.Equal("octocat"))
+		})
+
+		ginkgo.It("rejects a callback without a state", func() {
+			_, stateCookie := startLogin("/auth/github")
+
+			rr := callback("/auth/github/callback", "", stateCookie)
+
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+			gomega.Expect(provider.tokenRequests).To(gomega.Equal(0))
+		})
+
+		ginkgo.It("lets a user without a password confirm it is them with a linked account", func() {
+			var id int
+			err := app.DB.QueryRow(`INSERT INTO Users (email, username, password) VALUES ('octocat@example.com', 'octocat', '') RETURNING id`).Scan(&id)
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+			octocat := app.login(id, "session-octocat")
+
+			reauth := func(subject string) *httptest.ResponseRecorder {
+				_, err := app.DB.Exec(`DELETE FROM User_Identities; INSERT INTO User_Identities (user_id, provider, subject, email, created_at)
+				VALUES (?, 'github', ?, 'octocat@example.com', datetime('now'))`, id, subject)
+				gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+				rr := app.postForm(octocat, "/user/settings/reauth?provider=github", nil)
+				gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+				location, err := url.Parse(rr.Header().Get("Location"))
+				gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+				req := httptest.NewRequest(http.MethodGet, "/auth/github/callback?code=good-code&state="+url.QueryEscape(location.Query().Get("state")), nil)
+				req.AddCookie(&http.Cookie{Name: "oauth_state", Value: location.Query().Get("state")})
+				return app.do(octocat, req)
+			}
+			setPassword := func() int {
+				return app.postForm(octocat, "/user/settings/password", url.Values{
+					"newPassword":     {"password1"},
+					"confirmPassword": {"password1"},
+				}).Code
+			}
+
+			// Another GitHub account than the linked one proves nothing
+			rr := reauth("999")
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+			gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("This GitHub account is not linked to yours"))
+			gomega.Expect(setPassword()).To(gomega.Equal(http.StatusUnprocessableEntity))
+
+			rr = reauth("1234")
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+			gomega.Expect(rr.Header().Get("Location")).To(gomega.Equal("/user/settings"))
+			gomega.Expect(setPassword()).To(gomega.Equal(http.StatusOK))
+		})
+	})
+
+	ginkgo.Describe("OpenID Connect issuer from configuration", func() {
+		ginkgo.It("discovers the endpoints and logs in", func() {
+			params, stateCookie := startLogin("/auth/acme")
+			gomega.Expect(params.Get("redirect_uri")).To(gomega.Equal("https://forum.example.com/auth/acme/callback"))
+			gomega.Expect(params.Get("scope")).To(gomega.Equal("openid email profile"))
+			provider.codeChallenge = params.Get("code_challenge")
+
+			rr := callback("/auth/acme/callback", params.Get("state"), stateCookie)
+
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+			gomega.Expect(hasSessionCookie(rr)).To(gomega.BeTrue())
+
+			var username string
+			err := app.DB.QueryRow("SELECT username FROM Users WHERE email = ?", "ada@example.com").Scan(&username)
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+			gomega.Expect(username).To(gomega.Equal("ada"))
+		})
+
+		ginkgo.It("lists the provider on the login page", func() {
+			rr := app.get(nil, "/login")
+
+			gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring(`href="/auth/acme"`))
+			gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("Login with Acme SSO"))
+		})
+
+		ginkgo.It("answers 404 for providers that are not configured", func() {
+			rr := app.get(nil, "/auth/gitlab")
+
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusNotFound))
+		})
+	})
+})
@@ -17,35 +17,62 @@ func (app *Application) personalPage(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	userPosts, err := app.Posts.GetPostsByUserID(userID)
+	data, err := app.personalPageData(userID)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
+	app.render(w, r, http.StatusOK, "personal_page.html", data)
+}
+
+// personalPageData loads everything the personal page lists, handlers that
+// re-render the page after a form submission add their own fields to it.
+func (app *Application) personalPageData(userID int) (templateData, error) {
+	userPosts, err := app.Posts.GetPostsByUserID(userID)
+	if err != nil {
+		return templateData{}, err
+	}
+
 	likedPostIDs, err := app.PostReactions.GetLikedPostIDsByUserID(userID)
 	if err != nil && err != models.ErrNoReaction {
-		app.serverError(w, r, err)
-		return
+		return templateData{}, err
 	}
 
 	likedPosts, err := app.Posts.GetPostsByIDs(likedPostIDs)
 	if err != nil {
-		app.serverError(w, r, err)
-		return
+		return templateData{}, err
 	}
 
 	comments, err := app.Comments.GetAllByUserId(userID)
 	if err != nil {
-		app.serverError(w, r, err)
-		return
+		return templateData{}, err
+	}
+
+	apiTokens, err := app.ApiTokens.GetAllByUserId(userID)
+	if err != nil {
+		return templateData{}, err
+	}
+
+	linkedAccounts, err := app.linkedAccounts(userID)
+	if err != nil {
+		return templateData{}, err
+	}
+
+	profile, err := app.Profiles.Get(userID)
+	if err != nil {
+		return templateData{}, err
 	}
 
 	data := templateData{
+		Profile:             profile,
 		Posts:               userPosts,  // The user’s own posts
 		LikedPosts:          likedPosts, // The user’s liked posts
 		CommentPostAddition: comments,
+		APITokens:           apiTokens,
+		APIScopes:           models.AllScopes,
+		LinkedAccounts:      linkedAccounts,
 	}
 
-	app.render(w, r, http.StatusOK, "personal_page.html", data)
+	return data, nil
 }
@@ -3,12 +3,12 @@ package handlers
 import (
 	"errors"
 	"fmt"
+	"game-forum-abaliyev-ashirbay/internal/markdown"
 	"game-forum-abaliyev-ashirbay/internal/models"
 	"game-forum-abaliyev-ashirbay/internal/validator"
-	"io"
 	"net/http"
-	"os"
 	"strconv"
+	"strings"
 	"time"
 )
 
@@ -26,6 +26,17 @@ type PostForm struct {
 	Content    string
 }
 
+func checkPostForm(v *validator.Validator, form PostForm) {
+	v.CheckField(validator.NotBlank(form.Title), "title", "Title must not be blank")
+	v.CheckField(validator.MaxChars(form.Title, 100), "title", "Title must not be more than 100 characters long")
+	v.CheckField(validator.MinChars(form.Title, 5), "title", "Title must be at least 5 characters long")
+
+	v.CheckField(form.CategoryID > 0, "category_id", "You must select a category")
+
+	v.CheckField(validator.NotBlank(form.Content), "content", "Content must not be blank")
+	v.CheckField(validator.MinChars(form.Content, 10), "content", "Content must be at least 10 characters long")
+}
+
 func (app *Application) postView(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodGet {
 		app.clientError(w, r, http.StatusMethodNotAllowed)
@@ -71,9 +82,22 @@ func (app *Application) postView(w http.ResponseWriter, r *http.Request) {
 		},
 	}
 
+	attachments, err := app.PostAttachments.GetByPostID(post.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	shownRevision, _ := strconv.Atoi(r.URL.Query().Get("revision"))
+	revisions, err := app.postRevisions(post.ID, shownRevision)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
 	userId, err := app.getAuthenticatedUserID(r)
 
-	comments, err := app.Comments.GetAllCommentsReactionsByPostID(id, userId)
+	comments, err := app.Comments.GetCommentTreeByPostID(id, userId)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -81,9 +105,11 @@ func (app *Application) postView(w http.ResponseWriter, r *http.Request) {
 	userID, err := app.getAuthenticatedUserID(r)
 	if err != nil {
 		app.render(w, r, http.StatusOK, "view.html", templateData{
-			Category:   category,
-			PostByUser: fullPost,
-			Comments:   comments,
+			Category:    category,
+			PostByUser:  fullPost,
+			Comments:    comments,
+			Attachments: attachments,
+			Revisions:   revisions,
 		})
 		return
 	}
@@ -116,6 +142,11 @@ func (app *Application) postView(w http.ResponseWriter, r *http.Request) {
 		Comments:      comments,
 		ReportReasons: reportReasons,
 		User:          user,
+		Attachments:   attachments,
+		Revisions:     revisions,
+		CanRevert:     canRevert(user, post),
+
+		CommentEditWindow: app.commentEditWindow(),
 	}
 
 	app.render(w, r, http.StatusOK, "view.html", data)
@@ -140,33 +171,51 @@ func (app *Application) postCreate(w http.ResponseWriter, r *http.Request) {
 	app.render(w, r, http.StatusOK, "create.html", data)
 }
 
+// maxPreviewBody bounds the form of a preview request
+const maxPreviewBody = 1 << 20
+
+// postPreview renders the Markdown in the content field the way postView
+// will show it, for the preview on the create and edit pages.
+func (app *Application) postPreview(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, maxPreviewBody)
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(markdown.HTML(r.PostForm.Get("content"))))
+}
+
 func (app *Application) postCreatePost(w http.ResponseWriter, r *http.Request) {
 	if r.Method != http.MethodPost {
 		app.clientError(w, r, http.StatusMethodNotAllowed)
 		return
 	}
 
+	r.Body = http.MaxBytesReader(w, r.Body, maxPostBody)
 	err := r.ParseMultipartForm(15 << 20)
 	if err != nil {
 		app.clientError(w, r, http.StatusBadRequest)
 		return
 	}
+	defer r.MultipartForm.RemoveAll()
+
+	if !app.checkFormCSRF(w, r) {
+		return
+	}
 
 	title := r.FormValue("title")
 	categoryIDStr := r.FormValue("category_id")
 	content := r.FormValue("content")
 
-	file, header, imgErr := r.FormFile("image")
-	if imgErr != nil && imgErr != http.ErrMissingFile {
-		app.serverError(w, r, imgErr)
-		return
-	}
-	defer func() {
-		if file != nil {
-			file.Close()
-		}
-	}()
-
 	categoryID, err := strconv.Atoi(categoryIDStr)
 	if err != nil || categoryID < 1 {
 		categoryID = 0
@@ -179,23 +228,16 @@ func (app *Application) postCreatePost(w http.ResponseWriter, r *http.Request) {
 	}
 	v := validator.Validator{}
 
-	if imgErr != http.ErrMissingFile {
-		const maxFileSize = 15 << 20
-
-		v.CheckField(header.Size < maxFileSize, "image", "File too large: must be <= 15MB")
-
-		v.CheckField(isAllowedImageExt(header.Filename), "image", "Only .jpg, .png, or .gif files are allowed")
-
+	imgs, message, err := readUploads(r, maxAttachments)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if message != "" {
+		v.AddFieldError("images", message)
 	}
 
-	v.CheckField(validator.NotBlank(form.Title), "title", "Title must not be blank")
-	v.CheckField(validator.MaxChars(form.Title, 100), "title", "Title must not be more than 100 characters long")
-	v.CheckField(validator.MinChars(form.Title, 5), "title", "Title must be at least 5 characters long")
-
-	v.CheckField(form.CategoryID > 0, "category_id", "You must select a category")
-
-	v.CheckField(validator.NotBlank(form.Content), "content", "Content must not be blank")
-	v.CheckField(validator.MinChars(form.Content, 10), "content", "Content must be at least 10 characters long")
+	checkPostForm(&v, form)
 
 	if !v.Valid() {
 		categories, err := app.Categories.GetAll()
@@ -220,32 +262,13 @@ func (app *Application) postCreatePost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	imgUrl := ""
-
-	if imgErr != http.ErrMissingFile {
-		newFileName, err := generateUniqueFileName(header.Filename)
-		if err != nil {
-			app.serverError(w, r, err)
-			return
-		}
-
-		dst, err := os.Create("./data/imgs/" + newFileName)
-		if err != nil {
-			app.serverError(w, r, err)
-			return
-		}
-		defer dst.Close()
-
-		_, err = io.Copy(dst, file)
-		if err != nil {
-			app.serverError(w, r, err)
-			return
-		}
-
-		imgUrl = newFileName
+	postID, err := app.Posts.Insert(title, content, "", time.Now(), categoryID, userId)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
 	}
 
-	postID, err := app.Posts.Insert(title, content, imgUrl, time.Now(), categoryID, userId)
+	err = app.attachImages(postID, imgs)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
@@ -279,12 +302,6 @@ func (app *Application) handlePostReaction(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	existingReaction, err := app.PostReactions.GetReaction(userID, postID)
-	if err != nil && err != models.ErrNoReaction {
-		app.serverError(w, r, err)
-		return
-	}
-
 	post, err := app.Posts.Get(postID)
 	if err != nil {
 		if errors.Is(err, models.ErrNoRecord) {
@@ -295,75 +312,12 @@ func (app *Application) handlePostReaction(w http.ResponseWriter, r *http.Reques
 		return
 	}
 
-	newLikeCount := post.LikeCount
-	newDislikeCount := post.DislikeCount
-
-	if existingReaction != nil {
-		if existingReaction.Type == reaction {
-			err = app.PostReactions.DeleteReaction(userID, postID)
-			if err != nil {
-				app.serverError(w, r, err)
-				return
-			}
-			if reaction == "like" {
-				newLikeCount--
-			} else {
-				newDislikeCount--
-			}
-		} else {
-			err = app.PostReactions.UpdateReaction(userID, postID, reaction)
-			if err != nil {
-				app.serverError(w, r, err)
-				return
-			}
-			if reaction == "like" {
-				newLikeCount++
-				newDislikeCount--
-			} else {
-				newLikeCount--
-				newDislikeCount++
-			}
-		}
-	} else {
-		err = app.PostReactions.AddReaction(userID, postID, reaction)
-		if err != nil {
-			app.serverError(w, r, err)
-			return
-		}
-		if reaction == "like" {
-			newLikeCount++
-		} else {
-			newDislikeCount++
-		}
-	}
-
-	err = app.Posts.UpdatePostLikeDislikeCounts(postID, newLikeCount, newDislikeCount)
+	err = app.reactToPost(userID, post, reaction)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
-	if post.OwnerID != userID {
-		var notifType string
-		if reaction == "like" {
-			notifType = "post_like"
-		} else {
-			notifType = "post_dislike"
-		}
-
-		_, notifErr := app.Notifications.Insert(
-			notifType,
-			userID,
-			post.OwnerID,
-			postID,
-			nil,
-		)
-		if notifErr != nil {
-			app.serverError(w, r, notifErr)
-			return
-		}
-	}
-
 	http.Redirect(w, r, fmt.Sprintf("/post/view?id=%d", postID), http.StatusSeeOther)
 }
 
@@ -402,51 +356,17 @@ func (app *Application) postDelete(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if post.OwnerID != userID && user.Role != "moderator" && user.Role != "admin" {
+	if post.OwnerID != userID && !canModerate(r, user, post.OwnerID) {
 		app.clientError(w, r, http.StatusForbidden)
 		return
 	}
 
-	err = app.PostReactions.DeleteReactionsByPostId(postID)
+	err = app.Posts.SoftDelete(post.ID, user.ID)
 	if err != nil {
 		app.serverError(w, r, err)
 		return
 	}
 
-	comments, err := app.Comments.GetAllByPostId(postID)
-	if err != nil {
-		app.serverError(w, r, err)
-		return
-	}
-
-	for _, comment := range comments {
-		err = app.CommentsReactions.DeleteReactioByCommentId(comment.ID)
-		if err != nil {
-			app.serverError(w, r, err)
-			return
-		}
-	}
-
-	err = app.Comments.DeleteCommentsByPostId(postID)
-	if err != nil {
-		app.serverError(w, r, err)
-		return
-	}
-
-	err = app.Posts.DeletePostById(postID)
-	if err != nil {
-		app.serverError(w, r, err)
-		return
-	}
-
-	if post.ImgUrl != "" {
-		imagePath := "./data/imgs/" + post.ImgUrl
-		err = os.Remove(imagePath)
-		if err != nil && !os.IsNotExist(err) {
-			app.Logger.Error("Error deleting image file: %s, error: %v\n", imagePath, err)
-		}
-	}
-
 	http.Redirect(w, r, "/", http.StatusSeeOther)
 }
 
@@ -490,9 +410,16 @@ func (app *Application) postEdit(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	attachments, err := app.PostAttachments.GetByPostID(post.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
 	data := templateData{
-		Post:       post,
-		Categories: categories,
+		Post:        post,
+		Categories:  categories,
+		Attachments: attachments,
 	}
 
 	app.render(w, r, http.StatusOK, "edit_post.html", data)
@@ -532,27 +459,22 @@ func (app *Application) postEditPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
+	r.Body = http.MaxBytesReader(w, r.Body, maxPostBody)
 	err = r.ParseMultipartForm(15 << 20)
 	if err != nil {
 		app.clientError(w, r, http.StatusBadRequest)
 		return
 	}
+	defer r.MultipartForm.RemoveAll()
+
+	if !app.checkFormCSRF(w, r) {
+		return
+	}
 
 	title := r.FormValue("title")
 	categoryIDStr := r.FormValue("category_id")
 	content := r.FormValue("content")
 
-	file, header, imgErr := r.FormFile("image")
-	if imgErr != nil && imgErr != http.ErrMissingFile {
-		app.serverError(w, r, imgErr)
-		return
-	}
-	defer func() {
-		if file != nil {
-			file.Close()
-		}
-	}()
-
 	categoryID, err := strconv.Atoi(categoryIDStr)
 	if err != nil || categoryID < 1 {
 		categoryID = 0
@@ -565,18 +487,42 @@ func (app *Application) postEditPost(w http.ResponseWriter, r *http.Request) {
 	}
 	v := validator.Validator{}
 
-	if imgErr != http.ErrMissingFile {
-		const maxFileSize = 15 << 20
-		v.CheckField(header.Size < maxFileSize, "image", "File too large: must be <= 15MB")
-		v.CheckField(isAllowedImageExt(header.Filename), "image", "Only .jpg, .png, or .gif files are allowed")
+	attachments, err := app.PostAttachments.GetByPostID(post.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
 	}
 
-	v.CheckField(validator.NotBlank(form.Title), "title", "Title must not be blank")
-	v.CheckField(validator.MaxChars(form.Title, 100), "title", "Title must not be more than 100 characters long")
-	v.CheckField(validator.MinChars(form.Title, 5), "title", "Title must be at least 5 characters long")
-	v.CheckField(form.CategoryID > 0, "category_id", "You must select a category")
-	v.CheckField(validator.NotBlank(form.Content), "content", "Content must not be blank")
-	v.CheckField(validator.MinChars(form.Content, 10), "content", "Content must be at least 10 characters long")
+	// Every attachment is either removed or kept with the caption and
+	// position from the form
+	var kept, removed []*models.PostAttachment
+	for _, a := range attachments {
+		if r.FormValue(fmt.Sprintf("remove_%d", a.ID)) != "" {
+			removed = append(removed, a)
+			continue
+		}
+
+		a.Caption = strings.TrimSpace(r.FormValue(fmt.Sprintf("caption_%d", a.ID)))
+		v.CheckField(validator.MaxChars(a.Caption, maxAttachmentCaption), "attachments",
+			fmt.Sprintf("Captions must not be more than %d characters long", maxAttachmentCaption))
+
+		position, err := strconv.Atoi(r.FormValue(fmt.Sprintf("position_%d", a.ID)))
+		if err == nil {
+			a.Position = position
+		}
+		kept = append(kept, a)
+	}
+
+	imgs, message, err := readUploads(r, maxAttachments-len(kept))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if message != "" {
+		v.AddFieldError("images", message)
+	}
+
+	checkPostForm(&v, form)
 
 	if !v.Valid() {
 		categories, err := app.Categories.GetAll()
@@ -585,53 +531,183 @@ func (app *Application) postEditPost(w http.ResponseWriter, r *http.Request) {
 			return
 		}
 
+		post.Title = title
+		post.Content = content
+		post.CategoryID = categoryID
 		data := templateData{
-			Form:       form,
-			FormErrors: v.FieldErrors,
-			Categories: categories,
+			Post:        post,
+			Form:        form,
+			FormErrors:  v.FieldErrors,
+			Categories:  categories,
+			Attachments: attachments,
 		}
 
 		app.render(w, r, http.StatusUnprocessableEntity, "edit_post.html", data)
 		return
 	}
 
-	imgUrl := post.ImgUrl
-	if imgErr != http.ErrMissingFile {
-		newFileName, err := generateUniqueFileName(header.Filename)
+	err = app.Posts.UpdatePost(postID, userID, title, content, "", categoryID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	for _, a := range kept {
+		err = app.PostAttachments.Update(post.ID, a.ID, a.Caption, a.Position)
 		if err != nil {
 			app.serverError(w, r, err)
 			return
 		}
+	}
 
-		dst, err := os.Create("./data/imgs/" + newFileName)
+	for _, a := range removed {
+		err = app.PostAttachments.Delete(post.ID, a.ID)
 		if err != nil {
 			app.serverError(w, r, err)
 			return
 		}
-		defer dst.Close()
+		app.releaseImage(a.Name)
+	}
+
+	err = app.attachImages(post.ID, imgs)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/post/view?id=%d", postID), http.StatusSeeOther)
+}
+
+// reactToPost toggles the user's like or dislike on a post, keeps the cached
+// counters on the post in sync and notifies the post owner.
+func (app *Application) reactToPost(userID int, post *models.Post, reaction string) error {
+	existingReaction, err := app.PostReactions.GetReaction(userID, post.ID)
+	if err != nil && err != models.ErrNoReaction {
+		return err
+	}
+
+	newLikeCount := post.LikeCount
+	newDislikeCount := post.DislikeCount
+
+	if existingReaction != nil {
+		if existingReaction.Type == reaction {
+			err = app.PostReactions.DeleteReaction(userID, post.ID)
+			if err != nil {
+				return err
+			}
+			if reaction == "like" {
+				newLikeCount--
+			} else {
+				newDislikeCount--
+			}
+		} else {
+			err = app.PostReactions.UpdateReaction(userID, post.ID, reaction)
+			if err != nil {
+				return err
+			}
+			if reaction == "like" {
+				newLikeCount++
+				newDislikeCount--
+			} else {
+				newLikeCount--
+				newDislikeCount++
+			}
+		}
+	} else {
+		err = app.PostReactions.AddReaction(userID, post.ID, reaction)
+		if err != nil {
+			return err
+		}
+		if reaction == "like" {
+			newLikeCount++
+		} else {
+			newDislikeCount++
+		}
+	}
+
+	err = app.Posts.UpdatePostLikeDislikeCounts(post.ID, newLikeCount, newDislikeCount)
+	if err != nil {
+		return err
+	}
+	post.LikeCount = newLikeCount
+	post.DislikeCount = newDislikeCount
+
+	if post.OwnerID != userID {
+		var notifType string
+		if reaction == "like" {
+			notifType = "post_like"
+		} else {
+			notifType = "post_dislike"
+		}
 
-		_, err = io.Copy(dst, file)
+		_, err = app.Notifications.Insert(
+			notifType,
+			userID,
+			post.OwnerID,
+			post.ID,
+			nil,
+		)
 		if err != nil {
-			app.serverError(w, r, err)
-			return
+			return err
 		}
+	}
 
-		imgUrl = newFileName
+	return nil
+}
 
-		if post.ImgUrl != "" {
-			imagePath := "./data/imgs/" + post.ImgUrl
-			err = os.Remove(imagePath)
-			if err != nil && !os.IsNotExist(err) {
-				app.Logger.Error("Error deleting image file: %s, error: %v\n", imagePath, err)
-			}
+// purgePost removes a post for good together with its reactions, comments,
+// notifications and images.
+func (app *Application) purgePost(post *models.Post) error {
+	err := app.PostReactions.DeleteReactionsByPostId(post.ID)
+	if err != nil {
+		return err
+	}
+
+	err = app.Notifications.DeleteByPostID(post.ID)
+	if err != nil {
+		return err
+	}
+
+	attachments, err := app.PostAttachments.GetByPostID(post.ID)
+	if err != nil {
+		return err
+	}
+
+	err = app.PostAttachments.DeleteByPostID(post.ID)
+	if err != nil {
+		return err
+	}
+
+	comments, err := app.Comments.GetAllByPostId(post.ID)
+	if err != nil {
+		return err
+	}
+
+	for _, comment := range comments {
+		err = app.CommentsReactions.DeleteReactioByCommentId(comment.ID)
+		if err != nil {
+			return err
 		}
 	}
 
-	err = app.Posts.UpdatePost(postID, title, content, imgUrl, categoryID)
+	err = app.Comments.DeleteCommentsByPostId(post.ID)
 	if err != nil {
-		app.serverError(w, r, err)
-		return
+		return err
 	}
 
-	http.Redirect(w, r, fmt.Sprintf("/post/view?id=%d", postID), http.StatusSeeOther)
+	err = app.Posts.DeletePostById(post.ID)
+	if err != nil {
+		return err
+	}
+
+	if post.ImgUrl != "" {
+		app.releaseImage(post.ImgUrl)
+	}
+	for _, a := range attachments {
+		if a.Name != post.ImgUrl {
+			app.releaseImage(a.Name)
+		}
+	}
+
+	return nil
 }
@@ -0,0 +1,123 @@
+package handlers
+
+import (
+	"errors"
+	"game-forum-abaliyev-ashirbay/internal/models"
+	"game-forum-abaliyev-ashirbay/internal/validator"
+	"net/http"
+	"net/url"
+	"strings"
+)
+
+const (
+	profileActivityLimit = 10
+	activityExcerptChars = 200
+	bioMaxChars          = 500
+)
+
+// reservedUsernames are taken by pages under /user/, a profile with one of
+// these names could not be opened.
+var reservedUsernames = map[string]bool{
+	"personal-page": true,
+	"profile":       true,
+	"avatar":        true,
+	"tokens":        true,
+	"identities":    true,
+	"2fa":           true,
+	"sessions":      true,
+	"notifications": true,
+	"settings":      true,
+	"export":        true,
+}
+
+// deletedUsernamePrefix starts the names deleted accounts are renamed to.
+const deletedUsernamePrefix = "deleted-"
+
+func reservedUsername(username string) bool {
+	username = strings.ToLower(username)
+	return reservedUsernames[username] || strings.HasPrefix(username, deletedUsernamePrefix)
+}
+
+// userURL is the address of the public profile of username.
+func userURL(username string) string {
+	return "/user/" + url.PathEscape(username)
+}
+
+func (app *Application) userProfile(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	profile, err := app.Profiles.GetByUsername(r.PathValue("username"))
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	activity, err := app.Profiles.RecentActivity(profile.UserID, profileActivityLimit)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	for _, a := range activity {
+		if excerpt := truncateRunes(a.Text, activityExcerptChars); excerpt != a.Text {
+			a.Text = excerpt + "…"
+		}
+	}
+
+	data := templateData{
+		Profile:  profile,
+		Activity: activity,
+	}
+
+	app.render(w, r, http.StatusOK, "profile.html", data)
+}
+
+func (app *Application) profileBioPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := app.authenticatedUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	bio := strings.TrimSpace(r.PostForm.Get("bio"))
+
+	v := validator.Validator{}
+	v.CheckField(validator.MaxChars(bio, bioMaxChars), "bio", "Bio must not exceed 500 characters")
+
+	if !v.Valid() {
+		data, err := app.personalPageData(user.ID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		// Show what was typed
+		data.Profile.Bio = bio
+		data.FormErrors = v.FieldErrors
+		app.render(w, r, http.StatusUnprocessableEntity, "personal_page.html", data)
+		return
+	}
+
+	err = app.Profiles.UpdateBio(user.ID, bio)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, userURL(user.Username), http.StatusSeeOther)
+}
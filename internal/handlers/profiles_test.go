@@ -0,0 +1,182 @@
+package handlers_test
+
+import (
+	"bytes"
+	"image"
+	"image/color"
+	"image/png"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+
+	"game-forum-abaliyev-ashirbay/internal/storage"
+)
+
+var _ = ginkgo.Describe("User profiles", func() {
+	var (
+		app      *testApp
+		imageDir string
+		mod      *testSession
+	)
+
+	ginkgo.BeforeEach(func() {
+		app = newTestApp("198.51.100.4")
+		imageDir = ginkgo.GinkgoT().TempDir()
+		app.Images = storage.NewLocalStore(imageDir)
+
+		_, err := app.DB.Exec(`
+		INSERT INTO Categories (name) VALUES ('Speedruns');
+
+		INSERT INTO Users (id, email, username, password, role, created_at, bio) VALUES
+			(1, 'mod@example.com', 'Mod Erator', '', 'moderator', '2026-01-02 10:00:00', 'I keep things tidy'),
+			(2, 'other@example.com', 'other', '', 'user', '2026-03-04 10:00:00', '');
+
+		INSERT INTO Posts (title, content, createdAt, category_id, owner_id, like_count, dislike_count) VALUES
+			('Speedrun tips', 'Skip the cutscenes', '2026-05-01 10:00:00', 1, 1, 4, 1),
+			('Other post', 'Not by the moderator', '2026-05-02 10:00:00', 1, 2, 7, 0);
+
+		INSERT INTO Comments (post_id, user_id, created_at, text, like_count, dislike_count) VALUES
+			(2, 1, '2026-05-03 10:00:00', 'Nice find', 2, 0);
+		`)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		mod = app.login(1, "mod-session")
+	})
+
+	get := func(path string) *httptest.ResponseRecorder {
+		return app.get(nil, path)
+	}
+
+	ginkgo.It("shows the join date, role, counts, reputation and recent activity", func() {
+		rr := get("/user/Mod%20Erator")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+
+		body := rr.Body.String()
+		gomega.Expect(body).To(gomega.ContainSubstring("Joined 02 Jan 2026"))
+		gomega.Expect(body).To(gomega.ContainSubstring(`role-moderator`))
+		gomega.Expect(body).To(gomega.ContainSubstring("1 posts"))
+		gomega.Expect(body).To(gomega.ContainSubstring("1 comments"))
+		gomega.Expect(body).To(gomega.ContainSubstring("Reputation 6"))
+		gomega.Expect(body).To(gomega.ContainSubstring("I keep things tidy"))
+
+		// Newest first, comments name the post they were made on
+		comment := strings.Index(body, "Commented: Nice find")
+		post := strings.Index(body, "Speedrun tips")
+		gomega.Expect(comment).To(gomega.BeNumerically(">", 0))
+		gomega.Expect(comment).To(gomega.BeNumerically("<", post))
+
+		gomega.Expect(get("/user/nobody").Code).To(gomega.Equal(http.StatusNotFound))
+	})
+
+	ginkgo.It("leaves what is in the trash out of the counts and reputation", func() {
+		_, err := app.DB.Exec(`UPDATE Posts SET deleted_at = datetime('now'), deleted_by = 1 WHERE owner_id = 1`)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		body := get("/user/Mod%20Erator").Body.String()
+		gomega.Expect(body).To(gomega.ContainSubstring("0 posts"))
+		gomega.Expect(body).To(gomega.ContainSubstring("Reputation 2"))
+		gomega.Expect(body).ToNot(gomega.ContainSubstring("Speedrun tips"))
+	})
+
+	ginkgo.It("lets users edit their bio", func() {
+		post := func(bio string) *httptest.ResponseRecorder {
+			return app.postForm(mod, "/user/profile/bio", url.Values{"bio": {bio}})
+		}
+
+		rr := post("  Speedrunner since 2010  ")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+		gomega.Expect(rr.Header().Get("Location")).To(gomega.Equal("/user/Mod%20Erator"))
+
+		var bio string
+		gomega.Expect(app.DB.QueryRow(`SELECT bio FROM Users WHERE id = 1`).Scan(&bio)).To(gomega.Succeed())
+		gomega.Expect(bio).To(gomega.Equal("Speedrunner since 2010"))
+	})
+
+	ginkgo.Describe("avatars", func() {
+		uploadAvatar := func(picture []byte) *httptest.ResponseRecorder {
+			return app.postMultipart(mod, "/user/avatar", nil, "avatar", upload{"me.png", picture})
+		}
+
+		decode := func(rr *httptest.ResponseRecorder) image.Image {
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(rr.Header().Get("Content-Type")).To(gomega.Equal("image/png"))
+			img, err := png.Decode(rr.Body)
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+			return img
+		}
+
+		ginkgo.It("draws the same identicon every time for users without one", func() {
+			first := get("/avatars/2/64").Body.Bytes()
+			gomega.Expect(get("/avatars/2/64").Body.Bytes()).To(gomega.Equal(first))
+			gomega.Expect(get("/avatars/1/64").Body.Bytes()).ToNot(gomega.Equal(first))
+
+			img := decode(get("/avatars/2/64"))
+			gomega.Expect(img.Bounds().Dx()).To(gomega.Equal(64))
+
+			gomega.Expect(get("/avatars/2/100").Code).To(gomega.Equal(http.StatusNotFound))
+			gomega.Expect(get("/avatars/99/64").Code).To(gomega.Equal(http.StatusNotFound))
+		})
+
+		ginkgo.It("crops and resizes uploads, and goes back to the identicon", func() {
+			identicon := get("/avatars/1/32").Body.Bytes()
+
+			// A wide picture, red in the middle and blue at the sides
+			picture := image.NewRGBA(image.Rect(0, 0, 300, 100))
+			for y := 0; y < 100; y++ {
+				for x := 0; x < 300; x++ {
+					c := color.RGBA{0, 0, 255, 255}
+					if x >= 100 && x < 200 {
+						c = color.RGBA{255, 0, 0, 255}
+					}
+					picture.Set(x, y, c)
+				}
+			}
+			var buf bytes.Buffer
+			gomega.Expect(png.Encode(&buf, picture)).To(gomega.Succeed())
+
+			rr := uploadAvatar(buf.Bytes())
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+
+			for _, size := range []int{32, 64, 256} {
+				img := decode(get("/avatars/1/" + strconv.Itoa(size)))
+				gomega.Expect(img.Bounds().Dx()).To(gomega.Equal(size))
+				gomega.Expect(img.Bounds().Dy()).To(gomega.Equal(size))
+				r, g, b, _ := img.At(0, 0).RGBA()
+				gomega.Expect([]uint32{r >> 8, g >> 8, b >> 8}).To(gomega.Equal([]uint32{255, 0, 0}))
+			}
+			files, err := os.ReadDir(filepath.Join(imageDir, "avatars"))
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+			gomega.Expect(files).To(gomega.HaveLen(3))
+
+			// No post shows them, but the sweep of unused images keeps them
+			swept, err := app.SweepImages(time.Now().Add(time.Hour))
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+			gomega.Expect(swept).To(gomega.Equal(0))
+
+			rr = app.postForm(mod, "/user/avatar/delete", nil)
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+
+			gomega.Expect(get("/avatars/1/32").Body.Bytes()).To(gomega.Equal(identicon))
+			files, err = os.ReadDir(filepath.Join(imageDir, "avatars"))
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+			gomega.Expect(files).To(gomega.BeEmpty())
+		})
+
+		ginkgo.It("rejects an upload larger than the form of the largest picture", func() {
+			rr := uploadAvatar(make([]byte, 7<<20))
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusBadRequest))
+
+			var avatar string
+			gomega.Expect(app.DB.QueryRow(`SELECT avatar FROM Users WHERE id = 1`).Scan(&avatar)).To(gomega.Succeed())
+			gomega.Expect(avatar).To(gomega.BeEmpty())
+		})
+	})
+})
@@ -1,6 +1,7 @@
 package handlers
 
 import (
+	"fmt"
 	"game-forum-abaliyev-ashirbay/internal/models"
 	"game-forum-abaliyev-ashirbay/internal/validator"
 	"net/http"
@@ -54,6 +55,7 @@ func (app *Application) RegisterPost(w http.ResponseWriter, r *http.Request) {
 
 	v.CheckField(validator.NotBlank(form.Username), "username", "Username cannot be blank")
 	v.CheckField(validator.MaxChars(form.Username, 30), "username", "Username must not exceed 30 characters")
+	v.CheckField(!reservedUsername(form.Username), "username", "Username is not available")
 
 	v.CheckField(validator.NotBlank(form.Password), "password", "Password cannot be blank")
 	v.CheckField(validator.MinChars(form.Password, 8), "password", "Password must be at least 8 characters long")
@@ -77,7 +79,11 @@ func (app *Application) RegisterPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	_, err = app.Users.Insert(form.Email, form.Username, hashedPassword, false)
+	// Without a mailer there is no way to verify the address, the account
+	// is usable right away
+	verify := app.Mailer != nil
+
+	id, err := app.Users.Insert(form.Email, form.Username, hashedPassword, !verify)
 	if err != nil {
 		if err == models.ErrDuplicateEmail {
 			v.AddFieldError("email", "Email is already in use")
@@ -97,5 +103,27 @@ func (app *Application) RegisterPost(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	http.Redirect(w, r, "/login", http.StatusSeeOther)
+	if !verify {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	user, err := app.Users.GetById(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// The account exists either way, a failed mail can be sent again from
+	// the page
+	err = app.sendVerificationEmail(user, user.Email)
+	if err != nil {
+		app.Logger.Error("sending verification email", "user", user.ID, "err", err)
+	}
+
+	data := templateData{
+		Form:    emailForm{Email: user.Email},
+		Message: fmt.Sprintf("Almost done! We sent a link to %s, open it to activate your account.", user.Email),
+	}
+	app.render(w, r, http.StatusCreated, "verify_email.html", data)
 }
@@ -178,7 +178,9 @@ func createTestSchema(db *sql.DB) error {
 		password VARCHAR(255) NOT NULL,
 		email VARCHAR(100) NOT NULL UNIQUE,
 		role VARCHAR(20) NOT NULL DEFAULT 'user',
-		enabled BOOLEAN NOT NULL DEFAULT 1
+		enabled BOOLEAN NOT NULL DEFAULT 1,
+		created_at DATETIME,
+		bio TEXT NOT NULL DEFAULT ''
 	);
     `
 	_, err := db.Exec(userTable)
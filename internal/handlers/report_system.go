@@ -1,7 +1,9 @@
 package handlers
 
 import (
+	"errors"
 	"fmt"
+	"game-forum-abaliyev-ashirbay/internal/models"
 	"net/http"
 	"strconv"
 	"time"
@@ -114,8 +116,8 @@ func (app *Application) adminReportDeletePost(w http.ResponseWriter, r *http.Req
 		return
 	}
 
-	err = app.Posts.DeletePostById(report.PostID)
-	if err != nil {
+	err = app.Posts.SoftDelete(report.PostID, user.ID)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
 		app.serverError(w, r, err)
 		return
 	}
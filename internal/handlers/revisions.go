@@ -0,0 +1,257 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"game-forum-abaliyev-ashirbay/internal/diff"
+	"game-forum-abaliyev-ashirbay/internal/models"
+	"net/http"
+	"strconv"
+)
+
+// diffContext is how many unchanged lines are shown around a change.
+const diffContext = 2
+
+// maxRevisionsShown is how many of the latest revisions a post lists.
+const maxRevisionsShown = 20
+
+// maxDiffBytes bounds the content of the two versions a diff is computed
+// for, larger edits are only described as too large to show.
+const maxDiffBytes = 64 << 10
+
+// revisionHistory is the edit history shown under a post. Total counts all
+// revisions, only the latest maxRevisionsShown are in Revisions. Open is set
+// when the changes of a revision were asked for.
+type revisionHistory struct {
+	Revisions []revisionView
+	Total     int
+	Open      bool
+}
+
+// revisionView is a revision of a post with what changed since the one
+// before it. The first revision, the post as written, has no changes.
+type revisionView struct {
+	*models.PostRevision
+	Latest       bool
+	CategoryName string
+
+	// PreviousTitle and PreviousCategory are set when the revision changed
+	// them
+	PreviousTitle    string
+	PreviousCategory string
+
+	// Shown is set for the revision whose content changes were asked for,
+	// Diff holds them unless the content is too large to compare
+	Shown    bool
+	TooLarge bool
+	Diff     []diffLine
+}
+
+// diffLine is a line of a content diff. Skipped stands for unchanged lines
+// that are left out.
+type diffLine struct {
+	Class   string
+	Text    string
+	Skipped bool
+}
+
+// postRevisions loads the latest revisions of the post, the latest first,
+// and notes the title and category changes of each. The content is only
+// compared for the revision numbered shown, 0 compares none.
+func (app *Application) postRevisions(postID int, shown int) (*revisionHistory, error) {
+	total, err := app.PostRevisions.Count(postID)
+	if err != nil || total == 0 {
+		return nil, err
+	}
+
+	// One more than shown, to tell what the oldest shown one changed
+	revisions, err := app.PostRevisions.GetLatest(postID, maxRevisionsShown+1)
+	if err != nil {
+		return nil, err
+	}
+
+	categories, err := app.Categories.GetAll()
+	if err != nil {
+		return nil, err
+	}
+	categoryNames := map[int]string{}
+	for _, c := range categories {
+		categoryNames[c.ID] = c.Name
+	}
+
+	history := &revisionHistory{Total: total}
+	for i, rev := range revisions[:min(len(revisions), maxRevisionsShown)] {
+		view := revisionView{
+			PostRevision: rev,
+			Latest:       i == 0,
+			CategoryName: categoryNames[rev.CategoryID],
+		}
+
+		if i+1 < len(revisions) {
+			prev := revisions[i+1]
+			if prev.Title != rev.Title {
+				view.PreviousTitle = prev.Title
+			}
+			if prev.CategoryID != rev.CategoryID {
+				view.PreviousCategory = categoryNames[prev.CategoryID]
+			}
+
+			if rev.Revision == shown {
+				view.Shown = true
+				history.Open = true
+				view.Diff, view.TooLarge, err = app.revisionDiff(postID, prev.Revision, rev.Revision)
+				if err != nil {
+					return nil, err
+				}
+			}
+		}
+
+		history.Revisions = append(history.Revisions, view)
+	}
+
+	return history, nil
+}
+
+// revisionDiff compares the content of two revisions of a post. tooLarge is
+// set instead when they are longer than maxDiffBytes together.
+func (app *Application) revisionDiff(postID int, before, after int) (lines []diffLine, tooLarge bool, err error) {
+	prev, err := app.PostRevisions.Get(postID, before)
+	if err != nil {
+		return nil, false, err
+	}
+	rev, err := app.PostRevisions.Get(postID, after)
+	if err != nil {
+		return nil, false, err
+	}
+
+	if len(prev.Content)+len(rev.Content) > maxDiffBytes {
+		return nil, true, nil
+	}
+	return diffLines(prev.Content, rev.Content), false, nil
+}
+
+// diffLines compares two versions of a post and keeps the changed lines
+// with diffContext unchanged lines around them. It returns nil when the
+// content did not change.
+func diffLines(before, after string) []diffLine {
+	lines := diff.Lines(before, after)
+
+	changed := false
+	keep := make([]bool, len(lines))
+	for i, l := range lines {
+		if l.Op == diff.Equal {
+			continue
+		}
+		changed = true
+		for j := max(0, i-diffContext); j <= min(len(lines)-1, i+diffContext); j++ {
+			keep[j] = true
+		}
+	}
+
+	if !changed {
+		return nil
+	}
+
+	var out []diffLine
+	for i, l := range lines {
+		if !keep[i] {
+			if len(out) == 0 || !out[len(out)-1].Skipped {
+				out = append(out, diffLine{Skipped: true})
+			}
+			continue
+		}
+
+		switch l.Op {
+		case diff.Insert:
+			out = append(out, diffLine{Class: "diff-insert", Text: "+ " + l.Text})
+		case diff.Delete:
+			out = append(out, diffLine{Class: "diff-delete", Text: "- " + l.Text})
+		default:
+			out = append(out, diffLine{Class: "diff-equal", Text: "  " + l.Text})
+		}
+	}
+
+	return out
+}
+
+// canRevert reports whether user may restore an earlier revision of post:
+// its author and admins can.
+func canRevert(user *models.User, post *models.Post) bool {
+	return user != nil && (user.ID == post.OwnerID || user.Role == "admin")
+}
+
+// postRevert makes an earlier revision the current version of a post. The
+// revert is recorded as a new revision, so nothing is lost.
+func (app *Application) postRevert(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	postID, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || postID < 1 {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+	revision, err := strconv.Atoi(r.FormValue("revision"))
+	if err != nil || revision < 1 {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	userID, err := app.getAuthenticatedUserID(r)
+	if err != nil {
+		app.notAuthenticated(w, r)
+		return
+	}
+
+	post, err := app.Posts.Get(postID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	user, err := app.Users.GetById(userID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !canRevert(user, post) {
+		app.clientError(w, r, http.StatusForbidden)
+		return
+	}
+
+	rev, err := app.PostRevisions.Get(post.ID, revision)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	// The category of the revision may be gone by now, the post keeps its
+	// current one then
+	categoryID := rev.CategoryID
+	_, err = app.Categories.Get(categoryID)
+	if errors.Is(err, models.ErrNoRecord) {
+		categoryID = post.CategoryID
+	} else if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.Posts.UpdatePost(post.ID, user.ID, rev.Title, rev.Content, "", categoryID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, fmt.Sprintf("/post/view?id=%d#revisions", post.ID), http.StatusSeeOther)
+}
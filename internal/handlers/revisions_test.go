@@ -0,0 +1,164 @@
+package handlers_test
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Post revisions", func() {
+	var (
+		app   *testApp
+		users map[string]*testSession
+	)
+
+	ginkgo.BeforeEach(func() {
+		app = newTestApp("198.51.100.10")
+
+		_, err := app.DB.Exec(`
+		INSERT INTO Categories (name) VALUES ('Speedruns'), ('Glitches');
+		INSERT INTO Users (id, email, username, password, role, created_at) VALUES
+		(1, 'player@example.com', 'player', '', 'user', '2026-01-02 10:00:00'),
+		(2, 'rival@example.com', 'rival', '', 'user', '2026-01-02 10:00:00'),
+		(3, 'boss@example.com', 'boss', '', 'admin', '2026-01-02 10:00:00');
+		INSERT INTO Posts (title, content, imgUrl, createdAt, category_id, owner_id, like_count, dislike_count)
+		VALUES ('Any% route', ?, '', '2026-01-02 10:00:00', 1, 1, 0, 0);
+		`, "Start in the castle.\nTake the left door.\nSkip the boss.")
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		users = map[string]*testSession{}
+		for i, name := range []string{"player", "rival", "boss"} {
+			users[name] = app.login(i+1, name+"-session")
+		}
+	})
+
+	edit := func(user string, title, category, content string) *httptest.ResponseRecorder {
+		fields := map[string]string{"title": title, "category_id": category, "content": content}
+		return app.postMultipart(users[user], "/post/edit/post?id=1", fields, "images")
+	}
+
+	revert := func(user string, revision string) *httptest.ResponseRecorder {
+		return app.postForm(users[user], "/post/revert", url.Values{"id": {"1"}, "revision": {revision}})
+	}
+
+	viewPath := func(user string, path string) string {
+		rr := app.get(users[user], path)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		return rr.Body.String()
+	}
+
+	view := func(user string) string {
+		return viewPath(user, "/post/view?id=1")
+	}
+
+	current := func() (title, content string, category int) {
+		err := app.DB.QueryRow(`SELECT title, content, category_id FROM Posts WHERE id = 1`).Scan(&title, &content, &category)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		return title, content, category
+	}
+
+	ginkgo.It("keeps every version of an edited post and shows what changed", func() {
+		gomega.Expect(view("")).ToNot(gomega.ContainSubstring("(edited)"))
+
+		rr := edit("player", "Any% route", "1", "Start in the castle.\nTake the right door.\nSkip the boss.")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+		rr = edit("player", "Any% glitched", "2", "Start in the castle.\nTake the right door.\nSkip the boss.")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+
+		// Saving without changes is not a revision
+		rr = edit("player", "Any% glitched", "2", "Start in the castle.\nTake the right door.\nSkip the boss.")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+
+		var revisions []string
+		rows, err := app.DB.Query(`SELECT revision || ':' || editor_id || ':' || title FROM Post_Revisions WHERE post_id = 1 ORDER BY revision`)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		for rows.Next() {
+			var r string
+			gomega.Expect(rows.Scan(&r)).To(gomega.Succeed())
+			revisions = append(revisions, r)
+		}
+		rows.Close()
+		gomega.Expect(revisions).To(gomega.Equal([]string{"1:1:Any% route", "2:1:Any% route", "3:1:Any% glitched"}))
+
+		body := view("")
+		gomega.Expect(body).To(gomega.ContainSubstring("(edited)"))
+		gomega.Expect(body).To(gomega.ContainSubstring("Edit history (3 revisions)"))
+		gomega.Expect(body).ToNot(gomega.ContainSubstring(`diff-delete`))
+		gomega.Expect(body).To(gomega.ContainSubstring(`href="/post/view?id=1&revision=2#revision-2"`))
+		gomega.Expect(body).To(gomega.ContainSubstring("Title: <del>Any% route</del> → <ins>Any% glitched</ins>"))
+
+		// The content is only compared for the revision asked for
+		body = viewPath("", "/post/view?id=1&revision=2")
+		gomega.Expect(body).To(gomega.ContainSubstring(`<details class="post-revisions" id="revisions" open>`))
+		gomega.Expect(body).To(gomega.ContainSubstring(`<span class="diff-delete">- Take the left door.</span>`))
+		gomega.Expect(body).To(gomega.ContainSubstring(`<span class="diff-insert">&#43; Take the right door.</span>`))
+		gomega.Expect(viewPath("", "/post/view?id=1&revision=3")).To(gomega.ContainSubstring("The content did not change."))
+		gomega.Expect(body).To(gomega.ContainSubstring("Category: <del>Speedruns</del> → <ins>Glitches</ins>"))
+		gomega.Expect(body).ToNot(gomega.ContainSubstring("Revert to this revision"))
+		gomega.Expect(view("rival")).ToNot(gomega.ContainSubstring("Revert to this revision"))
+		gomega.Expect(strings.Count(view("player"), "Revert to this revision")).To(gomega.Equal(2))
+	})
+
+	ginkgo.It("lets the author or an admin revert to an earlier revision", func() {
+		gomega.Expect(edit("player", "Any% glitched", "2", "Clip through the wall.").Code).To(gomega.Equal(http.StatusSeeOther))
+
+		gomega.Expect(revert("rival", "1").Code).To(gomega.Equal(http.StatusForbidden))
+		gomega.Expect(revert("player", "7").Code).To(gomega.Equal(http.StatusNotFound))
+
+		rr := revert("player", "1")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+		gomega.Expect(rr.Header().Get("Location")).To(gomega.Equal("/post/view?id=1#revisions"))
+		title, content, category := current()
+		gomega.Expect(title).To(gomega.Equal("Any% route"))
+		gomega.Expect(content).To(gomega.Equal("Start in the castle.\nTake the left door.\nSkip the boss."))
+		gomega.Expect(category).To(gomega.Equal(1))
+
+		gomega.Expect(revert("boss", "2").Code).To(gomega.Equal(http.StatusSeeOther))
+		_, content, _ = current()
+		gomega.Expect(content).To(gomega.Equal("Clip through the wall."))
+
+		// Reverts are revisions too, so the history stays complete
+		var count, editor int
+		gomega.Expect(app.DB.QueryRow(`SELECT COUNT(*) FROM Post_Revisions WHERE post_id = 1`).Scan(&count)).To(gomega.Succeed())
+		gomega.Expect(count).To(gomega.Equal(4))
+		gomega.Expect(app.DB.QueryRow(`SELECT editor_id FROM Post_Revisions WHERE post_id = 1 AND revision = 4`).Scan(&editor)).To(gomega.Succeed())
+		gomega.Expect(editor).To(gomega.Equal(3))
+	})
+
+	ginkgo.It("keeps the current category when the revision's one is gone", func() {
+		gomega.Expect(edit("player", "Any% glitched", "2", "Clip through the wall.").Code).To(gomega.Equal(http.StatusSeeOther))
+		_, err := app.DB.Exec(`DELETE FROM Categories WHERE id = 1`)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		gomega.Expect(revert("player", "1").Code).To(gomega.Equal(http.StatusSeeOther))
+		title, _, category := current()
+		gomega.Expect(title).To(gomega.Equal("Any% route"))
+		gomega.Expect(category).To(gomega.Equal(2))
+	})
+
+	ginkgo.It("lists only the latest revisions and does not compare huge edits", func() {
+		for i := 0; i < 24; i++ {
+			content := fmt.Sprintf("Version %d of the route.", i)
+			if i == 23 {
+				content = strings.Repeat("Clip through the wall.\n", 4000)
+			}
+			gomega.Expect(edit("player", "Any% route", "1", content).Code).To(gomega.Equal(http.StatusSeeOther))
+		}
+
+		body := view("")
+		gomega.Expect(body).To(gomega.ContainSubstring("Edit history (25 revisions)"))
+		gomega.Expect(body).To(gomega.ContainSubstring("Showing the latest 20."))
+		gomega.Expect(strings.Count(body, `<li class="revision"`)).To(gomega.Equal(20))
+		gomega.Expect(body).To(gomega.ContainSubstring(`id="revision-6"`))
+		gomega.Expect(body).ToNot(gomega.ContainSubstring(`id="revision-5"`))
+
+		body = viewPath("", "/post/view?id=1&revision=25")
+		gomega.Expect(body).To(gomega.ContainSubstring("The changes are too large to show."))
+		gomega.Expect(body).ToNot(gomega.ContainSubstring("diff-insert"))
+	})
+})
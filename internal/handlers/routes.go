@@ -18,19 +18,30 @@ func (app *Application) Routes() http.Handler {
 
 	fileServer := http.FileServer(http.FS(staticFiles))
 
+	// Account management only works with the browser session, never with a
+	// personal API token
+	account := func(h http.HandlerFunc) http.Handler {
+		return app.loginMiddware(app.sessionOnly(h))
+	}
+
 	mux.Handle("/static/", http.StripPrefix("/static/", fileServer))
 
-	mux.Handle("/imgs/", http.StripPrefix("/imgs/", http.FileServer(http.Dir("./data/imgs"))))
+	mux.Handle("/imgs/{name}", imageHeaders(http.HandlerFunc(app.postImage)))
+	mux.HandleFunc("/imgs/thumbs/{name}", app.postThumbnail)
+	mux.HandleFunc("/avatars/{id}/{size}", app.avatarImage)
 
 	mux.HandleFunc("/", app.home)
 	mux.HandleFunc("/post/view", app.postView)
+	mux.HandleFunc("/search", app.search)
 	mux.Handle("/post/reaction", app.loginMiddware(http.HandlerFunc(app.handlePostReaction)))
 
 	mux.Handle("/post/create/post", app.loginMiddware(http.HandlerFunc(app.postCreatePost)))
 	mux.Handle("/post/create", app.loginMiddware(http.HandlerFunc(app.postCreate)))
+	mux.Handle("/post/preview", app.loginMiddware(http.HandlerFunc(app.postPreview)))
 	mux.Handle("/post/delete", app.loginMiddware(http.HandlerFunc(app.postDelete)))
 	mux.Handle("/post/edit", app.loginMiddware(http.HandlerFunc(app.postEdit)))
 	mux.Handle("/post/edit/post", app.loginMiddware(http.HandlerFunc(app.postEditPost)))
+	mux.Handle("/post/revert", app.loginMiddware(http.HandlerFunc(app.postRevert)))
 
 	// Report system routes
 	mux.Handle("/post/report", app.loginMiddware(http.HandlerFunc(app.ReportPost), "moderator", "admin"))
@@ -39,20 +50,54 @@ func (app *Application) Routes() http.Handler {
 	mux.Handle("/comments/create", app.loginMiddware(http.HandlerFunc(app.createCommentPost)))
 	mux.Handle("/comments/reaction", app.loginMiddware(http.HandlerFunc(app.handleCommentReaction)))
 	mux.Handle("/comments/delete", app.loginMiddware(http.HandlerFunc(app.commentDelete)))
+	mux.Handle("/comments/edit", app.loginMiddware(http.HandlerFunc(app.commentEdit)))
+	mux.Handle("/comments/edit/post", app.loginMiddware(http.HandlerFunc(app.commentEditPost)))
 
 	mux.Handle("/user/personal-page", app.loginMiddware(http.HandlerFunc(app.personalPage)))
+	mux.Handle("/user/tokens/create", account(app.apiTokenCreatePost))
+	mux.Handle("/user/tokens/revoke", account(app.apiTokenRevoke))
+	mux.Handle("/user/identities/link", account(app.identityLink))
+	mux.Handle("/user/identities/unlink", account(app.identityUnlink))
+	mux.Handle("/user/2fa", account(app.twoFactorPage))
+	mux.Handle("/user/2fa/setup", account(app.twoFactorSetup))
+	mux.Handle("/user/2fa/confirm", account(app.twoFactorConfirm))
+	mux.Handle("/user/2fa/recovery-codes", account(app.twoFactorRecoveryCodes))
+	mux.Handle("/user/2fa/disable", account(app.twoFactorDisable))
+	mux.Handle("/user/sessions", account(app.sessionsPage))
+	mux.Handle("/user/sessions/revoke", account(app.sessionRevoke))
+	mux.Handle("/user/sessions/revoke-others", account(app.sessionRevokeOthers))
 	mux.Handle("/user/notifications", app.loginMiddware(http.HandlerFunc(app.notificationsPage)))
+	mux.Handle("/user/profile/bio", app.loginMiddware(http.HandlerFunc(app.profileBioPost)))
+	mux.Handle("/user/avatar", app.loginMiddware(http.HandlerFunc(app.avatarUploadPost)))
+	mux.Handle("/user/avatar/delete", app.loginMiddware(http.HandlerFunc(app.avatarDeletePost)))
+	mux.Handle("/user/settings", account(app.settingsPage))
+	mux.Handle("/user/settings/username", account(app.settingsUsernamePost))
+	mux.Handle("/user/settings/email", account(app.settingsEmailPost))
+	mux.Handle("/user/settings/email/confirm", account(app.settingsEmailConfirm))
+	mux.Handle("/user/settings/password", account(app.settingsPasswordPost))
+	mux.Handle("/user/export", account(app.dataExport))
+	mux.Handle("/user/settings/delete", account(app.settingsDeletePost))
+	mux.Handle("/user/settings/reauth", account(app.settingsReauthPost))
+	mux.Handle("/user/settings/reauth/confirm", account(app.settingsReauthConfirm))
+	mux.HandleFunc("/user/{username}", app.userProfile)
 
 	mux.HandleFunc("/register", app.register)
 	mux.HandleFunc("/register/post", app.RegisterPost)
 	mux.HandleFunc("/login", app.login)
 	mux.HandleFunc("/login/post", app.LoginPost)
+	mux.HandleFunc("/login/2fa", app.loginSecondFactor)
+	mux.HandleFunc("/login/2fa/post", app.loginSecondFactorPost)
+	mux.HandleFunc("/verify-email", app.verifyEmail)
+	mux.HandleFunc("/verify-email/resend", app.verifyEmailResend)
+	mux.HandleFunc("/verify-email/resend/post", app.verifyEmailResendPost)
+	mux.HandleFunc("/password/forgot", app.forgotPassword)
+	mux.HandleFunc("/password/forgot/post", app.forgotPasswordPost)
+	mux.HandleFunc("/password/reset", app.resetPassword)
+	mux.HandleFunc("/password/reset/post", app.resetPasswordPost)
 	mux.HandleFunc("/logout", app.logout)
 	// external authentication
-	mux.HandleFunc("/auth/google", app.googleLogin)
-	mux.HandleFunc("/auth/google/callback", app.googleCallback)
-	mux.HandleFunc("/auth/github", app.githubLogin)
-	mux.HandleFunc("/auth/github/callback", app.githubCallback)
+	mux.HandleFunc("/auth/{provider}", app.oauthLogin)
+	mux.HandleFunc("/auth/{provider}/callback", app.oauthCallback)
 
 	// Promotion request routes
 	mux.Handle("/promotion_requests", app.loginMiddware(http.HandlerFunc(app.getAllPromotionRequests)))
@@ -67,11 +112,20 @@ func (app *Application) Routes() http.Handler {
 	// Admin panel routes
 
 	mux.Handle("/admin/users/change_role", app.loginMiddware(http.HandlerFunc(app.changeUserRole), "admin"))
+	mux.Handle("/admin/users/suspend", app.loginMiddware(http.HandlerFunc(app.suspendUser), "admin"))
+	mux.Handle("/admin/users/unsuspend", app.loginMiddware(http.HandlerFunc(app.unsuspendUser), "admin"))
+	mux.Handle("/admin/2fa/roles", app.loginMiddware(http.HandlerFunc(app.twoFactorRequiredRoles), "admin"))
 
 	mux.Handle("/admin", app.loginMiddware(http.HandlerFunc(app.adminPanel), "admin"))
 	mux.Handle("/admin/categories/create", app.loginMiddware(http.HandlerFunc(app.categoryCreate), "admin"))
 	mux.Handle("/admin/categories/create/post", app.loginMiddware(http.HandlerFunc(app.categoryCreatePost), "admin"))
 	mux.Handle("/admin/categories/delete", app.loginMiddware(http.HandlerFunc(app.DeleteCategory), "admin"))
+	mux.Handle("/admin/trash", app.loginMiddware(http.HandlerFunc(app.adminTrash), "admin"))
+	mux.Handle("/admin/trash/restore", app.loginMiddware(http.HandlerFunc(app.adminTrashRestore), "admin"))
+	mux.Handle("/admin/trash/purge", app.loginMiddware(http.HandlerFunc(app.adminTrashPurge), "admin"))
+
+	// JSON API
+	mux.Handle("/api/v1/", app.apiRoutes())
 
-	return app.rateLimitMiddleware(app.secureHeaders(mux))
+	return app.rateLimitMiddleware(app.secureHeaders(app.trackSession(app.csrfProtect(mux))))
 }
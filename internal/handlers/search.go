@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"game-forum-abaliyev-ashirbay/internal/validator"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+type searchForm struct {
+	Query string
+}
+
+func (app *Application) search(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	query := strings.TrimSpace(r.URL.Query().Get("q"))
+
+	page, err := strconv.Atoi(r.URL.Query().Get("page"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	pageSize, err := strconv.Atoi(r.URL.Query().Get("pageSize"))
+	if err != nil || pageSize < 1 || pageSize > 100 {
+		pageSize = 10
+	}
+
+	form := searchForm{Query: query}
+
+	v := validator.Validator{}
+	v.CheckField(validator.MaxChars(query, 200), "q", "Search query must not exceed 200 characters")
+
+	if !v.Valid() {
+		data := templateData{
+			Form:       form,
+			FormErrors: v.FieldErrors,
+		}
+		app.render(w, r, http.StatusUnprocessableEntity, "search.html", data)
+		return
+	}
+
+	results, err := app.Search.Search(query, page, pageSize)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	totalResults, err := app.Search.CountResults(query)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	totalPages := int(math.Ceil(float64(totalResults) / float64(pageSize)))
+
+	data := templateData{
+		Form:          form,
+		SearchResults: results,
+		TotalResults:  totalResults,
+		CurrentPage:   page,
+		TotalPages:    totalPages,
+		VisiblePages:  visiblePages(page, totalPages),
+		PageSize:      pageSize,
+	}
+
+	app.render(w, r, http.StatusOK, "search.html", data)
+}
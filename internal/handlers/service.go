@@ -1,9 +1,13 @@
 package handlers
 
 import (
+	"game-forum-abaliyev-ashirbay/internal/mailer"
 	"game-forum-abaliyev-ashirbay/internal/models"
+	"game-forum-abaliyev-ashirbay/internal/oauth"
+	"game-forum-abaliyev-ashirbay/internal/storage"
 	"html/template"
 	"log/slog"
+	"time"
 )
 
 const (
@@ -28,13 +32,54 @@ type Application struct {
 	ReportReasons     models.ReportsReasonsModelInterface
 
 	// authentication optional
-	GoogleClientID     string
-	GoogleClientSecret string
-	GitHubClientID     string
-	GitHubClientSecret string
+	OAuthProviders       []oauth.Provider
+	OAuthRedirectBaseURL string
+	OAuthStates          models.OAuthStatesModelInterface
+	UserIdentities       models.UserIdentitiesModelInterface
+
+	// Email verification and password reset. Without a Mailer accounts
+	// are enabled on registration. BaseURL is prepended to mailed links.
+	Mailer     mailer.Mailer
+	UserTokens models.UserTokensModelInterface
+	BaseURL    string
 
 	// Notifications optional
 	Notifications models.NotificationsModelInterface
+
+	Search models.SearchModelInterface
+
+	ApiTokens models.ApiTokensModelInterface
+
+	Suspensions models.SuspensionsModelInterface
+
+	TwoFactor       models.TwoFactorModelInterface
+	LoginChallenges models.LoginChallengesModelInterface
+
+	LoginAttempts models.LoginAttemptsModelInterface
+
+	Profiles models.ProfilesModelInterface
+
+	PostAttachments models.PostAttachmentsModelInterface
+	PostRevisions   models.PostRevisionsModelInterface
+
+	Trash models.TrashModelInterface
+
+	// Images keeps the images attached to posts and the uploaded avatars,
+	// ./data/imgs on the local disk when nil.
+	Images storage.Store
+
+	// Sessions expire after SessionLifetime without activity, or after
+	// RememberLifetime when "remember me" was ticked on login.
+	SessionLifetime  time.Duration
+	RememberLifetime time.Duration
+
+	// Authors can edit their comments for CommentEditWindow after posting
+	// them, 15 minutes when zero. Admins can edit any comment at any time.
+	CommentEditWindow time.Duration
+
+	// Deleted posts and comments are purged once they have been in the
+	// trash for TrashRetention.
+	TrashRetention time.Duration
 }
 
 func NewApp(
@@ -51,11 +96,29 @@ func NewApp(
 	promotionRequests *models.PromotionRequestsModel,
 	reports *models.ReportsModel, 
 	reportReasons *models.ReportReasonsModel, 
-	googleClientID string,
-	googleClientSecret string,
-	gitHubClientID string,
-	gitHubClientSecret string,
+	oauthProviders []oauth.Provider,
+	oauthRedirectBaseURL string,
 	notifications *models.NotificationsModel,
+	search *models.SearchModel,
+	apiTokens *models.ApiTokensModel,
+	sessionLifetime time.Duration,
+	rememberLifetime time.Duration,
+	oauthStates *models.OAuthStatesModel,
+	userIdentities *models.UserIdentitiesModel,
+	userTokens *models.UserTokensModel,
+	mailer mailer.Mailer,
+	baseURL string,
+	suspensions *models.SuspensionsModel,
+	twoFactor *models.TwoFactorModel,
+	loginChallenges *models.LoginChallengesModel,
+	loginAttempts *models.LoginAttemptsModel,
+	profiles *models.ProfilesModel,
+	postAttachments *models.PostAttachmentsModel,
+	postRevisions *models.PostRevisionsModel,
+	trash *models.TrashModel,
+	images storage.Store,
+	commentEditWindow time.Duration,
+	trashRetention time.Duration,
 ) *Application {
 	app := &Application{
 		Addr:              addr,
@@ -72,12 +135,41 @@ func NewApp(
 		Reports:           reports,       
 		ReportReasons:     reportReasons, 
 
-		GoogleClientID:     googleClientID,
-		GoogleClientSecret: googleClientSecret,
-		GitHubClientID:     gitHubClientID,
-		GitHubClientSecret: gitHubClientSecret,
+		OAuthProviders:       oauthProviders,
+		OAuthRedirectBaseURL: oauthRedirectBaseURL,
+		OAuthStates:          oauthStates,
+		UserIdentities:       userIdentities,
+
+		Mailer:     mailer,
+		UserTokens: userTokens,
+		BaseURL:    baseURL,
 
 		Notifications: notifications,
+
+		Search: search,
+
+		ApiTokens: apiTokens,
+
+		Suspensions: suspensions,
+
+		TwoFactor:       twoFactor,
+		LoginChallenges: loginChallenges,
+
+		LoginAttempts: loginAttempts,
+
+		Profiles: profiles,
+
+		PostAttachments: postAttachments,
+		PostRevisions:   postRevisions,
+		Images:          images,
+
+		Trash: trash,
+
+		SessionLifetime:  sessionLifetime,
+		RememberLifetime: rememberLifetime,
+
+		CommentEditWindow: commentEditWindow,
+		TrashRetention:    trashRetention,
 	}
 	return app
 }
@@ -0,0 +1,206 @@
+package handlers_test
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"golang.org/x/crypto/bcrypt"
+)
+
+var _ = ginkgo.Describe("Sessions", func() {
+	var app *testApp
+
+	ginkgo.BeforeEach(func() {
+		app = newTestApp("198.51.100.16")
+
+		hash, err := bcrypt.GenerateFromPassword([]byte("password1"), bcrypt.MinCost)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		_, err = app.DB.Exec(`
+		INSERT INTO Users (id, email, username, password, role) VALUES
+			(1, 'player@example.com', 'player', ?, 'user'),
+			(2, 'rival@example.com', 'rival', '', 'user');
+		`, string(hash))
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+	})
+
+	// loginFrom logs the player in with a browser sending userAgent.
+	loginFrom := func(userAgent string) *testSession {
+		form := url.Values{"email": {"player@example.com"}, "password": {"password1"}}
+		req := httptest.NewRequest(http.MethodPost, "/login/post", strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		req.Header.Set("User-Agent", userAgent)
+		rr := app.do(nil, req)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+
+		for _, c := range rr.Result().Cookies() {
+			if c.Name == "token" {
+				csrf, err := app.Sessions.GetCSRFToken(c.Value)
+				gomega.Expect(err).ToNot(gomega.HaveOccurred())
+				return &testSession{Cookie: &http.Cookie{Name: "token", Value: c.Value}, CSRF: csrf}
+			}
+		}
+		ginkgo.Fail("login did not set the token cookie")
+		return nil
+	}
+
+	sessionID := func(s *testSession) string {
+		var id int
+		gomega.Expect(app.DB.QueryRow(`SELECT id FROM Sessions WHERE token = ?`, s.Cookie.Value).Scan(&id)).To(gomega.Succeed())
+		return strconv.Itoa(id)
+	}
+
+	loggedIn := func(s *testSession) bool {
+		return app.get(s, "/user/sessions").Code == http.StatusOK
+	}
+
+	ginkgo.It("keeps a session per device with its browser and address", func() {
+		laptop := loginFrom("Mozilla/5.0 (X11; Linux x86_64; rv:128.0) Gecko/20100101 Firefox/128.0")
+		phone := loginFrom("Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Mobile/15E148 Safari/604.1")
+
+		var userAgent, ip string
+		err := app.DB.QueryRow(`SELECT user_agent, ip FROM Sessions WHERE token = ?`, laptop.Cookie.Value).Scan(&userAgent, &ip)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		gomega.Expect(userAgent).To(gomega.ContainSubstring("Firefox/128.0"))
+		gomega.Expect(ip).To(gomega.Equal("198.51.100.16"))
+
+		rr := app.get(laptop, "/user/sessions")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		body := rr.Body.String()
+		gomega.Expect(body).To(gomega.ContainSubstring("Firefox on Linux"))
+		gomega.Expect(body).To(gomega.ContainSubstring("Safari on iOS"))
+		gomega.Expect(body).To(gomega.ContainSubstring("198.51.100.16"))
+		gomega.Expect(strings.Count(body, "This device")).To(gomega.Equal(1))
+		gomega.Expect(body).To(gomega.ContainSubstring("/user/sessions/revoke?id=" + sessionID(phone)))
+		gomega.Expect(body).ToNot(gomega.ContainSubstring("/user/sessions/revoke?id=" + sessionID(laptop)))
+
+		// Other users' sessions are not listed
+		app.login(2, "rival-session")
+		gomega.Expect(app.get(laptop, "/user/sessions").Body.String()).ToNot(gomega.ContainSubstring("rival-session"))
+	})
+
+	ginkgo.It("revokes one session of the user's own", func() {
+		laptop := loginFrom("Firefox/128.0")
+		phone := loginFrom("Safari/604.1")
+		rival := app.login(2, "rival-session")
+
+		// Not someone else's
+		gomega.Expect(app.postForm(laptop, "/user/sessions/revoke?id="+sessionID(rival), nil).Code).To(gomega.Equal(http.StatusNotFound))
+		gomega.Expect(loggedIn(rival)).To(gomega.BeTrue())
+
+		rr := app.postForm(laptop, "/user/sessions/revoke?id="+sessionID(phone), nil)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+		gomega.Expect(rr.Header().Get("Location")).To(gomega.Equal("/user/sessions"))
+
+		gomega.Expect(loggedIn(phone)).To(gomega.BeFalse())
+		gomega.Expect(loggedIn(laptop)).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("logs out every other session and keeps the current one", func() {
+		laptop := loginFrom("Firefox/128.0")
+		phone := loginFrom("Safari/604.1")
+		tablet := loginFrom("Chrome/126.0")
+		rival := app.login(2, "rival-session")
+
+		gomega.Expect(app.postForm(laptop, "/user/sessions/revoke-others", nil).Code).To(gomega.Equal(http.StatusSeeOther))
+
+		gomega.Expect(loggedIn(laptop)).To(gomega.BeTrue())
+		gomega.Expect(loggedIn(phone)).To(gomega.BeFalse())
+		gomega.Expect(loggedIn(tablet)).To(gomega.BeFalse())
+		gomega.Expect(loggedIn(rival)).To(gomega.BeTrue())
+	})
+
+	ginkgo.It("ends the session on logout", func() {
+		laptop := loginFrom("Firefox/128.0")
+		phone := loginFrom("Safari/604.1")
+
+		gomega.Expect(app.get(laptop, "/logout").Code).To(gomega.Equal(http.StatusSeeOther))
+
+		gomega.Expect(loggedIn(laptop)).To(gomega.BeFalse())
+		gomega.Expect(loggedIn(phone)).To(gomega.BeTrue())
+	})
+
+	ginkgo.Describe("expiry", func() {
+		ginkgo.BeforeEach(func() {
+			app.SessionLifetime = time.Hour
+			app.RememberLifetime = 30 * 24 * time.Hour
+		})
+
+		tokenCookie := func(rr *httptest.ResponseRecorder) *http.Cookie {
+			for _, c := range rr.Result().Cookies() {
+				if c.Name == "token" {
+					return c
+				}
+			}
+			return nil
+		}
+
+		// expiresIn is how long the session has left, in whole minutes.
+		expiresIn := func(s *testSession) int {
+			var minutes float64
+			err := app.DB.QueryRow(`SELECT (julianday(expiresAt) - julianday('now')) * 24 * 60 FROM Sessions WHERE token = ?`, s.Cookie.Value).Scan(&minutes)
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+			return int(math.Round(minutes))
+		}
+
+		ginkgo.It("lasts longer when remember me is ticked", func() {
+			form := url.Values{"email": {"player@example.com"}, "password": {"password1"}, "remember": {"on"}}
+			rr := app.postForm(nil, "/login/post", form)
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+			gomega.Expect(tokenCookie(rr).MaxAge).To(gomega.Equal(30 * 24 * 60 * 60))
+
+			rr = app.postForm(nil, "/login/post", url.Values{"email": {"player@example.com"}, "password": {"password1"}})
+			gomega.Expect(tokenCookie(rr).MaxAge).To(gomega.Equal(60 * 60))
+		})
+
+		ginkgo.It("slides forward a full lifetime when the session is used", func() {
+			laptop := loginFrom("Firefox/128.0")
+			_, err := app.DB.Exec(`UPDATE Sessions SET lastSeenAt = datetime('now', '-50 minutes'), expiresAt = datetime('now', '+10 minutes'), ip = '192.0.2.1'`)
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+			rr := app.get(laptop, "/user/sessions")
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(tokenCookie(rr)).ToNot(gomega.BeNil())
+			gomega.Expect(tokenCookie(rr).MaxAge).To(gomega.Equal(60 * 60))
+			gomega.Expect(expiresIn(laptop)).To(gomega.Equal(60))
+
+			// And notes where it was used from
+			var ip string
+			gomega.Expect(app.DB.QueryRow(`SELECT ip FROM Sessions WHERE token = ?`, laptop.Cookie.Value).Scan(&ip)).To(gomega.Succeed())
+			gomega.Expect(ip).To(gomega.Equal("198.51.100.16"))
+		})
+
+		ginkgo.It("is only moved once a minute", func() {
+			laptop := loginFrom("Firefox/128.0")
+			_, err := app.DB.Exec(`UPDATE Sessions SET expiresAt = datetime('now', '+10 minutes')`)
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+			rr := app.get(laptop, "/user/sessions")
+			gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+			gomega.Expect(tokenCookie(rr)).To(gomega.BeNil())
+			gomega.Expect(expiresIn(laptop)).To(gomega.Equal(10))
+		})
+
+		ginkgo.It("is not revived once it has run out", func() {
+			laptop := loginFrom("Firefox/128.0")
+			phone := loginFrom("Safari/604.1")
+			_, err := app.DB.Exec(`UPDATE Sessions SET lastSeenAt = datetime('now', '-2 hours'), expiresAt = datetime('now', '-1 hour') WHERE token = ?`, laptop.Cookie.Value)
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+			gomega.Expect(loggedIn(laptop)).To(gomega.BeFalse())
+			gomega.Expect(expiresIn(laptop)).To(gomega.Equal(-60))
+
+			// The janitor clears it out, the live one stays
+			deleted, err := app.Sessions.DeleteExpired()
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+			gomega.Expect(deleted).To(gomega.Equal(1))
+			gomega.Expect(loggedIn(phone)).To(gomega.BeTrue())
+		})
+	})
+})
@@ -0,0 +1,644 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"game-forum-abaliyev-ashirbay/internal/mailer"
+	"game-forum-abaliyev-ashirbay/internal/models"
+	"game-forum-abaliyev-ashirbay/internal/oauth"
+	"game-forum-abaliyev-ashirbay/internal/validator"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	changeEmailLifetime = 24 * time.Hour
+
+	// An account without a password confirms who it is with a mailed link
+	// valid for reauthLinkLifetime or a linked login, the session it did so
+	// from can then make sensitive changes for reauthWindow
+	reauthLinkLifetime = time.Hour
+	reauthWindow       = 10 * time.Minute
+)
+
+// settingsForm fills the settings page. HasPassword is false for accounts
+// created through an external login, they have to reauthenticate instead of
+// typing the current password. Reauthenticated says that this session did
+// so recently. HasEmail is false until a user whose provider did not verify
+// their address sets one.
+type settingsForm struct {
+	Username        string
+	Email           string
+	HasPassword     bool
+	HasEmail        bool
+	Reauthenticated bool
+}
+
+func newSettingsForm(user *models.User) settingsForm {
+	form := settingsForm{
+		Username:    user.Username,
+		Email:       user.Email,
+		HasPassword: user.Password != "",
+		HasEmail:    hasEmail(user),
+	}
+	if !form.HasEmail {
+		form.Email = ""
+	}
+	return form
+}
+
+// checkCurrentPassword reports whether password is the user's password.
+// Accounts without one have nothing to type, their session must have been
+// reauthenticated within reauthWindow instead.
+func (app *Application) checkCurrentPassword(r *http.Request, user *models.User, password string) (bool, error) {
+	if user.Password == "" {
+		return app.reauthenticated(r)
+	}
+	return app.compareHashPassword(password, user.Password) == nil, nil
+}
+
+// reauthenticated reports whether the session of the request was
+// reauthenticated within reauthWindow.
+func (app *Application) reauthenticated(r *http.Request) (bool, error) {
+	tokenCookie, err := r.Cookie("token")
+	if err != nil {
+		return false, nil
+	}
+	return app.Session.ReauthenticatedWithin(tokenCookie.Value, reauthWindow)
+}
+
+// currentPasswordError is the form error for a failed checkCurrentPassword.
+func currentPasswordError(user *models.User) string {
+	if user.Password == "" {
+		return "Confirm it is you first, with an emailed link or a linked login"
+	}
+	return "Password is incorrect"
+}
+
+// renderSettings shows the settings page with errors or a message for the
+// form that was sent. Users without a password also get the ways they can
+// reauthenticate.
+func (app *Application) renderSettings(w http.ResponseWriter, r *http.Request, status int, form settingsForm, formErrors map[string]string, message string) {
+	data := templateData{
+		Form:       form,
+		FormErrors: formErrors,
+		Message:    message,
+	}
+
+	if !form.HasPassword {
+		userID, err := app.getAuthenticatedUserID(r)
+		if err != nil {
+			app.notAuthenticated(w, r)
+			return
+		}
+
+		data.LinkedAccounts, err = app.linkedAccounts(userID)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		form.Reauthenticated, err = app.reauthenticated(r)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		data.Form = form
+	}
+
+	app.render(w, r, status, "settings.html", data)
+}
+
+func (app *Application) settingsPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := app.authenticatedUser(w, r)
+	if !ok {
+		return
+	}
+
+	app.renderSettings(w, r, http.StatusOK, newSettingsForm(user), nil, "")
+}
+
+func (app *Application) settingsUsernamePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := app.authenticatedUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	form := newSettingsForm(user)
+	form.Username = r.PostForm.Get("username")
+
+	v := validator.Validator{}
+	v.CheckField(validator.NotBlank(form.Username), "username", "Username cannot be blank")
+	v.CheckField(validator.MaxChars(form.Username, 30), "username", "Username must not exceed 30 characters")
+	v.CheckField(!reservedUsername(form.Username), "username", "Username is not available")
+	v.CheckField(form.Username != user.Username, "username", "This is already your username")
+
+	if v.Valid() {
+		err = app.Users.UpdateUsername(user.ID, form.Username)
+		if errors.Is(err, models.ErrDuplicateUsername) {
+			v.AddFieldError("username", "Username is already taken")
+		} else if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !v.Valid() {
+		app.renderSettings(w, r, http.StatusUnprocessableEntity, form, v.FieldErrors, "")
+		return
+	}
+
+	http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+}
+
+func (app *Application) settingsEmailPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := app.authenticatedUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	form := newSettingsForm(user)
+	form.Email = strings.ToLower(r.PostForm.Get("email"))
+
+	v := validateEmailForm(emailForm{Email: form.Email})
+	v.CheckField(form.Email != user.Email, "email", "This is already your email address")
+
+	passwordOK, err := app.checkCurrentPassword(r, user, r.PostForm.Get("password"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	v.CheckField(passwordOK, "emailPassword", currentPasswordError(user))
+
+	if v.Valid() {
+		exists, err := app.Users.EmailExists(form.Email)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		v.CheckField(!exists, "email", "Email is already in use")
+	}
+
+	if !v.Valid() {
+		app.renderSettings(w, r, http.StatusUnprocessableEntity, form, v.FieldErrors, "")
+		return
+	}
+
+	// Without a mailer the new address cannot be checked, it is used as is
+	if app.Mailer == nil {
+		err = app.changeEmail(user, form.Email)
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			app.renderSettings(w, r, http.StatusUnprocessableEntity, form, map[string]string{"email": "Email is already in use"}, "")
+			return
+		}
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+		return
+	}
+
+	err = app.sendChangeEmailEmail(user, form.Email)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	message := fmt.Sprintf("We sent a link to %s, open it to confirm the new address.", form.Email)
+	if hasEmail(user) {
+		message += fmt.Sprintf(" Until then you keep using %s.", user.Email)
+	}
+	app.renderSettings(w, r, http.StatusOK, newSettingsForm(user), nil, message)
+}
+
+// settingsEmailConfirm moves the account to the address the opened link was
+// sent to. It has to be opened by the logged in owner of the account.
+func (app *Application) settingsEmailConfirm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := app.authenticatedUser(w, r)
+	if !ok {
+		return
+	}
+
+	invalid := func(message string) {
+		app.renderSettings(w, r, http.StatusBadRequest, newSettingsForm(user), map[string]string{"email": message}, "")
+	}
+
+	token, err := app.UserTokens.Get(r.URL.Query().Get("token"), models.TokenChangeEmail)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			invalid("This link is invalid or has expired.")
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+	if token.UserID != user.ID {
+		invalid("This link belongs to another account.")
+		return
+	}
+
+	_, err = app.UserTokens.Consume(r.URL.Query().Get("token"), models.TokenChangeEmail)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			invalid("This link is invalid or has expired.")
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.changeEmail(user, token.Email)
+	if err != nil {
+		if errors.Is(err, models.ErrDuplicateEmail) {
+			invalid(fmt.Sprintf("%s is used by another account by now.", token.Email))
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	user.Email = token.Email
+	message := fmt.Sprintf("Your email address is now %s.", token.Email)
+	app.renderSettings(w, r, http.StatusOK, newSettingsForm(user), nil, message)
+}
+
+// changeEmail moves the account to email and tells the old address about it.
+func (app *Application) changeEmail(user *models.User, email string) error {
+	err := app.Users.UpdateEmail(user.ID, email)
+	if err != nil {
+		return err
+	}
+
+	if app.Mailer == nil || !hasEmail(user) {
+		return nil
+	}
+
+	err = app.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Your email address was changed",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"The email address of your account was changed to %s. Emails from us go there from now on.\n\n"+
+			"If you did not do this, contact an administrator right away.\n",
+			user.Username, email),
+	})
+	if err != nil {
+		app.Logger.Error("sending email change notice", "user", user.ID, "err", err)
+	}
+
+	return nil
+}
+
+func (app *Application) sendChangeEmailEmail(user *models.User, email string) error {
+	token, err := randomURLToken(32)
+	if err != nil {
+		return err
+	}
+
+	err = app.UserTokens.Insert(token, user.ID, models.TokenChangeEmail, email, changeEmailLifetime)
+	if err != nil {
+		return err
+	}
+
+	return app.sendMail(mailer.Message{
+		To:      email,
+		Subject: "Confirm your new email address",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"To use this address for your account, open this link while logged in:\n\n%s\n\n"+
+			"The link is valid for %d hours. If you did not ask for this, you can ignore this email.\n",
+			user.Username, app.absoluteURL("/user/settings/email/confirm?token="+token), int(changeEmailLifetime.Hours())),
+	})
+}
+
+func (app *Application) settingsPasswordPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := app.authenticatedUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	password := r.PostForm.Get("newPassword")
+
+	passwordOK, err := app.checkCurrentPassword(r, user, r.PostForm.Get("currentPassword"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	v := validator.Validator{}
+	v.CheckField(passwordOK, "currentPassword", currentPasswordError(user))
+	v.CheckField(validator.NotBlank(password), "newPassword", "Password cannot be blank")
+	v.CheckField(validator.MinChars(password, 8), "newPassword", "Password must be at least 8 characters long")
+	v.CheckField(validator.MaxChars(password, 30), "newPassword", "Password must not exceed 30 characters")
+	v.CheckField(password == r.PostForm.Get("confirmPassword"), "confirmPassword", "Passwords do not match")
+
+	if !v.Valid() {
+		app.renderSettings(w, r, http.StatusUnprocessableEntity, newSettingsForm(user), v.FieldErrors, "")
+		return
+	}
+
+	hashedPassword, err := app.generateHashPassword(password)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.Users.UpdatePassword(user.ID, hashedPassword)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Whoever knew the old password is logged out, this device stays in
+	token := ""
+	tokenCookie, err := r.Cookie("token")
+	if err == nil {
+		token = tokenCookie.Value
+	}
+
+	err = app.Session.DeleteOthersByUserId(user.ID, token)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	user.Password = hashedPassword
+	app.renderSettings(w, r, http.StatusOK, newSettingsForm(user), nil, "Your password has been changed, all other sessions were logged out.")
+}
+
+func (app *Application) settingsDeletePost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := app.authenticatedUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	passwordOK, err := app.checkCurrentPassword(r, user, r.PostForm.Get("password"))
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	v := validator.Validator{}
+	v.CheckField(passwordOK, "delete", currentPasswordError(user))
+	if user.Password == "" {
+		v.CheckField(r.PostForm.Get("username") == user.Username, "delete", "Type your username to confirm")
+	}
+	// Someone has to be left to run the forum
+	v.CheckField(user.Role != "admin", "delete", "Admins cannot delete their account, ask another admin to change your role first")
+
+	if !v.Valid() {
+		app.renderSettings(w, r, http.StatusUnprocessableEntity, newSettingsForm(user), v.FieldErrors, "")
+		return
+	}
+
+	err = app.replaceAvatar(user.ID, "")
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.Users.Delete(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.Logger.Info("account deleted", "user", user.ID)
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     "token",
+		Value:    "",
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		SameSite: http.SameSiteLaxMode,
+	})
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// settingsReauthPost lets a user without a password confirm who they are:
+// with the linked provider named in the URL, or else with a link mailed to
+// their address.
+func (app *Application) settingsReauthPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := app.authenticatedUser(w, r)
+	if !ok {
+		return
+	}
+
+	// Everyone else types their password
+	if user.Password != "" {
+		http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+		return
+	}
+
+	if name := r.URL.Query().Get("provider"); name != "" {
+		var provider oauth.Provider
+		for _, p := range app.OAuthProviders {
+			if p.Name() == name {
+				provider = p
+			}
+		}
+		if provider == nil {
+			app.notFound(w, r)
+			return
+		}
+
+		state, codeChallenge, err := app.beginOAuth(w, provider.Name(), provider.UsesPKCE(), user.ID, true)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		http.Redirect(w, r, provider.AuthCodeURL(state, codeChallenge, app.oauthRedirectURI(provider)), http.StatusSeeOther)
+		return
+	}
+
+	if app.Mailer == nil || !hasEmail(user) {
+		app.renderSettings(w, r, http.StatusUnprocessableEntity, newSettingsForm(user), map[string]string{"reauth": "We cannot email you, confirm with a linked login instead"}, "")
+		return
+	}
+
+	err := app.sendReauthEmail(user)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	message := fmt.Sprintf("We sent a link to %s, open it in this browser to confirm it is you.", user.Email)
+	app.renderSettings(w, r, http.StatusOK, newSettingsForm(user), nil, message)
+}
+
+func (app *Application) sendReauthEmail(user *models.User) error {
+	token, err := randomURLToken(32)
+	if err != nil {
+		return err
+	}
+
+	err = app.UserTokens.Insert(token, user.ID, models.TokenReauthenticate, user.Email, reauthLinkLifetime)
+	if err != nil {
+		return err
+	}
+
+	return app.sendMail(mailer.Message{
+		To:      user.Email,
+		Subject: "Confirm it is you",
+		Body: fmt.Sprintf("Hi %s,\n\n"+
+			"To change your email address or password or to delete your account, open this link while logged in:\n\n%s\n\n"+
+			"The link is valid for %d minutes. If you did not ask for this, someone may be using your account, log out all its sessions.\n",
+			user.Username, app.absoluteURL("/user/settings/reauth/confirm?token="+token), int(reauthLinkLifetime.Minutes())),
+	})
+}
+
+// settingsReauthConfirm reauthenticates the session that opens a link sent
+// by settingsReauthPost. It has to be opened by the logged in owner of the
+// account.
+func (app *Application) settingsReauthConfirm(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := app.authenticatedUser(w, r)
+	if !ok {
+		return
+	}
+
+	invalid := func(message string) {
+		app.renderSettings(w, r, http.StatusBadRequest, newSettingsForm(user), map[string]string{"reauth": message}, "")
+	}
+
+	token, err := app.UserTokens.Get(r.URL.Query().Get("token"), models.TokenReauthenticate)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			invalid("This link is invalid or has expired.")
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+	if token.UserID != user.ID {
+		invalid("This link belongs to another account.")
+		return
+	}
+
+	_, err = app.UserTokens.Consume(r.URL.Query().Get("token"), models.TokenReauthenticate)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			invalid("This link is invalid or has expired.")
+			return
+		}
+		app.serverError(w, r, err)
+		return
+	}
+
+	err = app.reauthenticateSession(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	message := fmt.Sprintf("Thanks, for the next %d minutes you can change your email and password or delete your account.", int(reauthWindow.Minutes()))
+	app.renderSettings(w, r, http.StatusOK, newSettingsForm(user), nil, message)
+}
+
+// reauthIdentity finishes a reauthentication through a provider started by
+// userID. The external account has to be one they linked before.
+func (app *Application) reauthIdentity(w http.ResponseWriter, r *http.Request, provider oauth.Provider, userID int, info *oauth.UserInfo) {
+	user, ok := app.authenticatedUser(w, r)
+	if !ok {
+		return
+	}
+	if user.ID != userID {
+		app.clientError(w, r, http.StatusForbidden)
+		return
+	}
+
+	identity, err := app.UserIdentities.GetByProviderSubject(provider.Name(), info.Subject)
+	if err != nil && !errors.Is(err, models.ErrNoRecord) {
+		app.serverError(w, r, err)
+		return
+	}
+	if identity == nil || identity.UserID != user.ID {
+		message := fmt.Sprintf("This %s account is not linked to yours", provider.DisplayName())
+		app.renderSettings(w, r, http.StatusUnprocessableEntity, newSettingsForm(user), map[string]string{"reauth": message}, "")
+		return
+	}
+
+	err = app.reauthenticateSession(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/user/settings", http.StatusSeeOther)
+}
+
+// reauthenticateSession marks the browser session of the request as
+// reauthenticated.
+func (app *Application) reauthenticateSession(r *http.Request) error {
+	tokenCookie, err := r.Cookie("token")
+	if err != nil {
+		return err
+	}
+	return app.Session.Reauthenticate(tokenCookie.Value)
+}
@@ -0,0 +1,281 @@
+package handlers_test
+
+import (
+	"archive/zip"
+	"bytes"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"golang.org/x/crypto/bcrypt"
+
+	"game-forum-abaliyev-ashirbay/internal/storage"
+)
+
+var _ = ginkgo.Describe("Account settings", func() {
+	var (
+		app      *testApp
+		imageDir string
+		mail     *recordingMailer
+		player   *testSession
+	)
+
+	ginkgo.BeforeEach(func() {
+		app = newTestApp("198.51.100.7")
+		imageDir = ginkgo.GinkgoT().TempDir()
+		app.Images = storage.NewLocalStore(imageDir)
+		mail = &recordingMailer{}
+		app.Mailer = mail
+		app.BaseURL = "https://forum.example.com/"
+
+		hash, err := bcrypt.GenerateFromPassword([]byte("password1"), bcrypt.MinCost)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		_, err = app.DB.Exec(`INSERT INTO Users (id, email, username, password, role, created_at) VALUES
+			(1, 'player@example.com', 'player', ?, 'user', '2026-01-02 10:00:00'),
+			(2, 'other@example.com', 'other', ?, 'user', '2026-01-02 10:00:00')`, string(hash), string(hash))
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		player = app.login(1, "player-session")
+		_, err = app.Sessions.Insert("player-phone", 1, time.Hour, "phone", "127.0.0.2")
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+	})
+
+	post := func(path string, form url.Values) *httptest.ResponseRecorder {
+		return app.postForm(player, path, form)
+	}
+
+	get := func(path string) *httptest.ResponseRecorder {
+		return app.get(player, path)
+	}
+
+	column := func(stmt string, args ...interface{}) string {
+		var value string
+		gomega.Expect(app.DB.QueryRow(stmt, args...).Scan(&value)).To(gomega.Succeed())
+		return value
+	}
+
+	ginkgo.It("changes the username unless it is taken or reserved", func() {
+		gomega.Expect(post("/user/settings/username", url.Values{"username": {"other"}}).Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+		gomega.Expect(post("/user/settings/username", url.Values{"username": {"deleted-9"}}).Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+
+		rr := post("/user/settings/username", url.Values{"username": {"speedrunner"}})
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+		gomega.Expect(column(`SELECT username FROM Users WHERE id = 1`)).To(gomega.Equal("speedrunner"))
+	})
+
+	ginkgo.It("moves to a new email address once the link sent to it is opened", func() {
+		rr := post("/user/settings/email", url.Values{"email": {"new@example.com"}, "password": {"wrong-password"}})
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("Password is incorrect"))
+
+		rr = post("/user/settings/email", url.Values{"email": {"other@example.com"}, "password": {"password1"}})
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("Email is already in use"))
+		gomega.Expect(mail.sent).To(gomega.BeEmpty())
+
+		rr = post("/user/settings/email", url.Values{"email": {"New@Example.com"}, "password": {"password1"}})
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(mail.sent).To(gomega.HaveLen(1))
+		gomega.Expect(mail.sent[0].To).To(gomega.Equal("new@example.com"))
+		link := mailLinkRX.FindStringSubmatch(mail.sent[0].Body)
+		gomega.Expect(link).ToNot(gomega.BeNil())
+
+		// Nothing changes before the link is opened
+		gomega.Expect(column(`SELECT email FROM Users WHERE id = 1`)).To(gomega.Equal("player@example.com"))
+
+		rr = get(link[1])
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("Your email address is now new@example.com"))
+		gomega.Expect(column(`SELECT email FROM Users WHERE id = 1`)).To(gomega.Equal("new@example.com"))
+
+		// The old address hears about it, the link works once
+		gomega.Expect(mail.sent).To(gomega.HaveLen(2))
+		gomega.Expect(mail.sent[1].To).To(gomega.Equal("player@example.com"))
+		gomega.Expect(get(link[1]).Code).To(gomega.Equal(http.StatusBadRequest))
+	})
+
+	ginkgo.It("changes the password and logs out the other sessions", func() {
+		rr := post("/user/settings/password", url.Values{
+			"currentPassword": {"wrong-password"},
+			"newPassword":     {"password2"},
+			"confirmPassword": {"password2"},
+		})
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+
+		rr = post("/user/settings/password", url.Values{
+			"currentPassword": {"password1"},
+			"newPassword":     {"password2"},
+			"confirmPassword": {"password2"},
+		})
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+
+		hash := column(`SELECT password FROM Users WHERE id = 1`)
+		gomega.Expect(bcrypt.CompareHashAndPassword([]byte(hash), []byte("password2"))).To(gomega.Succeed())
+		gomega.Expect(column(`SELECT group_concat(token) FROM Sessions WHERE user_id = 1`)).To(gomega.Equal("player-session"))
+	})
+
+	ginkgo.It("makes a user without a password confirm it is them with a mailed link first", func() {
+		_, err := app.DB.Exec(`UPDATE Users SET password = '' WHERE id = 1`)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		setPassword := func() *httptest.ResponseRecorder {
+			return post("/user/settings/password", url.Values{
+				"newPassword":     {"password2"},
+				"confirmPassword": {"password2"},
+			})
+		}
+
+		rr := setPassword()
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("Confirm it is you first"))
+		gomega.Expect(post("/user/settings/email", url.Values{"email": {"new@example.com"}}).Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+		gomega.Expect(post("/user/settings/delete", url.Values{"username": {"player"}}).Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+		gomega.Expect(mail.sent).To(gomega.BeEmpty())
+
+		rr = post("/user/settings/reauth", nil)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(mail.sent).To(gomega.HaveLen(1))
+		gomega.Expect(mail.sent[0].To).To(gomega.Equal("player@example.com"))
+		link := mailLinkRX.FindStringSubmatch(mail.sent[0].Body)
+		gomega.Expect(link).ToNot(gomega.BeNil())
+
+		// The link only counts for the account it was sent for, and only
+		// reauthenticates the session that opens it
+		other := app.login(2, "other-session")
+		gomega.Expect(app.get(other, link[1]).Code).To(gomega.Equal(http.StatusBadRequest))
+
+		rr = get(link[1])
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(get(link[1]).Code).To(gomega.Equal(http.StatusBadRequest))
+		gomega.Expect(column(`SELECT COUNT(*) FROM Sessions WHERE reauthenticated_at IS NOT NULL`)).To(gomega.Equal("1"))
+
+		gomega.Expect(setPassword().Code).To(gomega.Equal(http.StatusOK))
+		hash := column(`SELECT password FROM Users WHERE id = 1`)
+		gomega.Expect(bcrypt.CompareHashAndPassword([]byte(hash), []byte("password2"))).To(gomega.Succeed())
+
+		// The reauthentication runs out
+		_, err = app.DB.Exec(`UPDATE Users SET password = '' WHERE id = 1;
+		UPDATE Sessions SET reauthenticated_at = datetime('now', '-11 minutes')`)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		gomega.Expect(setPassword().Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+	})
+
+	ginkgo.It("exports the user's data as a ZIP of JSON files and images", func() {
+		_, err := app.DB.Exec(`
+		INSERT INTO Posts (id, title, content, imgUrl, createdAt, category_id, owner_id, like_count, dislike_count) VALUES
+			(1, 'My post', 'Written by the player', 'map.png', '2026-05-01 10:00:00', 1, 1, 1, 0),
+			(2, 'Other post', 'Written by someone else', '', '2026-05-01 10:00:00', 1, 2, 0, 1);
+		INSERT INTO Posts (id, title, content, imgUrl, createdAt, category_id, owner_id, like_count, dislike_count, deleted_at, deleted_by) VALUES
+			(3, 'Regretted post', 'Deleted by the player', '', '2026-05-03 10:00:00', 1, 1, 0, 0, '2026-05-04 10:00:00', 1);
+		INSERT INTO Comments (id, post_id, user_id, created_at, text, like_count, dislike_count) VALUES
+			(1, 2, 1, '2026-05-02 10:00:00', 'Nice post', 0, 0);
+		INSERT INTO Comments (id, post_id, user_id, created_at, text, like_count, dislike_count, deleted_at, deleted_by) VALUES
+			(2, 2, 1, '2026-05-02 11:00:00', 'Regretted comment', 0, 0, '2026-05-04 10:00:00', 1);
+		INSERT INTO Post_Reactions (type, user_id, post_id) VALUES ('dislike', 1, 2), ('like', 2, 1);
+		INSERT INTO Notifications (type, actor_id, recipient_id, post_id, comment_id, created_at) VALUES
+			('post_like', 2, 1, 1, NULL, '2026-05-02 10:00:00');
+		INSERT INTO Promotion_Requests (user_id, description) VALUES (1, 'Let me help');
+		UPDATE Users SET avatar = '1-cafe' WHERE id = 1;
+		`)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		gomega.Expect(os.WriteFile(filepath.Join(imageDir, "map.png"), []byte("picture"), 0o644)).To(gomega.Succeed())
+		gomega.Expect(os.MkdirAll(filepath.Join(imageDir, "avatars"), 0o755)).To(gomega.Succeed())
+		gomega.Expect(os.WriteFile(filepath.Join(imageDir, "avatars", "1-cafe-256.png"), []byte("me"), 0o644)).To(gomega.Succeed())
+
+		rr := get("/user/export")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(rr.Header().Get("Content-Type")).To(gomega.Equal("application/zip"))
+		gomega.Expect(rr.Header().Get("Content-Disposition")).To(gomega.HavePrefix("attachment;"))
+
+		body := rr.Body.Bytes()
+		archive, err := zip.NewReader(bytes.NewReader(body), int64(len(body)))
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		files := map[string]string{}
+		for _, f := range archive.File {
+			rc, err := f.Open()
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+			content, err := io.ReadAll(rc)
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+			rc.Close()
+			files[f.Name] = string(content)
+		}
+
+		gomega.Expect(files).To(gomega.HaveKeyWithValue("images/map.png", "picture"))
+		gomega.Expect(files).To(gomega.HaveKeyWithValue("avatar.png", "me"))
+
+		var profile map[string]interface{}
+		gomega.Expect(json.Unmarshal([]byte(files["profile.json"]), &profile)).To(gomega.Succeed())
+		gomega.Expect(profile).To(gomega.HaveKeyWithValue("email", "player@example.com"))
+		gomega.Expect(profile).To(gomega.HaveKeyWithValue("avatar", "avatar.png"))
+
+		var posts []map[string]interface{}
+		gomega.Expect(json.Unmarshal([]byte(files["posts.json"]), &posts)).To(gomega.Succeed())
+		gomega.Expect(posts).To(gomega.HaveLen(2))
+		gomega.Expect(posts[0]).To(gomega.HaveKeyWithValue("image", "images/map.png"))
+		gomega.Expect(posts[0]).ToNot(gomega.HaveKey("deleted_at"))
+
+		// What is in the trash is still the user's, marked as deleted
+		gomega.Expect(posts[1]).To(gomega.HaveKeyWithValue("title", "Regretted post"))
+		gomega.Expect(posts[1]).To(gomega.HaveKey("deleted_at"))
+		var comments []map[string]interface{}
+		gomega.Expect(json.Unmarshal([]byte(files["comments.json"]), &comments)).To(gomega.Succeed())
+		gomega.Expect(comments).To(gomega.HaveLen(2))
+		gomega.Expect(comments[1]).To(gomega.HaveKeyWithValue("text", "Regretted comment"))
+		gomega.Expect(comments[1]).To(gomega.HaveKey("deleted_at"))
+
+		// Only the player's own reactions, notifications and requests
+		gomega.Expect(files["comments.json"]).To(gomega.ContainSubstring(`"text": "Nice post"`))
+		gomega.Expect(files["reactions.json"]).To(gomega.MatchJSON(`{"posts": [{"post_id": 2, "reaction": "dislike"}], "comments": []}`))
+		gomega.Expect(files["notifications.json"]).To(gomega.ContainSubstring(`"type": "post_like"`))
+		gomega.Expect(files["promotion_requests.json"]).To(gomega.ContainSubstring(`"description": "Let me help"`))
+	})
+
+	ginkgo.It("deletes the account, keeping posts and comments anonymously", func() {
+		_, err := app.DB.Exec(`
+		INSERT INTO Posts (id, title, content, createdAt, category_id, owner_id, like_count, dislike_count) VALUES
+			(1, 'My post', 'Written by the player', '2026-05-01 10:00:00', 1, 1, 1, 0),
+			(2, 'Other post', 'Written by someone else', '2026-05-01 10:00:00', 1, 2, 1, 1);
+		INSERT INTO Comments (id, post_id, user_id, created_at, text, like_count, dislike_count) VALUES
+			(1, 2, 1, '2026-05-02 10:00:00', 'Nice post', 0, 0),
+			(2, 1, 2, '2026-05-02 10:00:00', 'Thanks', 1, 0);
+		INSERT INTO Post_Reactions (type, user_id, post_id) VALUES ('dislike', 1, 2), ('like', 2, 2), ('like', 2, 1);
+		INSERT INTO Comment_Reactions (type, user_id, comment_id) VALUES ('like', 1, 2);
+		INSERT INTO Notifications (type, actor_id, recipient_id, post_id, comment_id, created_at) VALUES
+			('post_dislike', 1, 2, 2, NULL, '2026-05-02 10:00:00'),
+			('post_like', 2, 1, 1, NULL, '2026-05-02 10:00:00'),
+			('comment', 2, 1, 1, 2, '2026-05-02 10:00:00');
+		INSERT INTO Api_Tokens (user_id, name, token_hash, scopes, created_at) VALUES (1, 'bot', 'hash', 'read', '2026-05-01 10:00:00');
+		`)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		rr := post("/user/settings/delete", url.Values{"password": {"wrong-password"}})
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+
+		rr = post("/user/settings/delete", url.Values{"password": {"password1"}})
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+
+		gomega.Expect(column(`SELECT username || ' ' || email || ' ' || password || ' ' || enabled FROM Users WHERE id = 1`)).
+			To(gomega.Equal("deleted-1 deleted-1@deleted.invalid  0"))
+
+		// Posts and comments stay, the player's reactions are taken back
+		gomega.Expect(column(`SELECT COUNT(*) FROM Posts WHERE owner_id = 1`)).To(gomega.Equal("1"))
+		gomega.Expect(column(`SELECT COUNT(*) FROM Comments WHERE user_id = 1`)).To(gomega.Equal("1"))
+		gomega.Expect(column(`SELECT like_count || '/' || dislike_count FROM Posts WHERE id = 2`)).To(gomega.Equal("1/0"))
+		gomega.Expect(column(`SELECT like_count FROM Comments WHERE id = 2`)).To(gomega.Equal("0"))
+		gomega.Expect(column(`SELECT COUNT(*) FROM Post_Reactions`)).To(gomega.Equal("2"))
+
+		for _, table := range []string{"Notifications", "Sessions", "Api_Tokens", "Comment_Reactions"} {
+			gomega.Expect(column(`SELECT COUNT(*) FROM `+table)).To(gomega.Equal("0"), table)
+		}
+
+		gomega.Expect(get("/user/deleted-1").Code).To(gomega.Equal(http.StatusNotFound))
+		gomega.Expect(get("/user/settings").Code).To(gomega.Equal(http.StatusSeeOther))
+	})
+})
@@ -0,0 +1,163 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"game-forum-abaliyev-ashirbay/internal/models"
+	"game-forum-abaliyev-ashirbay/internal/validator"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+var errSuspended = errors.New("account suspended")
+
+type suspendForm struct {
+	UserID int
+	Reason string
+	Until  string
+}
+
+// activeSuspension returns the suspension the user is serving, nil when
+// there is none.
+func (app *Application) activeSuspension(userID int) (*models.Suspension, error) {
+	s, err := app.Suspensions.GetActive(userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return s, nil
+}
+
+// checkSuspension returns errSuspended for users serving a suspension.
+func (app *Application) checkSuspension(user *models.User) error {
+	s, err := app.activeSuspension(user.ID)
+	if err != nil {
+		return err
+	}
+	if s != nil {
+		return errSuspended
+	}
+	return nil
+}
+
+// suspensionMessage is what a suspended user sees when trying to log in.
+func suspensionMessage(s *models.Suspension) string {
+	if !s.Until.Valid {
+		return "Your account has been suspended: " + s.Reason
+	}
+	return fmt.Sprintf("Your account is suspended until %s: %s", humanDate(s.Until.Time), s.Reason)
+}
+
+func (app *Application) suspendUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	adminID, err := app.getAuthenticatedUserID(r)
+	if err != nil {
+		app.notAuthenticated(w, r)
+		return
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	user, err := app.Users.GetById(id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	err = r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	form := suspendForm{
+		UserID: id,
+		Reason: strings.TrimSpace(r.PostForm.Get("reason")),
+		Until:  r.PostForm.Get("until"),
+	}
+
+	v := validator.Validator{}
+	v.CheckField(validator.NotBlank(form.Reason), "suspend", "Give a reason, the user will see it")
+	v.CheckField(validator.MaxChars(form.Reason, 500), "suspend", "The reason must not exceed 500 characters")
+	v.CheckField(user.Role != "admin", "suspend", "Admins cannot be suspended, demote them first")
+
+	// An empty date suspends for good, a date lifts the suspension at the
+	// start of that day
+	var until time.Time
+	if form.Until != "" {
+		until, err = time.Parse("2006-01-02", form.Until)
+		v.CheckField(err == nil, "suspend", "Invalid date")
+		v.CheckField(err != nil || until.After(time.Now()), "suspend", "The date must be in the future")
+	}
+
+	if !v.Valid() {
+		data, err := app.adminPanelData()
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+		data.Form = form
+		data.FormErrors = v.FieldErrors
+		app.render(w, r, http.StatusUnprocessableEntity, "admin_panel.html", data)
+		return
+	}
+
+	_, err = app.Suspensions.Insert(id, form.Reason, until, adminID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Log the user out everywhere, logging back in is refused until the
+	// suspension ends
+	err = app.Session.DeleteByUserId(id)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
+
+func (app *Application) unsuspendUser(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	adminID, err := app.getAuthenticatedUserID(r)
+	if err != nil {
+		app.notAuthenticated(w, r)
+		return
+	}
+
+	id, err := strconv.Atoi(r.URL.Query().Get("id"))
+	if err != nil || id < 1 {
+		app.notFound(w, r)
+		return
+	}
+
+	err = app.Suspensions.Lift(id, adminID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
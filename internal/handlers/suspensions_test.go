@@ -0,0 +1,96 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"golang.org/x/crypto/bcrypt"
+
+	"game-forum-abaliyev-ashirbay/internal/models"
+)
+
+var _ = ginkgo.Describe("Suspensions", func() {
+	var (
+		app      *testApp
+		admin    *testSession
+		apiToken = "gfp_suspended-users-token"
+	)
+
+	ginkgo.BeforeEach(func() {
+		app = newTestApp("198.51.100.5")
+
+		hash, err := bcrypt.GenerateFromPassword([]byte("password1"), bcrypt.MinCost)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		_, err = app.DB.Exec(`INSERT INTO Users (id, email, username, password, role) VALUES
+			(1, 'admin@example.com', 'admin', ?, 'admin'),
+			(2, 'troll@example.com', 'troll', ?, 'user')`, string(hash), string(hash))
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		admin = app.login(1, "admin-session")
+		app.login(2, "troll-session")
+		_, err = app.ApiTokens.Insert(2, "bot", apiToken, []string{models.ScopeRead, models.ScopeWrite})
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+	})
+
+	adminPost := func(path string, form url.Values) *httptest.ResponseRecorder {
+		return app.postForm(admin, path, form)
+	}
+
+	login := func() *httptest.ResponseRecorder {
+		return app.postForm(nil, "/login/post", url.Values{"email": {"troll@example.com"}, "password": {"password1"}})
+	}
+
+	apiMe := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/api/v1/me", nil)
+		req.Header.Set("Authorization", "Bearer "+apiToken)
+		return app.do(nil, req).Code
+	}
+
+	ginkgo.It("logs the user out, refuses logins with the reason and blocks the API", func() {
+		gomega.Expect(apiMe()).To(gomega.Equal(http.StatusOK))
+
+		rr := adminPost("/admin/users/suspend?id=2", url.Values{"reason": {"Spamming the forum"}})
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+
+		var sessions int
+		gomega.Expect(app.DB.QueryRow(`SELECT COUNT(*) FROM Sessions WHERE user_id = 2`).Scan(&sessions)).To(gomega.Succeed())
+		gomega.Expect(sessions).To(gomega.Equal(0))
+
+		rr = login()
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusForbidden))
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("Your account has been suspended: Spamming the forum"))
+
+		gomega.Expect(apiMe()).To(gomega.Equal(http.StatusForbidden))
+
+		rr = adminPost("/admin/users/unsuspend?id=2", url.Values{})
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+
+		gomega.Expect(login().Code).To(gomega.Equal(http.StatusSeeOther))
+		gomega.Expect(apiMe()).To(gomega.Equal(http.StatusOK))
+	})
+
+	ginkgo.It("shows the end of a temporary suspension", func() {
+		until := time.Now().AddDate(0, 0, 3).Format("2006-01-02")
+
+		rr := adminPost("/admin/users/suspend?id=2", url.Values{"reason": {"Cool down"}, "until": {until}})
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+
+		rr = login()
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusForbidden))
+		end, err := time.Parse("2006-01-02", until)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("suspended until " + end.Format("02 Jan 2006")))
+	})
+
+	ginkgo.It("is over once the date has passed", func() {
+		_, err := app.DB.Exec(`INSERT INTO User_Suspensions (user_id, reason, suspended_until, created_by, created_at)
+		VALUES (2, 'Old news', datetime('now', '-1 minute'), 1, datetime('now', '-1 day'))`)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		gomega.Expect(login().Code).To(gomega.Equal(http.StatusSeeOther))
+	})
+})
@@ -1,11 +1,14 @@
 package handlers
 
 import (
+	"game-forum-abaliyev-ashirbay/internal/markdown"
 	"game-forum-abaliyev-ashirbay/internal/models"
+	"game-forum-abaliyev-ashirbay/internal/oauth"
 	"game-forum-abaliyev-ashirbay/ui"
 	"html/template"
 	"io/fs"
 	"path/filepath"
+	"strings"
 	"time"
 )
 
@@ -35,6 +38,33 @@ type templateData struct {
 	ReportReasons       []*models.ReportReasons
 	Reports             []*models.Reports 
 	CommentPostAddition []*models.CommentPostAddition
+	SearchResults       []*models.SearchResult
+	TotalResults        int
+	APITokens           []*models.ApiToken
+	APIScopes           []string
+	NewAPIToken         string
+	Sessions            []*models.Session
+	CurrentSessionToken string
+	CSRFToken           string
+	OAuthProviders      []oauth.Provider
+	LinkedAccounts      []linkedAccount
+	Message             string
+	Suspensions         map[int]*models.Suspension
+	TwoFactor           *twoFactorView
+	TwoFactorRoles      []string
+	Roles               []string
+	FailedLogins        []loginFailuresView
+	FailedLoginIPs      []loginFailuresView
+	Profile             *models.Profile
+	Activity            []*models.Activity
+	Attachments         []*models.PostAttachment
+	Revisions           *revisionHistory
+	CanRevert           bool
+	Comment             *models.Comment
+	CommentRevisions    []*models.CommentRevision
+	CommentEditWindow   time.Duration
+	TrashItems          []*models.TrashItem
+	TrashRetention      time.Duration
 
 	// ERROR FIELDS:
 	ErrorCode int
@@ -46,9 +76,33 @@ type templateData struct {
 	UserNotifications  []NotificationView
 }
 
+// commentNode carries the viewing user alongside a comment so the recursive
+// "comment" partial can decide which controls to show.
+type commentNode struct {
+	*models.CommentReaction
+	User       *models.User
+	CSRFToken  string
+	EditWindow time.Duration
+}
+
+// CanEdit mirrors canEditComment to decide whether to show the edit link.
+func (n commentNode) CanEdit() bool {
+	if n.User == nil {
+		return false
+	}
+	if n.User.Role == "admin" {
+		return true
+	}
+	if n.User.ID != n.UserID && n.User.Role != "moderator" {
+		return false
+	}
+	return time.Since(n.CreatedAt) < n.EditWindow
+}
+
 type NotificationView struct {
 	ID            int
 	Type          string
+	ActorID       int
 	ActorUsername string
 	PostID        int
 	CommentText   string
@@ -61,6 +115,18 @@ var functions = template.FuncMap{
 	"add":       add,
 	"sub":       sub,
 	"slice":     slice,
+	"highlight": highlight,
+	"markdown":  renderMarkdown,
+	"markdownText": markdown.Text,
+	"deviceName": deviceName,
+	"commentNode": func(c *models.CommentReaction, u *models.User, csrfToken string, editWindow time.Duration) commentNode {
+		return commentNode{CommentReaction: c, User: u, CSRFToken: csrfToken, EditWindow: editWindow}
+	},
+	"contains": contains,
+	"userURL":  userURL,
+	"avatarURL": avatarURL,
+	"thumbnailURL": thumbnailURL,
+	"hasEmail":     hasEmail,
 	"or": func(a, b bool) bool {
 		return a || b
 	},
@@ -103,6 +169,21 @@ func humanDate(t time.Time) string {
 	return t.UTC().Format("02 Jan 2006 at 15:04")
 }
 
+// highlight escapes a search snippet and turns the match markers put in by
+// the search model into <mark> tags.
+func highlight(snippet string) template.HTML {
+	escaped := template.HTMLEscapeString(snippet)
+	escaped = strings.ReplaceAll(escaped, models.SearchMatchStart, "<mark>")
+	escaped = strings.ReplaceAll(escaped, models.SearchMatchEnd, "</mark>")
+	return template.HTML(escaped)
+}
+
+// renderMarkdown turns the Markdown of a post or comment into HTML. The
+// renderer escapes what the writer typed, so its output is safe to embed.
+func renderMarkdown(source string) template.HTML {
+	return template.HTML(markdown.HTML(source))
+}
+
 func add(a, b int) int {
 	return a + b
 }
@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"errors"
+	"game-forum-abaliyev-ashirbay/internal/models"
+	"net/http"
+	"strconv"
+	"time"
+)
+
+// adminTrash lists the deleted posts and comments admins can restore or
+// purge.
+func (app *Application) adminTrash(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	items, err := app.Trash.List()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	data := templateData{
+		TrashItems:     items,
+		TrashRetention: app.TrashRetention,
+	}
+
+	app.render(w, r, http.StatusOK, "admin_trash.html", data)
+}
+
+// trashForm reads the kind and id of the trashed item a form acts on.
+func trashForm(r *http.Request) (string, int, bool) {
+	kind := r.FormValue("kind")
+	id, err := strconv.Atoi(r.FormValue("id"))
+	if err != nil || id < 1 || (kind != "post" && kind != "comment") {
+		return "", 0, false
+	}
+	return kind, id, true
+}
+
+func (app *Application) adminTrashRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	kind, id, ok := trashForm(r)
+	if !ok {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	var err error
+	if kind == "post" {
+		err = app.Posts.Restore(id)
+	} else {
+		err = app.Comments.Restore(id)
+	}
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/admin/trash", http.StatusSeeOther)
+}
+
+func (app *Application) adminTrashPurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	kind, id, ok := trashForm(r)
+	if !ok {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	err := app.purgeTrashed(kind, id)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			app.notFound(w, r)
+		} else {
+			app.serverError(w, r, err)
+		}
+		return
+	}
+
+	http.Redirect(w, r, "/admin/trash", http.StatusSeeOther)
+}
+
+// purgeTrashed removes a post or comment that is in the trash for good. It
+// returns models.ErrNoRecord when the item is not in the trash.
+func (app *Application) purgeTrashed(kind string, id int) error {
+	if kind == "post" {
+		post, err := app.Trash.GetPost(id)
+		if err != nil {
+			return err
+		}
+		return app.purgePost(post)
+	}
+
+	comment, err := app.Trash.GetComment(id)
+	if err != nil {
+		return err
+	}
+	return app.purgeComment(comment)
+}
+
+// PurgeTrash removes for good the posts and comments deleted before
+// deletedBefore. It returns the number of items purged.
+func (app *Application) PurgeTrash(deletedBefore time.Time) (int, error) {
+	items, err := app.Trash.List()
+	if err != nil {
+		return 0, err
+	}
+
+	purged := 0
+	for _, item := range items {
+		if !item.DeletedAt.Before(deletedBefore) {
+			continue
+		}
+
+		err = app.purgeTrashed(item.Kind, item.ID)
+		if err != nil {
+			// Comments go along with a post purged before them
+			if errors.Is(err, models.ErrNoRecord) {
+				continue
+			}
+			return purged, err
+		}
+		purged++
+	}
+
+	return purged, nil
+}
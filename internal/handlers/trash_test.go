@@ -0,0 +1,118 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+)
+
+var _ = ginkgo.Describe("Trash", func() {
+	var (
+		app   *testApp
+		users map[string]*testSession
+	)
+
+	ginkgo.BeforeEach(func() {
+		app = newTestApp("198.51.100.12")
+		app.TrashRetention = 30 * 24 * time.Hour
+
+		_, err := app.DB.Exec(`
+		INSERT INTO Categories (name) VALUES ('Speedruns');
+		INSERT INTO Users (id, email, username, password, role, created_at) VALUES
+		(1, 'player@example.com', 'player', '', 'user', '2026-01-02 10:00:00'),
+		(2, 'rival@example.com', 'rival', '', 'user', '2026-01-02 10:00:00'),
+		(3, 'boss@example.com', 'boss', '', 'admin', '2026-01-02 10:00:00');
+		INSERT INTO Posts (title, content, imgUrl, createdAt, category_id, owner_id, like_count, dislike_count) VALUES
+		('Any% route', 'Skip the boss.', '', '2026-01-02 10:00:00', 1, 1, 0, 0),
+		('Glitchless route', 'Fight the boss.', '', '2026-01-02 11:00:00', 1, 2, 0, 0);
+		INSERT INTO Comments (post_id, parent_id, user_id, created_at, text, like_count, dislike_count) VALUES
+		(2, NULL, 1, '2026-01-02 12:00:00', 'Too slow', 0, 0),
+		(2, 1, 2, '2026-01-02 12:05:00', 'Safer though', 0, 0),
+		(2, NULL, 1, '2026-01-02 12:10:00', 'Nevermind', 0, 0);
+		INSERT INTO Notifications (type, actor_id, recipient_id, post_id, comment_id, created_at, is_read) VALUES
+		('comment', 1, 2, 2, 1, '2026-01-02 12:00:00', 0),
+		('reply', 2, 1, 2, 2, '2026-01-02 12:05:00', 0);
+		`)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		users = map[string]*testSession{}
+		for i, name := range []string{"player", "rival", "boss"} {
+			users[name] = app.login(i+1, name+"-session")
+		}
+	})
+
+	get := func(user string, path string) *httptest.ResponseRecorder {
+		return app.get(users[user], path)
+	}
+
+	post := func(user string, path string, form url.Values) *httptest.ResponseRecorder {
+		return app.postForm(users[user], path, form)
+	}
+
+	count := func(query string) int {
+		var n int
+		gomega.Expect(app.DB.QueryRow(query).Scan(&n)).To(gomega.Succeed())
+		return n
+	}
+
+	ginkgo.It("hides deleted posts until an admin restores them", func() {
+		gomega.Expect(post("player", "/post/delete?id=1", url.Values{}).Code).To(gomega.Equal(http.StatusSeeOther))
+		gomega.Expect(count(`SELECT COUNT(*) FROM Posts WHERE id = 1 AND deleted_by = 1`)).To(gomega.Equal(1))
+
+		gomega.Expect(get("", "/post/view?id=1").Code).To(gomega.Equal(http.StatusNotFound))
+		gomega.Expect(get("", "/").Body.String()).ToNot(gomega.ContainSubstring("Any% route"))
+		gomega.Expect(post("player", "/post/delete?id=1", url.Values{}).Code).To(gomega.Equal(http.StatusNotFound))
+
+		gomega.Expect(get("player", "/admin/trash").Code).To(gomega.Equal(http.StatusForbidden))
+		rr := get("boss", "/admin/trash")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("Post #1: Any% route"))
+
+		rr = post("boss", "/admin/trash/restore", url.Values{"kind": {"post"}, "id": {"1"}})
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+		gomega.Expect(rr.Header().Get("Location")).To(gomega.Equal("/admin/trash"))
+		gomega.Expect(get("", "/post/view?id=1").Code).To(gomega.Equal(http.StatusOK))
+		gomega.Expect(get("boss", "/admin/trash").Body.String()).To(gomega.ContainSubstring("The trash is empty."))
+
+		gomega.Expect(post("boss", "/admin/trash/restore", url.Values{"kind": {"post"}, "id": {"1"}}).Code).To(gomega.Equal(http.StatusNotFound))
+		gomega.Expect(post("boss", "/admin/trash/restore", url.Values{"kind": {"user"}, "id": {"1"}}).Code).To(gomega.Equal(http.StatusBadRequest))
+	})
+
+	ginkgo.It("leaves a placeholder for deleted comments that have replies", func() {
+		gomega.Expect(post("player", "/comments/delete?id=1", url.Values{}).Code).To(gomega.Equal(http.StatusSeeOther))
+		gomega.Expect(post("player", "/comments/delete?id=3", url.Values{}).Code).To(gomega.Equal(http.StatusSeeOther))
+
+		body := get("rival", "/post/view?id=2").Body.String()
+		gomega.Expect(body).To(gomega.ContainSubstring("[deleted]"))
+		gomega.Expect(body).To(gomega.ContainSubstring("Safer though"))
+		gomega.Expect(body).ToNot(gomega.ContainSubstring("Too slow"))
+		gomega.Expect(body).ToNot(gomega.ContainSubstring("Nevermind"))
+		gomega.Expect(body).ToNot(gomega.ContainSubstring(`action="/comments/delete?id=1"`))
+
+		gomega.Expect(post("player", "/comments/delete?id=1", url.Values{}).Code).To(gomega.Equal(http.StatusNotFound))
+		gomega.Expect(post("boss", "/admin/trash/purge", url.Values{"kind": {"comment"}, "id": {"1"}}).Code).To(gomega.Equal(http.StatusSeeOther))
+		gomega.Expect(count(`SELECT COUNT(*) FROM Comments WHERE id = 1`)).To(gomega.Equal(0))
+		gomega.Expect(count(`SELECT COUNT(*) FROM Notifications WHERE comment_id = 1`)).To(gomega.Equal(0))
+		gomega.Expect(get("rival", "/post/view?id=2").Body.String()).To(gomega.ContainSubstring("Safer though"))
+	})
+
+	ginkgo.It("purges what has been in the trash for longer than the retention period", func() {
+		gomega.Expect(post("boss", "/post/delete?id=2", url.Values{}).Code).To(gomega.Equal(http.StatusSeeOther))
+		gomega.Expect(post("player", "/post/delete?id=1", url.Values{}).Code).To(gomega.Equal(http.StatusSeeOther))
+		_, err := app.DB.Exec(`UPDATE Posts SET deleted_at = ? WHERE id = 2`, time.Now().Add(-31*24*time.Hour))
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		purged, err := app.PurgeTrash(time.Now().Add(-app.TrashRetention))
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		gomega.Expect(purged).To(gomega.Equal(1))
+
+		gomega.Expect(count(`SELECT COUNT(*) FROM Posts`)).To(gomega.Equal(1))
+		gomega.Expect(count(`SELECT COUNT(*) FROM Comments`)).To(gomega.Equal(0))
+		gomega.Expect(count(`SELECT COUNT(*) FROM Notifications`)).To(gomega.Equal(0))
+		gomega.Expect(get("boss", "/admin/trash").Body.String()).To(gomega.ContainSubstring("Post #1: Any% route"))
+	})
+})
@@ -0,0 +1,577 @@
+package handlers
+
+import (
+	"crypto/rand"
+	"errors"
+	"game-forum-abaliyev-ashirbay/internal/models"
+	"game-forum-abaliyev-ashirbay/internal/totp"
+	"html/template"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	totpIssuer = "Game Forum"
+
+	loginChallengeCookie    = "login_challenge"
+	loginChallengeLifetime  = 5 * time.Minute
+	maxSecondFactorAttempts = 5
+
+	recoveryCodeCount = 10
+)
+
+// twoFactorView is what the two-factor page shows. Secret and URI are set
+// during enrollment, RecoveryCodes right after they were generated.
+type twoFactorView struct {
+	Enabled           bool
+	Required          bool
+	Secret            string
+	URI               template.URL
+	RecoveryCodes     []string
+	RecoveryCodesLeft int
+}
+
+type secondFactorForm struct {
+	Code string
+}
+
+// generateRecoveryCodes returns codes like "k3v9q-x2mfa". Only their hashes
+// are stored, so they have to be shown to the user right away.
+func generateRecoveryCodes() ([]string, error) {
+	const alphabet = "abcdefghijklmnopqrstuvwxyz234567"
+
+	codes := make([]string, recoveryCodeCount)
+	for i := range codes {
+		b := make([]byte, 10)
+		_, err := rand.Read(b)
+		if err != nil {
+			return nil, err
+		}
+		for j := range b {
+			b[j] = alphabet[int(b[j])%len(alphabet)]
+		}
+		codes[i] = string(b[:5]) + "-" + string(b[5:])
+	}
+
+	return codes, nil
+}
+
+// getTOTP returns the user's authenticator secret, nil when there is none.
+func (app *Application) getTOTP(userID int) (*models.TOTP, error) {
+	t, err := app.TwoFactor.GetTOTP(userID)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return nil, nil
+		}
+		return nil, err
+	}
+	return t, nil
+}
+
+// checkSecondFactor accepts a current authenticator code or, when
+// allowRecovery is set, an unused recovery code. Either works only once.
+func (app *Application) checkSecondFactor(t *models.TOTP, code string, allowRecovery bool) (bool, error) {
+	code = strings.TrimSpace(code)
+
+	step, ok := totp.Validate(t.Secret, code, time.Now())
+	if ok {
+		return app.TwoFactor.UseStep(t.UserID, step)
+	}
+
+	if !allowRecovery || code == "" {
+		return false, nil
+	}
+
+	return app.TwoFactor.UseRecoveryCode(t.UserID, code)
+}
+
+// twoFactorRequired reports whether the user's role must use two-factor
+// authentication.
+func (app *Application) twoFactorRequired(user *models.User) (bool, error) {
+	roles, err := app.TwoFactor.RequiredRoles()
+	if err != nil {
+		return false, err
+	}
+	return contains(roles, user.Role), nil
+}
+
+// twoFactorMissing reports whether the user still has to set up two-factor
+// authentication required for their role.
+func (app *Application) twoFactorMissing(user *models.User) (bool, error) {
+	required, err := app.twoFactorRequired(user)
+	if err != nil || !required {
+		return false, err
+	}
+
+	t, err := app.getTOTP(user.ID)
+	if err != nil {
+		return false, err
+	}
+
+	return t == nil || !t.Confirmed(), nil
+}
+
+// completeLogin logs in a user who passed the password or external login.
+// With two-factor authentication on no session is created yet, the browser
+// gets a short-lived challenge and goes on to the second step.
+func (app *Application) completeLogin(w http.ResponseWriter, r *http.Request, user *models.User, remember bool) {
+	t, err := app.getTOTP(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if t != nil && t.Confirmed() {
+		token, err := randomURLToken(32)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		err = app.LoginChallenges.Insert(token, user.ID, remember, loginChallengeLifetime)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		setLoginChallengeCookie(w, token, loginChallengeLifetime)
+		http.Redirect(w, r, "/login/2fa", http.StatusSeeOther)
+		return
+	}
+
+	err = app.startSession(w, r, user, remember)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// setLoginChallengeCookie sets the challenge cookie, a negative lifetime
+// deletes it.
+func setLoginChallengeCookie(w http.ResponseWriter, token string, lifetime time.Duration) {
+	maxAge := int(lifetime.Seconds())
+	if lifetime < 0 {
+		maxAge = -1
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginChallengeCookie,
+		Value:    token,
+		Path:     "/login/",
+		MaxAge:   maxAge,
+		HttpOnly: true,
+		Secure:   true,
+		SameSite: http.SameSiteLaxMode,
+	})
+}
+
+// loginChallenge returns the pending login of the browser, nil when there is
+// none or it expired.
+func (app *Application) loginChallenge(r *http.Request) (string, *models.LoginChallenge, error) {
+	cookie, err := r.Cookie(loginChallengeCookie)
+	if err != nil || cookie.Value == "" {
+		return "", nil, nil
+	}
+
+	challenge, err := app.LoginChallenges.Get(cookie.Value)
+	if err != nil {
+		if errors.Is(err, models.ErrNoRecord) {
+			return "", nil, nil
+		}
+		return "", nil, err
+	}
+
+	return cookie.Value, challenge, nil
+}
+
+func (app *Application) loginSecondFactor(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	_, challenge, err := app.loginChallenge(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if challenge == nil {
+		http.Redirect(w, r, "/login", http.StatusSeeOther)
+		return
+	}
+
+	data := templateData{Form: secondFactorForm{}}
+
+	app.render(w, r, http.StatusOK, "login_2fa.html", data)
+}
+
+func (app *Application) loginSecondFactorPost(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	loginAgain := func(message string) {
+		setLoginChallengeCookie(w, "", -1)
+		data := templateData{
+			Form:       loginForm{},
+			FormErrors: map[string]string{"general": message},
+		}
+		app.render(w, r, http.StatusUnprocessableEntity, "login.html", data)
+	}
+
+	token, challenge, err := app.loginChallenge(r)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if challenge == nil {
+		loginAgain("Your login expired, please log in again")
+		return
+	}
+
+	user, err := app.Users.GetById(challenge.UserID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	blocked, err := app.loginBlocked(w, r, user.ID, "", "login_2fa.html", secondFactorForm{})
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if blocked {
+		return
+	}
+
+	t, err := app.getTOTP(challenge.UserID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Two-factor authentication was turned off since the password step
+	ok := t == nil || !t.Confirmed()
+	if !ok {
+		ok, err = app.checkSecondFactor(t, r.PostForm.Get("code"), true)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	}
+
+	if !ok {
+		err = app.recordLoginFailure(r, user, user.Email)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+
+		attempts, err := app.LoginChallenges.AddAttempt(token)
+		if err != nil && !errors.Is(err, models.ErrNoRecord) {
+			app.serverError(w, r, err)
+			return
+		}
+
+		// Guessing needs the password again every few tries
+		if attempts >= maxSecondFactorAttempts {
+			err = app.LoginChallenges.Delete(token)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+			loginAgain("Too many wrong codes, please log in again")
+			return
+		}
+
+		data := templateData{
+			Form:       secondFactorForm{},
+			FormErrors: map[string]string{"code": "Invalid code"},
+		}
+		app.render(w, r, http.StatusUnprocessableEntity, "login_2fa.html", data)
+		return
+	}
+
+	err = app.LoginChallenges.Delete(token)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	setLoginChallengeCookie(w, "", -1)
+
+	suspension, err := app.activeSuspension(challenge.UserID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if suspension != nil {
+		loginAgain(suspensionMessage(suspension))
+		return
+	}
+
+	err = app.startSession(w, r, user, challenge.Remember)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/", http.StatusSeeOther)
+}
+
+// twoFactorPageData loads the two-factor page of the user.
+func (app *Application) twoFactorPageData(user *models.User) (templateData, error) {
+	required, err := app.twoFactorRequired(user)
+	if err != nil {
+		return templateData{}, err
+	}
+
+	t, err := app.getTOTP(user.ID)
+	if err != nil {
+		return templateData{}, err
+	}
+
+	view := &twoFactorView{Required: required}
+	switch {
+	case t != nil && t.Confirmed():
+		view.Enabled = true
+		view.RecoveryCodesLeft, err = app.TwoFactor.CountRecoveryCodes(user.ID)
+		if err != nil {
+			return templateData{}, err
+		}
+	case t != nil:
+		view.Secret = t.Secret
+		// html/template only allows web links, this one is built by us
+		view.URI = template.URL(totp.URI(totpIssuer, user.Email, t.Secret))
+	}
+
+	return templateData{Form: secondFactorForm{}, TwoFactor: view}, nil
+}
+
+func (app *Application) twoFactorPage(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodGet {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := app.authenticatedUser(w, r)
+	if !ok {
+		return
+	}
+
+	data, err := app.twoFactorPageData(user)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	app.render(w, r, http.StatusOK, "two_factor.html", data)
+}
+
+func (app *Application) twoFactorSetup(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := app.authenticatedUser(w, r)
+	if !ok {
+		return
+	}
+
+	secret, err := totp.GenerateSecret()
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	// Does nothing when two-factor authentication is already on
+	err = app.TwoFactor.SetPendingSecret(user.ID, secret)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/user/2fa", http.StatusSeeOther)
+}
+
+// twoFactorCodeAction handles the forms of the two-factor page that need a
+// code from the authenticator app: the code is checked and action is run.
+// refuse, when not nil, may turn the request down with an error message
+// before the code is checked, so that a recovery code is not used up for
+// nothing.
+func (app *Application) twoFactorCodeAction(w http.ResponseWriter, r *http.Request, wantConfirmed bool, allowRecovery bool, refuse func(data *templateData) string, action func(user *models.User, t *models.TOTP, data *templateData) error) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	user, ok := app.authenticatedUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	t, err := app.getTOTP(user.ID)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+	if t == nil || t.Confirmed() != wantConfirmed {
+		http.Redirect(w, r, "/user/2fa", http.StatusSeeOther)
+		return
+	}
+
+	data, err := app.twoFactorPageData(user)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if refuse != nil {
+		if message := refuse(&data); message != "" {
+			data.FormErrors = map[string]string{"code": message}
+			app.render(w, r, http.StatusUnprocessableEntity, "two_factor.html", data)
+			return
+		}
+	}
+
+	var valid bool
+	if wantConfirmed {
+		valid, err = app.checkSecondFactor(t, r.PostForm.Get("code"), allowRecovery)
+		if err != nil {
+			app.serverError(w, r, err)
+			return
+		}
+	} else {
+		// Confirming the enrollment, the code proves the app has the secret
+		var step int64
+		step, valid = totp.Validate(t.Secret, r.PostForm.Get("code"), time.Now())
+		if valid {
+			err = app.TwoFactor.Confirm(user.ID, step)
+			if err != nil {
+				app.serverError(w, r, err)
+				return
+			}
+		}
+	}
+
+	// Confirming changes what the page shows
+	data, err = app.twoFactorPageData(user)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if !valid {
+		data.FormErrors = map[string]string{"code": "Invalid code"}
+		app.render(w, r, http.StatusUnprocessableEntity, "two_factor.html", data)
+		return
+	}
+
+	err = action(user, t, &data)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	if data.FormErrors != nil {
+		app.render(w, r, http.StatusUnprocessableEntity, "two_factor.html", data)
+		return
+	}
+
+	app.render(w, r, http.StatusOK, "two_factor.html", data)
+}
+
+// newRecoveryCodes replaces the user's recovery codes and puts the new ones
+// on the page.
+func (app *Application) newRecoveryCodes(user *models.User, data *templateData) error {
+	codes, err := generateRecoveryCodes()
+	if err != nil {
+		return err
+	}
+
+	err = app.TwoFactor.ReplaceRecoveryCodes(user.ID, codes)
+	if err != nil {
+		return err
+	}
+
+	data.TwoFactor.RecoveryCodes = codes
+	data.TwoFactor.RecoveryCodesLeft = len(codes)
+	return nil
+}
+
+func (app *Application) twoFactorConfirm(w http.ResponseWriter, r *http.Request) {
+	app.twoFactorCodeAction(w, r, false, false, nil, func(user *models.User, t *models.TOTP, data *templateData) error {
+		return app.newRecoveryCodes(user, data)
+	})
+}
+
+func (app *Application) twoFactorRecoveryCodes(w http.ResponseWriter, r *http.Request) {
+	app.twoFactorCodeAction(w, r, true, false, nil, func(user *models.User, t *models.TOTP, data *templateData) error {
+		return app.newRecoveryCodes(user, data)
+	})
+}
+
+func (app *Application) twoFactorDisable(w http.ResponseWriter, r *http.Request) {
+	refuse := func(data *templateData) string {
+		if data.TwoFactor.Required {
+			return "Two-factor authentication is required for your role"
+		}
+		return ""
+	}
+
+	app.twoFactorCodeAction(w, r, true, true, refuse, func(user *models.User, t *models.TOTP, data *templateData) error {
+		err := app.TwoFactor.Disable(user.ID)
+		if err != nil {
+			return err
+		}
+
+		*data, err = app.twoFactorPageData(user)
+		return err
+	})
+}
+
+func (app *Application) twoFactorRequiredRoles(w http.ResponseWriter, r *http.Request) {
+	if r.Method != http.MethodPost {
+		app.clientError(w, r, http.StatusMethodNotAllowed)
+		return
+	}
+
+	err := r.ParseForm()
+	if err != nil {
+		app.clientError(w, r, http.StatusBadRequest)
+		return
+	}
+
+	var roles []string
+	for _, role := range r.PostForm["roles"] {
+		if !contains(defaultRoles, role) {
+			app.clientError(w, r, http.StatusBadRequest)
+			return
+		}
+		roles = append(roles, role)
+	}
+
+	err = app.TwoFactor.SetRequiredRoles(roles)
+	if err != nil {
+		app.serverError(w, r, err)
+		return
+	}
+
+	http.Redirect(w, r, "/admin", http.StatusSeeOther)
+}
@@ -0,0 +1,172 @@
+package handlers_test
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"time"
+
+	"github.com/onsi/ginkgo/v2"
+	"github.com/onsi/gomega"
+	"golang.org/x/crypto/bcrypt"
+
+	"game-forum-abaliyev-ashirbay/internal/totp"
+)
+
+var recoveryCodeRX = regexp.MustCompile(`<code>([a-z2-7]{5}-[a-z2-7]{5})</code>`)
+
+var _ = ginkgo.Describe("Two-factor authentication", func() {
+	var (
+		app *testApp
+		mod *testSession
+	)
+
+	ginkgo.BeforeEach(func() {
+		app = newTestApp("198.51.100.6")
+
+		hash, err := bcrypt.GenerateFromPassword([]byte("password1"), bcrypt.MinCost)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		_, err = app.DB.Exec(`INSERT INTO Users (id, email, username, password, role) VALUES
+			(1, 'mod@example.com', 'mod', ?, 'moderator')`, string(hash))
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		mod = app.login(1, "mod-session")
+	})
+
+	do := func(method, path string, form url.Values, cookies ...*http.Cookie) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, strings.NewReader(form.Encode()))
+		req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		for _, c := range cookies {
+			req.AddCookie(c)
+		}
+		return app.do(nil, req)
+	}
+
+	cookie := func(rr *httptest.ResponseRecorder, name string) *http.Cookie {
+		for _, c := range rr.Result().Cookies() {
+			if c.Name == name && c.Value != "" {
+				return c
+			}
+		}
+		return nil
+	}
+
+	// enroll turns two-factor authentication on and returns the secret and
+	// the recovery codes.
+	enroll := func() (string, []string) {
+		rr := do(http.MethodPost, "/user/2fa/setup", url.Values{"csrf_token": {mod.CSRF}}, mod.Cookie)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+
+		var secret string
+		gomega.Expect(app.DB.QueryRow(`SELECT secret FROM User_TOTP WHERE user_id = 1`).Scan(&secret)).To(gomega.Succeed())
+
+		rr = do(http.MethodGet, "/user/2fa", url.Values{}, mod.Cookie)
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring(secret))
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("otpauth://totp/Game%20Forum:mod@example.com?"))
+
+		code, err := totp.Code(secret, totp.Step(time.Now()))
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		rr = do(http.MethodPost, "/user/2fa/confirm", url.Values{"csrf_token": {mod.CSRF}, "code": {code}}, mod.Cookie)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusOK))
+
+		var codes []string
+		for _, m := range recoveryCodeRX.FindAllStringSubmatch(rr.Body.String(), -1) {
+			codes = append(codes, m[1])
+		}
+		gomega.Expect(codes).To(gomega.HaveLen(10))
+		return secret, codes
+	}
+
+	// login passes the password step and returns the challenge cookie.
+	login := func() *http.Cookie {
+		rr := do(http.MethodPost, "/login/post", url.Values{"email": {"mod@example.com"}, "password": {"password1"}})
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+		gomega.Expect(rr.Header().Get("Location")).To(gomega.Equal("/login/2fa"))
+		gomega.Expect(cookie(rr, "token")).To(gomega.BeNil())
+
+		challenge := cookie(rr, "login_challenge")
+		gomega.Expect(challenge).ToNot(gomega.BeNil())
+		return challenge
+	}
+
+	secondStep := func(challenge *http.Cookie, code string) *httptest.ResponseRecorder {
+		return do(http.MethodPost, "/login/2fa/post", url.Values{"code": {code}}, challenge)
+	}
+
+	ginkgo.It("asks for a code after the password before creating a session", func() {
+		secret, _ := enroll()
+		challenge := login()
+
+		rr := secondStep(challenge, "000000")
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+		gomega.Expect(cookie(rr, "token")).To(gomega.BeNil())
+
+		// The code used to confirm the setup cannot be replayed, wait for
+		// the next one
+		_, err := app.DB.Exec(`UPDATE User_TOTP SET last_used_step = last_used_step - 1`)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		code, err := totp.Code(secret, totp.Step(time.Now()))
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		rr = secondStep(challenge, code)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+		gomega.Expect(rr.Header().Get("Location")).To(gomega.Equal("/"))
+		gomega.Expect(cookie(rr, "token")).ToNot(gomega.BeNil())
+
+		// Neither the challenge nor the code work a second time
+		gomega.Expect(secondStep(challenge, code).Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+		gomega.Expect(secondStep(login(), code).Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+	})
+
+	ginkgo.It("accepts each recovery code once", func() {
+		_, codes := enroll()
+
+		rr := secondStep(login(), strings.ToUpper(codes[3]))
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+		gomega.Expect(cookie(rr, "token")).ToNot(gomega.BeNil())
+
+		rr = secondStep(login(), codes[3])
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+	})
+
+	ginkgo.It("sends the password step again after too many wrong codes", func() {
+		enroll()
+		challenge := login()
+
+		for i := 0; i < 4; i++ {
+			gomega.Expect(secondStep(challenge, "000000").Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+			// Wrong codes also slow down the account, that is tested elsewhere
+			_, err := app.DB.Exec(`DELETE FROM Login_Attempts`)
+			gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		}
+		rr := secondStep(challenge, "000000")
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("Too many wrong codes"))
+
+		var n int
+		gomega.Expect(app.DB.QueryRow(`SELECT COUNT(*) FROM Login_Challenges`).Scan(&n)).To(gomega.Succeed())
+		gomega.Expect(n).To(gomega.Equal(0))
+	})
+
+	ginkgo.It("makes members of required roles set it up first", func() {
+		_, err := app.DB.Exec(`INSERT INTO Two_Factor_Required_Roles (role) VALUES ('moderator')`)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+
+		rr := do(http.MethodGet, "/user/personal-page", url.Values{}, mod.Cookie)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusSeeOther))
+		gomega.Expect(rr.Header().Get("Location")).To(gomega.Equal("/user/2fa"))
+
+		_, codes := enroll()
+
+		// and cannot turn it off
+		rr = do(http.MethodPost, "/user/2fa/disable", url.Values{"csrf_token": {mod.CSRF}, "code": {codes[0]}}, mod.Cookie)
+		gomega.Expect(rr.Code).To(gomega.Equal(http.StatusUnprocessableEntity))
+		gomega.Expect(rr.Body.String()).To(gomega.ContainSubstring("required for your role"))
+
+		// The recovery code was not spent on the refusal
+		left, err := app.TwoFactor.CountRecoveryCodes(1)
+		gomega.Expect(err).ToNot(gomega.HaveOccurred())
+		gomega.Expect(left).To(gomega.Equal(len(codes)))
+	})
+})
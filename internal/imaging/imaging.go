@@ -0,0 +1,230 @@
+// Package imaging checks uploaded pictures and re-encodes them so that only
+// their pixels are kept, and draws the thumbnails shown in post lists.
+package imaging
+
+import (
+	"bytes"
+	"errors"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"net/http"
+)
+
+const (
+	MaxSide   = 6000
+	MaxPixels = 6000 * 4000
+
+	// GIFs keep all their frames in memory while they are re-encoded
+	maxGIFFrames = 300
+	maxGIFPixels = 100 << 20
+
+	ThumbnailWidth  = 320
+	ThumbnailHeight = 240
+
+	jpegQuality = 90
+)
+
+var (
+	ErrFormat   = errors.New("imaging: not a JPEG, PNG or GIF image")
+	ErrTooLarge = errors.New("imaging: image dimensions too large")
+)
+
+// Image is an upload that passed Process. Ext is the extension matching the
+// real format, ".jpg", ".png" or ".gif". Thumbnail is always a JPEG.
+type Image struct {
+	Ext       string
+	Data      []byte
+	Thumbnail []byte
+}
+
+// Process works out the format of data from its content, not from the name
+// it was uploaded with, and accepts JPEG, PNG and GIF only. The picture is
+// decoded and encoded again, which drops EXIF and GPS data, comments and
+// anything appended to the file. JPEGs are turned the way their EXIF
+// orientation asks for before that information is lost.
+func Process(data []byte) (*Image, error) {
+	var format string
+	switch http.DetectContentType(data) {
+	case "image/jpeg":
+		format = "jpeg"
+	case "image/png":
+		format = "png"
+	case "image/gif":
+		format = "gif"
+	default:
+		return nil, ErrFormat
+	}
+
+	// Check the header first so that huge images are never decoded
+	config, configFormat, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil || configFormat != format {
+		return nil, ErrFormat
+	}
+	if config.Width <= 0 || config.Height <= 0 || config.Width > MaxSide || config.Height > MaxSide ||
+		config.Width*config.Height > MaxPixels {
+		return nil, ErrTooLarge
+	}
+
+	result := &Image{}
+	var first image.Image
+	var buf bytes.Buffer
+
+	switch format {
+	case "jpeg":
+		img, err := jpeg.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrFormat
+		}
+		first = orient(img, exifOrientation(data))
+		err = jpeg.Encode(&buf, first, &jpeg.Options{Quality: jpegQuality})
+		if err != nil {
+			return nil, err
+		}
+		result.Ext = ".jpg"
+
+	case "png":
+		img, err := png.Decode(bytes.NewReader(data))
+		if err != nil {
+			return nil, ErrFormat
+		}
+		first = img
+		err = png.Encode(&buf, img)
+		if err != nil {
+			return nil, err
+		}
+		result.Ext = ".png"
+
+	case "gif":
+		frames, err := gifFrameCount(data)
+		if err != nil {
+			return nil, ErrFormat
+		}
+		if frames > maxGIFFrames || frames*config.Width*config.Height > maxGIFPixels {
+			return nil, ErrTooLarge
+		}
+		g, err := gif.DecodeAll(bytes.NewReader(data))
+		if err != nil || len(g.Image) == 0 {
+			return nil, ErrFormat
+		}
+		first = g.Image[0]
+		// Only frames, timing and looping are written back
+		err = gif.EncodeAll(&buf, &gif.GIF{
+			Image:           g.Image,
+			Delay:           g.Delay,
+			LoopCount:       g.LoopCount,
+			Disposal:        g.Disposal,
+			Config:          g.Config,
+			BackgroundIndex: g.BackgroundIndex,
+		})
+		if err != nil {
+			return nil, err
+		}
+		result.Ext = ".gif"
+	}
+	result.Data = buf.Bytes()
+
+	result.Thumbnail, err = Thumbnail(first)
+	if err != nil {
+		return nil, err
+	}
+
+	return result, nil
+}
+
+// Thumbnail scales img down to fit ThumbnailWidth x ThumbnailHeight and
+// returns it as a JPEG. Transparent parts become white.
+func Thumbnail(img image.Image) ([]byte, error) {
+	b := img.Bounds()
+	width, height := b.Dx(), b.Dy()
+	if width > ThumbnailWidth {
+		height = height * ThumbnailWidth / width
+		width = ThumbnailWidth
+	}
+	if height > ThumbnailHeight {
+		width = width * ThumbnailHeight / height
+		height = ThumbnailHeight
+	}
+	if width < 1 {
+		width = 1
+	}
+	if height < 1 {
+		height = 1
+	}
+
+	flat := image.NewRGBA(image.Rect(0, 0, b.Dx(), b.Dy()))
+	draw.Draw(flat, flat.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(flat, flat.Bounds(), img, b.Min, draw.Over)
+
+	var buf bytes.Buffer
+	err := jpeg.Encode(&buf, Resize(flat, width, height), &jpeg.Options{Quality: jpegQuality})
+	if err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
+
+// gifFrameCount counts the images in a GIF by walking its blocks, without
+// decompressing any of them.
+func gifFrameCount(data []byte) (int, error) {
+	errBad := errors.New("imaging: malformed GIF")
+
+	// Header and logical screen descriptor
+	if len(data) < 13 {
+		return 0, errBad
+	}
+	pos := 13
+	if data[10]&0x80 != 0 {
+		pos += 3 << (int(data[10]&0x07) + 1)
+	}
+
+	// skipSubBlocks moves past a chain of data sub-blocks
+	skipSubBlocks := func() error {
+		for {
+			if pos >= len(data) {
+				return errBad
+			}
+			size := int(data[pos])
+			pos++
+			if size == 0 {
+				return nil
+			}
+			pos += size
+		}
+	}
+
+	frames := 0
+	for pos < len(data) {
+		switch data[pos] {
+		case 0x21: // extension
+			pos += 2
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+		case 0x2C: // image descriptor
+			if pos+10 > len(data) {
+				return 0, errBad
+			}
+			flags := data[pos+9]
+			pos += 10
+			if flags&0x80 != 0 {
+				pos += 3 << (int(flags&0x07) + 1)
+			}
+			pos++ // LZW minimum code size
+			if err := skipSubBlocks(); err != nil {
+				return 0, err
+			}
+			frames++
+		case 0x3B: // trailer
+			return frames, nil
+		default:
+			return 0, errBad
+		}
+	}
+
+	return frames, nil
+}
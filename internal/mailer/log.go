@@ -0,0 +1,32 @@
+package mailer
+
+import (
+	"errors"
+	"io"
+	"sync"
+)
+
+// LogMailer writes messages to a writer instead of sending them, for local
+// development and tests. Point it at a file and follow the links from there.
+type LogMailer struct {
+	From string
+
+	mu sync.Mutex
+	w  io.Writer
+}
+
+func NewLogMailer(w io.Writer, from string) *LogMailer {
+	return &LogMailer{From: from, w: w}
+}
+
+func (m *LogMailer) Send(msg Message) error {
+	if !validHeader(msg.To) || !validHeader(msg.Subject) {
+		return errors.New("mailer: newline in header")
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	_, err := m.w.Write(append(format(m.From, msg), "\r\n"...))
+	return err
+}
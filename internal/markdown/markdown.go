@@ -0,0 +1,459 @@
+// Package markdown renders the Markdown subset of posts and comments: bold,
+// italics, inline code and code blocks, lists, links, quotes and ||spoilers||.
+// Everything the writer typed is escaped, so the only tags in the output are
+// the ones the renderer writes itself. Raw HTML shows up as text.
+package markdown
+
+import (
+	"html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+// maxDepth bounds how deep quotes and lists nest.
+const maxDepth = 8
+
+var (
+	bulletRX   = regexp.MustCompile(`^ {0,3}[-*+][ \t]+(.*)$`)
+	numberRX   = regexp.MustCompile(`^ {0,3}(\d{1,9})[.)][ \t]+(.*)$`)
+	languageRX = regexp.MustCompile(`^[A-Za-z0-9_+-]{1,20}$`)
+)
+
+// HTML renders source as HTML. Links to other sites get rel="nofollow".
+func HTML(source string) string {
+	r := &renderer{html: true}
+	r.blocks(splitLines(source), 0)
+	return strings.TrimSpace(r.b.String())
+}
+
+// Text renders source as plain text on one line, for lists of posts and
+// notifications. Spoilers are left out.
+func Text(source string) string {
+	r := &renderer{}
+	r.blocks(splitLines(source), 0)
+	return strings.Join(strings.Fields(r.b.String()), " ")
+}
+
+func splitLines(source string) []string {
+	source = strings.ReplaceAll(source, "\r\n", "\n")
+	source = strings.ReplaceAll(source, "\r", "\n")
+	return strings.Split(source, "\n")
+}
+
+type renderer struct {
+	html bool
+	b    strings.Builder
+}
+
+// tag writes s in HTML mode and sep in text mode.
+func (r *renderer) tag(s string, sep string) {
+	if r.html {
+		r.b.WriteString(s)
+	} else {
+		r.b.WriteString(sep)
+	}
+}
+
+func (r *renderer) text(s string) {
+	if r.html {
+		r.b.WriteString(html.EscapeString(s))
+	} else {
+		r.b.WriteString(s)
+	}
+}
+
+func (r *renderer) blocks(lines []string, depth int) {
+	var paragraph []string
+	flush := func() {
+		if len(paragraph) > 0 {
+			r.tag("<p>", " ")
+			r.inline(strings.Join(paragraph, "\n"), false)
+			r.tag("</p>\n", " ")
+			paragraph = nil
+		}
+	}
+
+	for i := 0; i < len(lines); {
+		trimmed := strings.TrimSpace(lines[i])
+
+		switch {
+		case trimmed == "":
+			flush()
+			i++
+
+		case strings.HasPrefix(trimmed, "```"):
+			flush()
+			i = r.codeBlock(lines, i)
+
+		case strings.HasPrefix(trimmed, ">") && depth < maxDepth:
+			flush()
+			var quoted []string
+			for i < len(lines) && strings.HasPrefix(strings.TrimSpace(lines[i]), ">") {
+				line := strings.TrimPrefix(strings.TrimSpace(lines[i]), ">")
+				quoted = append(quoted, strings.TrimPrefix(line, " "))
+				i++
+			}
+			r.tag("<blockquote>\n", " ")
+			r.blocks(quoted, depth+1)
+			r.tag("</blockquote>\n", " ")
+
+		case isListItem(lines[i]) && depth < maxDepth:
+			flush()
+			i = r.list(lines, i, depth)
+
+		default:
+			paragraph = append(paragraph, trimmed)
+			i++
+		}
+	}
+
+	flush()
+}
+
+// codeBlock writes the fenced code block starting at lines[start] and
+// returns the index of the line after it. An unclosed fence runs to the end.
+func (r *renderer) codeBlock(lines []string, start int) int {
+	language := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(lines[start]), "```"))
+
+	end := start + 1
+	for end < len(lines) && !strings.HasPrefix(strings.TrimSpace(lines[end]), "```") {
+		end++
+	}
+
+	if languageRX.MatchString(language) {
+		r.tag(`<pre><code class="language-`+language+`">`, " ")
+	} else {
+		r.tag("<pre><code>", " ")
+	}
+	r.text(strings.Join(lines[start+1:min(end, len(lines))], "\n"))
+	r.tag("</code></pre>\n", " ")
+
+	return end + 1
+}
+
+func isListItem(line string) bool {
+	return bulletRX.MatchString(line) || numberRX.MatchString(line)
+}
+
+// listItem returns the text of a list item line, whether the list is
+// ordered and the number of the item.
+func listItem(line string) (text string, ordered bool, number string, ok bool) {
+	if m := bulletRX.FindStringSubmatch(line); m != nil {
+		return m[1], false, "", true
+	}
+	if m := numberRX.FindStringSubmatch(line); m != nil {
+		return m[2], true, m[1], true
+	}
+	return "", false, "", false
+}
+
+// list writes the list starting at lines[start] and returns the index of the
+// line after it. Indented lines belong to the item above them and can hold
+// nested lists.
+func (r *renderer) list(lines []string, start int, depth int) int {
+	_, ordered, number, _ := listItem(lines[start])
+
+	switch n := strings.TrimLeft(number, "0"); {
+	case !ordered:
+		r.tag("<ul>\n", " ")
+	case n != "1" && n != "":
+		r.tag(`<ol start="`+n+`">`+"\n", " ")
+	default:
+		r.tag("<ol>\n", " ")
+	}
+
+	i := start
+	for i < len(lines) {
+		text, itemOrdered, _, ok := listItem(lines[i])
+		if !ok || itemOrdered != ordered {
+			break
+		}
+		i++
+
+		var nested []string
+		for i < len(lines) {
+			line := lines[i]
+			if strings.TrimSpace(line) == "" {
+				// A blank line ends the list unless more of it follows
+				if i+1 < len(lines) && (isIndented(lines[i+1]) || sameList(lines[i+1], ordered)) {
+					nested = append(nested, "")
+					i++
+					continue
+				}
+				break
+			}
+			if !isIndented(line) {
+				break
+			}
+			nested = append(nested, strings.TrimLeft(line, " \t"))
+			i++
+		}
+
+		r.tag("<li>", " • ")
+		r.inline(strings.TrimSpace(text), false)
+		if len(nested) > 0 {
+			r.tag("\n", " ")
+			r.blocks(nested, depth+1)
+		}
+		r.tag("</li>\n", " ")
+
+		if i < len(lines) && strings.TrimSpace(lines[i]) == "" {
+			i++
+		}
+	}
+
+	if ordered {
+		r.tag("</ol>\n", " ")
+	} else {
+		r.tag("</ul>\n", " ")
+	}
+
+	return i
+}
+
+func isIndented(line string) bool {
+	return strings.HasPrefix(line, "  ") || strings.HasPrefix(line, "\t")
+}
+
+func sameList(line string, ordered bool) bool {
+	_, itemOrdered, _, ok := listItem(line)
+	return ok && itemOrdered == ordered
+}
+
+// inline writes the spans of s. Links are not allowed inside links.
+func (r *renderer) inline(s string, inLink bool) {
+	for i := 0; i < len(s); {
+		c := s[i]
+
+		switch {
+		case c == '\\' && i+1 < len(s) && strings.IndexByte("\\`*_[]()|>#+-.!~", s[i+1]) >= 0:
+			r.text(s[i+1 : i+2])
+			i += 2
+			continue
+
+		case c == '`':
+			n := 1
+			for i+n < len(s) && s[i+n] == '`' {
+				n++
+			}
+			fence := s[i : i+n]
+			if end := strings.Index(s[i+n:], fence); end > 0 {
+				r.tag("<code>", "")
+				r.text(s[i+n : i+n+end])
+				r.tag("</code>", "")
+				i += n + end + n
+				continue
+			}
+			r.text(fence)
+			i += n
+			continue
+
+		case c == '|' && strings.HasPrefix(s[i:], "||"):
+			if end := closing(s, i+2, "||"); end >= 0 {
+				if r.html {
+					r.b.WriteString(`<span class="spoiler" tabindex="0">`)
+					r.inline(s[i+2:end], inLink)
+					r.b.WriteString("</span>")
+				} else {
+					r.b.WriteString("[spoiler]")
+				}
+				i = end + 2
+				continue
+			}
+
+		case (c == '*' || c == '_') && strings.HasPrefix(s[i+1:], string(c)) && canOpen(s, i, c):
+			delim := s[i : i+2]
+			if end := closing(s, i+2, delim); end >= 0 && canClose(s, end+2, c) {
+				r.tag("<strong>", "")
+				r.inline(s[i+2:end], inLink)
+				r.tag("</strong>", "")
+				i = end + 2
+				continue
+			}
+
+		case (c == '*' || c == '_') && canOpen(s, i, c):
+			if end := closingSingle(s, i+1, c); end >= 0 {
+				r.tag("<em>", "")
+				r.inline(s[i+1:end], inLink)
+				r.tag("</em>", "")
+				i = end + 1
+				continue
+			}
+
+		case c == '[' && !inLink:
+			if text, target, n, ok := parseLink(s[i:]); ok {
+				r.link(text, target)
+				i += n
+				continue
+			}
+
+		case c == 'h' && !inLink && (i == 0 || !isWordChar(s[i-1])):
+			if target := autolink(s[i:]); target != "" {
+				r.link("", target)
+				i += len(target)
+				continue
+			}
+
+		case c == '\n':
+			r.tag("<br>\n", " ")
+			i++
+			continue
+		}
+
+		// Plain text up to the next character that may start a span
+		j := i + 1
+		for j < len(s) && strings.IndexByte("\\`|*_[h\n", s[j]) < 0 {
+			j++
+		}
+		r.text(s[i:j])
+		i = j
+	}
+}
+
+// link writes a link to target. Without text the address is shown.
+func (r *renderer) link(text string, target string) {
+	if !r.html {
+		if text == "" {
+			text = target
+		}
+		r.inline(text, true)
+		return
+	}
+
+	r.b.WriteString(`<a href="` + html.EscapeString(target) + `"`)
+	if !strings.HasPrefix(target, "/") {
+		r.b.WriteString(` rel="nofollow ugc noopener"`)
+	}
+	r.b.WriteString(">")
+	if text == "" {
+		r.text(target)
+	} else {
+		r.inline(text, true)
+	}
+	r.b.WriteString("</a>")
+}
+
+// closing returns the index of the delim closing a span whose content
+// starts at from, or -1. Spans do not start or end with a space.
+func closing(s string, from int, delim string) int {
+	if from >= len(s) || isSpace(s[from]) {
+		return -1
+	}
+	for offset := from; offset < len(s); {
+		end := strings.Index(s[offset:], delim)
+		if end < 0 {
+			return -1
+		}
+		end += offset
+		if end > from && !isSpace(s[end-1]) {
+			return end
+		}
+		offset = end + 1
+	}
+	return -1
+}
+
+// closingSingle is closing for a single * or _, skipping doubled ones that
+// belong to a nested strong span.
+func closingSingle(s string, from int, c byte) int {
+	if from >= len(s) || isSpace(s[from]) {
+		return -1
+	}
+	for j := from; j < len(s); j++ {
+		if s[j] != c {
+			continue
+		}
+		if j+1 < len(s) && s[j+1] == c {
+			j++
+			continue
+		}
+		if j > from && !isSpace(s[j-1]) && canClose(s, j+1, c) {
+			return j
+		}
+	}
+	return -1
+}
+
+// canOpen keeps underscores inside words, as in snake_case, from starting
+// a span.
+func canOpen(s string, i int, c byte) bool {
+	return c != '_' || i == 0 || !isWordChar(s[i-1])
+}
+
+func canClose(s string, after int, c byte) bool {
+	return c != '_' || after >= len(s) || !isWordChar(s[after])
+}
+
+// parseLink reads a [text](target) link at the start of s and returns its
+// parts and length. Links to unsafe targets are not links.
+func parseLink(s string) (text string, target string, n int, ok bool) {
+	closeText := strings.IndexByte(s, ']')
+	if closeText < 2 || !strings.HasPrefix(s[closeText+1:], "(") {
+		return "", "", 0, false
+	}
+	closeTarget := strings.IndexByte(s[closeText+2:], ')')
+	if closeTarget < 0 {
+		return "", "", 0, false
+	}
+
+	text = s[1:closeText]
+	target = strings.TrimSpace(s[closeText+2 : closeText+2+closeTarget])
+	if strings.ContainsAny(text, "\n") || !safeURL(target) {
+		return "", "", 0, false
+	}
+
+	return text, target, closeText + 2 + closeTarget + 1, true
+}
+
+// autolink returns the web address at the start of s, without punctuation
+// that most likely ends the sentence around it.
+func autolink(s string) string {
+	if !strings.HasPrefix(s, "http://") && !strings.HasPrefix(s, "https://") {
+		return ""
+	}
+
+	end := strings.IndexAny(s, " \t\n<>\"")
+	if end < 0 {
+		end = len(s)
+	}
+	target := strings.TrimRight(s[:end], ".,:;!?'*_|")
+	if strings.HasSuffix(target, ")") && !strings.Contains(target, "(") {
+		target = strings.TrimRight(target, ")")
+	}
+
+	if !safeURL(target) || strings.HasSuffix(target, "//") {
+		return ""
+	}
+	return target
+}
+
+// safeURL accepts web and mail addresses and paths on the forum itself.
+func safeURL(target string) bool {
+	if target == "" || strings.ContainsAny(target, " \t\n\"'<>\\") {
+		return false
+	}
+
+	u, err := url.Parse(target)
+	if err != nil {
+		return false
+	}
+
+	switch strings.ToLower(u.Scheme) {
+	case "http", "https":
+		return u.Host != ""
+	case "mailto":
+		return u.Opaque != ""
+	case "":
+		return strings.HasPrefix(target, "/") && !strings.HasPrefix(target, "//")
+	}
+	return false
+}
+
+func isSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n'
+}
+
+func isWordChar(c byte) bool {
+	return c == '_' || 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c >= 0x80
+}
@@ -0,0 +1,125 @@
+package markdown
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestHTMLLinks(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"web address", "[guide](https://example.com/guide?a=1&b=2)",
+			`<p><a href="https://example.com/guide?a=1&amp;b=2" rel="nofollow ugc noopener">guide</a></p>`},
+		{"mail address", "[mail me](mailto:player@example.com)",
+			`<p><a href="mailto:player@example.com" rel="nofollow ugc noopener">mail me</a></p>`},
+		{"forum path is followed", "[rules](/post/view?id=1)",
+			`<p><a href="/post/view?id=1">rules</a></p>`},
+		{"bare address", "see https://example.com/run.",
+			`<p>see <a href="https://example.com/run" rel="nofollow ugc noopener">https://example.com/run</a>.</p>`},
+
+		{"javascript", "[click](javascript:alert(1))", `<p>[click](javascript:alert(1))</p>`},
+		{"javascript in capitals", "[click](JavaScript:alert(1))", `<p>[click](JavaScript:alert(1))</p>`},
+		{"data", "[click](data:text/html;base64,PHNjcmlwdD4=)", `<p>[click](data:text/html;base64,PHNjcmlwdD4=)</p>`},
+		{"vbscript", "[click](vbscript:msgbox)", `<p>[click](vbscript:msgbox)</p>`},
+		{"protocol relative", "[click](//evil.example/)", `<p>[click](//evil.example/)</p>`},
+		{"backslash host", `[click](/\evil.example/)`, `<p>[click](/\evil.example/)</p>`},
+		{"relative path", "[click](post/view)", `<p>[click](post/view)</p>`},
+		{"web address without host", "[click](https:///path)", `<p>[click](https:///path)</p>`},
+		{"quote in target", `[click](https://example.com/"onmouseover="x)`,
+			`<p>[click](<a href="https://example.com/" rel="nofollow ugc noopener">https://example.com/</a>&#34;onmouseover=&#34;x)</p>`},
+
+		{"no links in links", "[see https://example.com](https://example.com/a)",
+			`<p><a href="https://example.com/a" rel="nofollow ugc noopener">see https://example.com</a></p>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTML(tt.source); got != tt.want {
+				t.Errorf("HTML(%q)\n got %s\nwant %s", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTMLEscaping(t *testing.T) {
+	tests := []struct {
+		name   string
+		source string
+		want   string
+	}{
+		{"raw html", `<script>alert("x")</script>`, `<p>&lt;script&gt;alert(&#34;x&#34;)&lt;/script&gt;</p>`},
+		{"html in a span", `**<b onclick="x">**`, `<p><strong>&lt;b onclick=&#34;x&#34;&gt;</strong></p>`},
+		{"html in link text", `[<img src=x>](/a)`, `<p><a href="/a">&lt;img src=x&gt;</a></p>`},
+		{"html in inline code", "`<i>`", `<p><code>&lt;i&gt;</code></p>`},
+		{"html in a code block", "```\n<i>&amp;</i>\n```", "<pre><code>&lt;i&gt;&amp;amp;&lt;/i&gt;</code></pre>"},
+		{"code block language", "```go\nx\n```", `<pre><code class="language-go">x</code></pre>`},
+		{"language breaking out of the class", "```go\"><script>\nx\n```", `<pre><code>x</code></pre>`},
+		{"language with a space", "```go onclick=x\nx\n```", `<pre><code>x</code></pre>`},
+		{"spoiler", "||<u>||", `<p><span class="spoiler" tabindex="0">&lt;u&gt;</span></p>`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := HTML(tt.source); got != tt.want {
+				t.Errorf("HTML(%q)\n got %s\nwant %s", tt.source, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestHTMLNesting(t *testing.T) {
+	tests := []struct {
+		name       string
+		source     string
+		blockquote int
+		list       int
+	}{
+		{"quotes up to the limit", strings.Repeat(">", maxDepth) + " deep", maxDepth, 0},
+		{"deeper quotes are text", strings.Repeat(">", 1000) + " deep", maxDepth, 0},
+		{"list inside quotes", strings.Repeat(">", maxDepth-1) + " - item", maxDepth - 1, 1},
+		{"no list past the limit", strings.Repeat(">", maxDepth) + " - item", maxDepth, 0},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := HTML(tt.source)
+			if n := strings.Count(got, "<blockquote>"); n != tt.blockquote {
+				t.Errorf("%d blockquotes, want %d in %s", n, tt.blockquote, got)
+			}
+			if n := strings.Count(got, "<ul>"); n != tt.list {
+				t.Errorf("%d lists, want %d in %s", n, tt.list, got)
+			}
+			if strings.Count(got, "<blockquote>") != strings.Count(got, "</blockquote>") {
+				t.Errorf("unbalanced blockquotes in %s", got)
+			}
+		})
+	}
+
+	// A nested list item is one level deeper than its parent
+	got := HTML("- a\n  - b\n- c")
+	want := "<ul>\n<li>a\n<ul>\n<li>b</li>\n</ul>\n</li>\n<li>c</li>\n</ul>"
+	if got != want {
+		t.Errorf("nested list\n got %q\nwant %q", got, want)
+	}
+}
+
+func TestText(t *testing.T) {
+	tests := []struct {
+		source string
+		want   string
+	}{
+		{"**Any%** route with ||the ending||", "Any% route with [spoiler]"},
+		{"[guide](https://example.com/guide)", "guide"},
+		{"[click](javascript:alert(1))", "[click](javascript:alert(1))"},
+		{"<b>bold</b>\n\n- one\n- two", "<b>bold</b> • one • two"},
+	}
+
+	for _, tt := range tests {
+		if got := Text(tt.source); got != tt.want {
+			t.Errorf("Text(%q) = %q, want %q", tt.source, got, tt.want)
+		}
+	}
+}
@@ -0,0 +1,164 @@
+package models
+
+import (
+	"crypto/sha256"
+	"database/sql"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+// Scopes a personal API token can be granted. Session cookies implicitly
+// carry all of them.
+const (
+	ScopeRead     = "read"
+	ScopeWrite    = "write"
+	ScopeModerate = "moderate"
+)
+
+var AllScopes = []string{ScopeRead, ScopeWrite, ScopeModerate}
+
+type ApiTokensModelInterface interface {
+	Insert(userID int, name string, token string, scopes []string) (int, error)
+	GetByToken(token string) (*ApiToken, error)
+	GetAllByUserId(userID int) ([]*ApiToken, error)
+	Delete(id int, userID int) error
+	DeleteByUserId(userID int) error
+	UpdateLastUsed(id int) error
+}
+
+type ApiToken struct {
+	ID         int
+	UserID     int
+	Name       string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt sql.NullTime
+}
+
+func (t *ApiToken) HasScope(scope string) bool {
+	for _, s := range t.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+	return false
+}
+
+type ApiTokensModel struct {
+	DB *sql.DB
+}
+
+func hashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
+
+func (m *ApiTokensModel) Insert(userID int, name string, token string, scopes []string) (int, error) {
+	stmt := `INSERT INTO Api_Tokens (user_id, name, token_hash, scopes, created_at)
+	VALUES (?, ?, ?, ?, datetime('now'))`
+
+	result, err := m.DB.Exec(stmt, userID, name, hashToken(token), strings.Join(scopes, " "))
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (m *ApiTokensModel) GetByToken(token string) (*ApiToken, error) {
+	stmt := `SELECT id, user_id, name, scopes, created_at, last_used_at
+	FROM Api_Tokens
+	WHERE token_hash = ?`
+
+	t := &ApiToken{}
+	var scopes string
+
+	err := m.DB.QueryRow(stmt, hashToken(token)).Scan(&t.ID, &t.UserID, &t.Name, &scopes, &t.CreatedAt, &t.LastUsedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+	t.Scopes = strings.Fields(scopes)
+
+	return t, nil
+}
+
+func (m *ApiTokensModel) GetAllByUserId(userID int) ([]*ApiToken, error) {
+	stmt := `SELECT id, user_id, name, scopes, created_at, last_used_at
+	FROM Api_Tokens
+	WHERE user_id = ?
+	ORDER BY created_at DESC`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var tokens []*ApiToken
+
+	for rows.Next() {
+		t := &ApiToken{}
+		var scopes string
+
+		err := rows.Scan(&t.ID, &t.UserID, &t.Name, &scopes, &t.CreatedAt, &t.LastUsedAt)
+		if err != nil {
+			return nil, err
+		}
+		t.Scopes = strings.Fields(scopes)
+
+		tokens = append(tokens, t)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return tokens, nil
+}
+
+// Delete revokes a token. The user id is part of the condition so users can
+// only revoke their own tokens.
+func (m *ApiTokensModel) Delete(id int, userID int) error {
+	stmt := `DELETE FROM Api_Tokens WHERE id = ? AND user_id = ?`
+
+	result, err := m.DB.Exec(stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// DeleteByUserId revokes all tokens of the user.
+func (m *ApiTokensModel) DeleteByUserId(userID int) error {
+	stmt := `DELETE FROM Api_Tokens WHERE user_id = ?`
+
+	_, err := m.DB.Exec(stmt, userID)
+	return err
+}
+
+func (m *ApiTokensModel) UpdateLastUsed(id int) error {
+	stmt := `UPDATE Api_Tokens SET last_used_at = datetime('now') WHERE id = ?`
+
+	_, err := m.DB.Exec(stmt, id)
+	return err
+}
@@ -9,7 +9,7 @@ import (
 )
 
 type CommentsModelInterface interface {
-	Insert(postID int, userID int, text string, created_at time.Time) (int, error)
+	Insert(postID int, parentID *int, userID int, text string, created_at time.Time) (int, error)
 	GetAllByPostIdAndUserId(userId int, postId int) ([]*CommentReaction, error)
 	UpdateCommentLikeDislikeCounts(commentID int, likeCount int, dislikeCount int) error
 	Get(id int) (*Comment, error)
@@ -18,16 +18,39 @@ type CommentsModelInterface interface {
 	DeleteCommentById(id int) error
 	GetAllCommentsReactionsByPostID(postID int, userID int) ([]*CommentReaction, error)
 	GetAllByUserId(userId int) ([]*CommentPostAddition, error)
+	GetCommentTreeByPostID(postID int, userID int) ([]*CommentReaction, error)
+	Update(id int, editorID int, text string) error
+	GetRevisions(commentID int) ([]*CommentRevision, error)
+	SoftDelete(id int, deletedBy int) error
+	Restore(id int) error
 }
 
+// maxCommentDepth is the deepest level replies are nested to, deeper replies
+// are shown at this level under their closest visible ancestor.
+const maxCommentDepth = 4
+
 type Comment struct {
 	ID           int
 	PostID       int
+	ParentID     int
 	UserID       int
 	Text         string
 	LikeCount    int
 	DislikeCount int
 	CreatedAt    time.Time
+	EditedAt     sql.NullTime
+}
+
+// CommentRevision is one version of the text of a comment. Revisions are
+// numbered from 1 per comment.
+type CommentRevision struct {
+	ID         int
+	CommentID  int
+	Revision   int
+	Text       string
+	EditorID   int
+	EditorName string
+	CreatedAt  time.Time
 }
 
 type CommentAdditionals struct {
@@ -39,6 +62,12 @@ type CommentReaction struct {
 	CommentAdditionals
 	IsLiked    bool
 	IsDisliked bool
+	Depth      int
+	Replies    []*CommentReaction
+
+	// Deleted comments are only kept in a thread, without their text, as
+	// long as replies to them are visible
+	Deleted bool
 }
 
 type CommentPostAddition struct {
@@ -51,15 +80,15 @@ type CommentsModel struct {
 }
 
 func (m *CommentsModel) Get(id int) (*Comment, error) {
-	stmt := `SELECT id, post_id, user_id, text, like_count, dislike_count, created_at
+	stmt := `SELECT id, post_id, COALESCE(parent_id, 0), user_id, text, like_count, dislike_count, created_at, edited_at
 	         FROM Comments
-	         WHERE id = ?`
+	         WHERE id = ? AND deleted_at IS NULL`
 
 	row := m.DB.QueryRow(stmt, id)
 
 	comment := &Comment{}
 
-	err := row.Scan(&comment.ID, &comment.PostID, &comment.UserID, &comment.Text, &comment.LikeCount, &comment.DislikeCount, &comment.CreatedAt)
+	err := row.Scan(&comment.ID, &comment.PostID, &comment.ParentID, &comment.UserID, &comment.Text, &comment.LikeCount, &comment.DislikeCount, &comment.CreatedAt, &comment.EditedAt)
 	if err != nil {
 		if errors.Is(err, sql.ErrNoRows) {
 			return nil, ErrNoRecord
@@ -71,11 +100,16 @@ func (m *CommentsModel) Get(id int) (*Comment, error) {
 	return comment, nil
 }
 
-func (m *CommentsModel) Insert(postID int, userID int, text string, created_at time.Time) (int, error) {
-	stmt := `INSERT INTO Comments (post_id, user_id, text, like_count, dislike_count, created_at)
-	VALUES (?, ?, ?, 0, 0, ?)`
+func (m *CommentsModel) Insert(postID int, parentID *int, userID int, text string, created_at time.Time) (int, error) {
+	stmt := `INSERT INTO Comments (post_id, parent_id, user_id, text, like_count, dislike_count, created_at)
+	VALUES (?, ?, ?, ?, 0, 0, ?)`
 
-	result, err := m.DB.Exec(stmt, postID, userID, text, created_at)
+	var parentArg interface{}
+	if parentID != nil {
+		parentArg = *parentID
+	}
+
+	result, err := m.DB.Exec(stmt, postID, parentArg, userID, text, created_at)
 	if err != nil {
 		return 0, err
 	}
@@ -92,7 +126,7 @@ func (m *CommentsModel) GetAllByPostIdAndUserId(userId int, postId int) ([]*Comm
 	stmt := `SELECT c.id, c.post_id, c.user_id, c.text, c.like_count, c.dislike_count, c.created_at, cr.type as reaction
 			FROM Comments c
 			LEFT JOIN Comment_Reactions cr on cr.comment_id = c.id
-			WHERE c.post_id = ? AND c.user_id = ?
+			WHERE c.post_id = ? AND c.user_id = ? AND c.deleted_at IS NULL
 			ORDER BY c.created_at ASC`
 
 	rows, err := m.DB.Query(stmt, postId, userId)
@@ -150,6 +184,8 @@ func (m *CommentsModel) UpdateCommentLikeDislikeCounts(commentID int, likeCount
 	return nil
 }
 
+// GetAllByPostId returns every comment of a post, including the ones in the
+// trash.
 func (m *CommentsModel) GetAllByPostId(postId int) ([]*Comment, error) {
 	stmt := `SELECT c.id, c.post_id, c.user_id, c.text, c.like_count, c.dislike_count, c.created_at
 			FROM Comments c
@@ -185,12 +221,15 @@ func (m *CommentsModel) GetAllCommentsReactionsByPostID(postID int, userID int)
 	stmt := `SELECT 
 				c.id AS comment_id, 
 				c.post_id, 
+				COALESCE(c.parent_id, 0) AS parent_id,
 				c.user_id, 
 				u.username,  
-				c.text, 
+				CASE WHEN c.deleted_at IS NULL THEN c.text ELSE '' END AS text,
 				c.like_count, 
 				c.dislike_count, 
 				c.created_at,
+				c.edited_at,
+				c.deleted_at IS NOT NULL AS deleted,
 				GROUP_CONCAT(cr.type || ':' || cr.user_id, ', ') AS reactions
 			FROM 
 				Comments c
@@ -201,7 +240,7 @@ func (m *CommentsModel) GetAllCommentsReactionsByPostID(postID int, userID int)
 			WHERE 
 				c.post_id = ?
 			GROUP BY 
-				c.id, c.post_id, c.user_id, u.username, c.text, c.like_count, c.dislike_count, c.created_at
+				c.id, c.post_id, c.parent_id, c.user_id, u.username, c.text, c.like_count, c.dislike_count, c.created_at, c.edited_at, c.deleted_at
 			ORDER BY 
 				c.created_at ASC;
 `
@@ -222,12 +261,15 @@ func (m *CommentsModel) GetAllCommentsReactionsByPostID(postID int, userID int)
 		err := rows.Scan(
 			&comment.ID,
 			&comment.PostID,
+			&comment.ParentID,
 			&comment.UserID,
 			&comment.Username,
 			&comment.Text,
 			&comment.LikeCount,
 			&comment.DislikeCount,
 			&comment.CreatedAt,
+			&comment.EditedAt,
+			&comment.Deleted,
 			&reactions,
 		)
 		if err != nil {
@@ -271,30 +313,176 @@ func (m *CommentsModel) GetAllCommentsReactionsByPostID(postID int, userID int)
 }
 
 func (m *CommentsModel) DeleteCommentsByPostId(postID int) error {
-	stmt := `DELETE FROM Comments WHERE post_id = ?`
-	_, err := m.DB.Exec(stmt, postID)
+	tx, err := m.DB.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
 
-	return nil
+	_, err = tx.Exec(`DELETE FROM Comment_Revisions WHERE comment_id IN (SELECT id FROM Comments WHERE post_id = ?)`, postID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM Comments WHERE post_id = ?`, postID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
 }
 
 func (m *CommentsModel) DeleteCommentById(id int) error {
-	stmt := `DELETE FROM Comments WHERE id = ?`
-	_, err := m.DB.Exec(stmt, id)
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM Comment_Revisions WHERE comment_id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM Comments WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SoftDelete moves a comment to the trash. Threads show a placeholder in
+// its place while replies to it are visible.
+func (m *CommentsModel) SoftDelete(id int, deletedBy int) error {
+	stmt := `UPDATE Comments SET deleted_at = ?, deleted_by = ? WHERE id = ? AND deleted_at IS NULL`
+	result, err := m.DB.Exec(stmt, time.Now(), deletedBy, id)
 	if err != nil {
 		return err
 	}
 
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Restore takes a comment out of the trash.
+func (m *CommentsModel) Restore(id int) error {
+	stmt := `UPDATE Comments SET deleted_at = NULL, deleted_by = NULL WHERE id = ? AND deleted_at IS NOT NULL`
+	result, err := m.DB.Exec(stmt, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
 	return nil
 }
 
+// Update replaces the text of a comment and sets its edited_at. The new text
+// is recorded as a revision made by editorID; the first edit also records
+// the comment as it was written, as revision 1. Saving the same text again
+// changes nothing.
+func (m *CommentsModel) Update(id int, editorID int, text string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	var authorID int
+	var oldText string
+	var createdAt time.Time
+	err = tx.QueryRow(`SELECT user_id, text, created_at FROM Comments WHERE id = ? AND deleted_at IS NULL`, id).Scan(&authorID, &oldText, &createdAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return ErrNoRecord
+		}
+		return err
+	}
+	if oldText == text {
+		return nil
+	}
+
+	var latest int
+	err = tx.QueryRow(`SELECT COALESCE(MAX(revision), 0) FROM Comment_Revisions WHERE comment_id = ?`, id).Scan(&latest)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO Comment_Revisions (comment_id, revision, text, editor_id, created_at)
+	         VALUES (?, ?, ?, ?, ?)`
+
+	if latest == 0 {
+		_, err = tx.Exec(stmt, id, 1, oldText, authorID, createdAt)
+		if err != nil {
+			return err
+		}
+		latest = 1
+	}
+
+	now := time.Now()
+	_, err = tx.Exec(stmt, id, latest+1, text, editorID, now)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`UPDATE Comments SET text = ?, edited_at = ? WHERE id = ?`, text, now, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// GetRevisions returns the revisions of a comment, the latest first.
+// Comments that were never edited have none.
+func (m *CommentsModel) GetRevisions(commentID int) ([]*CommentRevision, error) {
+	stmt := `SELECT r.id, r.comment_id, r.revision, r.text, r.editor_id, COALESCE(u.username, ''), r.created_at
+	         FROM Comment_Revisions r
+	         LEFT JOIN Users u ON u.id = r.editor_id
+	         WHERE r.comment_id = ?
+	         ORDER BY r.revision DESC`
+
+	rows, err := m.DB.Query(stmt, commentID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*CommentRevision
+	for rows.Next() {
+		rev := &CommentRevision{}
+		err = rows.Scan(&rev.ID, &rev.CommentID, &rev.Revision, &rev.Text, &rev.EditorID, &rev.EditorName, &rev.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
 func (m *CommentsModel) GetAllByUserId(userId int) ([]*CommentPostAddition, error) {
 	stmt := `SELECT c.id, c.post_id, c.user_id, c.text, c.like_count, c.dislike_count, c.created_at, p.title
 			FROM Comments c
 			INNER JOIN Posts p ON p.id = c.post_id
-			WHERE user_id = ?`
+			WHERE user_id = ? AND c.deleted_at IS NULL AND p.deleted_at IS NULL`
 
 	rows, err := m.DB.Query(stmt, userId)
 	if err != nil {
@@ -321,3 +509,67 @@ func (m *CommentsModel) GetAllByUserId(userId int) ([]*CommentPostAddition, erro
 
 	return comments, nil
 }
+
+// GetCommentTreeByPostID returns the top-level comments of a post with their
+// replies nested under Replies, oldest first on every level.
+func (m *CommentsModel) GetCommentTreeByPostID(postID int, userID int) ([]*CommentReaction, error) {
+	comments, err := m.GetAllCommentsReactionsByPostID(postID, userID)
+	if err != nil {
+		return nil, err
+	}
+
+	return buildCommentTree(comments), nil
+}
+
+func buildCommentTree(comments []*CommentReaction) []*CommentReaction {
+	byID := make(map[int]*CommentReaction, len(comments))
+	for _, c := range comments {
+		byID[c.ID] = c
+	}
+
+	var roots []*CommentReaction
+	for _, c := range comments {
+		parent, ok := byID[c.ParentID]
+		if c.ParentID == 0 || !ok || parent == c {
+			roots = append(roots, c)
+			continue
+		}
+		parent.Replies = append(parent.Replies, c)
+	}
+
+	var prune func(nodes []*CommentReaction) []*CommentReaction
+	prune = func(nodes []*CommentReaction) []*CommentReaction {
+		var kept []*CommentReaction
+		for _, c := range nodes {
+			c.Replies = prune(c.Replies)
+			if c.Deleted && len(c.Replies) == 0 {
+				continue
+			}
+			kept = append(kept, c)
+		}
+		return kept
+	}
+	roots = prune(roots)
+
+	var walk func(nodes []*CommentReaction, depth int) []*CommentReaction
+	walk = func(nodes []*CommentReaction, depth int) []*CommentReaction {
+		var flattened []*CommentReaction
+		for _, c := range nodes {
+			c.Depth = depth
+			children := c.Replies
+			c.Replies = nil
+
+			if depth >= maxCommentDepth {
+				flattened = append(flattened, c)
+				flattened = append(flattened, walk(children, depth)...)
+				continue
+			}
+
+			c.Replies = walk(children, depth+1)
+			flattened = append(flattened, c)
+		}
+		return flattened
+	}
+
+	return walk(roots, 0)
+}
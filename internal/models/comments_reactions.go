@@ -12,6 +12,7 @@ type CommentsReactionsModelInterface interface {
 	GetReaction(userID int, CommentID int) (*CommentsReactions, error)
 	GetReactionCount(CommentID int, reactionType string) (int, error)
 	GetReactionByUserID(userID int) (*CommentsReactions, error)
+	GetAllByUserID(userID int) ([]*CommentsReactions, error)
 	DeleteReactioByCommentId(CommentID int) error
 }
 
@@ -136,3 +137,27 @@ func (m *CommentsReactionsModel) DeleteReactioByCommentId(CommentID int) error {
 	}
 	return nil
 }
+
+// GetAllByUserID returns the likes and dislikes the user gave to comments.
+func (m *CommentsReactionsModel) GetAllByUserID(userID int) ([]*CommentsReactions, error) {
+	stmt := `SELECT user_id, comment_id, type FROM Comment_Reactions WHERE user_id = ? ORDER BY comment_id`
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reactions []*CommentsReactions
+	for rows.Next() {
+		reaction := &CommentsReactions{}
+		if err := rows.Scan(&reaction.UserID, &reaction.CommentID, &reaction.Type); err != nil {
+			return nil, err
+		}
+		reactions = append(reactions, reaction)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reactions, nil
+}
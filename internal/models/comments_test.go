@@ -0,0 +1,80 @@
+package models
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+)
+
+// treeString writes a comment tree as "id:depth" with the replies in
+// parentheses, such as "1:0(2:1 3:1)".
+func treeString(nodes []*CommentReaction) string {
+	var parts []string
+	for _, c := range nodes {
+		s := fmt.Sprintf("%d:%d", c.ID, c.Depth)
+		if len(c.Replies) > 0 {
+			s += "(" + treeString(c.Replies) + ")"
+		}
+		parts = append(parts, s)
+	}
+	return strings.Join(parts, " ")
+}
+
+func TestBuildCommentTree(t *testing.T) {
+	type comment struct {
+		id, parent int
+		deleted    bool
+	}
+
+	tests := []struct {
+		name     string
+		comments []comment
+		want     string
+	}{
+		{
+			name:     "flat thread",
+			comments: []comment{{1, 0, false}, {2, 0, false}},
+			want:     "1:0 2:0",
+		},
+		{
+			name:     "replies nest under their parent in order",
+			comments: []comment{{1, 0, false}, {2, 1, false}, {3, 0, false}, {4, 1, false}, {5, 2, false}},
+			want:     "1:0(2:1(5:2) 4:1) 3:0",
+		},
+		{
+			name: "replies deeper than the limit are flattened",
+			comments: []comment{
+				{1, 0, false}, {2, 1, false}, {3, 2, false}, {4, 3, false},
+				{5, 4, false}, {6, 5, false}, {7, 6, false}, {8, 5, false},
+			},
+			want: "1:0(2:1(3:2(4:3(5:4 6:4 7:4 8:4))))",
+		},
+		{
+			name:     "deleted comments stay while they have replies",
+			comments: []comment{{1, 0, true}, {2, 1, false}, {3, 0, true}, {4, 3, true}},
+			want:     "1:0(2:1)",
+		},
+		{
+			name:     "replies to missing or themselves become top level",
+			comments: []comment{{1, 0, false}, {2, 9, false}, {3, 3, false}},
+			want:     "1:0 2:0 3:0",
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var comments []*CommentReaction
+			for _, c := range tt.comments {
+				comments = append(comments, &CommentReaction{
+					Comment: Comment{ID: c.id, ParentID: c.parent},
+					Deleted: c.deleted,
+				})
+			}
+
+			got := treeString(buildCommentTree(comments))
+			if got != tt.want {
+				t.Errorf("got %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
@@ -10,3 +10,5 @@ var ErrDuplicateEmail = errors.New("models: email already exists")
 
 
 var ErrDuplicateUsername = errors.New("models: username already exists")
+
+var ErrDuplicateIdentity = errors.New("models: external identity already linked")
@@ -0,0 +1,186 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+// loginAttemptsKept is how long attempts are kept for the admin panel.
+const loginAttemptsKept = 30 * 24 * time.Hour
+
+type LoginAttemptsModelInterface interface {
+	Insert(userID int, login string, ip string, success bool) error
+	AccountFailures(userID int, login string, window time.Duration) (int, time.Time, error)
+	IPFailures(ip string, window time.Duration) (int, time.Time, error)
+	FailuresByAccount(window time.Duration) ([]*LoginFailures, error)
+	FailuresByIP(window time.Duration) ([]*LoginFailures, error)
+}
+
+// LoginFailures sums up the failed logins of an account, or of an IP
+// address. UserID is 0 for logins that name no account, those are told apart
+// by Login.
+type LoginFailures struct {
+	UserID   int
+	Username string
+	Login    string
+	IP       string
+	Count    int
+	IPs      int
+	Accounts int
+	Last     time.Time
+}
+
+type LoginAttemptsModel struct {
+	DB *sql.DB
+}
+
+// Insert records an attempt, userID is 0 when the login names no account.
+func (m *LoginAttemptsModel) Insert(userID int, login string, ip string, success bool) error {
+	_, err := m.DB.Exec(`DELETE FROM Login_Attempts
+	WHERE created_at <= datetime('now', '-' || ? || ' seconds')`, int(loginAttemptsKept.Seconds()))
+	if err != nil {
+		return err
+	}
+
+	var user sql.NullInt64
+	if userID != 0 {
+		user = sql.NullInt64{Int64: int64(userID), Valid: true}
+	}
+
+	stmt := `INSERT INTO Login_Attempts (user_id, login, ip, success, created_at)
+	VALUES (?, ?, ?, ?, datetime('now'))`
+
+	_, err = m.DB.Exec(stmt, user, login, ip, success)
+	return err
+}
+
+// AccountFailures counts the failed attempts on an account within window
+// since its last successful login, and returns when the last one was made.
+// Logins that name no account are counted by login instead.
+func (m *LoginAttemptsModel) AccountFailures(userID int, login string, window time.Duration) (int, time.Time, error) {
+	account, arg := "user_id = ?", interface{}(userID)
+	if userID == 0 {
+		account, arg = "user_id IS NULL AND login = ?", login
+	}
+
+	stmt := `SELECT COUNT(*), COALESCE(MAX(created_at), '') FROM Login_Attempts
+	WHERE ` + account + ` AND success = 0
+	AND created_at > datetime('now', '-' || ? || ' seconds')
+	AND id > COALESCE((SELECT MAX(id) FROM Login_Attempts WHERE ` + account + ` AND success = 1), 0)`
+
+	return m.countFailures(stmt, arg, int(window.Seconds()), arg)
+}
+
+// IPFailures counts the failed attempts made from an IP address within
+// window. Logging in to some account does not reset them.
+func (m *LoginAttemptsModel) IPFailures(ip string, window time.Duration) (int, time.Time, error) {
+	stmt := `SELECT COUNT(*), COALESCE(MAX(created_at), '') FROM Login_Attempts
+	WHERE ip = ? AND success = 0 AND created_at > datetime('now', '-' || ? || ' seconds')`
+
+	return m.countFailures(stmt, ip, int(window.Seconds()))
+}
+
+func (m *LoginAttemptsModel) countFailures(stmt string, args ...interface{}) (int, time.Time, error) {
+	var count int
+	var last string
+	err := m.DB.QueryRow(stmt, args...).Scan(&count, &last)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	lastAt, err := parseAggregateTime(last)
+	if err != nil {
+		return 0, time.Time{}, err
+	}
+
+	return count, lastAt, nil
+}
+
+// FailuresByAccount lists the accounts with failed attempts within window
+// since their last successful login, latest first.
+func (m *LoginAttemptsModel) FailuresByAccount(window time.Duration) ([]*LoginFailures, error) {
+	stmt := `SELECT COALESCE(a.user_id, 0), COALESCE(u.username, ''),
+		CASE WHEN a.user_id IS NULL THEN a.login ELSE '' END AS account_login,
+		COUNT(*), COUNT(DISTINCT a.ip), MAX(a.created_at)
+	FROM Login_Attempts a
+	LEFT JOIN Users u ON u.id = a.user_id
+	WHERE a.success = 0 AND a.created_at > datetime('now', '-' || ? || ' seconds')
+	AND a.id > COALESCE((SELECT MAX(s.id) FROM Login_Attempts s WHERE s.user_id = a.user_id AND s.success = 1), 0)
+	GROUP BY a.user_id, account_login
+	ORDER BY MAX(a.created_at) DESC
+	LIMIT 50`
+
+	rows, err := m.DB.Query(stmt, int(window.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failures []*LoginFailures
+	for rows.Next() {
+		f := &LoginFailures{}
+		var last string
+		err := rows.Scan(&f.UserID, &f.Username, &f.Login, &f.Count, &f.IPs, &last)
+		if err != nil {
+			return nil, err
+		}
+		f.Last, err = parseAggregateTime(last)
+		if err != nil {
+			return nil, err
+		}
+		failures = append(failures, f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return failures, nil
+}
+
+// FailuresByIP lists the IP addresses with failed attempts within window,
+// latest first.
+func (m *LoginAttemptsModel) FailuresByIP(window time.Duration) ([]*LoginFailures, error) {
+	stmt := `SELECT ip, COUNT(*), COUNT(DISTINCT COALESCE(user_id, login)), MAX(created_at)
+	FROM Login_Attempts
+	WHERE success = 0 AND created_at > datetime('now', '-' || ? || ' seconds')
+	GROUP BY ip
+	ORDER BY MAX(created_at) DESC
+	LIMIT 50`
+
+	rows, err := m.DB.Query(stmt, int(window.Seconds()))
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var failures []*LoginFailures
+	for rows.Next() {
+		f := &LoginFailures{}
+		var last string
+		err := rows.Scan(&f.IP, &f.Count, &f.Accounts, &last)
+		if err != nil {
+			return nil, err
+		}
+		f.Last, err = parseAggregateTime(last)
+		if err != nil {
+			return nil, err
+		}
+		failures = append(failures, f)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return failures, nil
+}
+
+// parseAggregateTime parses a datetime that went through an SQL function
+// such as MAX, the driver only converts plain columns to time.Time.
+func parseAggregateTime(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	return time.Parse("2006-01-02 15:04:05", s)
+}
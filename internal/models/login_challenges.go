@@ -0,0 +1,78 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type LoginChallengesModelInterface interface {
+	Insert(token string, userID int, remember bool, lifetime time.Duration) error
+	Get(token string) (*LoginChallenge, error)
+	AddAttempt(token string) (int, error)
+	Delete(token string) error
+}
+
+// LoginChallenge is a login whose password was right and that waits for the
+// second factor. Remember carries the "remember me" choice over.
+type LoginChallenge struct {
+	UserID   int
+	Remember bool
+	Attempts int
+}
+
+type LoginChallengesModel struct {
+	DB *sql.DB
+}
+
+// Insert stores a pending login, dropping the expired ones.
+func (m *LoginChallengesModel) Insert(token string, userID int, remember bool, lifetime time.Duration) error {
+	_, err := m.DB.Exec(`DELETE FROM Login_Challenges WHERE expires_at <= datetime('now')`)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO Login_Challenges (token_hash, user_id, remember, created_at, expires_at)
+	VALUES (?, ?, ?, datetime('now'), datetime('now', '+' || ? || ' seconds'))`
+
+	_, err = m.DB.Exec(stmt, hashToken(token), userID, remember, int(lifetime.Seconds()))
+	return err
+}
+
+func (m *LoginChallengesModel) Get(token string) (*LoginChallenge, error) {
+	stmt := `SELECT user_id, remember, attempts FROM Login_Challenges
+	WHERE token_hash = ? AND expires_at > datetime('now')`
+
+	c := &LoginChallenge{}
+	err := m.DB.QueryRow(stmt, hashToken(token)).Scan(&c.UserID, &c.Remember, &c.Attempts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return c, nil
+}
+
+// AddAttempt counts a wrong code and returns how many there were so far.
+func (m *LoginChallengesModel) AddAttempt(token string) (int, error) {
+	stmt := `UPDATE Login_Challenges SET attempts = attempts + 1
+	WHERE token_hash = ? RETURNING attempts`
+
+	var attempts int
+	err := m.DB.QueryRow(stmt, hashToken(token)).Scan(&attempts)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+
+	return attempts, nil
+}
+
+func (m *LoginChallengesModel) Delete(token string) error {
+	_, err := m.DB.Exec(`DELETE FROM Login_Challenges WHERE token_hash = ?`, hashToken(token))
+	return err
+}
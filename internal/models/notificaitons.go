@@ -22,6 +22,8 @@ type NotificationsModelInterface interface {
 	MarkAsRead(notificationID int) error
 	GetUsersNorificationsCount(recipientID int) (int, error)
 	MarkAllAsReadByUser(userID int) error
+	DeleteByPostID(postID int) error
+	DeleteByCommentID(commentID int) error
 }
 
 type NotificationsModel struct {
@@ -118,3 +120,15 @@ func (m *NotificationsModel) MarkAllAsReadByUser(userID int) error {
     _, err := m.DB.Exec(stmt, userID)
     return err
 }
+
+// DeleteByPostID removes the notifications about a post and its comments.
+func (m *NotificationsModel) DeleteByPostID(postID int) error {
+	_, err := m.DB.Exec(`DELETE FROM Notifications WHERE post_id = ?`, postID)
+	return err
+}
+
+// DeleteByCommentID removes the notifications about a comment.
+func (m *NotificationsModel) DeleteByCommentID(commentID int) error {
+	_, err := m.DB.Exec(`DELETE FROM Notifications WHERE comment_id = ?`, commentID)
+	return err
+}
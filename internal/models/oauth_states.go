@@ -0,0 +1,60 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type OAuthStatesModelInterface interface {
+	Insert(state string, provider string, codeVerifier string, userID int, reauth bool, lifetime time.Duration) error
+	Consume(state string, provider string) (*OAuthState, error)
+}
+
+// OAuthState is a login in progress. UserID is set when a logged in user is
+// linking an external account rather than logging in, or with Reauth when
+// they confirm who they are with an account they linked before.
+type OAuthState struct {
+	CodeVerifier string
+	UserID       int
+	Reauth       bool
+}
+
+type OAuthStatesModel struct {
+	DB *sql.DB
+}
+
+// Insert stores a pending login, dropping the ones that were never finished.
+// userID is 0 for a login and the user's id for linking an account or, with
+// reauth, for confirming the user.
+func (m *OAuthStatesModel) Insert(state string, provider string, codeVerifier string, userID int, reauth bool, lifetime time.Duration) error {
+	_, err := m.DB.Exec(`DELETE FROM OAuth_States WHERE expires_at <= datetime('now')`)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO OAuth_States (state, provider, code_verifier, user_id, reauth, created_at, expires_at)
+	VALUES (?, ?, ?, NULLIF(?, 0), ?, datetime('now'), datetime('now', '+' || ? || ' seconds'))`
+
+	_, err = m.DB.Exec(stmt, state, provider, codeVerifier, userID, reauth, int(lifetime.Seconds()))
+	return err
+}
+
+// Consume deletes the pending login and returns it. A state can only be used
+// once, ErrNoRecord is returned for unknown, expired or already used states.
+func (m *OAuthStatesModel) Consume(state string, provider string) (*OAuthState, error) {
+	stmt := `DELETE FROM OAuth_States
+	WHERE state = ? AND provider = ? AND expires_at > datetime('now')
+	RETURNING code_verifier, COALESCE(user_id, 0), reauth`
+
+	s := &OAuthState{}
+	err := m.DB.QueryRow(stmt, state, provider).Scan(&s.CodeVerifier, &s.UserID, &s.Reauth)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return s, nil
+}
@@ -0,0 +1,177 @@
+package models
+
+import (
+	"database/sql"
+	"time"
+)
+
+type PostAttachmentsModelInterface interface {
+	Insert(postID int, name string, caption string) (int, error)
+	GetByPostID(postID int) ([]*PostAttachment, error)
+	Update(postID int, id int, caption string, position int) error
+	Delete(postID int, id int) error
+	DeleteByPostID(postID int) error
+}
+
+// PostAttachment is an image attached to a post. Name is what the image is
+// stored under, attachments are shown by ascending Position.
+type PostAttachment struct {
+	ID        int
+	PostID    int
+	Name      string
+	Caption   string
+	Position  int
+	CreatedAt time.Time
+}
+
+// PostAttachmentsModel keeps Posts.imgUrl set to the first attachment of
+// each post, the cover shown in post lists.
+type PostAttachmentsModel struct {
+	DB *sql.DB
+}
+
+// Insert adds an attachment after the existing ones.
+func (m *PostAttachmentsModel) Insert(postID int, name string, caption string) (int, error) {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return 0, err
+	}
+	defer tx.Rollback()
+
+	stmt := `INSERT INTO Post_Attachments (post_id, name, caption, position, created_at)
+	         VALUES (?, ?, ?, (SELECT COALESCE(MAX(position), 0) + 1 FROM Post_Attachments WHERE post_id = ?), ?)`
+	result, err := tx.Exec(stmt, postID, name, caption, postID, time.Now())
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	err = updateCover(tx, postID)
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), tx.Commit()
+}
+
+func (m *PostAttachmentsModel) GetByPostID(postID int) ([]*PostAttachment, error) {
+	stmt := `SELECT id, post_id, name, caption, position, created_at
+	         FROM Post_Attachments
+	         WHERE post_id = ?
+	         ORDER BY position, id`
+
+	rows, err := m.DB.Query(stmt, postID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var attachments []*PostAttachment
+	for rows.Next() {
+		a := &PostAttachment{}
+		err = rows.Scan(&a.ID, &a.PostID, &a.Name, &a.Caption, &a.Position, &a.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		attachments = append(attachments, a)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return attachments, nil
+}
+
+// Update changes the caption and position of an attachment of the post.
+func (m *PostAttachmentsModel) Update(postID int, id int, caption string, position int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`UPDATE Post_Attachments SET caption = ?, position = ? WHERE id = ? AND post_id = ?`,
+		caption, position, id, postID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	err = updateCover(tx, postID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// Delete removes an attachment of the post. The image itself stays in
+// storage.
+func (m *PostAttachmentsModel) Delete(postID int, id int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	result, err := tx.Exec(`DELETE FROM Post_Attachments WHERE id = ? AND post_id = ?`, id, postID)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	err = updateCover(tx, postID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func (m *PostAttachmentsModel) DeleteByPostID(postID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM Post_Attachments WHERE post_id = ?`, postID)
+	if err != nil {
+		return err
+	}
+
+	err = updateCover(tx, postID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// updateCover sets Posts.imgUrl to the first attachment of the post, or
+// clears it when there is none.
+func updateCover(tx *sql.Tx, postID int) error {
+	stmt := `UPDATE Posts
+	         SET imgUrl = COALESCE((SELECT name FROM Post_Attachments WHERE post_id = ? ORDER BY position, id LIMIT 1), '')
+	         WHERE id = ?`
+	_, err := tx.Exec(stmt, postID, postID)
+	return err
+}
@@ -18,6 +18,7 @@ type PostReactionModelInterface interface {
 	GetReactionCount(postID int, reactionType string) (int, error)
 	GetReactionByUserID(userID int) (*PostReaction, error)
 	GetLikedPostIDsByUserID(userID int) ([]int, error)
+	GetAllByUserID(userID int) ([]*PostReaction, error)
 	DeleteReactionsByPostId(postID int) error
 }
 
@@ -165,3 +166,27 @@ func (m *PostReactionsModel) DeleteReactionsByPostId(postID int) error {
 	}
 	return nil
 }
+
+// GetAllByUserID returns the likes and dislikes the user gave to posts.
+func (m *PostReactionsModel) GetAllByUserID(userID int) ([]*PostReaction, error) {
+	stmt := `SELECT user_id, post_id, type FROM Post_Reactions WHERE user_id = ? ORDER BY post_id`
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var reactions []*PostReaction
+	for rows.Next() {
+		reaction := &PostReaction{}
+		if err := rows.Scan(&reaction.UserID, &reaction.PostID, &reaction.Type); err != nil {
+			return nil, err
+		}
+		reactions = append(reactions, reaction)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return reactions, nil
+}
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type PostRevisionsModelInterface interface {
+	GetLatest(postID int, limit int) ([]*PostRevision, error)
+	Count(postID int) (int, error)
+	Get(postID int, revision int) (*PostRevision, error)
+}
+
+// PostRevision is one version of the title, category and content of a post.
+// Revisions are numbered from 1 per post; images are not part of them.
+type PostRevision struct {
+	ID         int
+	PostID     int
+	Revision   int
+	Title      string
+	Content    string
+	CategoryID int
+	EditorID   int
+	EditorName string
+	CreatedAt  time.Time
+}
+
+// PostRevisionsModel reads the revisions PostModel.UpdatePost records.
+type PostRevisionsModel struct {
+	DB *sql.DB
+}
+
+// GetLatest returns up to limit revisions of a post, the latest first. Posts
+// that were never edited have none. The content is left out, Get loads it.
+func (m *PostRevisionsModel) GetLatest(postID int, limit int) ([]*PostRevision, error) {
+	stmt := `SELECT r.id, r.post_id, r.revision, r.title, r.category_id, r.editor_id, COALESCE(u.username, ''), r.created_at
+	         FROM Post_Revisions r
+	         LEFT JOIN Users u ON u.id = r.editor_id
+	         WHERE r.post_id = ?
+	         ORDER BY r.revision DESC
+	         LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, postID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var revisions []*PostRevision
+	for rows.Next() {
+		rev := &PostRevision{}
+		err = rows.Scan(&rev.ID, &rev.PostID, &rev.Revision, &rev.Title, &rev.CategoryID, &rev.EditorID, &rev.EditorName, &rev.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		revisions = append(revisions, rev)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return revisions, nil
+}
+
+// Count returns how many revisions a post has.
+func (m *PostRevisionsModel) Count(postID int) (int, error) {
+	var count int
+	err := m.DB.QueryRow(`SELECT COUNT(*) FROM Post_Revisions WHERE post_id = ?`, postID).Scan(&count)
+	return count, err
+}
+
+func (m *PostRevisionsModel) Get(postID int, revision int) (*PostRevision, error) {
+	stmt := `SELECT r.id, r.post_id, r.revision, r.title, r.content, r.category_id, r.editor_id, COALESCE(u.username, ''), r.created_at
+	         FROM Post_Revisions r
+	         LEFT JOIN Users u ON u.id = r.editor_id
+	         WHERE r.post_id = ? AND r.revision = ?`
+
+	rev := &PostRevision{}
+	err := m.DB.QueryRow(stmt, postID, revision).Scan(&rev.ID, &rev.PostID, &rev.Revision, &rev.Title, &rev.Content, &rev.CategoryID, &rev.EditorID, &rev.EditorName, &rev.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return rev, nil
+}
+
+// recordEdit adds after as the next revision of the post. The first edit
+// also records before, the post as it was written, as revision 1.
+func recordEdit(tx *sql.Tx, before *Post, after *Post, editorID int) error {
+	var latest int
+	err := tx.QueryRow(`SELECT COALESCE(MAX(revision), 0) FROM Post_Revisions WHERE post_id = ?`, before.ID).Scan(&latest)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO Post_Revisions (post_id, revision, title, content, category_id, editor_id, created_at)
+	         VALUES (?, ?, ?, ?, ?, ?, ?)`
+
+	if latest == 0 {
+		_, err = tx.Exec(stmt, before.ID, 1, before.Title, before.Content, before.CategoryID, before.OwnerID, before.CreatedAt)
+		if err != nil {
+			return err
+		}
+		latest = 1
+	}
+
+	_, err = tx.Exec(stmt, after.ID, latest+1, after.Title, after.Content, after.CategoryID, editorID, time.Now())
+	return err
+}
@@ -18,7 +18,11 @@ type PostsModelInterface interface {
 	GetFilteredPosts(userID, categoryID, page, pageSize int) ([]*PostByUser, error)
 	CountPosts(categoryID int) (int, error)
 	DeletePostById(id int) error
-	UpdatePost(id int, title, content, imgUrl string, categoryID int) error
+	SoftDelete(id int, deletedBy int) error
+	Restore(id int) error
+	UpdatePost(id int, editorID int, title, content, imgUrl string, categoryID int) error
+	ImageInUse(name string) (bool, error)
+	ImageNames() ([]string, error)
 }
 
 type Post struct {
@@ -75,7 +79,7 @@ func (m *PostModel) Insert(title string, content string, imgUrl string, createdA
 func (m *PostModel) Get(id int) (*Post, error) {
 	stmt := `SELECT id, title, content, imgUrl, createdAt, category_id, owner_id, like_count, dislike_count
 	         FROM Posts
-	         WHERE id = ?`
+	         WHERE id = ? AND deleted_at IS NULL`
 
 	row := m.DB.QueryRow(stmt, id)
 
@@ -96,6 +100,7 @@ func (m *PostModel) Get(id int) (*Post, error) {
 func (m *PostModel) Latest() ([]*Post, error) {
 	stmt := `SELECT id, title, content, imgUrl, createdAt, category_id, owner_id, like_count, dislike_count
 	         FROM Posts
+	         WHERE deleted_at IS NULL
 	         ORDER BY createdAt ASC
 	         LIMIT 10`
 
@@ -136,7 +141,7 @@ func (m *PostModel) UpdatePostLikeDislikeCounts(postID int, likeCount int, disli
 func (m *PostModel) GetPostsByUserID(userID int) ([]*Post, error) {
 	stmt := `SELECT id, title, content, imgUrl, createdAt, category_id, owner_id, like_count, dislike_count
 			FROM Posts 
-			WHERE owner_id = ?
+			WHERE owner_id = ? AND deleted_at IS NULL
 			ORDER BY createdAt ASC`
 
 	rows, err := m.DB.Query(stmt, userID)
@@ -178,7 +183,7 @@ func (m *PostModel) GetPostsByIDs(postIDs []int) ([]*Post, error) {
 	query := fmt.Sprintf(`
         SELECT id, title, content, imgUrl, createdAt, category_id, owner_id, like_count, dislike_count
         FROM Posts
-        WHERE id IN (%s)
+        WHERE id IN (%s) AND deleted_at IS NULL
         ORDER BY createdAt ASC
     `, strings.Join(placeholders, ", "))
 
@@ -220,13 +225,13 @@ func (m *PostModel) GetFilteredPosts(userID int, categoryID, page, pageSize int)
 		FROM Posts AS p
 		INNER JOIN Users AS u ON p.owner_id = u.id
 		INNER JOIN Categories AS cat ON p.category_id = cat.id
-		LEFT JOIN Comments AS c ON p.id = c.post_id
+		LEFT JOIN Comments AS c ON p.id = c.post_id AND c.deleted_at IS NULL
 		LEFT JOIN Post_Reactions AS pr ON p.id = pr.post_id AND pr.user_id = ?
 	`
 
 	var args []interface{}
 	args = append(args, userID, userID, userID) 
-	var whereClauses []string
+	whereClauses := []string{"p.deleted_at IS NULL"}
 
 	if categoryID > 0 {
 		whereClauses = append(whereClauses, "p.category_id = ?")
@@ -277,7 +282,7 @@ func (m *PostModel) GetFilteredPosts(userID int, categoryID, page, pageSize int)
 func (m *PostModel) CountPosts(categoryID int) (int, error) {
 	query := `SELECT COUNT(*) FROM Posts`
 	var args []interface{}
-	var whereClauses []string
+	whereClauses := []string{"deleted_at IS NULL"}
 
 	if categoryID > 0 {
 		whereClauses = append(whereClauses, "category_id = ?")
@@ -297,17 +302,81 @@ func (m *PostModel) CountPosts(categoryID int) (int, error) {
 	return count, nil
 }
 
+// DeletePostById removes the post along with its revisions for good. Posts
+// that users delete go to the trash with SoftDelete first.
 func (m *PostModel) DeletePostById(id int) error {
-	stmt := `DELETE FROM Posts WHERE id = ?`
-	_, err := m.DB.Exec(stmt, id)
+	tx, err := m.DB.Begin()
 	if err != nil {
 		return err
 	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM Post_Revisions WHERE post_id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM Posts WHERE id = ?`, id)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+// SoftDelete moves a post to the trash. It disappears from every listing but
+// keeps its comments, reactions and images until it is restored or purged.
+func (m *PostModel) SoftDelete(id int, deletedBy int) error {
+	stmt := `UPDATE Posts SET deleted_at = ?, deleted_by = ? WHERE id = ? AND deleted_at IS NULL`
+	result, err := m.DB.Exec(stmt, time.Now(), deletedBy, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// Restore takes a post out of the trash.
+func (m *PostModel) Restore(id int) error {
+	stmt := `UPDATE Posts SET deleted_at = NULL, deleted_by = NULL WHERE id = ? AND deleted_at IS NOT NULL`
+	result, err := m.DB.Exec(stmt, id)
+	if err != nil {
+		return err
+	}
+
+	n, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if n == 0 {
+		return ErrNoRecord
+	}
 
 	return nil
 }
 
-func (m *PostModel) UpdatePost(id int, title, content, imgUrl string, categoryID int) error {
+// UpdatePost changes the fields that are not empty or zero. A change to the
+// title, content or category is recorded as a revision made by editorID.
+func (m *PostModel) UpdatePost(id int, editorID int, title, content, imgUrl string, categoryID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	before, err := getPostTx(tx, id)
+	if err != nil {
+		return err
+	}
+
 	query := "UPDATE Posts SET "
 	args := []interface{}{}
 
@@ -327,16 +396,91 @@ func (m *PostModel) UpdatePost(id int, title, content, imgUrl string, categoryID
 		query += "category_id = ?, "
 		args = append(args, categoryID)
 	}
+	if len(args) == 0 {
+		return nil
+	}
 
 	query = query[:len(query)-2]
 
 	query += " WHERE id = ?"
 	args = append(args, id)
 
-	_, err := m.DB.Exec(query, args...)
+	_, err = tx.Exec(query, args...)
 	if err != nil {
 		return err
 	}
 
-	return nil
+	after, err := getPostTx(tx, id)
+	if err != nil {
+		return err
+	}
+
+	if after.Title != before.Title || after.Content != before.Content || after.CategoryID != before.CategoryID {
+		err = recordEdit(tx, before, after, editorID)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+func getPostTx(tx *sql.Tx, id int) (*Post, error) {
+	stmt := `SELECT id, title, content, imgUrl, createdAt, category_id, owner_id, like_count, dislike_count
+	         FROM Posts
+	         WHERE id = ? AND deleted_at IS NULL`
+
+	post := &Post{}
+	err := tx.QueryRow(stmt, id).Scan(&post.ID, &post.Title, &post.Content, &post.ImgUrl, &post.CreatedAt, &post.CategoryID, &post.OwnerID, &post.LikeCount, &post.DislikeCount)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return post, nil
+}
+
+// ImageInUse reports whether any post shows the image stored as name.
+func (m *PostModel) ImageInUse(name string) (bool, error) {
+	stmt := `SELECT EXISTS (SELECT 1 FROM Posts WHERE imgUrl = ?)
+	             OR EXISTS (SELECT 1 FROM Post_Attachments a JOIN Posts p ON p.id = a.post_id WHERE a.name = ?)`
+
+	var inUse bool
+	err := m.DB.QueryRow(stmt, name, name).Scan(&inUse)
+	if err != nil {
+		return false, err
+	}
+
+	return inUse, nil
+}
+
+// ImageNames returns the names of all images shown by posts. Attachments
+// left behind by a deleted post do not count.
+func (m *PostModel) ImageNames() ([]string, error) {
+	stmt := `SELECT imgUrl FROM Posts WHERE imgUrl IS NOT NULL AND imgUrl != ''
+	         UNION
+	         SELECT a.name FROM Post_Attachments a JOIN Posts p ON p.id = a.post_id`
+
+	rows, err := m.DB.Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		err = rows.Scan(&name)
+		if err != nil {
+			return nil, err
+		}
+		names = append(names, name)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return names, nil
 }
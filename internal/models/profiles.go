@@ -0,0 +1,153 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type ProfilesModelInterface interface {
+	Get(userID int) (*Profile, error)
+	GetByUsername(username string) (*Profile, error)
+	RecentActivity(userID int, limit int) ([]*Activity, error)
+	UpdateBio(userID int, bio string) error
+	Avatar(userID int) (string, error)
+	SetAvatar(userID int, avatar string) error
+}
+
+// Profile is what everyone can see about a user, deleted accounts have
+// none. Reputation counts the likes the user's posts and comments received,
+// Avatar is empty for users without an uploaded one.
+type Profile struct {
+	UserID       int
+	Username     string
+	Role         string
+	Bio          string
+	Avatar       string
+	JoinedAt     time.Time
+	PostCount    int
+	CommentCount int
+	Reputation   int
+}
+
+// Activity is a post or a comment of a user. PostID and PostTitle are those
+// of the commented post for comments.
+type Activity struct {
+	Kind      string
+	ID        int
+	PostID    int
+	PostTitle string
+	Text      string
+	CreatedAt time.Time
+}
+
+const (
+	ActivityPost    = "post"
+	ActivityComment = "comment"
+)
+
+type ProfilesModel struct {
+	DB *sql.DB
+}
+
+func (m *ProfilesModel) Get(userID int) (*Profile, error) {
+	return m.get("u.id = ?", userID)
+}
+
+func (m *ProfilesModel) GetByUsername(username string) (*Profile, error) {
+	return m.get("u.username = ?", username)
+}
+
+func (m *ProfilesModel) get(where string, arg interface{}) (*Profile, error) {
+	stmt := `SELECT u.id, u.username, u.role, u.bio, u.avatar, u.created_at,
+		(SELECT COUNT(*) FROM Posts WHERE owner_id = u.id AND deleted_at IS NULL),
+		(SELECT COUNT(*) FROM Comments WHERE user_id = u.id AND deleted_at IS NULL),
+		(SELECT COALESCE(SUM(like_count), 0) FROM Posts WHERE owner_id = u.id AND deleted_at IS NULL)
+			+ (SELECT COALESCE(SUM(like_count), 0) FROM Comments WHERE user_id = u.id AND deleted_at IS NULL)
+	FROM Users u WHERE u.deleted_at IS NULL AND ` + where
+
+	p := &Profile{}
+	var joinedAt sql.NullTime
+	err := m.DB.QueryRow(stmt, arg).Scan(&p.UserID, &p.Username, &p.Role, &p.Bio, &p.Avatar, &joinedAt,
+		&p.PostCount, &p.CommentCount, &p.Reputation)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+	p.JoinedAt = joinedAt.Time
+
+	return p, nil
+}
+
+// RecentActivity returns the latest posts and comments of the user, newest
+// first.
+func (m *ProfilesModel) RecentActivity(userID int, limit int) ([]*Activity, error) {
+	// datetime() evens out the formats posts and comments are stored in
+	stmt := `SELECT 'post', id, id, title, content, datetime(createdAt) AS at
+	FROM Posts WHERE owner_id = ? AND deleted_at IS NULL
+	UNION ALL
+	SELECT 'comment', c.id, c.post_id, p.title, c.text, datetime(c.created_at) AS at
+	FROM Comments c JOIN Posts p ON p.id = c.post_id
+	WHERE c.user_id = ? AND c.deleted_at IS NULL AND p.deleted_at IS NULL
+	ORDER BY at DESC
+	LIMIT ?`
+
+	rows, err := m.DB.Query(stmt, userID, userID, limit)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var activity []*Activity
+	for rows.Next() {
+		a := &Activity{}
+		var createdAt sql.NullString
+		err := rows.Scan(&a.Kind, &a.ID, &a.PostID, &a.PostTitle, &a.Text, &createdAt)
+		if err != nil {
+			return nil, err
+		}
+		a.CreatedAt, err = parseAggregateTime(createdAt.String)
+		if err != nil {
+			return nil, err
+		}
+		activity = append(activity, a)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return activity, nil
+}
+
+func (m *ProfilesModel) UpdateBio(userID int, bio string) error {
+	stmt := `UPDATE Users SET bio = ? WHERE id = ?`
+
+	_, err := m.DB.Exec(stmt, bio, userID)
+	return err
+}
+
+// Avatar returns the name the user's avatar files are stored under.
+func (m *ProfilesModel) Avatar(userID int) (string, error) {
+	stmt := `SELECT avatar FROM Users WHERE id = ?`
+
+	var avatar string
+	err := m.DB.QueryRow(stmt, userID).Scan(&avatar)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNoRecord
+		}
+		return "", err
+	}
+
+	return avatar, nil
+}
+
+func (m *ProfilesModel) SetAvatar(userID int, avatar string) error {
+	stmt := `UPDATE Users SET avatar = ? WHERE id = ?`
+
+	_, err := m.DB.Exec(stmt, avatar, userID)
+	return err
+}
@@ -15,6 +15,7 @@ type PromotionRequestsModelInterface interface {
 	Insert(user_id int, description string, status string) (int, error)
 	GetByID(id int) (*PromotionRequests, error)
 	GetAll() ([]*PromotionRequests, error)
+	GetAllByUserID(userID int) ([]*PromotionRequests, error)
 	UpdateStatus(id int, status string) error
 }
 
@@ -85,3 +86,28 @@ func (m *PromotionRequestsModel) UpdateStatus(id int, status string) error {
 	_, err := m.DB.Exec(stmt, status, id)
 	return err
 }
+
+func (m *PromotionRequestsModel) GetAllByUserID(userID int) ([]*PromotionRequests, error) {
+	stmt := `SELECT id, user_id, description, status FROM Promotion_Requests WHERE user_id = ? ORDER BY id`
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var requests []*PromotionRequests
+	for rows.Next() {
+		var pr PromotionRequests
+		err := rows.Scan(&pr.ID, &pr.UserID, &pr.Description, &pr.Status)
+		if err != nil {
+			return nil, err
+		}
+		requests = append(requests, &pr)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return requests, nil
+}
@@ -0,0 +1,139 @@
+package models
+
+import (
+	"database/sql"
+	"strings"
+	"time"
+)
+
+// Snippets returned by Search wrap every matched term in these markers, the
+// handlers turn them into <mark> tags after escaping the rest of the text.
+const (
+	SearchMatchStart = "\x02"
+	SearchMatchEnd   = "\x03"
+)
+
+type SearchModelInterface interface {
+	Search(query string, page, pageSize int) ([]*SearchResult, error)
+	CountResults(query string) (int, error)
+}
+
+type SearchResult struct {
+	PostID    int
+	CommentID int
+	Title     string
+	Snippet   string
+	CreatedAt time.Time
+}
+
+func (r *SearchResult) IsComment() bool {
+	return r.CommentID > 0
+}
+
+type SearchModel struct {
+	DB *sql.DB
+}
+
+func (m *SearchModel) Search(query string, page, pageSize int) ([]*SearchResult, error) {
+	match := buildMatchQuery(query)
+	if match == "" {
+		return []*SearchResult{}, nil
+	}
+
+	if page < 1 {
+		page = 1
+	}
+	offset := (page - 1) * pageSize
+
+	stmt := `
+		SELECT p.id, 0, p.title,
+			   snippet(Posts_Search, -1, ?, ?, '...', 24),
+			   bm25(Posts_Search, 5.0, 1.0) AS score,
+			   p.createdAt
+		FROM Posts_Search
+		INNER JOIN Posts AS p ON p.id = Posts_Search.rowid
+		WHERE Posts_Search MATCH ? AND p.deleted_at IS NULL
+		UNION ALL
+		SELECT c.post_id, c.id, p.title,
+			   snippet(Comments_Search, 0, ?, ?, '...', 24),
+			   bm25(Comments_Search) AS score,
+			   c.created_at
+		FROM Comments_Search
+		INNER JOIN Comments AS c ON c.id = Comments_Search.rowid
+		INNER JOIN Posts AS p ON p.id = c.post_id
+		WHERE Comments_Search MATCH ? AND c.deleted_at IS NULL AND p.deleted_at IS NULL
+		ORDER BY score ASC
+		LIMIT ? OFFSET ?
+	`
+
+	rows, err := m.DB.Query(stmt,
+		SearchMatchStart, SearchMatchEnd, match,
+		SearchMatchStart, SearchMatchEnd, match,
+		pageSize, offset,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var results []*SearchResult
+	for rows.Next() {
+		r := &SearchResult{}
+		var score float64
+
+		err := rows.Scan(&r.PostID, &r.CommentID, &r.Title, &r.Snippet, &score, &r.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+
+		results = append(results, r)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return results, nil
+}
+
+func (m *SearchModel) CountResults(query string) (int, error) {
+	match := buildMatchQuery(query)
+	if match == "" {
+		return 0, nil
+	}
+
+	stmt := `
+		SELECT (SELECT COUNT(*) FROM Posts_Search
+				INNER JOIN Posts AS p ON p.id = Posts_Search.rowid
+				WHERE Posts_Search MATCH ? AND p.deleted_at IS NULL) +
+			   (SELECT COUNT(*) FROM Comments_Search
+				INNER JOIN Comments AS c ON c.id = Comments_Search.rowid
+				INNER JOIN Posts AS p ON p.id = c.post_id
+				WHERE Comments_Search MATCH ? AND c.deleted_at IS NULL AND p.deleted_at IS NULL)
+	`
+
+	var count int
+	err := m.DB.QueryRow(stmt, match, match).Scan(&count)
+	if err != nil {
+		return 0, err
+	}
+
+	return count, nil
+}
+
+// buildMatchQuery turns free text into an FTS5 query where every word has to
+// match and the last one may be a prefix. Words are quoted so FTS5 operators
+// typed by users are searched for literally instead of being interpreted.
+func buildMatchQuery(query string) string {
+	words := strings.Fields(query)
+	if len(words) == 0 {
+		return ""
+	}
+
+	terms := make([]string, 0, len(words))
+	for _, w := range words {
+		terms = append(terms, `"`+strings.ReplaceAll(w, `"`, `""`)+`"`)
+	}
+
+	return strings.Join(terms, " ") + "*"
+}
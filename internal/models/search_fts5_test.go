@@ -0,0 +1,163 @@
+//go:build sqlite_fts5
+
+package models
+
+import (
+	"database/sql"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"testing"
+
+	_ "github.com/mattn/go-sqlite3"
+)
+
+// newSearchTestDB returns a database with every migration applied. The
+// search index needs SQLite built with FTS5, hence the build tag.
+func newSearchTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "forum.db"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { db.Close() })
+
+	files, err := filepath.Glob(filepath.Join("..", "..", "data", "migrations", "*.sql"))
+	if err != nil || len(files) == 0 {
+		t.Fatalf("no migrations found: %v", err)
+	}
+	sort.Strings(files)
+
+	for _, file := range files {
+		b, err := os.ReadFile(file)
+		if err != nil {
+			t.Fatal(err)
+		}
+		up, _, _ := strings.Cut(string(b), "-- +goose Down")
+		if _, err := db.Exec(up); err != nil {
+			t.Fatalf("%s: %v", file, err)
+		}
+	}
+
+	return db
+}
+
+// searchKeys lists the results as "p<post>" for posts and "c<comment>" for
+// comments, in the order they were returned.
+func searchKeys(t *testing.T, m *SearchModel, query string) string {
+	t.Helper()
+
+	results, err := m.Search(query, 1, 10)
+	if err != nil {
+		t.Fatalf("Search(%q): %v", query, err)
+	}
+
+	count, err := m.CountResults(query)
+	if err != nil {
+		t.Fatalf("CountResults(%q): %v", query, err)
+	}
+	if count != len(results) {
+		t.Errorf("CountResults(%q) = %d, Search returned %d results", query, count, len(results))
+	}
+
+	var keys []string
+	for _, r := range results {
+		if r.IsComment() {
+			keys = append(keys, "c"+strconv.Itoa(r.CommentID))
+		} else {
+			keys = append(keys, "p"+strconv.Itoa(r.PostID))
+		}
+	}
+	return strings.Join(keys, " ")
+}
+
+func TestSearch(t *testing.T) {
+	db := newSearchTestDB(t)
+	m := &SearchModel{DB: db}
+
+	exec := func(stmt string) {
+		t.Helper()
+		if _, err := db.Exec(stmt); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	exec(`
+	INSERT INTO Users (id, email, username, password, created_at) VALUES (1, 'player@example.com', 'player', '', datetime('now'));
+	INSERT INTO Posts (id, title, content, createdAt, category_id, owner_id, like_count, dislike_count) VALUES
+		(1, 'Speedrun notes', 'The glitch in Hyrule castle saves a minute', datetime('now'), 1, 1, 0, 0),
+		(2, 'Hyrule castle skip', 'Works on every version', datetime('now'), 1, 1, 0, 0),
+		(3, 'Kart tips', 'Drift early on Rainbow Road', datetime('now'), 1, 1, 0, 0);
+	INSERT INTO Comments (id, post_id, user_id, created_at, text, like_count, dislike_count) VALUES
+		(1, 3, 1, datetime('now'), 'The castle track is harder', 0, 0),
+		(2, 3, 1, datetime('now'), 'Rainbow Road again', 0, 0);
+	`)
+
+	t.Run("new content is indexed and title matches rank first", func(t *testing.T) {
+		if got, want := searchKeys(t, m, "hyrule castle"), "p2 p1"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+		// Posts and comments are ranked in separate indexes, only the
+		// order of the posts is fixed
+		got := searchKeys(t, m, "castle")
+		if !strings.Contains(got, "c1") || strings.Index(got, "p2") > strings.Index(got, "p1") {
+			t.Errorf("got %q, want p2 before p1 and the comment c1", got)
+		}
+	})
+
+	t.Run("the last word is a prefix", func(t *testing.T) {
+		if got := searchKeys(t, m, "rainb"); got != "p3 c2" && got != "c2 p3" {
+			t.Errorf("got %q, want p3 and c2", got)
+		}
+	})
+
+	t.Run("edits replace the indexed text", func(t *testing.T) {
+		exec(`UPDATE Posts SET content = 'Works on the Japanese version only' WHERE id = 2`)
+		exec(`UPDATE Comments SET text = 'The moon track is harder' WHERE id = 1`)
+
+		if got := searchKeys(t, m, "every"); got != "" {
+			t.Errorf("old post text still found: %q", got)
+		}
+		if got, want := searchKeys(t, m, "japanese"), "p2"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+		if got, want := searchKeys(t, m, "moon"), "c1"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+		if got, want := searchKeys(t, m, "castle"), "p2 p1"; got != want {
+			t.Errorf("got %q, want %q", got, want)
+		}
+	})
+
+	t.Run("deleted posts and comments are left out", func(t *testing.T) {
+		exec(`UPDATE Comments SET deleted_at = datetime('now') WHERE id = 1`)
+		if got := searchKeys(t, m, "moon"); got != "" {
+			t.Errorf("deleted comment found: %q", got)
+		}
+
+		// The comments of a deleted post go with it
+		exec(`UPDATE Posts SET deleted_at = datetime('now') WHERE id = 3`)
+		if got := searchKeys(t, m, "rainbow"); got != "" {
+			t.Errorf("deleted post or its comments found: %q", got)
+		}
+
+		// Purged rows leave the index
+		exec(`DELETE FROM Comments WHERE id = 2`)
+		var n int
+		if err := db.QueryRow(`SELECT COUNT(*) FROM Comments_Search WHERE Comments_Search MATCH 'rainbow'`).Scan(&n); err != nil {
+			t.Fatal(err)
+		}
+		if n != 0 {
+			t.Errorf("purged comment still indexed")
+		}
+	})
+
+	t.Run("operators typed by users match nothing special", func(t *testing.T) {
+		if got := searchKeys(t, m, "castle OR kart"); got != "" {
+			t.Errorf("got %q, want nothing", got)
+		}
+	})
+}
@@ -0,0 +1,29 @@
+package models
+
+import "testing"
+
+func TestBuildMatchQuery(t *testing.T) {
+	tests := []struct {
+		name  string
+		query string
+		want  string
+	}{
+		{"empty", "", ""},
+		{"only spaces", " \t\n ", ""},
+		{"one word is a prefix", "zelda", `"zelda"*`},
+		{"every word has to match", "  speed   run ", `"speed" "run"*`},
+		{"operators are searched literally", "mario OR NOT luigi", `"mario" "OR" "NOT" "luigi"*`},
+		{"syntax characters stay inside the quotes", "c++ (any%) title:glitch", `"c++" "(any%)" "title:glitch"*`},
+		{"quotes are doubled", `say "hi"`, `"say" """hi"""*`},
+		{"a lone quote", `"`, `""""*`},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := buildMatchQuery(tt.query)
+			if got != tt.want {
+				t.Errorf("buildMatchQuery(%q) = %q, want %q", tt.query, got, tt.want)
+			}
+		})
+	}
+}
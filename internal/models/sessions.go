@@ -1,19 +1,29 @@
 package models
 
 import (
+	"crypto/rand"
 	"database/sql"
+	"encoding/hex"
 	"errors"
 	"time"
 )
 
 type SessionModelInterface interface {
 	GetById(id int) (*Session, error)
-	Insert(token string, userId int) (int, error)
+	Insert(token string, userId int, lifetime time.Duration, userAgent string, ip string) (int, error)
 	GetLastUserSession(id int) (*Session, error)
 	GetUserIDByToken(token string) (int, error)
 	DeleteByToken(token string) error
 	DeleteByUserId(userId int) error
 	GetByUserId(userId int) (*Session, error)
+	GetAllByUserId(userId int) ([]*Session, error)
+	Touch(token string, ip string) (time.Duration, error)
+	DeleteByIdAndUserId(id int, userId int) error
+	DeleteOthersByUserId(userId int, token string) error
+	DeleteExpired() (int, error)
+	GetCSRFToken(token string) (string, error)
+	Reauthenticate(token string) error
+	ReauthenticatedWithin(token string, window time.Duration) (bool, error)
 }
 
 type Session struct {
@@ -22,17 +32,30 @@ type Session struct {
 	UserID    int
 	CreatedAt time.Time
 	ExpiresAt time.Time
+
+	UserAgent  string
+	IP         string
+	LastSeenAt time.Time
+	Lifetime   time.Duration
 }
 
 type SessionModel struct {
 	DB *sql.DB
 }
 
-func (m *SessionModel) Insert(token string, userId int) (int, error) {
-	stmt := `INSERT INTO sessions (token, user_id, createdAt, expiresAt)
-	VALUES(?, ?, datetime('now'), datetime('now',  '1 days'))`
+// Insert creates a session that expires after lifetime unless it is used,
+// see Touch.
+func (m *SessionModel) Insert(token string, userId int, lifetime time.Duration, userAgent string, ip string) (int, error) {
+	stmt := `INSERT INTO sessions (token, user_id, createdAt, expiresAt, lifetime, user_agent, ip, lastSeenAt, csrf_token)
+	VALUES(?, ?, datetime('now'), datetime('now', '+' || ? || ' seconds'), ?, ?, ?, datetime('now'), ?)`
+
+	csrfToken, err := generateCSRFToken()
+	if err != nil {
+		return 0, err
+	}
 
-	result, err := m.DB.Exec(stmt, token, userId)
+	seconds := int(lifetime.Seconds())
+	result, err := m.DB.Exec(stmt, token, userId, seconds, seconds, userAgent, ip, csrfToken)
 	if err != nil {
 		return 0, err
 	}
@@ -135,4 +158,173 @@ func (m *SessionModel) DeleteByUserId(userId int) error {
 	}
 
 	return nil
-}
\ No newline at end of file
+}
+
+// GetAllByUserId returns the user's active sessions, most recently used first.
+func (m *SessionModel) GetAllByUserId(userId int) ([]*Session, error) {
+	stmt := `SELECT id, token, user_id, createdAt, expiresAt, user_agent, ip, lastSeenAt, lifetime
+	FROM Sessions
+	WHERE user_id = ? AND expiresAt > datetime('now')
+	ORDER BY COALESCE(lastSeenAt, createdAt) DESC, id DESC`
+
+	rows, err := m.DB.Query(stmt, userId)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var sessions []*Session
+	for rows.Next() {
+		s := &Session{}
+		var lastSeenAt sql.NullTime
+		var lifetime int
+		err := rows.Scan(&s.ID, &s.Token, &s.UserID, &s.CreatedAt, &s.ExpiresAt, &s.UserAgent, &s.IP, &lastSeenAt, &lifetime)
+		if err != nil {
+			return nil, err
+		}
+
+		s.Lifetime = time.Duration(lifetime) * time.Second
+		s.LastSeenAt = s.CreatedAt
+		if lastSeenAt.Valid {
+			s.LastSeenAt = lastSeenAt.Time
+		}
+		sessions = append(sessions, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return sessions, nil
+}
+
+// Touch records that the session was just used from ip and slides its
+// expiry to a full lifetime from now, which it returns. To keep writes down
+// this happens at most once a minute, in between ErrNoRecord is returned.
+func (m *SessionModel) Touch(token string, ip string) (time.Duration, error) {
+	stmt := `UPDATE Sessions
+	SET lastSeenAt = datetime('now'), ip = ?, expiresAt = datetime('now', '+' || lifetime || ' seconds')
+	WHERE token = ? AND expiresAt > datetime('now')
+	AND (lastSeenAt IS NULL OR lastSeenAt < datetime('now', '-1 minute'))
+	RETURNING lifetime`
+
+	var seconds int
+	err := m.DB.QueryRow(stmt, ip, token).Scan(&seconds)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return 0, ErrNoRecord
+		}
+		return 0, err
+	}
+
+	return time.Duration(seconds) * time.Second, nil
+}
+
+func (m *SessionModel) DeleteByIdAndUserId(id int, userId int) error {
+	stmt := `DELETE FROM Sessions WHERE id = ? AND user_id = ?`
+
+	result, err := m.DB.Exec(stmt, id, userId)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// DeleteOthersByUserId ends every session of the user except the one
+// identified by token.
+func (m *SessionModel) DeleteOthersByUserId(userId int, token string) error {
+	stmt := `DELETE FROM Sessions WHERE user_id = ? AND token != ?`
+
+	_, err := m.DB.Exec(stmt, userId, token)
+	return err
+}
+
+// DeleteExpired removes sessions that have run out and returns how many
+// there were.
+func (m *SessionModel) DeleteExpired() (int, error) {
+	stmt := `DELETE FROM Sessions WHERE expiresAt <= datetime('now')`
+
+	result, err := m.DB.Exec(stmt)
+	if err != nil {
+		return 0, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(affected), nil
+}
+
+func generateCSRFToken() (string, error) {
+	b := make([]byte, 32)
+	_, err := rand.Read(b)
+	if err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(b), nil
+}
+
+// GetCSRFToken returns the CSRF token of an active session.
+func (m *SessionModel) GetCSRFToken(token string) (string, error) {
+	stmt := `SELECT csrf_token FROM Sessions WHERE token = ? AND expiresAt > datetime('now')`
+
+	var csrfToken string
+	err := m.DB.QueryRow(stmt, token).Scan(&csrfToken)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return "", ErrNoRecord
+		}
+		return "", err
+	}
+
+	return csrfToken, nil
+}
+
+// Reauthenticate records that the user of the session just proved who they
+// are again.
+func (m *SessionModel) Reauthenticate(token string) error {
+	stmt := `UPDATE Sessions SET reauthenticated_at = datetime('now')
+	WHERE token = ? AND expiresAt > datetime('now')`
+
+	result, err := m.DB.Exec(stmt, token)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
+
+// ReauthenticatedWithin reports whether the session was reauthenticated no
+// longer than window ago.
+func (m *SessionModel) ReauthenticatedWithin(token string, window time.Duration) (bool, error) {
+	stmt := `SELECT EXISTS(SELECT 1 FROM Sessions
+	WHERE token = ? AND expiresAt > datetime('now')
+	AND reauthenticated_at > datetime('now', '-' || ? || ' seconds'))`
+
+	var ok bool
+	err := m.DB.QueryRow(stmt, token, int(window.Seconds())).Scan(&ok)
+	if err != nil {
+		return false, err
+	}
+
+	return ok, nil
+}
@@ -0,0 +1,115 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type SuspensionsModelInterface interface {
+	Insert(userID int, reason string, until time.Time, createdBy int) (int, error)
+	GetActive(userID int) (*Suspension, error)
+	GetAllActive() ([]*Suspension, error)
+	Lift(userID int, liftedBy int) error
+}
+
+// Suspension keeps a user from logging in and from using the API. Until is
+// not valid for permanent suspensions.
+type Suspension struct {
+	ID        int
+	UserID    int
+	Reason    string
+	Until     sql.NullTime
+	CreatedBy int
+	CreatedAt time.Time
+}
+
+type SuspensionsModel struct {
+	DB *sql.DB
+}
+
+const activeSuspension = `lifted_at IS NULL
+	AND (suspended_until IS NULL OR suspended_until > datetime('now'))`
+
+// Insert suspends the user until the given time, or for good when until is
+// zero. It replaces a suspension the user is already serving.
+func (m *SuspensionsModel) Insert(userID int, reason string, until time.Time, createdBy int) (int, error) {
+	err := m.Lift(userID, createdBy)
+	if err != nil {
+		return 0, err
+	}
+
+	var suspendedUntil sql.NullString
+	if !until.IsZero() {
+		suspendedUntil = sql.NullString{String: until.UTC().Format("2006-01-02 15:04:05"), Valid: true}
+	}
+
+	stmt := `INSERT INTO User_Suspensions (user_id, reason, suspended_until, created_by, created_at)
+	VALUES (?, ?, ?, ?, datetime('now'))`
+
+	result, err := m.DB.Exec(stmt, userID, reason, suspendedUntil, createdBy)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (m *SuspensionsModel) GetActive(userID int) (*Suspension, error) {
+	stmt := `SELECT id, user_id, reason, suspended_until, created_by, created_at
+	FROM User_Suspensions WHERE user_id = ? AND ` + activeSuspension + `
+	ORDER BY id DESC LIMIT 1`
+
+	s := &Suspension{}
+	err := m.DB.QueryRow(stmt, userID).Scan(&s.ID, &s.UserID, &s.Reason, &s.Until, &s.CreatedBy, &s.CreatedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return s, nil
+}
+
+func (m *SuspensionsModel) GetAllActive() ([]*Suspension, error) {
+	stmt := `SELECT id, user_id, reason, suspended_until, created_by, created_at
+	FROM User_Suspensions WHERE ` + activeSuspension + `
+	ORDER BY id`
+
+	rows, err := m.DB.Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var suspensions []*Suspension
+	for rows.Next() {
+		s := &Suspension{}
+		err := rows.Scan(&s.ID, &s.UserID, &s.Reason, &s.Until, &s.CreatedBy, &s.CreatedAt)
+		if err != nil {
+			return nil, err
+		}
+		suspensions = append(suspensions, s)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return suspensions, nil
+}
+
+// Lift ends the suspension the user is serving, if any.
+func (m *SuspensionsModel) Lift(userID int, liftedBy int) error {
+	stmt := `UPDATE User_Suspensions SET lifted_at = datetime('now'), lifted_by = ?
+	WHERE user_id = ? AND ` + activeSuspension
+
+	_, err := m.DB.Exec(stmt, liftedBy, userID)
+	return err
+}
@@ -0,0 +1,203 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"sort"
+	"time"
+)
+
+type TrashModelInterface interface {
+	List() ([]*TrashItem, error)
+	GetPost(id int) (*Post, error)
+	GetComment(id int) (*Comment, error)
+	GetPostsByOwner(userID int) ([]*TrashedPost, error)
+	GetCommentsByUser(userID int) ([]*TrashedComment, error)
+}
+
+// TrashItem is a deleted post or comment. Kind is "post" or "comment"; for
+// posts PostID is the same as ID.
+type TrashItem struct {
+	Kind          string
+	ID            int
+	PostID        int
+	Title         string
+	Text          string
+	AuthorName    string
+	DeletedByName string
+	DeletedAt     time.Time
+}
+
+// TrashedPost is a post in the trash with the time it was deleted.
+type TrashedPost struct {
+	Post
+	DeletedAt time.Time
+}
+
+// TrashedComment is a comment that is in the trash, or hidden because its
+// post is, with the time it was deleted.
+type TrashedComment struct {
+	CommentPostAddition
+	DeletedAt time.Time
+}
+
+// TrashModel reads the posts and comments SoftDelete moved to the trash.
+type TrashModel struct {
+	DB *sql.DB
+}
+
+// List returns everything in the trash, the latest deleted first.
+func (m *TrashModel) List() ([]*TrashItem, error) {
+	posts, err := m.list("post", `SELECT p.id, p.id, p.title, p.content, COALESCE(a.username, ''), COALESCE(d.username, ''), p.deleted_at
+		FROM Posts p
+		LEFT JOIN Users a ON a.id = p.owner_id
+		LEFT JOIN Users d ON d.id = p.deleted_by
+		WHERE p.deleted_at IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+
+	comments, err := m.list("comment", `SELECT c.id, c.post_id, COALESCE(p.title, ''), c.text, COALESCE(a.username, ''), COALESCE(d.username, ''), c.deleted_at
+		FROM Comments c
+		LEFT JOIN Posts p ON p.id = c.post_id
+		LEFT JOIN Users a ON a.id = c.user_id
+		LEFT JOIN Users d ON d.id = c.deleted_by
+		WHERE c.deleted_at IS NOT NULL`)
+	if err != nil {
+		return nil, err
+	}
+
+	items := append(posts, comments...)
+	sort.SliceStable(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(items[j].DeletedAt)
+	})
+
+	return items, nil
+}
+
+func (m *TrashModel) list(kind string, stmt string) ([]*TrashItem, error) {
+	rows, err := m.DB.Query(stmt)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var items []*TrashItem
+	for rows.Next() {
+		item := &TrashItem{Kind: kind}
+		err = rows.Scan(&item.ID, &item.PostID, &item.Title, &item.Text, &item.AuthorName, &item.DeletedByName, &item.DeletedAt)
+		if err != nil {
+			return nil, err
+		}
+		items = append(items, item)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return items, nil
+}
+
+// GetPost returns a post only while it is in the trash.
+func (m *TrashModel) GetPost(id int) (*Post, error) {
+	stmt := `SELECT id, title, content, imgUrl, createdAt, category_id, owner_id, like_count, dislike_count
+	         FROM Posts
+	         WHERE id = ? AND deleted_at IS NOT NULL`
+
+	post := &Post{}
+	err := m.DB.QueryRow(stmt, id).Scan(&post.ID, &post.Title, &post.Content, &post.ImgUrl, &post.CreatedAt, &post.CategoryID, &post.OwnerID, &post.LikeCount, &post.DislikeCount)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return post, nil
+}
+
+// GetComment returns a comment only while it is in the trash.
+func (m *TrashModel) GetComment(id int) (*Comment, error) {
+	stmt := `SELECT id, post_id, COALESCE(parent_id, 0), user_id, text, like_count, dislike_count, created_at, edited_at
+	         FROM Comments
+	         WHERE id = ? AND deleted_at IS NOT NULL`
+
+	comment := &Comment{}
+	err := m.DB.QueryRow(stmt, id).Scan(&comment.ID, &comment.PostID, &comment.ParentID, &comment.UserID, &comment.Text, &comment.LikeCount, &comment.DislikeCount, &comment.CreatedAt, &comment.EditedAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return comment, nil
+}
+
+// GetPostsByOwner returns the user's posts that are in the trash, oldest
+// first.
+func (m *TrashModel) GetPostsByOwner(userID int) ([]*TrashedPost, error) {
+	stmt := `SELECT id, title, content, imgUrl, createdAt, category_id, owner_id, like_count, dislike_count, deleted_at
+	         FROM Posts
+	         WHERE owner_id = ? AND deleted_at IS NOT NULL
+	         ORDER BY createdAt ASC`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var posts []*TrashedPost
+	for rows.Next() {
+		p := &TrashedPost{}
+		err = rows.Scan(&p.ID, &p.Title, &p.Content, &p.ImgUrl, &p.CreatedAt, &p.CategoryID, &p.OwnerID, &p.LikeCount, &p.DislikeCount, &p.DeletedAt)
+		if err != nil {
+			return nil, err
+		}
+		posts = append(posts, p)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return posts, nil
+}
+
+// GetCommentsByUser returns the user's comments that are in the trash or on
+// a post that is, oldest first. A comment hidden with its post counts as
+// deleted when the post was.
+func (m *TrashModel) GetCommentsByUser(userID int) ([]*TrashedComment, error) {
+	stmt := `SELECT c.id, c.post_id, c.user_id, c.text, c.like_count, c.dislike_count, c.created_at, p.title,
+	                c.deleted_at, p.deleted_at
+	         FROM Comments c
+	         INNER JOIN Posts p ON p.id = c.post_id
+	         WHERE c.user_id = ? AND (c.deleted_at IS NOT NULL OR p.deleted_at IS NOT NULL)
+	         ORDER BY c.created_at ASC`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var comments []*TrashedComment
+	for rows.Next() {
+		c := &TrashedComment{}
+		var deletedAt, postDeletedAt sql.NullTime
+		err = rows.Scan(&c.ID, &c.PostID, &c.UserID, &c.Text, &c.LikeCount, &c.DislikeCount, &c.CreatedAt, &c.PostTitle, &deletedAt, &postDeletedAt)
+		if err != nil {
+			return nil, err
+		}
+		c.DeletedAt = deletedAt.Time
+		if !deletedAt.Valid {
+			c.DeletedAt = postDeletedAt.Time
+		}
+		comments = append(comments, c)
+	}
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return comments, nil
+}
@@ -0,0 +1,215 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"strings"
+	"time"
+)
+
+type TwoFactorModelInterface interface {
+	GetTOTP(userID int) (*TOTP, error)
+	SetPendingSecret(userID int, secret string) error
+	Confirm(userID int, step int64) error
+	UseStep(userID int, step int64) (bool, error)
+	Disable(userID int) error
+	ReplaceRecoveryCodes(userID int, codes []string) error
+	UseRecoveryCode(userID int, code string) (bool, error)
+	CountRecoveryCodes(userID int) (int, error)
+	RequiredRoles() ([]string, error)
+	SetRequiredRoles(roles []string) error
+}
+
+// TOTP is a user's authenticator app secret. Two-factor authentication is on
+// once it is confirmed.
+type TOTP struct {
+	UserID       int
+	Secret       string
+	CreatedAt    time.Time
+	ConfirmedAt  sql.NullTime
+	LastUsedStep int64
+}
+
+func (t *TOTP) Confirmed() bool {
+	return t.ConfirmedAt.Valid
+}
+
+type TwoFactorModel struct {
+	DB *sql.DB
+}
+
+func (m *TwoFactorModel) GetTOTP(userID int) (*TOTP, error) {
+	stmt := `SELECT user_id, secret, created_at, confirmed_at, last_used_step
+	FROM User_TOTP WHERE user_id = ?`
+
+	t := &TOTP{}
+	err := m.DB.QueryRow(stmt, userID).Scan(&t.UserID, &t.Secret, &t.CreatedAt, &t.ConfirmedAt, &t.LastUsedStep)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// SetPendingSecret starts an enrollment. It replaces an earlier unconfirmed
+// secret but never a confirmed one.
+func (m *TwoFactorModel) SetPendingSecret(userID int, secret string) error {
+	stmt := `INSERT INTO User_TOTP (user_id, secret, created_at)
+	VALUES (?, ?, datetime('now'))
+	ON CONFLICT (user_id) DO UPDATE SET secret = excluded.secret, created_at = excluded.created_at
+	WHERE confirmed_at IS NULL`
+
+	_, err := m.DB.Exec(stmt, userID, secret)
+	return err
+}
+
+// Confirm turns two-factor authentication on, step is the one of the code
+// the user confirmed with.
+func (m *TwoFactorModel) Confirm(userID int, step int64) error {
+	stmt := `UPDATE User_TOTP SET confirmed_at = datetime('now'), last_used_step = ?
+	WHERE user_id = ?`
+
+	_, err := m.DB.Exec(stmt, step, userID)
+	return err
+}
+
+// UseStep records a code as used. It returns false when a code of that or a
+// later step was used already.
+func (m *TwoFactorModel) UseStep(userID int, step int64) (bool, error) {
+	stmt := `UPDATE User_TOTP SET last_used_step = ?
+	WHERE user_id = ? AND last_used_step < ?`
+
+	result, err := m.DB.Exec(stmt, step, userID, step)
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+// Disable turns two-factor authentication off and drops the recovery codes.
+func (m *TwoFactorModel) Disable(userID int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM User_TOTP WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+
+	_, err = tx.Exec(`DELETE FROM User_Recovery_Codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+
+	return tx.Commit()
+}
+
+func normalizeRecoveryCode(code string) string {
+	code = strings.ToLower(code)
+	return strings.NewReplacer(" ", "", "-", "").Replace(code)
+}
+
+// ReplaceRecoveryCodes stores new recovery codes, the old ones stop working.
+func (m *TwoFactorModel) ReplaceRecoveryCodes(userID int, codes []string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM User_Recovery_Codes WHERE user_id = ?`, userID)
+	if err != nil {
+		return err
+	}
+
+	for _, code := range codes {
+		_, err = tx.Exec(`INSERT INTO User_Recovery_Codes (user_id, code_hash, created_at)
+		VALUES (?, ?, datetime('now'))`, userID, hashToken(normalizeRecoveryCode(code)))
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
+
+// UseRecoveryCode deletes the code and reports whether it was valid.
+func (m *TwoFactorModel) UseRecoveryCode(userID int, code string) (bool, error) {
+	stmt := `DELETE FROM User_Recovery_Codes WHERE user_id = ? AND code_hash = ?`
+
+	result, err := m.DB.Exec(stmt, userID, hashToken(normalizeRecoveryCode(code)))
+	if err != nil {
+		return false, err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return false, err
+	}
+
+	return affected == 1, nil
+}
+
+func (m *TwoFactorModel) CountRecoveryCodes(userID int) (int, error) {
+	var n int
+	err := m.DB.QueryRow(`SELECT COUNT(*) FROM User_Recovery_Codes WHERE user_id = ?`, userID).Scan(&n)
+	return n, err
+}
+
+func (m *TwoFactorModel) RequiredRoles() ([]string, error) {
+	rows, err := m.DB.Query(`SELECT role FROM Two_Factor_Required_Roles ORDER BY role`)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var roles []string
+	for rows.Next() {
+		var role string
+		err := rows.Scan(&role)
+		if err != nil {
+			return nil, err
+		}
+		roles = append(roles, role)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return roles, nil
+}
+
+func (m *TwoFactorModel) SetRequiredRoles(roles []string) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	_, err = tx.Exec(`DELETE FROM Two_Factor_Required_Roles`)
+	if err != nil {
+		return err
+	}
+
+	for _, role := range roles {
+		_, err = tx.Exec(`INSERT INTO Two_Factor_Required_Roles (role) VALUES (?)`, role)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
@@ -0,0 +1,133 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+type UserIdentitiesModelInterface interface {
+	Insert(userID int, provider string, subject string, email string) (int, error)
+	GetByProviderSubject(provider string, subject string) (*UserIdentity, error)
+	GetAllByUserId(userID int) ([]*UserIdentity, error)
+	RecordLogin(id int, email string) error
+	Delete(id int, userID int) error
+}
+
+// UserIdentity is an account at an external login provider linked to a
+// local user. Subject is the provider's id for the account, which unlike
+// the email never changes.
+type UserIdentity struct {
+	ID          int
+	UserID      int
+	Provider    string
+	Subject     string
+	Email       string
+	CreatedAt   time.Time
+	LastLoginAt sql.NullTime
+}
+
+type UserIdentitiesModel struct {
+	DB *sql.DB
+}
+
+// Insert links an external account to the user. ErrDuplicateIdentity is
+// returned when the account is already linked, or the user already has one
+// from this provider.
+func (m *UserIdentitiesModel) Insert(userID int, provider string, subject string, email string) (int, error) {
+	var exists bool
+	err := m.DB.QueryRow(`SELECT EXISTS(SELECT 1 FROM User_Identities
+	WHERE provider = ? AND (subject = ? OR user_id = ?))`, provider, subject, userID).Scan(&exists)
+	if err != nil {
+		return 0, err
+	}
+	if exists {
+		return 0, ErrDuplicateIdentity
+	}
+
+	stmt := `INSERT INTO User_Identities (user_id, provider, subject, email, created_at)
+	VALUES (?, ?, ?, ?, datetime('now'))`
+
+	result, err := m.DB.Exec(stmt, userID, provider, subject, email)
+	if err != nil {
+		return 0, err
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return 0, err
+	}
+
+	return int(id), nil
+}
+
+func (m *UserIdentitiesModel) GetByProviderSubject(provider string, subject string) (*UserIdentity, error) {
+	stmt := `SELECT id, user_id, provider, subject, email, created_at, last_login_at
+	FROM User_Identities WHERE provider = ? AND subject = ?`
+
+	i := &UserIdentity{}
+	err := m.DB.QueryRow(stmt, provider, subject).Scan(&i.ID, &i.UserID, &i.Provider, &i.Subject, &i.Email, &i.CreatedAt, &i.LastLoginAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return i, nil
+}
+
+func (m *UserIdentitiesModel) GetAllByUserId(userID int) ([]*UserIdentity, error) {
+	stmt := `SELECT id, user_id, provider, subject, email, created_at, last_login_at
+	FROM User_Identities WHERE user_id = ? ORDER BY provider`
+
+	rows, err := m.DB.Query(stmt, userID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+
+	var identities []*UserIdentity
+	for rows.Next() {
+		i := &UserIdentity{}
+		err := rows.Scan(&i.ID, &i.UserID, &i.Provider, &i.Subject, &i.Email, &i.CreatedAt, &i.LastLoginAt)
+		if err != nil {
+			return nil, err
+		}
+		identities = append(identities, i)
+	}
+
+	if err = rows.Err(); err != nil {
+		return nil, err
+	}
+
+	return identities, nil
+}
+
+// RecordLogin notes a login through the identity and the email the provider
+// currently reports for it.
+func (m *UserIdentitiesModel) RecordLogin(id int, email string) error {
+	stmt := `UPDATE User_Identities SET last_login_at = datetime('now'), email = ? WHERE id = ?`
+
+	_, err := m.DB.Exec(stmt, email, id)
+	return err
+}
+
+func (m *UserIdentitiesModel) Delete(id int, userID int) error {
+	stmt := `DELETE FROM User_Identities WHERE id = ? AND user_id = ?`
+
+	result, err := m.DB.Exec(stmt, id, userID)
+	if err != nil {
+		return err
+	}
+
+	affected, err := result.RowsAffected()
+	if err != nil {
+		return err
+	}
+	if affected == 0 {
+		return ErrNoRecord
+	}
+
+	return nil
+}
@@ -0,0 +1,86 @@
+package models
+
+import (
+	"database/sql"
+	"errors"
+	"time"
+)
+
+const (
+	TokenVerifyEmail    = "verify_email"
+	TokenResetPassword  = "reset_password"
+	TokenChangeEmail    = "change_email"
+	TokenReauthenticate = "reauthenticate"
+)
+
+type UserTokensModelInterface interface {
+	Insert(token string, userID int, purpose string, email string, lifetime time.Duration) error
+	Get(token string, purpose string) (*UserToken, error)
+	Consume(token string, purpose string) (*UserToken, error)
+}
+
+// UserToken is a link mailed to a user, for verifying Email, resetting the
+// password, moving the account to the new address Email or confirming who
+// the user is before a sensitive change.
+type UserToken struct {
+	UserID    int
+	Purpose   string
+	Email     string
+	ExpiresAt time.Time
+}
+
+type UserTokensModel struct {
+	DB *sql.DB
+}
+
+// Insert stores a new token for the user. Older tokens for the same purpose
+// stop working, only the latest mail is valid.
+func (m *UserTokensModel) Insert(token string, userID int, purpose string, email string, lifetime time.Duration) error {
+	_, err := m.DB.Exec(`DELETE FROM User_Tokens
+	WHERE (user_id = ? AND purpose = ?) OR expires_at <= datetime('now')`, userID, purpose)
+	if err != nil {
+		return err
+	}
+
+	stmt := `INSERT INTO User_Tokens (user_id, purpose, token_hash, email, created_at, expires_at)
+	VALUES (?, ?, ?, ?, datetime('now'), datetime('now', '+' || ? || ' seconds'))`
+
+	_, err = m.DB.Exec(stmt, userID, purpose, hashToken(token), email, int(lifetime.Seconds()))
+	return err
+}
+
+// Get returns a valid token without using it up.
+func (m *UserTokensModel) Get(token string, purpose string) (*UserToken, error) {
+	stmt := `SELECT user_id, purpose, email, expires_at FROM User_Tokens
+	WHERE token_hash = ? AND purpose = ? AND expires_at > datetime('now')`
+
+	t := &UserToken{}
+	err := m.DB.QueryRow(stmt, hashToken(token), purpose).Scan(&t.UserID, &t.Purpose, &t.Email, &t.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return t, nil
+}
+
+// Consume deletes the token and returns it. ErrNoRecord is returned for
+// unknown, expired or already used tokens.
+func (m *UserTokensModel) Consume(token string, purpose string) (*UserToken, error) {
+	stmt := `DELETE FROM User_Tokens
+	WHERE token_hash = ? AND purpose = ? AND expires_at > datetime('now')
+	RETURNING user_id, purpose, email, expires_at`
+
+	t := &UserToken{}
+	err := m.DB.QueryRow(stmt, hashToken(token), purpose).Scan(&t.UserID, &t.Purpose, &t.Email, &t.ExpiresAt)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		}
+		return nil, err
+	}
+
+	return t, nil
+}
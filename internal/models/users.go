@@ -11,7 +11,15 @@ type UserModelInterface interface {
 	GetAll() ([]*User, error)
 	Insert(email string, username string, password string, enabled bool) (int, error)
 	GetByUsernameOrEmail(column string) (*User, error)
+	GetByEmail(email string) (*User, error)
 	UpdateRole(id int, role string) error
+	SetEnabled(id int, enabled bool) error
+	UpdatePassword(id int, password string) error
+	EmailExists(email string) (bool, error)
+	UsernameExists(username string) (bool, error)
+	UpdateUsername(id int, username string) error
+	UpdateEmail(id int, email string) error
+	Delete(id int) error
 }
 
 type User struct {
@@ -45,6 +53,26 @@ func (m *UserModel) GetByUsernameOrEmail(column string) (*User, error) {
 	return u, nil
 }
 
+// GetByEmail returns the user with the email address. Unlike
+// GetByUsernameOrEmail it never matches a username.
+func (m *UserModel) GetByEmail(email string) (*User, error) {
+	stmt := `SELECT id, email, username, password, enabled, role FROM users
+	WHERE email = ?`
+
+	u := &User{}
+
+	err := m.DB.QueryRow(stmt, email).Scan(&u.ID, &u.Email, &u.Username, &u.Password, &u.Enabled, &u.Role)
+	if err != nil {
+		if errors.Is(err, sql.ErrNoRows) {
+			return nil, ErrNoRecord
+		} else {
+			return nil, err
+		}
+	}
+
+	return u, nil
+}
+
 func (m *UserModel) GetById(id int) (*User, error) {
 	stmt := `SELECT id, email, username, password, enabled, role FROM users
 	WHERE id = ?`
@@ -154,8 +182,8 @@ func (m *UserModel) Insert(email string, username string, password string, enabl
 		return 0, ErrDuplicateUsername
 	}
 
-	stmt := `INSERT INTO users (email, username, password, enabled)
-	VALUES(?, ?, ?, ?)`
+	stmt := `INSERT INTO users (email, username, password, enabled, created_at)
+	VALUES(?, ?, ?, ?, datetime('now'))`
 
 	result, err := m.DB.Exec(stmt, email, username, password, enabled)
 	if err != nil {
@@ -180,3 +208,125 @@ func (m *UserModel) UpdateRole(id int, role string) error {
 
 	return nil
 }
+
+// SetEnabled enables an account once its email is verified. Disabled
+// accounts cannot log in.
+func (m *UserModel) SetEnabled(id int, enabled bool) error {
+	stmt := `UPDATE users SET enabled = ? WHERE id = ?`
+
+	_, err := m.DB.Exec(stmt, enabled, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *UserModel) UpdatePassword(id int, password string) error {
+	stmt := `UPDATE users SET password = ? WHERE id = ?`
+
+	_, err := m.DB.Exec(stmt, password, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *UserModel) UpdateUsername(id int, username string) error {
+	usernameExists, err := m.UsernameExists(username)
+	if err != nil {
+		return err
+	}
+	if usernameExists {
+		return ErrDuplicateUsername
+	}
+
+	stmt := `UPDATE users SET username = ? WHERE id = ?`
+
+	_, err = m.DB.Exec(stmt, username, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+func (m *UserModel) UpdateEmail(id int, email string) error {
+	emailExists, err := m.EmailExists(email)
+	if err != nil {
+		return err
+	}
+	if emailExists {
+		return ErrDuplicateEmail
+	}
+
+	stmt := `UPDATE users SET email = ? WHERE id = ?`
+
+	_, err = m.DB.Exec(stmt, email, id)
+	if err != nil {
+		return err
+	}
+
+	return nil
+}
+
+// Delete erases an account. The row stays behind as "deleted-<id>" without
+// email, password or profile, so the user's posts and comments remain
+// readable but anonymous. Their reactions are taken back, notifications they
+// caused or received are dropped, and everything that could log them in is
+// removed.
+func (m *UserModel) Delete(id int) error {
+	tx, err := m.DB.Begin()
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	stmts := []string{
+		`UPDATE Posts SET
+			like_count = like_count - (SELECT COUNT(*) FROM Post_Reactions
+				WHERE post_id = Posts.id AND user_id = ?1 AND type = 'like'),
+			dislike_count = dislike_count - (SELECT COUNT(*) FROM Post_Reactions
+				WHERE post_id = Posts.id AND user_id = ?1 AND type = 'dislike')
+		WHERE id IN (SELECT post_id FROM Post_Reactions WHERE user_id = ?1)`,
+		`DELETE FROM Post_Reactions WHERE user_id = ?1`,
+		`UPDATE Comments SET
+			like_count = like_count - (SELECT COUNT(*) FROM Comment_Reactions
+				WHERE comment_id = Comments.id AND user_id = ?1 AND type = 'like'),
+			dislike_count = dislike_count - (SELECT COUNT(*) FROM Comment_Reactions
+				WHERE comment_id = Comments.id AND user_id = ?1 AND type = 'dislike')
+		WHERE id IN (SELECT comment_id FROM Comment_Reactions WHERE user_id = ?1)`,
+		`DELETE FROM Comment_Reactions WHERE user_id = ?1`,
+		`DELETE FROM Notifications WHERE actor_id = ?1 OR recipient_id = ?1`,
+		`DELETE FROM Sessions WHERE user_id = ?1`,
+		`DELETE FROM Api_Tokens WHERE user_id = ?1`,
+		`DELETE FROM User_Identities WHERE user_id = ?1`,
+		`DELETE FROM OAuth_States WHERE user_id = ?1`,
+		`DELETE FROM User_Tokens WHERE user_id = ?1`,
+		`DELETE FROM User_TOTP WHERE user_id = ?1`,
+		`DELETE FROM User_Recovery_Codes WHERE user_id = ?1`,
+		`DELETE FROM Login_Challenges WHERE user_id = ?1`,
+		`DELETE FROM Login_Attempts WHERE user_id = ?1`,
+		`DELETE FROM Promotion_Requests WHERE user_id = ?1`,
+		`DELETE FROM User_Suspensions WHERE user_id = ?1`,
+		`UPDATE Users SET
+			username = 'deleted-' || id,
+			email = 'deleted-' || id || '@deleted.invalid',
+			password = '',
+			role = 'user',
+			enabled = 0,
+			bio = '',
+			avatar = '',
+			deleted_at = datetime('now')
+		WHERE id = ?1`,
+	}
+	for _, stmt := range stmts {
+		_, err = tx.Exec(stmt, id)
+		if err != nil {
+			return err
+		}
+	}
+
+	return tx.Commit()
+}
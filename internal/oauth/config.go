@@ -0,0 +1,187 @@
+package oauth
+
+import (
+	"fmt"
+	"strings"
+)
+
+// presets are the providers that only need a client id and secret. Any of
+// their settings can still be overridden from the environment.
+var presets = map[string]Config{
+	"google": {
+		DisplayName: "Google",
+		Issuer:      "https://accounts.google.com",
+		AuthURL:     "https://accounts.google.com/o/oauth2/v2/auth",
+		TokenURL:    "https://oauth2.googleapis.com/token",
+		UserInfoURL: "https://openidconnect.googleapis.com/v1/userinfo",
+		Scopes:      []string{"openid", "email", "profile"},
+		PKCE:        true,
+		Claims: Claims{
+			Subject:       "sub",
+			Email:         "email",
+			EmailVerified: "email_verified",
+			Username:      "name",
+			Name:          "name",
+		},
+	},
+	"github": {
+		DisplayName: "GitHub",
+		AuthURL:     "https://github.com/login/oauth/authorize",
+		TokenURL:    "https://github.com/login/oauth/access_token",
+		UserInfoURL: "https://api.github.com/user",
+		EmailsURL:   "https://api.github.com/user/emails",
+		Scopes:      []string{"read:user", "user:email"},
+		Claims: Claims{
+			Subject:  "id",
+			Username: "login",
+			Name:     "name",
+		},
+	},
+	"gitlab": {
+		DisplayName: "GitLab",
+		Issuer:      "https://gitlab.com",
+		AuthURL:     "https://gitlab.com/oauth/authorize",
+		TokenURL:    "https://gitlab.com/oauth/token",
+		UserInfoURL: "https://gitlab.com/oauth/userinfo",
+		Scopes:      []string{"openid", "email", "profile"},
+		PKCE:        true,
+		Claims:      oidcClaims,
+	},
+	"discord": {
+		DisplayName: "Discord",
+		AuthURL:     "https://discord.com/oauth2/authorize",
+		TokenURL:    "https://discord.com/api/oauth2/token",
+		UserInfoURL: "https://discord.com/api/users/@me",
+		Scopes:      []string{"identify", "email"},
+		Claims: Claims{
+			Subject:       "id",
+			Email:         "email",
+			EmailVerified: "verified",
+			Username:      "username",
+			Name:          "global_name",
+		},
+	},
+}
+
+// ConfigsFromEnv reads the providers listed in OAUTH_PROVIDERS (comma
+// separated names). Each one is configured with OAUTH_<NAME>_* variables:
+//
+//	CLIENT_ID, CLIENT_SECRET   required
+//	DISPLAY_NAME               button label
+//	ISSUER                     OpenID Connect issuer, enables discovery
+//	AUTH_URL, TOKEN_URL,       endpoints, needed unless a preset or the
+//	USERINFO_URL, EMAILS_URL   issuer provides them
+//	SCOPES                     space separated
+//	PKCE                       "true" or "false"
+//	SUBJECT_CLAIM, EMAIL_CLAIM, EMAIL_VERIFIED_CLAIM,
+//	USERNAME_CLAIM, NAME_CLAIM userinfo field names
+//
+// Names with a preset (google, github, gitlab, discord) only need the client
+// credentials. The older GOOGLE_CLIENT_ID/SECRET and GITHUB_CLIENT_ID/SECRET
+// variables still enable those two providers.
+func ConfigsFromEnv(getenv func(string) string) ([]Config, error) {
+	var names []string
+	for _, name := range strings.Split(getenv("OAUTH_PROVIDERS"), ",") {
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name != "" && !contains(names, name) {
+			names = append(names, name)
+		}
+	}
+
+	for _, legacy := range []string{"google", "github"} {
+		if getenv(strings.ToUpper(legacy)+"_CLIENT_ID") != "" && !contains(names, legacy) {
+			names = append(names, legacy)
+		}
+	}
+
+	configs := make([]Config, 0, len(names))
+	for _, name := range names {
+		cfg, err := configFromEnv(name, getenv)
+		if err != nil {
+			return nil, err
+		}
+		configs = append(configs, cfg)
+	}
+
+	return configs, nil
+}
+
+func configFromEnv(name string, getenv func(string) string) (Config, error) {
+	for _, r := range name {
+		if !(r >= 'a' && r <= 'z' || r >= '0' && r <= '9' || r == '-' || r == '_') {
+			return Config{}, fmt.Errorf("oauth: invalid provider name %q", name)
+		}
+	}
+
+	cfg, ok := presets[name]
+	if !ok {
+		cfg = Config{Claims: oidcClaims}
+	}
+	cfg.Name = name
+	cfg.Scopes = append([]string(nil), cfg.Scopes...)
+
+	prefix := "OAUTH_" + strings.ToUpper(strings.ReplaceAll(name, "-", "_")) + "_"
+	get := func(key string) string {
+		return strings.TrimSpace(getenv(prefix + key))
+	}
+
+	cfg.ClientID = get("CLIENT_ID")
+	cfg.ClientSecret = get("CLIENT_SECRET")
+	if cfg.ClientID == "" && (name == "google" || name == "github") {
+		cfg.ClientID = strings.TrimSpace(getenv(strings.ToUpper(name) + "_CLIENT_ID"))
+		cfg.ClientSecret = strings.TrimSpace(getenv(strings.ToUpper(name) + "_CLIENT_SECRET"))
+	}
+	if cfg.ClientID == "" {
+		return Config{}, fmt.Errorf("oauth: %sCLIENT_ID is not set", prefix)
+	}
+
+	override := func(dst *string, key string) {
+		if v := get(key); v != "" {
+			*dst = v
+		}
+	}
+
+	override(&cfg.DisplayName, "DISPLAY_NAME")
+	override(&cfg.AuthURL, "AUTH_URL")
+	override(&cfg.TokenURL, "TOKEN_URL")
+	override(&cfg.UserInfoURL, "USERINFO_URL")
+	override(&cfg.EmailsURL, "EMAILS_URL")
+	override(&cfg.Claims.Subject, "SUBJECT_CLAIM")
+	override(&cfg.Claims.Email, "EMAIL_CLAIM")
+	override(&cfg.Claims.EmailVerified, "EMAIL_VERIFIED_CLAIM")
+	override(&cfg.Claims.Username, "USERNAME_CLAIM")
+	override(&cfg.Claims.Name, "NAME_CLAIM")
+
+	if issuer := get("ISSUER"); issuer != "" {
+		cfg.Issuer = issuer
+		if !ok {
+			// A custom issuer's endpoints come from its discovery document
+			// unless they were given explicitly above
+			cfg.PKCE = true
+		}
+	}
+
+	if scopes := get("SCOPES"); scopes != "" {
+		cfg.Scopes = strings.Fields(scopes)
+	} else if !ok && cfg.Issuer != "" {
+		cfg.Scopes = []string{"openid", "email", "profile"}
+	}
+
+	switch strings.ToLower(get("PKCE")) {
+	case "true", "1", "yes":
+		cfg.PKCE = true
+	case "false", "0", "no":
+		cfg.PKCE = false
+	}
+
+	return cfg, nil
+}
+
+func contains(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,329 @@
+// Package oauth signs users in with external OAuth2 and OpenID Connect
+// providers. Every provider is described by a Config, so new ones can be added
+// through the environment without code changes.
+package oauth
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Provider is an identity provider users can log in with.
+type Provider interface {
+	// Name identifies the provider in URLs and the database, e.g. "github".
+	Name() string
+	// DisplayName is shown on the login button.
+	DisplayName() string
+	// UsesPKCE reports whether AuthCodeURL expects a PKCE code challenge.
+	UsesPKCE() bool
+	// AuthCodeURL is where the browser is sent to log in.
+	AuthCodeURL(state, codeChallenge, redirectURI string) string
+	// Exchange trades the authorization code for an access token.
+	Exchange(ctx context.Context, code, codeVerifier, redirectURI string) (*Token, error)
+	// UserInfo fetches the profile of the user the token belongs to.
+	UserInfo(ctx context.Context, token *Token) (*UserInfo, error)
+}
+
+type Token struct {
+	AccessToken string `json:"access_token"`
+	TokenType   string `json:"token_type"`
+	ExpiresIn   int    `json:"expires_in"`
+	IDToken     string `json:"id_token"`
+}
+
+// UserInfo is the profile of a provider's user, mapped to the same fields for
+// every provider.
+type UserInfo struct {
+	Subject       string
+	Email         string
+	EmailVerified bool
+	Username      string
+	Name          string
+}
+
+// Claims names the userinfo response fields the UserInfo fields are read
+// from. Providers that are not OpenID Connect use their own names.
+type Claims struct {
+	Subject       string
+	Email         string
+	EmailVerified string
+	Username      string
+	Name          string
+}
+
+var oidcClaims = Claims{
+	Subject:       "sub",
+	Email:         "email",
+	EmailVerified: "email_verified",
+	Username:      "preferred_username",
+	Name:          "name",
+}
+
+type Config struct {
+	Name         string
+	DisplayName  string
+	ClientID     string
+	ClientSecret string
+	Scopes       []string
+	PKCE         bool
+
+	// Issuer, when set, is an OpenID Connect issuer whose discovery document
+	// fills in the URLs below that are left empty.
+	Issuer      string
+	AuthURL     string
+	TokenURL    string
+	UserInfoURL string
+	// EmailsURL is a GitHub style list of the user's addresses, used to find
+	// the primary verified one.
+	EmailsURL string
+
+	Claims Claims
+}
+
+// GenericProvider implements Provider for standard OAuth2 authorization code
+// logins, OpenID Connect or not.
+type GenericProvider struct {
+	Config Config
+	Client *http.Client
+}
+
+// NewProvider returns a Provider for cfg, discovering the endpoints of an
+// OpenID Connect issuer first when needed.
+func NewProvider(ctx context.Context, cfg Config, client *http.Client) (*GenericProvider, error) {
+	if client == nil {
+		client = &http.Client{Timeout: 10 * time.Second}
+	}
+
+	if cfg.ClientID == "" {
+		return nil, fmt.Errorf("oauth %s: missing client id", cfg.Name)
+	}
+
+	if cfg.Issuer != "" && (cfg.AuthURL == "" || cfg.TokenURL == "" || cfg.UserInfoURL == "") {
+		doc, err := discover(ctx, client, cfg.Issuer)
+		if err != nil {
+			return nil, fmt.Errorf("oauth %s: %w", cfg.Name, err)
+		}
+		if cfg.AuthURL == "" {
+			cfg.AuthURL = doc.AuthorizationEndpoint
+		}
+		if cfg.TokenURL == "" {
+			cfg.TokenURL = doc.TokenEndpoint
+		}
+		if cfg.UserInfoURL == "" {
+			cfg.UserInfoURL = doc.UserinfoEndpoint
+		}
+	}
+
+	if cfg.AuthURL == "" || cfg.TokenURL == "" || cfg.UserInfoURL == "" {
+		return nil, fmt.Errorf("oauth %s: authorization, token and userinfo URLs are required", cfg.Name)
+	}
+
+	if cfg.DisplayName == "" {
+		cfg.DisplayName = cfg.Name
+	}
+
+	return &GenericProvider{Config: cfg, Client: client}, nil
+}
+
+func (p *GenericProvider) Name() string        { return p.Config.Name }
+func (p *GenericProvider) DisplayName() string { return p.Config.DisplayName }
+func (p *GenericProvider) UsesPKCE() bool      { return p.Config.PKCE }
+
+func (p *GenericProvider) AuthCodeURL(state, codeChallenge, redirectURI string) string {
+	params := url.Values{}
+	params.Set("client_id", p.Config.ClientID)
+	params.Set("redirect_uri", redirectURI)
+	params.Set("response_type", "code")
+	params.Set("state", state)
+	if len(p.Config.Scopes) > 0 {
+		params.Set("scope", strings.Join(p.Config.Scopes, " "))
+	}
+	if p.Config.PKCE {
+		params.Set("code_challenge", codeChallenge)
+		params.Set("code_challenge_method", "S256")
+	}
+
+	sep := "?"
+	if strings.Contains(p.Config.AuthURL, "?") {
+		sep = "&"
+	}
+	return p.Config.AuthURL + sep + params.Encode()
+}
+
+func (p *GenericProvider) Exchange(ctx context.Context, code, codeVerifier, redirectURI string) (*Token, error) {
+	params := url.Values{}
+	params.Set("grant_type", "authorization_code")
+	params.Set("code", code)
+	params.Set("redirect_uri", redirectURI)
+	params.Set("client_id", p.Config.ClientID)
+	params.Set("client_secret", p.Config.ClientSecret)
+	if p.Config.PKCE {
+		params.Set("code_verifier", codeVerifier)
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.Config.TokenURL, strings.NewReader(params.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token Token
+	err = p.do(req, &token)
+	if err != nil {
+		return nil, fmt.Errorf("oauth %s: token exchange: %w", p.Config.Name, err)
+	}
+
+	if token.AccessToken == "" {
+		return nil, fmt.Errorf("oauth %s: token exchange: no access token in response", p.Config.Name)
+	}
+
+	return &token, nil
+}
+
+func (p *GenericProvider) UserInfo(ctx context.Context, token *Token) (*UserInfo, error) {
+	var claims map[string]interface{}
+	err := p.get(ctx, p.Config.UserInfoURL, token, &claims)
+	if err != nil {
+		return nil, fmt.Errorf("oauth %s: userinfo: %w", p.Config.Name, err)
+	}
+
+	c := p.Config.Claims
+	info := &UserInfo{
+		Subject:       claimString(claims, c.Subject),
+		Email:         claimString(claims, c.Email),
+		EmailVerified: claimBool(claims, c.EmailVerified),
+		Username:      claimString(claims, c.Username),
+		Name:          claimString(claims, c.Name),
+	}
+
+	if p.Config.EmailsURL != "" {
+		var emails []struct {
+			Email    string `json:"email"`
+			Primary  bool   `json:"primary"`
+			Verified bool   `json:"verified"`
+		}
+		err := p.get(ctx, p.Config.EmailsURL, token, &emails)
+		if err != nil {
+			return nil, fmt.Errorf("oauth %s: emails: %w", p.Config.Name, err)
+		}
+
+		for _, e := range emails {
+			if e.Primary && e.Verified {
+				info.Email = e.Email
+				info.EmailVerified = true
+				break
+			}
+		}
+	}
+
+	if info.Subject == "" {
+		return nil, fmt.Errorf("oauth %s: userinfo: no %q claim in response", p.Config.Name, c.Subject)
+	}
+
+	return info, nil
+}
+
+func (p *GenericProvider) get(ctx context.Context, url string, token *Token, dst interface{}) error {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+token.AccessToken)
+	req.Header.Set("Accept", "application/json")
+
+	return p.do(req, dst)
+}
+
+func (p *GenericProvider) do(req *http.Request, dst interface{}) error {
+	resp, err := p.Client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, 1<<20))
+	if err != nil {
+		return err
+	}
+
+	if resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("unexpected status %d: %s", resp.StatusCode, strings.TrimSpace(string(body)))
+	}
+
+	return json.Unmarshal(body, dst)
+}
+
+func claimString(claims map[string]interface{}, name string) string {
+	if name == "" {
+		return ""
+	}
+
+	switch v := claims[name].(type) {
+	case string:
+		return v
+	case float64:
+		// Numeric ids such as GitHub's, formatted without an exponent
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case nil:
+		return ""
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func claimBool(claims map[string]interface{}, name string) bool {
+	if name == "" {
+		return false
+	}
+
+	switch v := claims[name].(type) {
+	case bool:
+		return v
+	case string:
+		return v == "true"
+	}
+	return false
+}
+
+type discoveryDocument struct {
+	Issuer                string `json:"issuer"`
+	AuthorizationEndpoint string `json:"authorization_endpoint"`
+	TokenEndpoint         string `json:"token_endpoint"`
+	UserinfoEndpoint      string `json:"userinfo_endpoint"`
+}
+
+var errIssuerMismatch = errors.New("discovery document is for another issuer")
+
+// discover reads the OpenID Connect discovery document of issuer.
+func discover(ctx context.Context, client *http.Client, issuer string) (*discoveryDocument, error) {
+	issuer = strings.TrimSuffix(issuer, "/")
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, issuer+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	p := &GenericProvider{Client: client}
+
+	var doc discoveryDocument
+	err = p.do(req, &doc)
+	if err != nil {
+		return nil, fmt.Errorf("discovery: %w", err)
+	}
+
+	if strings.TrimSuffix(doc.Issuer, "/") != issuer {
+		return nil, errIssuerMismatch
+	}
+
+	return &doc, nil
+}
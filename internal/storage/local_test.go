@@ -0,0 +1,97 @@
+package storage
+
+import (
+	"os"
+	"path/filepath"
+	"sort"
+	"testing"
+)
+
+func TestLocalStore(t *testing.T) {
+	dir := t.TempDir()
+	s := NewLocalStore(dir)
+
+	if err := s.Put("a.png", []byte("png")); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Put("thumbs/a.jpg", []byte("jpeg")); err != nil {
+		t.Fatal(err)
+	}
+	// Replacing keeps one object
+	if err := s.Put("a.png", []byte("png2")); err != nil {
+		t.Fatal(err)
+	}
+
+	data, err := s.Get("a.png")
+	if err != nil || string(data) != "png2" {
+		t.Fatalf("Get = %q, %v", data, err)
+	}
+	if _, err := s.Get("missing.png"); err != ErrNotExist {
+		t.Errorf("Get of a missing object = %v, want ErrNotExist", err)
+	}
+
+	// Files still being written and dotfiles are not objects
+	for _, name := range []string{tempPrefix + "123", ".gitkeep"} {
+		if err := os.WriteFile(filepath.Join(dir, name), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	list, err := s.List()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var names []string
+	for _, o := range list {
+		names = append(names, o.Name)
+		if o.ModTime.IsZero() {
+			t.Errorf("%s has no modification time", o.Name)
+		}
+	}
+	sort.Strings(names)
+	if len(names) != 2 || names[0] != "a.png" || names[1] != "thumbs/a.jpg" {
+		t.Errorf("List names = %q", names)
+	}
+
+	if err := s.Delete("a.png"); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Delete("a.png"); err != nil {
+		t.Errorf("deleting a missing object: %v", err)
+	}
+	if _, err := s.Get("a.png"); err != ErrNotExist {
+		t.Errorf("Get after Delete = %v, want ErrNotExist", err)
+	}
+}
+
+func TestLocalStoreInvalidNames(t *testing.T) {
+	dir := t.TempDir()
+	s := NewLocalStore(filepath.Join(dir, "store"))
+	if err := os.WriteFile(filepath.Join(dir, "secret"), []byte("secret"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, name := range []string{"", "../secret", "a/../../secret", "/secret", "a//b", "./a", `a\b`, "a\x00b"} {
+		if err := s.Put(name, []byte("x")); err == nil {
+			t.Errorf("Put accepted %q", name)
+		}
+		if _, err := s.Get(name); err != ErrNotExist {
+			t.Errorf("Get(%q) = %v, want ErrNotExist", name, err)
+		}
+		if err := s.Delete(name); err == nil {
+			t.Errorf("Delete accepted %q", name)
+		}
+	}
+
+	if data, _ := os.ReadFile(filepath.Join(dir, "secret")); string(data) != "secret" {
+		t.Error("a file outside the store was changed")
+	}
+}
+
+func TestLocalStoreListMissingDir(t *testing.T) {
+	s := NewLocalStore(filepath.Join(t.TempDir(), "not-created"))
+	list, err := s.List()
+	if err != nil || len(list) != 0 {
+		t.Errorf("List = %v, %v, want nothing", list, err)
+	}
+}
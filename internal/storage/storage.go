@@ -0,0 +1,57 @@
+// Package storage keeps the media attached to posts, either in a directory
+// on the local disk or in an S3 compatible bucket.
+package storage
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"strings"
+	"time"
+)
+
+var ErrNotExist = errors.New("storage: object does not exist")
+
+// Object is a stored file as returned by List.
+type Object struct {
+	Name    string
+	ModTime time.Time
+}
+
+// Store keeps files under slash separated names such as "thumbs/a.jpg".
+// Implementations must be safe for concurrent use.
+type Store interface {
+	// Put stores data as name, replacing what was there. A replaced object
+	// counts as modified now.
+	Put(name string, data []byte) error
+
+	// Get returns the content of name, or ErrNotExist.
+	Get(name string) ([]byte, error)
+
+	// Delete removes name. Deleting a missing object is not an error.
+	Delete(name string) error
+
+	// List returns every stored object.
+	List() ([]Object, error)
+}
+
+// ContentName is the name data is stored under: the SHA-256 of the content
+// followed by ext. The same file uploaded twice is only kept once.
+func ContentName(data []byte, ext string) string {
+	sum := sha256.Sum256(data)
+	return hex.EncodeToString(sum[:]) + ext
+}
+
+// ValidName reports whether name is a relative slash separated path without
+// empty, "." or ".." parts, so that it cannot leave the store.
+func ValidName(name string) bool {
+	if name == "" || strings.ContainsAny(name, "\\\x00") {
+		return false
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
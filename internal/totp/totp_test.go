@@ -0,0 +1,145 @@
+package totp
+
+import (
+	"strings"
+	"testing"
+	"time"
+)
+
+// rfcSecret is the SHA-1 key of the RFC 6238 test vectors, the ASCII string
+// "12345678901234567890", in base32.
+const rfcSecret = "GEZDGNBVGY3TQOJQGEZDGNBVGY3TQOJQ"
+
+func TestCodeRFC6238(t *testing.T) {
+	// Appendix B lists 8 digit codes, the last 6 of them are the 6 digit ones
+	tests := []struct {
+		unix int64
+		want string
+	}{
+		{59, "94287082"},
+		{1111111109, "07081804"},
+		{1111111111, "14050471"},
+		{1234567890, "89005924"},
+		{2000000000, "69279037"},
+		{20000000000, "65353130"},
+	}
+
+	for _, tt := range tests {
+		got, err := Code(rfcSecret, Step(time.Unix(tt.unix, 0)))
+		if err != nil {
+			t.Fatalf("Code at %d: %v", tt.unix, err)
+		}
+		if want := tt.want[len(tt.want)-Digits:]; got != want {
+			t.Errorf("Code at %d = %q, want %q", tt.unix, got, want)
+		}
+	}
+}
+
+func TestCodeSecret(t *testing.T) {
+	lower, err := Code(strings.ToLower(rfcSecret), 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	upper, err := Code(rfcSecret, 1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if lower != upper {
+		t.Errorf("lower case secret gives %q, upper case %q", lower, upper)
+	}
+
+	_, err = Code("not base32!", 1)
+	if err == nil {
+		t.Error("invalid secret was accepted")
+	}
+}
+
+func TestValidateSkew(t *testing.T) {
+	now := time.Unix(1111111111, 0)
+	step := Step(now)
+
+	tests := []struct {
+		name   string
+		offset int64
+		ok     bool
+	}{
+		{"current step", 0, true},
+		{"one step behind", -1, true},
+		{"one step ahead", 1, true},
+		{"two steps behind", -2, false},
+		{"two steps ahead", 2, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, err := Code(rfcSecret, step+tt.offset)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			matched, ok := Validate(rfcSecret, code, now)
+			if ok != tt.ok {
+				t.Fatalf("Validate ok = %v, want %v", ok, tt.ok)
+			}
+			if ok && matched != step+tt.offset {
+				t.Errorf("Validate matched step %d, want %d", matched, step+tt.offset)
+			}
+		})
+	}
+}
+
+func TestValidateInput(t *testing.T) {
+	now := time.Unix(59, 0)
+
+	if _, ok := Validate(rfcSecret, "287 082", now); !ok {
+		t.Error("code with a space was rejected")
+	}
+	for _, code := range []string{"", "28708", "2870820", "94287082", "287083"} {
+		if _, ok := Validate(rfcSecret, code, now); ok {
+			t.Errorf("Validate accepted %q", code)
+		}
+	}
+	if _, ok := Validate("not base32!", "287082", now); ok {
+		t.Error("Validate accepted a code for an invalid secret")
+	}
+}
+
+// TestValidateReplay checks that a code reports the same step for as long as
+// it is accepted, which is what callers compare against the last step used.
+func TestValidateReplay(t *testing.T) {
+	issued := time.Unix(1234567890, 0)
+	code, err := Code(rfcSecret, Step(issued))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	first, ok := Validate(rfcSecret, code, issued)
+	if !ok {
+		t.Fatal("fresh code was rejected")
+	}
+	again, ok := Validate(rfcSecret, code, issued.Add(Period))
+	if !ok {
+		t.Fatal("code was rejected one step later")
+	}
+	if again != first {
+		t.Errorf("code matched step %d and then %d, a replay would not be noticed", first, again)
+	}
+
+	// The next code is for a later step
+	next, err := Code(rfcSecret, Step(issued)+1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	step, ok := Validate(rfcSecret, next, issued.Add(Period))
+	if !ok || step <= first {
+		t.Errorf("next code matched step %d (ok %v), want one after %d", step, ok, first)
+	}
+}
+
+func TestURI(t *testing.T) {
+	got := URI("Game Forum", "player@example.com", rfcSecret)
+	want := "otpauth://totp/Game%20Forum:player@example.com?algorithm=SHA1&digits=6&issuer=Game%20Forum&period=30&secret=" + rfcSecret
+	if got != want {
+		t.Errorf("URI = %q, want %q", got, want)
+	}
+}
@@ -23,4 +23,32 @@ for (var i = 0; i < navLinks.length; i++) {
     if (e.target === modal) {
       modal.style.display = "none";
     }
-  });
\ No newline at end of file
+  });
+
+  // Post preview: the server renders the Markdown so the preview matches
+  // what the post will look like.
+  const previewBtn = document.getElementById("previewContent");
+  const preview = document.getElementById("contentPreview");
+
+  previewBtn?.addEventListener("click", function() {
+    const form = previewBtn.closest("form");
+    const body = new URLSearchParams();
+    body.set("csrf_token", form.querySelector("input[name=csrf_token]").value);
+    body.set("content", form.querySelector("textarea[name=content]").value);
+
+    fetch("/post/preview", {method: "POST", body: body, credentials: "same-origin"})
+      .then(function(resp) {
+        if (!resp.ok) {
+          throw new Error(resp.statusText);
+        }
+        return resp.text();
+      })
+      .then(function(html) {
+        preview.innerHTML = html;
+        preview.hidden = false;
+      })
+      .catch(function() {
+        preview.textContent = "Preview is not available right now.";
+        preview.hidden = false;
+      });
+  });